@@ -0,0 +1,63 @@
+package measure
+
+import (
+	"sync/atomic"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithAckOrdering numbers Put calls as they reach the backend and counts
+// in put.ack_reorder_total the calls acknowledged after a later one was:
+// those whose write succeeded when a Put started after them had already
+// succeeded. This is a diagnostic for pipelines assuming writes are
+// acknowledged in order, which asynchronous backends, write-behind and
+// concurrent callers don't guarantee. It keeps two counters, whatever
+// the number of Puts in flight.
+func WithAckOrdering() Option {
+	return func(cfg *config) {
+		cfg.ackOrdering = true
+	}
+}
+
+type ackOrder struct {
+	// next is the sequence number of the next Put, maxAcked the highest
+	// acknowledged so far. Both are accessed atomically.
+	next     uint64
+	maxAcked uint64
+
+	reordered metrics.Counter
+}
+
+func newAckOrder(r *registry) *ackOrder {
+	return &ackOrder{
+		reordered: r.counter("put.ack_reorder_total",
+			"Number of Put calls acknowledged after a Put started later than them"),
+	}
+}
+
+// startAck returns the sequence number of a Put reaching the backend, or
+// 0 if acknowledgments aren't tracked.
+func (m *measure) startAck() uint64 {
+	if m.ackOrder == nil {
+		return 0
+	}
+	return atomic.AddUint64(&m.ackOrder.next, 1)
+}
+
+// ack records the acknowledgment of the Put numbered seq.
+func (m *measure) ack(seq uint64) {
+	a := m.ackOrder
+	if a == nil {
+		return
+	}
+	for {
+		max := atomic.LoadUint64(&a.maxAcked)
+		if seq < max {
+			a.reordered.Inc()
+			return
+		}
+		if atomic.CompareAndSwapUint64(&a.maxAcked, max, seq) {
+			return
+		}
+	}
+}
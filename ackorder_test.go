@@ -0,0 +1,55 @@
+package measure
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+// gatedPutBS holds Puts of the block in hold until release is closed.
+type gatedPutBS struct {
+	*testutil.Blockstore
+	hold    blocks.Block
+	release chan struct{}
+	started chan struct{}
+}
+
+func (b gatedPutBS) Put(ctx context.Context, blk blocks.Block) error {
+	if blk.Cid() == b.hold.Cid() {
+		close(b.started)
+		<-b.release
+	}
+	return b.Blockstore.Put(ctx, blk)
+}
+
+func TestAckReorder(t *testing.T) {
+	ctx := context.Background()
+	blks := mkBlocks(3)
+	bs := gatedPutBS{testutil.New(), blks[0], make(chan struct{}), make(chan struct{})}
+	m := New("ao", bs, WithAckOrdering())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.Put(ctx, blks[0])
+	}()
+	<-bs.started
+	m.Put(ctx, blks[1])
+	m.Put(ctx, blks[2])
+	close(bs.release)
+	wg.Wait()
+	if v := m.Stats().Counters["put.ack_reorder_total"]; v != 1 {
+		t.Fatal(v)
+	}
+	n := New("ao2", testutil.New(), WithAckOrdering())
+	for _, b := range mkBlocks(5) {
+		n.Put(ctx, b)
+	}
+	if v := n.Stats().Counters["put.ack_reorder_total"]; v != 0 {
+		t.Fatal(v)
+	}
+}
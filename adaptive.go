@@ -0,0 +1,127 @@
+package measure
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+const (
+	// adaptiveWarmup is the number of observations a latency histogram
+	// collects before its buckets are chosen.
+	adaptiveWarmup = 1000
+	// adaptiveBuckets is the number of buckets chosen.
+	adaptiveBuckets = 20
+)
+
+// WithAdaptiveBuckets fits the buckets of latency histograms to the
+// latencies actually seen. Each histogram keeps its first 1000
+// observations aside, then picks 20 log-spaced buckets between their 1st
+// and 99th percentiles, registers itself with them and replays the kept
+// observations into it.
+//
+// Until its warmup is over a histogram is neither reported nor part of
+// Stats. Bucket bounds differ between processes and restarts, so
+// Prometheus can't aggregate these histograms across instances, e.g.
+// with histogram_quantile over a sum, and dashboards should not assume
+// fixed bounds.
+func WithAdaptiveBuckets() Option {
+	return func(cfg *config) {
+		cfg.adaptiveBuckets = true
+	}
+}
+
+type adaptiveHistogram struct {
+	reg        *registry
+	name, help string
+
+	// ready holds the registered histogram once warmup is over.
+	ready atomic.Value
+
+	mu      sync.Mutex
+	samples []float64
+}
+
+// adaptive returns the adaptive histogram with the given name, creating
+// it if needed.
+func (r *registry) adaptive(name, help string) metrics.Histogram {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok := r.adaptives[name]; ok {
+		return h
+	}
+	h := &adaptiveHistogram{
+		reg:     r,
+		name:    name,
+		help:    help,
+		samples: make([]float64, 0, adaptiveWarmup),
+	}
+	r.adaptives[name] = h
+	return h
+}
+
+func (h *adaptiveHistogram) Observe(v float64) {
+	if ready, ok := h.ready.Load().(metrics.Histogram); ok {
+		ready.Observe(v)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ready, ok := h.ready.Load().(metrics.Histogram); ok {
+		ready.Observe(v)
+		return
+	}
+	h.samples = append(h.samples, v)
+	if len(h.samples) < adaptiveWarmup {
+		return
+	}
+	ready := h.reg.histogram(h.name, h.help, fitBuckets(h.samples, adaptiveBuckets))
+	for _, s := range h.samples {
+		ready.Observe(s)
+	}
+	h.samples = nil
+	h.ready.Store(ready)
+}
+
+// fitBuckets returns n log-spaced bucket bounds between the 1st and 99th
+// percentiles of samples, rounded to three significant digits.
+func fitBuckets(samples []float64, n int) []float64 {
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	lo := sorted[len(sorted)/100]
+	hi := sorted[len(sorted)*99/100]
+	if lo <= 0 {
+		// Log spacing needs a positive start; use the smallest positive
+		// sample, or a nanosecond.
+		lo = 1e-9
+		for _, s := range sorted {
+			if s > 0 {
+				lo = s
+				break
+			}
+		}
+	}
+	if hi <= lo {
+		lo, hi = lo/2, lo*2
+	}
+	bounds := make([]float64, 0, n)
+	ratio := math.Pow(hi/lo, 1/float64(n-1))
+	for i := 0; i < n; i++ {
+		b := roundSignificant(lo*math.Pow(ratio, float64(i)), 3)
+		if len(bounds) == 0 || b > bounds[len(bounds)-1] {
+			bounds = append(bounds, b)
+		}
+	}
+	return bounds
+}
+
+func roundSignificant(v float64, digits int) float64 {
+	if v == 0 {
+		return 0
+	}
+	scale := math.Pow(10, float64(digits)-math.Ceil(math.Log10(math.Abs(v))))
+	return math.Round(v*scale) / scale
+}
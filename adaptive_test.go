@@ -0,0 +1,22 @@
+package measure
+
+import (
+	"testing"
+)
+
+func TestAdaptive(t *testing.T) {
+	r := newRegistry("ad", nil)
+	r.adaptiveBuckets = true
+	h := r.latency("x.latency", "")
+	for i := 0; i < adaptiveWarmup-1; i++ {
+		h.Observe(0.001 + float64(i%100)*0.0001) // 1ms..10.9ms
+	}
+	if _, ok := r.snapshot().Histograms["x.latency_seconds"]; ok {
+		t.Fatal("registered early")
+	}
+	h.Observe(0.005)
+	s := r.snapshot().Histograms["x.latency_seconds"]
+	if s.Count != adaptiveWarmup || s.Bounds[0] > 0.0011 || s.Bounds[len(s.Bounds)-1] < 0.0105 || s.Bounds[len(s.Bounds)-1] > 0.012 {
+		t.Fatal(s.Bounds, s.Count)
+	}
+}
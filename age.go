@@ -0,0 +1,91 @@
+package measure
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// sort block ages in buckets with following upper bounds in seconds,
+// from a minute to a year
+var blockAgeBuckets = []float64{60, 600, 3600, 6 * 3600, 24 * 3600, 7 * 24 * 3600, 30 * 24 * 3600, 90 * 24 * 3600, 365 * 24 * 3600}
+
+// CreationTimer is implemented by backends that record when blocks were
+// stored.
+type CreationTimer interface {
+	CreatedAt(ctx context.Context, c cid.Cid) (time.Time, error)
+}
+
+// WithBlockAge observes how old blocks are when they are read, in
+// get.block_age_seconds, if the backend implements CreationTimer. Every
+// successful Get then also asks the backend for the creation time;
+// blocks it has no time for are not observed.
+func WithBlockAge() Option {
+	return func(cfg *config) {
+		cfg.blockAge = true
+	}
+}
+
+// WithDeletedBlockAge observes how old blocks are when they are deleted,
+// in delete.block_age_seconds, if the backend implements CreationTimer.
+// Deletes then first ask the backend for the creation times of the
+// blocks; those it has no time for are not observed.
+func WithDeletedBlockAge() Option {
+	return func(cfg *config) {
+		cfg.deleteAge = true
+	}
+}
+
+func newBlockAgeHistogram(r *registry) metrics.Histogram {
+	return r.histogram("get.block_age_seconds",
+		"Age distribution of blocks returned by Blockstore.Get", blockAgeBuckets)
+}
+
+func newDeleteAgeHistogram(r *registry) metrics.Histogram {
+	return r.histogram("delete.block_age_seconds",
+		"Age distribution of blocks removed by Blockstore.DeleteBlock and DeleteMany", blockAgeBuckets)
+}
+
+// createdAt returns when c was stored, or the zero time if the backend
+// doesn't know.
+func (m *measure) createdAt(ctx context.Context, c cid.Cid) time.Time {
+	ct, ok := m.backend.(CreationTimer)
+	if !ok {
+		return time.Time{}
+	}
+	created, err := ct.CreatedAt(ctx, c)
+	if err != nil {
+		return time.Time{}
+	}
+	return created
+}
+
+// observeAge records the age of c, just read, if the backend knows it.
+func (m *measure) observeAge(ctx context.Context, c cid.Cid) {
+	if m.blockAge == nil {
+		return
+	}
+	if created := m.createdAt(ctx, c); !created.IsZero() {
+		m.blockAge.Observe(m.clock.Now().Sub(created).Seconds())
+	}
+}
+
+// deletedCreatedAt returns the creation time of c, about to be deleted,
+// to pass to observeDeleteAge once it is.
+func (m *measure) deletedCreatedAt(ctx context.Context, c cid.Cid) time.Time {
+	if m.deleteAge == nil {
+		return time.Time{}
+	}
+	return m.createdAt(ctx, c)
+}
+
+// observeDeleteAge records the age of a block created at created and
+// just deleted, unless its creation time is unknown.
+func (m *measure) observeDeleteAge(created time.Time) {
+	if m.deleteAge == nil || created.IsZero() {
+		return
+	}
+	m.deleteAge.Observe(m.clock.Now().Sub(created).Seconds())
+}
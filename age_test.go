@@ -0,0 +1,53 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type agedBS struct {
+	*testutil.Blockstore
+	at time.Time
+}
+
+func (a agedBS) CreatedAt(ctx context.Context, c cid.Cid) (time.Time, error) { return a.at, nil }
+
+type fixedClock time.Time
+
+func (f fixedClock) Now() time.Time { return time.Time(f) }
+
+func TestBlockAge(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	bs := agedBS{testutil.New(), now.Add(-time.Hour)}
+	m := New("age", bs, WithBlockAge(), WithClock(fixedClock(now)))
+	b := blocks.NewBlock([]byte("x"))
+	bs.Put(ctx, b)
+	m.Get(ctx, b.Cid())
+	h := m.Stats().Histograms["get.block_age_seconds"]
+	if h.Count != 1 || h.Sum != 3600 {
+		t.Fatal(h)
+	}
+}
+
+func TestDeletedBlockAge(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	bs := agedBS{testutil.New(), now.Add(-2 * time.Hour)}
+	m := New("dage", bs, WithDeletedBlockAge(), WithClock(fixedClock(now)))
+	b := blocks.NewBlock([]byte("x"))
+	bs.Put(ctx, b)
+	if err := m.DeleteBlock(ctx, b.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	h := m.Stats().Histograms["delete.block_age_seconds"]
+	if h.Count != 1 || h.Sum != 7200 {
+		t.Fatal(h)
+	}
+}
@@ -0,0 +1,195 @@
+package measure
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// shardedKeyLister is implemented by backends that can enumerate a
+// subset of their keys, so that a full listing can run in parallel.
+// Shards must be disjoint and together cover all keys.
+type shardedKeyLister interface {
+	AllKeysShard(ctx context.Context, shard, shards int) (<-chan cid.Cid, error)
+}
+
+// AllKeysParallel is like AllKeysChan but enumerates shards of the
+// keyspace concurrently and merges them into the returned channel, which
+// is closed once every shard is done or ctx is cancelled. Backends that
+// can't enumerate shards fall back to a single AllKeysChan stream.
+func (m *measure) AllKeysParallel(ctx context.Context, shards int) (<-chan cid.Cid, error) {
+	sl, ok := m.backend.(shardedKeyLister)
+	if !ok || shards < 2 {
+		return m.AllKeysChan(ctx)
+	}
+
+	start := m.clock.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	ins := make([]<-chan cid.Cid, shards)
+	for i := range ins {
+		ch, err := sl.AllKeysShard(ctx, i, shards)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		ins[i] = ch
+	}
+
+	m.allKeysActive.Inc()
+	m.keyScan.begin()
+	seen := m.newKeySet()
+	out := make(chan cid.Cid)
+	var wg sync.WaitGroup
+	for i, in := range ins {
+		keys := m.reg.counter(fmt.Sprintf("allkeys.parallel.shard%d.keys_total", i),
+			"Number of keys enumerated from one shard by AllKeysParallel")
+		wg.Add(1)
+		go func(in <-chan cid.Cid, keys metrics.Counter) {
+			defer wg.Done()
+			for c := range in {
+				if m.duplicate(seen, c) {
+					continue
+				}
+				if m.keyScan.wait(ctx) != nil {
+					return
+				}
+				select {
+				case out <- c:
+					keys.Inc()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(in, keys)
+	}
+	go func() {
+		wg.Wait()
+		if ctx.Err() != nil {
+			m.allKeysAbandoned.Inc()
+		}
+		cancel()
+		recordLatency(m.clock, m.allKeysParallelLatency, start)
+		m.keyScan.end()
+		m.allKeysActive.Dec()
+		close(out)
+	}()
+	return out, nil
+}
+
+// proxyKeys passes keys through, counting the enumeration in
+// allkeys.active until keys is closed or ctx is done, in which case it
+// is also counted in allkeys.abandoned_total. The delivery of the first
+// key is timed from start.
+func (m *measure) proxyKeys(ctx context.Context, keys <-chan cid.Cid, start time.Time) <-chan cid.Cid {
+	m.allKeysActive.Inc()
+	m.keyScan.begin()
+	seen := m.newKeySet()
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		defer m.allKeysActive.Dec()
+		defer m.keyScan.end()
+		first := true
+		var last time.Time
+		for {
+			select {
+			case c, ok := <-keys:
+				if !ok {
+					if ctx.Err() != nil {
+						// The backend noticed first.
+						m.allKeysAbandoned.Inc()
+					}
+					return
+				}
+				m.checkKey(c)
+				if m.duplicate(seen, c) {
+					continue
+				}
+				if m.keyScan.wait(ctx) != nil {
+					m.allKeysAbandoned.Inc()
+					return
+				}
+				select {
+				case out <- c:
+					if first {
+						recordLatency(m.clock, m.allKeysFirstKeyLatency, start)
+						first = false
+					}
+					last = m.observeKeyGap(last)
+				case <-ctx.Done():
+					m.allKeysAbandoned.Inc()
+					return
+				}
+			case <-ctx.Done():
+				m.allKeysAbandoned.Inc()
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// dumpFlushEvery is the number of keys DumpKeys buffers between flushes.
+const dumpFlushEvery = 1024
+
+// DumpKeys writes every key of the blockstore to w, one CID per line, and
+// returns how many were written. Progress is counted in
+// dumpkeys.written_total and the whole dump timed in
+// dumpkeys.latency_seconds. It stops at the first write error, or when
+// ctx is cancelled, returning the keys written so far with the error.
+func (m *measure) DumpKeys(ctx context.Context, w io.Writer) (n int, err error) {
+	written := m.reg.counter("dumpkeys.written_total", "Number of keys written by DumpKeys")
+	defer recordLatency(m.clock, m.reg.latency("dumpkeys.latency", "Latency distribution of DumpKeys calls"), m.clock.Now())
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	keys, err := m.AllKeysChan(ctx)
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(w)
+	// Keys are counted once flushed, so that n never includes keys lost
+	// in the buffer.
+	pending := 0
+	flush := func() error {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		n += pending
+		written.Add(float64(pending))
+		pending = 0
+		return nil
+	}
+	for {
+		select {
+		case c, ok := <-keys:
+			if !ok {
+				// Closed early if ctx was cancelled.
+				if err := flush(); err != nil {
+					return n, err
+				}
+				return n, ctx.Err()
+			}
+			if _, err := bw.WriteString(c.String() + "\n"); err != nil {
+				return n, err
+			}
+			pending++
+			if pending == dumpFlushEvery {
+				if err := flush(); err != nil {
+					return n, err
+				}
+			}
+		case <-ctx.Done():
+			if err := flush(); err != nil {
+				return n, err
+			}
+			return n, ctx.Err()
+		}
+	}
+}
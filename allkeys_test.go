@@ -0,0 +1,205 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+// shardedBackend enumerates its keys in shards split by key order.
+type shardedBackend struct {
+	*testutil.Blockstore
+	keys []cid.Cid
+}
+
+func (b *shardedBackend) AllKeysShard(ctx context.Context, shard, shards int) (<-chan cid.Cid, error) {
+	ch := make(chan cid.Cid)
+	go func() {
+		defer close(ch)
+		for i := shard; i < len(b.keys); i += shards {
+			select {
+			case ch <- b.keys[i]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func TestAllKeysParallel(t *testing.T) {
+	ctx := context.Background()
+	fb := &shardedBackend{Blockstore: testutil.New()}
+	for _, b := range mkBlocks(100) {
+		fb.Put(ctx, b)
+		fb.keys = append(fb.keys, b.Cid())
+	}
+	m := New("test", fb)
+
+	ch, err := m.AllKeysParallel(ctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[cid.Cid]int)
+	for c := range ch {
+		seen[c]++
+	}
+	for _, c := range fb.keys {
+		if seen[c] != 1 {
+			t.Fatalf("key %s emitted %d times", c, seen[c])
+		}
+	}
+	if len(seen) != len(fb.keys) {
+		t.Fatalf("got %d keys, want %d", len(seen), len(fb.keys))
+	}
+	if fb.Count(testutil.AllKeysChan) != 0 {
+		t.Fatal("sharded backend enumerated with AllKeysChan")
+	}
+	for i := 0; i < 4; i++ {
+		if got := statCounter(m, fmt.Sprintf("allkeys.parallel.shard%d.keys_total", i)); got != 25 {
+			t.Fatalf("shard %d enumerated %v keys, want 25", i, got)
+		}
+	}
+	if got := statCount(m, "allkeys.parallel.latency_seconds"); got != 1 {
+		t.Fatalf("allkeys.parallel.latency_seconds count = %v, want 1", got)
+	}
+
+	// Cancelling stops every shard and closes the channel.
+	cctx, cancel := context.WithCancel(ctx)
+	ch, err = m.AllKeysParallel(cctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+	cancel()
+	for range ch {
+	}
+	waitGauge(t, m, "allkeys.active", 0)
+}
+
+func TestAllKeysParallelFallback(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	for _, b := range mkBlocks(10) {
+		fb.Put(ctx, b)
+	}
+	m := New("test", fb)
+	ch, err := m.AllKeysParallel(ctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != 10 {
+		t.Fatalf("got %d keys, want 10", n)
+	}
+	if fb.Count(testutil.AllKeysChan) != 1 {
+		t.Fatal("fallback didn't use AllKeysChan")
+	}
+}
+
+func TestDumpKeys(t *testing.T) {
+	ctx := context.Background()
+	m := New("dk", testutil.New())
+	var want []string
+	for _, s := range []string{"a", "b", "c"} {
+		b := blocks.NewBlock([]byte(s))
+		m.Put(ctx, b)
+		want = append(want, b.Cid().String())
+	}
+	var buf bytes.Buffer
+	n, err := m.DumpKeys(ctx, &buf)
+	if err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+	for _, w := range want {
+		if !strings.Contains(buf.String(), w+"\n") {
+			t.Fatal(buf.String())
+		}
+	}
+	if m.Stats().Counters["dumpkeys.written_total"] != 3 {
+		t.Fatal("counter")
+	}
+}
+
+func TestAllKeysActive(t *testing.T) {
+	ctx := context.Background()
+	m := New("ak", testutil.New())
+	for i := 0; i < 10; i++ {
+		m.Put(ctx, blocks.NewBlock([]byte{byte(i)}))
+	}
+	before := runtime.NumGoroutine()
+	ch, _ := m.AllKeysChan(ctx)
+	if m.Stats().Gauges["allkeys.active"] != 1 {
+		t.Fatal("not active")
+	}
+	for range ch {
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	ch, _ = m.AllKeysChan(cctx)
+	<-ch
+	cancel()
+	for range ch {
+	}
+	st := m.Stats()
+	if st.Gauges["allkeys.active"] != 0 || st.Counters["allkeys.abandoned_total"] != 1 {
+		t.Fatal(st.Gauges, st.Counters)
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("leaked %d goroutines", n-before)
+	}
+}
+
+type delayedKeysBS struct {
+	*testutil.Blockstore
+}
+
+func (d *delayedKeysBS) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	in, _ := d.Blockstore.AllKeysChan(ctx)
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		time.Sleep(30 * time.Millisecond)
+		for c := range in {
+			out <- c
+		}
+	}()
+	return out, nil
+}
+
+func TestFirstKeyLatency(t *testing.T) {
+	ctx := context.Background()
+	mem := testutil.New()
+	m := New("fk", &delayedKeysBS{mem})
+	keys, _ := m.AllKeysChan(ctx)
+	for range keys {
+	}
+	if n := m.Stats().Histograms["allkeys.first_key.latency_seconds"].Count; n != 0 {
+		t.Fatal("empty store recorded")
+	}
+	for _, b := range mkBlocks(3) {
+		mem.Put(context.Background(), b)
+	}
+	keys, _ = m.AllKeysChan(ctx)
+	for range keys {
+	}
+	h := m.Stats().Histograms["allkeys.first_key.latency_seconds"]
+	if h.Count != 1 || h.Sum < 0.03 {
+		t.Fatal(h)
+	}
+}
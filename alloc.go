@@ -0,0 +1,99 @@
+package measure
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithAllocSampling records, for a sampled fraction (0 to 1) of Put,
+// PutMany, Get and View calls, the bytes allocated while the backend
+// served them in <op>.alloc_bytes. The count comes from
+// runtime.ReadMemStats, which stops the world twice per sampled call,
+// and covers allocations by every goroutine during the call, so it is
+// only meaningful on a quiet process. This is a diagnostic for tuning
+// backends, meant for very low sample rates and never for production.
+//
+// Once both have been sampled, the putmany.alloc_efficiency gauge holds
+// the bytes allocated per block by Put divided by those allocated per
+// block by PutMany: above 1, batching saves allocations.
+func WithAllocSampling(sampleRate float64) Option {
+	return func(cfg *config) {
+		cfg.allocRate = sampleRate
+	}
+}
+
+var allocBuckets = []float64{1 << 6, 1 << 8, 1 << 10, 1 << 12, 1 << 14, 1 << 16, 1 << 18, 1 << 20, 1 << 22, 1 << 24, 1 << 26}
+
+type allocSampler struct {
+	rate  float64
+	bytes map[Op]metrics.Histogram
+
+	// mu guards the per-block totals of Put and PutMany.
+	mu          sync.Mutex
+	perBlock    map[Op]*allocTotal
+	putManyGain metrics.Gauge
+}
+
+type allocTotal struct {
+	bytes, blocks float64
+}
+
+func newAllocSampler(r *registry, rate float64) *allocSampler {
+	s := &allocSampler{
+		rate:  rate,
+		bytes: make(map[Op]metrics.Histogram),
+		perBlock: map[Op]*allocTotal{
+			OpPut:     {},
+			OpPutMany: {},
+		},
+		putManyGain: r.gauge("putmany.alloc_efficiency",
+			"Bytes allocated per block by Put divided by bytes allocated per block by PutMany, over sampled calls"),
+	}
+	for _, op := range []Op{OpPut, OpPutMany, OpGet, OpView} {
+		s.bytes[op] = r.histogram(string(op)+".alloc_bytes",
+			"Distribution of the bytes allocated during sampled backend calls", allocBuckets)
+	}
+	return s
+}
+
+func nopAllocDone() {}
+
+// sampleAlloc starts measuring the allocations of a backend call of op,
+// on n blocks, if it is sampled. The returned function must be called
+// once the backend returned.
+func (m *measure) sampleAlloc(op Op, n int) func() {
+	s := m.alloc
+	if s == nil || rand.Float64() >= s.rate {
+		return nopAllocDone
+	}
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	return func() {
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		allocated := float64(after.TotalAlloc - before.TotalAlloc)
+		s.bytes[op].Observe(allocated)
+		s.addPerBlock(op, allocated, n)
+	}
+}
+
+// addPerBlock adds a sampled call of op to the per-block totals and
+// updates putmany.alloc_efficiency.
+func (s *allocSampler) addPerBlock(op Op, allocated float64, n int) {
+	t, ok := s.perBlock[op]
+	if !ok || n == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.bytes += allocated
+	t.blocks += float64(n)
+	put, many := s.perBlock[OpPut], s.perBlock[OpPutMany]
+	if put.blocks == 0 || many.blocks == 0 || many.bytes == 0 {
+		return
+	}
+	s.putManyGain.Set((put.bytes / put.blocks) / (many.bytes / many.blocks))
+}
@@ -0,0 +1,47 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestAllocSampling(t *testing.T) {
+	ctx := context.Background()
+	m := New("al", testutil.New(), WithAllocSampling(1))
+	b := blocks.NewBlock([]byte("x"))
+	m.Put(ctx, b)
+	m.Get(ctx, b.Cid())
+	st := m.Stats().Histograms
+	if st["get.alloc_bytes"].Count != 1 || st["put.alloc_bytes"].Count != 1 {
+		t.Fatal(st["get.alloc_bytes"])
+	}
+	n := New("al2", testutil.New())
+	if n.alloc != nil {
+		t.Fatal("sampler by default")
+	}
+	if _, ok := n.Stats().Histograms["get.alloc_bytes"]; ok {
+		t.Fatal("histogram by default")
+	}
+}
+
+func TestPutManyAllocEfficiency(t *testing.T) {
+	ctx := context.Background()
+	m := New("ae", testutil.New(), WithAllocSampling(1))
+	for _, b := range mkBlocks(20) {
+		m.Put(ctx, b)
+	}
+	m.PutMany(ctx, mkBlocks(40))
+	if g := m.Stats().Gauges["putmany.alloc_efficiency"]; g <= 0 {
+		t.Fatal(g)
+	}
+	n := New("ae2", testutil.New())
+	n.Put(ctx, mkBlocks(1)[0])
+	n.PutMany(ctx, mkBlocks(3))
+	if g := n.Stats().Gauges["putmany.alloc_efficiency"]; g != 0 {
+		t.Fatal(g)
+	}
+}
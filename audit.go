@@ -0,0 +1,193 @@
+package measure
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// ErrAuditFailed is returned in strict mode by deletes that succeeded but
+// could not be written to the delete audit log.
+var ErrAuditFailed = errors.New("measure: block deleted but not audited")
+
+// auditQueueSize is the number of audit lines that may be waiting to be
+// written before deletes wait for room.
+const auditQueueSize = 4096
+
+// DeleteAuditOption configures WithDeleteAudit.
+type DeleteAuditOption func(*deleteAuditConfig)
+
+type deleteAuditConfig struct {
+	w      io.Writer
+	strict bool
+}
+
+// StrictAudit writes audit lines synchronously and makes deletes whose
+// line could not be written return ErrAuditFailed. The block is deleted
+// all the same.
+func StrictAudit() DeleteAuditOption {
+	return func(cfg *deleteAuditConfig) {
+		cfg.strict = true
+	}
+}
+
+// WithDeleteAudit writes a line to w for every block the backend
+// confirmed deleting:
+//
+//	<time, RFC 3339> <cid> <size in bytes or -> <batch id or ->
+//
+// The size is only known for blocks held by the read cache. Blocks
+// removed by the same DeleteMany call share a batch id. CIDs are always
+// written in full, whatever WithCidFormatter says.
+//
+// Lines are buffered and written in the background, and flushed on
+// Close, which also closes w if it is an io.Closer. Deletes wait when
+// the writer falls behind rather than lose lines. Write failures are
+// counted in delete_audit.errors_total.
+func WithDeleteAudit(w io.Writer, opts ...DeleteAuditOption) Option {
+	return func(cfg *config) {
+		cfg.deleteAudit = &deleteAuditConfig{w: w}
+		for _, o := range opts {
+			o(cfg.deleteAudit)
+		}
+	}
+}
+
+type deleteAudit struct {
+	w      io.Writer
+	bw     *bufio.Writer
+	strict bool
+	errors metrics.Counter
+	batch  uint64
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan string
+	done   chan struct{}
+	// wmu serializes writes to bw in strict mode.
+	wmu sync.Mutex
+}
+
+func newDeleteAudit(r *registry, cfg deleteAuditConfig) *deleteAudit {
+	a := &deleteAudit{
+		w:      cfg.w,
+		bw:     bufio.NewWriter(cfg.w),
+		strict: cfg.strict,
+		errors: r.counter("delete_audit.errors_total", "Number of deleted blocks that could not be written to the audit log"),
+		queue:  make(chan string, auditQueueSize),
+		done:   make(chan struct{}),
+	}
+	if a.strict {
+		close(a.done)
+	} else {
+		go a.run()
+	}
+	return a
+}
+
+// nextBatch returns a new batch id for a DeleteMany call.
+func (a *deleteAudit) nextBatch() uint64 {
+	return atomic.AddUint64(&a.batch, 1)
+}
+
+func (a *deleteAudit) write(line string) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		a.errors.Inc()
+		if a.strict {
+			return ErrAuditFailed
+		}
+		return nil
+	}
+	if !a.strict {
+		a.queue <- line
+		return nil
+	}
+
+	a.wmu.Lock()
+	defer a.wmu.Unlock()
+	_, err := a.bw.WriteString(line)
+	if err == nil {
+		err = a.bw.Flush()
+	}
+	if err != nil {
+		a.errors.Inc()
+		return fmt.Errorf("%w: %v", ErrAuditFailed, err)
+	}
+	return nil
+}
+
+func (a *deleteAudit) run() {
+	defer close(a.done)
+	for line := range a.queue {
+		if _, err := a.bw.WriteString(line); err != nil {
+			a.errors.Inc()
+		}
+		if len(a.queue) == 0 {
+			if err := a.bw.Flush(); err != nil {
+				a.errors.Inc()
+			}
+		}
+	}
+}
+
+// close writes out pending lines and closes the writer if possible.
+func (a *deleteAudit) close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	if !a.strict {
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	<-a.done
+	err := a.bw.Flush()
+	if c, ok := a.w.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// cachedSize returns the size of c if it can be known without asking the
+// backend, or -1.
+func (m *measure) cachedSize(c cid.Cid) int {
+	if m.cache == nil {
+		return -1
+	}
+	return m.cache.blockSize(c)
+}
+
+// auditDelete records the deletion of c, of the given size (-1 if
+// unknown) and in the given batch (0 for none).
+func (m *measure) auditDelete(c cid.Cid, size int, batch uint64) error {
+	if m.audit == nil {
+		return nil
+	}
+	line := m.clock.Now().UTC().Format(time.RFC3339Nano) + " " + c.String()
+	if size >= 0 {
+		line += " " + strconv.Itoa(size)
+	} else {
+		line += " -"
+	}
+	if batch > 0 {
+		line += " " + strconv.FormatUint(batch, 10)
+	} else {
+		line += " -"
+	}
+	return m.audit.write(line + "\n")
+}
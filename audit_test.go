@@ -0,0 +1,38 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type failW struct{}
+
+func (failW) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestDeleteAudit(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	m := New("au", testutil.New(), WithDeleteAudit(&buf))
+	a, b := blocks.NewBlock([]byte("a")), blocks.NewBlock([]byte("b"))
+	m.Put(ctx, a)
+	m.Put(ctx, b)
+	m.DeleteMany(ctx, []cid.Cid{a.Cid(), b.Cid()})
+	m.Close()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[1], " - 1") || !strings.Contains(lines[0], a.Cid().String()) {
+		t.Fatal(buf.String())
+	}
+	s := New("au2", testutil.New(), WithDeleteAudit(failW{}, StrictAudit()))
+	s.Put(ctx, a)
+	if err := s.DeleteBlock(ctx, a.Cid()); !errors.Is(err, ErrAuditFailed) {
+		t.Fatal(err)
+	}
+}
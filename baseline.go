@@ -0,0 +1,83 @@
+package measure
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+const (
+	// baselineWeight is the weight of each new call in a latency baseline.
+	baselineWeight = 0.1
+	// baselineWarmup is the number of calls feeding a baseline before it
+	// is used to flag anomalies.
+	baselineWarmup = 10
+)
+
+// WithLatencyBaseline keeps a rolling baseline of the latency of each
+// operation, an exponentially weighted moving average of its successful
+// calls, and counts the calls taking more than factor times the baseline
+// in <op>.anomaly_total. Unlike fixed thresholds such as
+// WithSLOTarget, this adapts to the environment the backend runs in.
+// The first calls of each operation only build up the baseline. A
+// sustained slowdown is counted until the baseline catches up with it.
+func WithLatencyBaseline(factor float64) Option {
+	return func(cfg *config) {
+		cfg.baselineFactor = factor
+	}
+}
+
+type latencyBaseline struct {
+	// ewma holds the bits of the baseline in seconds, samples the number
+	// of calls it was built from. Both are accessed atomically.
+	ewma    uint64
+	samples uint64
+
+	factor    float64
+	anomalies metrics.Counter
+}
+
+func newLatencyBaselines(r *registry, factor float64) map[Op]*latencyBaseline {
+	bs := make(map[Op]*latencyBaseline)
+	for _, op := range []Op{OpPut, OpPutMany, OpGet, OpHas, OpGetSize, OpDelete, OpDeleteMany, OpView} {
+		bs[op] = &latencyBaseline{
+			factor: factor,
+			anomalies: r.counter(string(op)+".anomaly_total",
+				"Number of calls much slower than the rolling latency baseline"),
+		}
+	}
+	return bs
+}
+
+// observe folds a call of d seconds into the baseline, counting it as an
+// anomaly if it exceeds the baseline as it was before.
+func (b *latencyBaseline) observe(d float64) {
+	n := atomic.AddUint64(&b.samples, 1)
+	for {
+		old := atomic.LoadUint64(&b.ewma)
+		avg := math.Float64frombits(old)
+		next := avg + baselineWeight*(d-avg)
+		if n == 1 {
+			next = d
+		}
+		if atomic.CompareAndSwapUint64(&b.ewma, old, math.Float64bits(next)) {
+			if n > baselineWarmup && d > avg*b.factor {
+				b.anomalies.Inc()
+			}
+			return
+		}
+	}
+}
+
+// observeBaseline checks a call of op started at start against the
+// baseline of op.
+func (m *measure) observeBaseline(op Op, start time.Time, err error) {
+	b, ok := m.baselines[op]
+	if !ok || (err != nil && !format.IsNotFound(err)) {
+		return
+	}
+	b.observe(m.clock.Now().Sub(start).Seconds())
+}
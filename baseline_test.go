@@ -0,0 +1,33 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestLatencyBaselineAnomaly(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	fb.SetLatency(testutil.Get, testutil.Fixed(5*time.Millisecond))
+	m := New("lb", fb, WithLatencyBaseline(5))
+	b := mkBlocks(1)[0]
+	fb.Put(ctx, b)
+	for i := 0; i < 20; i++ {
+		m.Get(ctx, b.Cid())
+	}
+	if v := m.Stats().Counters["get.anomaly_total"]; v != 0 {
+		t.Fatal(v)
+	}
+	fb.SetLatency(testutil.Get, testutil.Fixed(100*time.Millisecond))
+	m.Get(ctx, b.Cid())
+	fb.SetLatency(testutil.Get, testutil.Fixed(5*time.Millisecond))
+	for i := 0; i < 5; i++ {
+		m.Get(ctx, b.Cid())
+	}
+	if v := m.Stats().Counters["get.anomaly_total"]; v != 1 {
+		t.Fatal(v)
+	}
+}
@@ -0,0 +1,156 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// ErrBatchTooLarge is returned by PutMany and DeleteMany for batches
+// larger than the limit set with WithMaxBatchSize and RejectOversized.
+var ErrBatchTooLarge = errors.New("measure: batch exceeds the maximum size")
+
+// MaxBatchOption configures WithMaxBatchSize.
+type MaxBatchOption func(*config)
+
+// RejectOversized makes PutMany and DeleteMany fail oversized batches
+// with ErrBatchTooLarge instead of splitting them.
+func RejectOversized() MaxBatchOption {
+	return func(cfg *config) {
+		cfg.rejectOversized = true
+	}
+}
+
+// WithMaxBatchSize limits PutMany and DeleteMany batches to n items.
+// Larger batches are split into batches of at most n items, each
+// measured as a batch of its own, and counted in putmany.split_total
+// or deletemany.split_total. All sub-batches are attempted; their
+// errors are combined into the returned error.
+func WithMaxBatchSize(n int, opts ...MaxBatchOption) Option {
+	return func(cfg *config) {
+		cfg.maxBatchSize = n
+		for _, o := range opts {
+			o(cfg)
+		}
+	}
+}
+
+// WithLegacyBatchSizeName records the number of blocks of PutMany
+// batches under their old name, putmany.size_bytes, instead of
+// putmany.batch_items, for dashboards that still use it. The buckets
+// are the new ones either way.
+func WithLegacyBatchSizeName() Option {
+	return func(cfg *config) {
+		cfg.legacyBatchSizeName = true
+	}
+}
+
+func (cfg *config) putManySizeName() string {
+	if cfg.legacyBatchSizeName {
+		return "putmany.size_bytes"
+	}
+	return "putmany.batch_items"
+}
+
+func (m *measure) oversized(n int) bool {
+	return m.maxBatchSize > 0 && n > m.maxBatchSize
+}
+
+// rejectBatch fails an oversized op batch with ErrBatchTooLarge.
+func (m *measure) rejectBatch(op Op, num, errs metrics.Counter) (err error) {
+	if err = m.enter(op); err != nil {
+		return err
+	}
+	defer m.exitOp()
+	defer m.recordOutcome(op, cid.Undef, &err)
+	num.Inc()
+	err = ErrBatchTooLarge
+	m.countError(op, errs, cid.Undef, err)
+	return err
+}
+
+func (m *measure) splitPutMany(ctx context.Context, blks []blocks.Block) error {
+	if m.rejectOversized {
+		return m.rejectBatch(OpPutMany, m.putManyNum, m.putManyErr)
+	}
+	m.reg.counter("putmany.split_total", "Number of PutMany batches split because they exceeded the maximum size").Inc()
+	var errs batchErrors
+	for len(blks) > 0 {
+		n := m.maxBatchSize
+		if n > len(blks) {
+			n = len(blks)
+		}
+		if err := m.PutMany(ctx, blks[:n]); err != nil {
+			errs = append(errs, err)
+		}
+		blks = blks[n:]
+	}
+	return errs.err()
+}
+
+func (m *measure) splitDeleteMany(ctx context.Context, cids []cid.Cid) error {
+	if m.rejectOversized {
+		return m.rejectBatch(OpDeleteMany, m.deleteManyNum, m.deleteManyErr)
+	}
+	m.reg.counter("deletemany.split_total", "Number of DeleteMany batches split because they exceeded the maximum size").Inc()
+	var errs batchErrors
+	for len(cids) > 0 {
+		n := m.maxBatchSize
+		if n > len(cids) {
+			n = len(cids)
+		}
+		if err := m.DeleteMany(ctx, cids[:n]); err != nil {
+			errs = append(errs, err)
+		}
+		cids = cids[n:]
+	}
+	return errs.err()
+}
+
+// batchErrors combines the errors of the sub-batches of a split batch.
+type batchErrors []error
+
+func (e batchErrors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	default:
+		return e
+	}
+}
+
+func (e batchErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the sub-batch errors matches target.
+func (e batchErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// observePerBlockLatency records in putmany.per_block_latency_seconds
+// the latency of a successful PutMany of n blocks started at start,
+// divided by n. Compared with put.latency_seconds, it shows how well
+// batching amortizes the cost of writes. It is meant to be deferred.
+func (m *measure) observePerBlockLatency(start time.Time, n int, err *error) {
+	if *err != nil || n == 0 {
+		return
+	}
+	m.putManyPerBlock.Observe(m.clock.Now().Sub(start).Seconds() / float64(n))
+}
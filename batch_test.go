@@ -0,0 +1,78 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestMaxBatchSplit(t *testing.T) {
+	m := New("mb", testutil.New(), WithMaxBatchSize(3))
+	var blks []blocks.Block
+	for i := 0; i < 10; i++ {
+		blks = append(blks, blocks.NewBlock([]byte{byte(i)}))
+	}
+	if err := m.PutMany(context.Background(), blks); err != nil {
+		t.Fatal(err)
+	}
+	if v := m.Stats().Counters["putmany_total"]; v != 4 {
+		t.Fatal(v)
+	}
+	r := New("mbr", testutil.New(), WithMaxBatchSize(3, RejectOversized()))
+	if err := r.PutMany(context.Background(), blks); !errors.Is(err, ErrBatchTooLarge) {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxBatchSplitCounter(t *testing.T) {
+	m := New("mbc", testutil.New(), WithMaxBatchSize(3))
+	var blks []blocks.Block
+	for i := 0; i < 7; i++ {
+		blks = append(blks, blocks.NewBlock([]byte{byte(i)}))
+	}
+	m.PutMany(context.Background(), blks)
+	if m.Stats().Counters["putmany.split_total"] != 1 {
+		t.Fatal(m.Stats().Counters)
+	}
+}
+
+func TestBatchSizeBuckets(t *testing.T) {
+	ctx := context.Background()
+	m := New("bb", testutil.New())
+	m.PutMany(ctx, mkBlocks(100))
+	m.PutMany(ctx, mkBlocks(3))
+	h := m.Stats().Histograms["putmany.batch_items"]
+	// 100 -> (64,128], 3 -> (2,4]
+	if h.Count != 2 || h.Counts[7] != 1 || h.Counts[2] != 1 {
+		t.Fatal(h.Counts)
+	}
+	n := New("bb2", testutil.New(), WithLegacyBatchSizeName())
+	n.PutMany(ctx, mkBlocks(1))
+	if n.Stats().Histograms["putmany.size_bytes"].Count != 1 {
+		t.Fatal("legacy")
+	}
+}
+
+func TestPutManyPerBlockLatency(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	fb := testutil.New()
+	fb.SetClock(clock)
+	fb.SetLatency(testutil.PutMany, testutil.Fixed(40*time.Millisecond))
+	m := New("test", fb, WithClock(clock))
+	if err := m.PutMany(ctx, mkBlocks(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.PutMany(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	h := m.Stats().Histograms["putmany.per_block_latency_seconds"]
+	if h.Count != 1 || h.Sum != 0.01 {
+		t.Fatalf("putmany.per_block_latency_seconds count %d sum %v, want 1 observation of 0.01", h.Count, h.Sum)
+	}
+}
@@ -0,0 +1,131 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	blocks "github.com/ipfs/go-block-format"
+)
+
+// ItemErrors is implemented by backend errors that tell which items of a
+// failed batch were not written. PutMany counts only those items in
+// putmany.partial_failed_items, retries them with WithFailedItemRetries
+// and reports them with WithBatchErrors.
+type ItemErrors interface {
+	error
+	// ItemErrors maps the index in the batch of every failed item to its
+	// error.
+	ItemErrors() map[int]error
+}
+
+// BatchError is returned by PutMany, with WithBatchErrors, when the
+// backend fails a batch and the wrapper knows, or could estimate, how
+// much of it was written.
+type BatchError struct {
+	Op Op
+	// Err is the error returned by the backend.
+	Err error
+	// Failed maps the index in the batch of every failed item to its
+	// error. It is nil when the backend only returned an opaque error.
+	Failed map[int]error
+	// Written is the number of leading items of the batch that are
+	// stored, so that retrying the items from index Written on is enough.
+	Written int
+	// Estimated tells whether Written was estimated by probing a sample
+	// of the batch, see ProbePartialWrites. The estimate is conservative:
+	// the items before Written are stored, some after it may be too.
+	Estimated bool
+}
+
+func (e *BatchError) Error() string {
+	if e.Failed != nil {
+		return fmt.Sprintf("measure: %s: %d items failed: %v", e.Op, len(e.Failed), e.Err)
+	}
+	return fmt.Sprintf("measure: %s: failed after about %d items: %v", e.Op, e.Written, e.Err)
+}
+
+func (e *BatchError) Unwrap() error { return e.Err }
+
+// BatchErrorOption configures WithBatchErrors.
+type BatchErrorOption func(*config)
+
+// ProbePartialWrites makes PutMany, when the backend fails a batch with
+// an opaque error, check with Has whether up to sample blocks spread over
+// the batch were written, to estimate how much of it was. The probe
+// costs up to sample backend reads per failed batch.
+func ProbePartialWrites(sample int) BatchErrorOption {
+	return func(cfg *config) {
+		cfg.partialWriteProbe = sample
+	}
+}
+
+// WithBatchErrors makes PutMany return a *BatchError when the backend
+// fails a batch with an error implementing ItemErrors, or with any error
+// if ProbePartialWrites is given. Failed batches of which some items
+// were written are counted in putmany.partial_failures_total.
+func WithBatchErrors(opts ...BatchErrorOption) Option {
+	return func(cfg *config) {
+		cfg.batchErrors = true
+		for _, o := range opts {
+			o(cfg)
+		}
+	}
+}
+
+// putManyError turns err, returned by the backend for blks, into a
+// *BatchError when the wrapper can tell how much of the batch was
+// written.
+func (m *measure) putManyError(ctx context.Context, blks []blocks.Block, err error) error {
+	if !m.batchErrors || isWrapperError(err) {
+		return err
+	}
+	be := &BatchError{Op: OpPutMany, Err: err}
+	var ie ItemErrors
+	switch {
+	case errors.As(err, &ie):
+		be.Failed = ie.ItemErrors()
+		be.Written = len(blks)
+		for i := range be.Failed {
+			if i < be.Written {
+				be.Written = i
+			}
+		}
+		if len(be.Failed) == len(blks) {
+			return be
+		}
+	case m.partialWriteProbe > 0:
+		be.Estimated = true
+		if !m.probeWritten(ctx, blks, be) {
+			return be
+		}
+	default:
+		return err
+	}
+	m.reg.counter("putmany.partial_failures_total",
+		"Number of failed PutMany batches of which some blocks were written").Inc()
+	return be
+}
+
+// probeWritten sets be.Written from Has calls on a sample of blks, and
+// reports whether any of the sampled blocks was found.
+func (m *measure) probeWritten(ctx context.Context, blks []blocks.Block, be *BatchError) bool {
+	n := m.partialWriteProbe
+	if n > len(blks) {
+		n = len(blks)
+	}
+	found := false
+	for j := 0; j < n; j++ {
+		i := j * len(blks) / n
+		if j == n-1 {
+			i = len(blks) - 1
+		}
+		ok, err := m.backend.Has(ctx, blks[i].Cid())
+		if err != nil || !ok {
+			break
+		}
+		found = true
+		be.Written = i + 1
+	}
+	return found
+}
@@ -0,0 +1,57 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type itemErrs map[int]error
+
+func (e itemErrs) Error() string             { return "items" }
+func (e itemErrs) ItemErrors() map[int]error { return e }
+
+type partialBS struct {
+	*testutil.Blockstore
+	upTo    int
+	itemize bool
+}
+
+func (p *partialBS) PutMany(ctx context.Context, blks []blocks.Block) error {
+	p.Blockstore.PutMany(ctx, blks[:p.upTo])
+	if p.itemize {
+		e := itemErrs{}
+		for i := p.upTo; i < len(blks); i++ {
+			e[i] = errors.New("no")
+		}
+		return e
+	}
+	return errors.New("opaque")
+}
+
+func TestBatchErrors(t *testing.T) {
+	ctx := context.Background()
+	blks := mkBlocks(100)
+	m := New("be", &partialBS{Blockstore: testutil.New(), upTo: 40, itemize: true}, WithBatchErrors())
+	err := m.PutMany(ctx, blks)
+	var be *BatchError
+	if !errors.As(err, &be) || be.Written != 40 || len(be.Failed) != 60 || be.Estimated {
+		t.Fatal(err)
+	}
+	m2 := New("be2", &partialBS{Blockstore: testutil.New(), upTo: 40}, WithBatchErrors(ProbePartialWrites(10)))
+	err = m2.PutMany(ctx, blks)
+	if !errors.As(err, &be) || be.Written != 31 || !be.Estimated {
+		t.Fatal(err, be.Written)
+	}
+	if m2.Stats().Counters["putmany.partial_failures_total"] != 1 {
+		t.Fatal("count")
+	}
+	m3 := New("be3", &partialBS{Blockstore: testutil.New(), upTo: 40}, WithBatchErrors())
+	if err = m3.PutMany(ctx, blks); errors.As(err, &be) {
+		t.Fatal("opaque wrapped")
+	}
+}
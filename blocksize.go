@@ -0,0 +1,87 @@
+package measure
+
+import (
+	"errors"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// ErrBlockTooLarge is returned by writes of blocks over the limit set with
+// WithMaxBlockSizeAlarm, when RejectTooLargeBlocks is set.
+var ErrBlockTooLarge = errors.New("measure: block too large")
+
+// WithMaxBlockSizeAlarm counts every block over n bytes written with Put,
+// PutMany or PutWithTTL in put.oversized_total. Unexpectedly large blocks
+// can point at misuse or an attack. By default the write goes through;
+// with RejectTooLargeBlocks it fails with ErrBlockTooLarge without
+// reaching the backend, even while the wrapper is disabled. A PutMany
+// holding any such block is rejected as a whole.
+func WithMaxBlockSizeAlarm(n int, opts ...BlockSizeAlarmOption) Option {
+	return func(cfg *config) {
+		cfg.maxBlockSizeAlarm = n
+		for _, o := range opts {
+			o(cfg)
+		}
+	}
+}
+
+// BlockSizeAlarmOption configures WithMaxBlockSizeAlarm.
+type BlockSizeAlarmOption func(*config)
+
+// RejectTooLargeBlocks makes WithMaxBlockSizeAlarm refuse the write
+// instead of only counting it.
+func RejectTooLargeBlocks() BlockSizeAlarmOption {
+	return func(cfg *config) {
+		cfg.rejectTooLarge = true
+	}
+}
+
+// LogTooLargeBlocks reports every block over the WithMaxBlockSizeAlarm
+// limit to logf, with its CID and size.
+func LogTooLargeBlocks(logf func(format string, args ...interface{})) BlockSizeAlarmOption {
+	return func(cfg *config) {
+		cfg.blockSizeAlarmLogf = logf
+	}
+}
+
+type blockSizeAlarm struct {
+	max       int
+	reject    bool
+	logf      func(format string, args ...interface{})
+	oversized metrics.Counter
+}
+
+func newBlockSizeAlarm(r *registry, max int, reject bool, logf func(string, ...interface{})) *blockSizeAlarm {
+	return &blockSizeAlarm{
+		max:       max,
+		reject:    reject,
+		logf:      logf,
+		oversized: r.counter("put.oversized_total", "Number of blocks written over the size alarm limit"),
+	}
+}
+
+// checkBlockSizes counts the blocks in blks over the size alarm limit and
+// returns ErrBlockTooLarge if any was found in reject mode.
+func (m *measure) checkBlockSizes(blks ...blocks.Block) error {
+	a := m.sizeAlarm
+	if a == nil {
+		return nil
+	}
+	var found bool
+	for _, blk := range blks {
+		size := len(blk.RawData())
+		if size <= a.max {
+			continue
+		}
+		found = true
+		a.oversized.Inc()
+		if a.logf != nil {
+			a.logf("measure: block %s is %d bytes, over the %d byte limit", m.cidFormat(blk.Cid()), size, a.max)
+		}
+	}
+	if found && a.reject {
+		return ErrBlockTooLarge
+	}
+	return nil
+}
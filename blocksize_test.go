@@ -0,0 +1,54 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestBlockSizeAlarmOnly(t *testing.T) {
+	ctx := context.Background()
+	bs := testutil.New()
+	var logged int
+	m := New("bsa", bs, WithMaxBlockSizeAlarm(4, LogTooLargeBlocks(func(string, ...interface{}) { logged++ })))
+	big := blocks.NewBlock([]byte("0123456789"))
+	small := blocks.NewBlock([]byte("ab"))
+	if err := m.Put(ctx, big); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.PutMany(ctx, []blocks.Block{small, blocks.NewBlock([]byte("abcdefgh"))}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := bs.Has(ctx, big.Cid()); !ok {
+		t.Fatal("not stored")
+	}
+	if v := m.Stats().Counters["put.oversized_total"]; v != 2 || logged != 2 {
+		t.Fatalf("got %v logged %d", v, logged)
+	}
+}
+
+func TestBlockSizeReject(t *testing.T) {
+	ctx := context.Background()
+	bs := testutil.New()
+	m := New("bsr", bs, WithMaxBlockSizeAlarm(4, RejectTooLargeBlocks()))
+	big := blocks.NewBlock([]byte("0123456789"))
+	if err := m.Put(ctx, big); !errors.Is(err, ErrBlockTooLarge) {
+		t.Fatal(err)
+	}
+	if err := m.PutMany(ctx, []blocks.Block{blocks.NewBlock([]byte("ab")), big}); !errors.Is(err, ErrBlockTooLarge) {
+		t.Fatal(err)
+	}
+	if ok, _ := bs.Has(ctx, big.Cid()); ok {
+		t.Fatal("stored")
+	}
+	if err := m.Put(ctx, blocks.NewBlock([]byte("ab"))); err != nil {
+		t.Fatal(err)
+	}
+	if v := m.Stats().Counters["put.oversized_total"]; v != 2 {
+		t.Fatalf("got %v", v)
+	}
+}
@@ -0,0 +1,201 @@
+package measure
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithBloomFilter keeps a bloom filter of the blocks in the store, sized
+// for expectedKeys at the false positive rate fpRate, to tell how many
+// Has and Get lookups of missing blocks could skip the backend. Lookups
+// the filter rules out are counted in bloom.definite_misses_total, and
+// lookups it let through that missed the backend in
+// bloom.false_positive_total.
+//
+// The filter learns of blocks from the writes going through the wrapper
+// and, starting with the first lookup, from a listing of the backend's
+// keys. Until that listing is complete nothing is counted. Blocks
+// written to the backend other than through this wrapper are unknown to
+// the filter, so it can't be trusted to answer lookups: those it rules
+// out still go to the backend. Only the absence of blocks deleted
+// through the wrapper, and not written through it since, is taken as
+// confirmed: lookups of up to expectedKeys of them are answered as not
+// found without asking the backend, counted in
+// bloom.negative_hits_total. Deleted blocks stay in the filter, adding
+// to the false positives, until the wrapper is recreated.
+func WithBloomFilter(expectedKeys int, fpRate float64) Option {
+	return func(cfg *config) {
+		cfg.bloomKeys = expectedKeys
+		cfg.bloomFPRate = fpRate
+	}
+}
+
+type bloomFilter struct {
+	bits   []uint64 // updated atomically
+	hashes int
+
+	// ready is set once the backend's keys have all been added.
+	ready    int32
+	populate sync.Once
+	cancel   context.CancelFunc
+
+	// deleted holds, up to maxDeleted, the blocks deleted through the
+	// wrapper and not written since.
+	mu         sync.Mutex
+	deleted    map[cid.Cid]struct{}
+	maxDeleted int
+
+	negativeHits   metrics.Counter
+	definiteMisses metrics.Counter
+	falsePositive  metrics.Counter
+}
+
+func newBloomFilter(r *registry, n int, p float64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{
+		bits:       make([]uint64, int(m)/64+1),
+		hashes:     k,
+		deleted:    make(map[cid.Cid]struct{}),
+		maxDeleted: n,
+		negativeHits: r.counter("bloom.negative_hits_total",
+			"Number of lookups of blocks deleted through the wrapper answered as not found without asking the backend"),
+		definiteMisses: r.counter("bloom.definite_misses_total",
+			"Number of lookups the bloom filter ruled out, which still went to the backend"),
+		falsePositive: r.counter("bloom.false_positive_total",
+			"Number of lookups the bloom filter let through that missed the backend"),
+	}
+}
+
+// positions calls f with the k bit positions of c.
+func (b *bloomFilter) positions(c cid.Cid, f func(word int, mask uint64)) {
+	h := fnv.New64a()
+	h.Write(c.Hash())
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32
+	n := uint64(len(b.bits) * 64)
+	for i := uint64(0); i < uint64(b.hashes); i++ {
+		bit := (h1 + i*h2) % n
+		f(int(bit/64), 1<<(bit%64))
+	}
+}
+
+func (b *bloomFilter) add(c cid.Cid) {
+	b.positions(c, func(word int, mask uint64) {
+		for {
+			old := atomic.LoadUint64(&b.bits[word])
+			if old&mask != 0 || atomic.CompareAndSwapUint64(&b.bits[word], old, old|mask) {
+				return
+			}
+		}
+	})
+}
+
+func (b *bloomFilter) mayContain(c cid.Cid) bool {
+	found := true
+	b.positions(c, func(word int, mask uint64) {
+		if atomic.LoadUint64(&b.bits[word])&mask == 0 {
+			found = false
+		}
+	})
+	return found
+}
+
+// bloomAdd records that c is being written.
+func (m *measure) bloomAdd(c cid.Cid) {
+	if m.bloom == nil {
+		return
+	}
+	m.bloom.add(c)
+	m.bloom.mu.Lock()
+	delete(m.bloom.deleted, c)
+	m.bloom.mu.Unlock()
+}
+
+// bloomDelete records that c was deleted.
+func (m *measure) bloomDelete(c cid.Cid) {
+	b := m.bloom
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.deleted) < b.maxDeleted {
+		b.deleted[c] = struct{}{}
+	}
+}
+
+// bloomMiss reports whether c is known to be missing, having been
+// deleted through the wrapper, and counts the lookups the filter rules
+// out otherwise. It starts filling the filter with the backend's keys on
+// first use.
+func (m *measure) bloomMiss(c cid.Cid) bool {
+	b := m.bloom
+	if b == nil {
+		return false
+	}
+	b.populate.Do(m.populateBloom)
+	b.mu.Lock()
+	_, deleted := b.deleted[c]
+	b.mu.Unlock()
+	if deleted {
+		b.negativeHits.Inc()
+		return true
+	}
+	if atomic.LoadInt32(&b.ready) == 1 && !b.mayContain(c) {
+		b.definiteMisses.Inc()
+	}
+	return false
+}
+
+// bloomFalsePositive counts a backend miss of c the filter let through.
+func (m *measure) bloomFalsePositive(c cid.Cid) {
+	if m.bloom != nil && atomic.LoadInt32(&m.bloom.ready) == 1 {
+		m.bloom.falsePositive.Inc()
+	}
+}
+
+// populateBloom adds the backend's keys to the filter in the background,
+// and makes it ready once they are all in.
+func (m *measure) populateBloom() {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.bloom.cancel = cancel
+	keys, err := m.backend.AllKeysChan(ctx)
+	if err != nil {
+		cancel()
+		return
+	}
+	go func() {
+		defer cancel()
+		for c := range keys {
+			m.bloom.add(c)
+		}
+		if ctx.Err() == nil {
+			atomic.StoreInt32(&m.bloom.ready, 1)
+		}
+	}()
+}
+
+// stopBloom stops filling the filter, for Close.
+func (m *measure) stopBloom() {
+	if m.bloom == nil {
+		return
+	}
+	// Make sure populateBloom can't start after this.
+	m.bloom.populate.Do(func() {})
+	if m.bloom.cancel != nil {
+		m.bloom.cancel()
+	}
+}
@@ -0,0 +1,89 @@
+package measure
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+// waitBloom waits for the bloom filter to be filled with the backend's
+// keys.
+func waitBloom(t *testing.T, m *measure) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&m.bloom.ready) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("bloom filter not populated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBloomFilterDeleted(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	m := New("test", fb, WithBloomFilter(1000, 0.01))
+	defer m.Close()
+	blk := mkBlocks(1)[0]
+
+	m.Put(ctx, blk)
+	if err := m.DeleteBlock(ctx, blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := m.Has(ctx, blk.Cid()); err != nil || ok {
+		t.Fatalf("Has of a deleted block: %t, %v", ok, err)
+	}
+	if fb.Count(testutil.Has) != 0 {
+		t.Fatal("a confirmed absence went to the backend")
+	}
+	if got := statCounter(m, "bloom.negative_hits_total"); got != 1 {
+		t.Fatalf("bloom.negative_hits_total = %v, want 1", got)
+	}
+
+	// Written again, the block is looked up in the backend.
+	m.Put(ctx, blk)
+	if ok, err := m.Has(ctx, blk.Cid()); err != nil || !ok {
+		t.Fatalf("Has of a block written again: %t, %v", ok, err)
+	}
+	if fb.Count(testutil.Has) != 1 {
+		t.Fatal("lookup of a block written again skipped the backend")
+	}
+}
+
+func TestBloomFilterUnseenWrites(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	m := New("test", fb, WithBloomFilter(1000, 0.01))
+	defer m.Close()
+	blks := mkBlocks(2)
+
+	m.Has(ctx, blks[0].Cid())
+	waitBloom(t, m)
+	// A block written behind the wrapper's back is unknown to the
+	// filter but must still be found.
+	fb.Put(ctx, blks[1])
+	for _, b := range blks {
+		ok, err := m.Has(ctx, b.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != (b == blks[1]) {
+			t.Fatalf("Has(%s) = %t", b.Cid(), ok)
+		}
+	}
+	if _, err := m.Get(ctx, blks[1].Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if fb.Count(testutil.Has) != 3 {
+		t.Fatalf("backend saw %d Has calls, want 3", fb.Count(testutil.Has))
+	}
+	if got := statCounter(m, "bloom.negative_hits_total"); got != 0 {
+		t.Fatalf("bloom.negative_hits_total = %v, want 0", got)
+	}
+	if got := statCounter(m, "bloom.definite_misses_total"); got != 3 {
+		t.Fatalf("bloom.definite_misses_total = %v, want 3", got)
+	}
+}
@@ -0,0 +1,159 @@
+package measure
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithReadCache keeps recently read blocks in memory, up to maxBytes of
+// block data, and serves Get and View from it. Lookups are counted in
+// cache.hits_total and cache.misses_total, and their latencies observed
+// separately in cache.hit.latency_seconds and cache.miss.latency_seconds.
+// cache.bytes is the amount of data held and cache.evictions_total the
+// number of blocks dropped to make room. Deleted blocks are dropped from
+// the cache.
+//
+// View callbacks on a hit get the cached data without a copy; like with
+// any Viewer they must not modify it.
+func WithReadCache(maxBytes int64) Option {
+	return func(cfg *config) {
+		cfg.readCacheBytes = maxBytes
+	}
+}
+
+type readCache struct {
+	maxBytes int64
+
+	hits        metrics.Counter
+	misses      metrics.Counter
+	evictions   metrics.Counter
+	bytes       metrics.Gauge
+	hitLatency  metrics.Histogram
+	missLatency metrics.Histogram
+
+	mu sync.Mutex
+	// gen is incremented by every removal, so that a block read before
+	// its deletion isn't cached after it.
+	gen   uint64
+	size  int64
+	ll    *list.List // of blocks.Block, most recent first
+	items map[cid.Cid]*list.Element
+}
+
+func newReadCache(r *registry, maxBytes int64) *readCache {
+	return &readCache{
+		maxBytes:  maxBytes,
+		hits:      r.counter("cache.hits_total", "Number of reads served from the read cache"),
+		misses:    r.counter("cache.misses_total", "Number of reads the read cache could not serve"),
+		evictions: r.counter("cache.evictions_total", "Number of blocks evicted from the read cache"),
+		bytes:     r.gauge("cache.bytes", "Bytes of block data held in the read cache"),
+		hitLatency: r.latency("cache.hit.latency",
+			"Latency distribution of reads served from the read cache"),
+		missLatency: r.latency("cache.miss.latency",
+			"Latency distribution of reads the read cache could not serve"),
+		ll:    list.New(),
+		items: make(map[cid.Cid]*list.Element),
+	}
+}
+
+func (rc *readCache) generation() uint64 {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.gen
+}
+
+func (rc *readCache) get(c cid.Cid) (blocks.Block, bool) {
+	rc.mu.Lock()
+	e, ok := rc.items[c]
+	if ok {
+		rc.ll.MoveToFront(e)
+	}
+	rc.mu.Unlock()
+	if !ok {
+		rc.misses.Inc()
+		return nil, false
+	}
+	rc.hits.Inc()
+	return e.Value.(blocks.Block), true
+}
+
+// blockSize returns the size of c if it is cached, or -1. It doesn't count
+// as a use of c.
+func (rc *readCache) blockSize(c cid.Cid) int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if e, ok := rc.items[c]; ok {
+		return len(e.Value.(blocks.Block).RawData())
+	}
+	return -1
+}
+
+// add caches blk, read at generation gen, evicting the least recently
+// used blocks to make room. Blocks larger than the whole cache are not
+// cached.
+func (rc *readCache) add(blk blocks.Block, gen uint64) {
+	n := int64(len(blk.RawData()))
+	if n > rc.maxBytes {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.gen != gen {
+		return
+	}
+	if _, ok := rc.items[blk.Cid()]; ok {
+		return
+	}
+	for rc.size+n > rc.maxBytes {
+		rc.removeElement(rc.ll.Back())
+		rc.evictions.Inc()
+	}
+	rc.items[blk.Cid()] = rc.ll.PushFront(blk)
+	rc.size += n
+	rc.bytes.Set(float64(rc.size))
+}
+
+func (rc *readCache) remove(c cid.Cid) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.gen++
+	if e, ok := rc.items[c]; ok {
+		rc.removeElement(e)
+		rc.bytes.Set(float64(rc.size))
+	}
+}
+
+func (rc *readCache) removeElement(e *list.Element) {
+	blk := rc.ll.Remove(e).(blocks.Block)
+	delete(rc.items, blk.Cid())
+	rc.size -= int64(len(blk.RawData()))
+}
+
+// uncache drops c from the read cache, for when it is deleted.
+func (m *measure) uncache(c cid.Cid) {
+	if m.cache != nil {
+		m.cache.remove(c)
+	}
+}
+
+// cachedRead serves c from the read cache, or runs read and caches the
+// block it returns. The latency since start is recorded as a hit or a
+// miss.
+func (m *measure) cachedRead(c cid.Cid, start time.Time, read func() (blocks.Block, error)) (blocks.Block, error) {
+	if blk, ok := m.cache.get(c); ok {
+		recordLatency(m.clock, m.cache.hitLatency, start)
+		return blk, nil
+	}
+	defer recordLatency(m.clock, m.cache.missLatency, start)
+	gen := m.cache.generation()
+	blk, err := read()
+	if err == nil {
+		m.cache.add(blk, gen)
+	}
+	return blk, err
+}
@@ -0,0 +1,33 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestReadCache(t *testing.T) {
+	ctx := context.Background()
+	mem := testutil.New()
+	m := New("rc", mem, WithReadCache(3))
+	a, b := blocks.NewBlock([]byte("aa")), blocks.NewBlock([]byte("bb"))
+	mem.Put(ctx, a)
+	mem.Put(ctx, b)
+	m.Get(ctx, a.Cid())
+	m.Get(ctx, a.Cid())
+	if mem.Count(testutil.Get) != 1 {
+		t.Fatal(mem.Calls())
+	}
+	m.Get(ctx, b.Cid())
+	st := m.Stats()
+	if st.Counters["cache.hits_total"] != 1 || st.Counters["cache.evictions_total"] != 1 || st.Gauges["cache.bytes"] != 2 {
+		t.Fatal(st.Counters, st.Gauges)
+	}
+	m.DeleteBlock(ctx, b.Cid())
+	if _, err := m.Get(ctx, b.Cid()); err == nil {
+		t.Fatal("served deleted block")
+	}
+}
@@ -0,0 +1,29 @@
+package measure
+
+import (
+	blocks "github.com/ipfs/go-block-format"
+)
+
+// CacheHintedBlock is implemented by the blocks of backends that tell
+// whether they served them from their own cache. Gets returning such
+// blocks from the backend are counted in get.cache_hit_total or
+// get.cache_miss_total, independently of the read cache of the wrapper,
+// whose hits never reach the backend.
+type CacheHintedBlock interface {
+	blocks.Block
+	FromCache() bool
+}
+
+// observeCacheHint counts the cache hint of blk, just returned by the
+// backend, if it has one.
+func (m *measure) observeCacheHint(blk blocks.Block) {
+	hinted, ok := blk.(CacheHintedBlock)
+	if !ok {
+		return
+	}
+	if hinted.FromCache() {
+		m.reg.counter("get.cache_hit_total", "Number of Gets the backend reported serving from its cache").Inc()
+	} else {
+		m.reg.counter("get.cache_miss_total", "Number of Gets the backend reported not serving from its cache").Inc()
+	}
+}
@@ -0,0 +1,52 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type hintedBlock struct {
+	blocks.Block
+	hit bool
+}
+
+func (h hintedBlock) FromCache() bool { return h.hit }
+
+type hintingBS struct {
+	*testutil.Blockstore
+	seen map[cid.Cid]bool
+}
+
+func (h hintingBS) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := h.Blockstore.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	hit := h.seen[c]
+	h.seen[c] = true
+	return hintedBlock{blk, hit}, nil
+}
+
+func TestBackendCacheHints(t *testing.T) {
+	ctx := context.Background()
+	bs := hintingBS{testutil.New(), map[cid.Cid]bool{}}
+	m := New("ch", bs)
+	blks := mkBlocks(2)
+	for _, b := range blks {
+		bs.Blockstore.Put(ctx, b)
+	}
+	for i := 0; i < 3; i++ {
+		for _, b := range blks {
+			m.Get(ctx, b.Cid())
+		}
+	}
+	s := m.Stats()
+	if s.Counters["get.cache_hit_total"] != 4 || s.Counters["get.cache_miss_total"] != 2 {
+		t.Fatal(s.Counters)
+	}
+}
@@ -0,0 +1,23 @@
+package measure
+
+// reportCapabilities sets the capability.<name> gauges to 1 for the
+// optional interfaces the backend implements and to 0 for those it
+// lacks, for which the wrapper falls back to slower paths: View reads
+// with Get, DeleteMany deletes block by block, ViewPrefix reads whole
+// blocks and PutWithTTL tracks expiries itself. They are set once, at
+// construction, so that a degraded configuration shows from the start.
+func (m *measure) reportCapabilities(r *registry) {
+	for name, ok := range map[string]bool{
+		"view":       m.viewer != nil,
+		"deletemany": m.deleter != nil,
+		"viewprefix": m.prefixViewer != nil,
+		"ttl":        m.ttlPutter != nil,
+	} {
+		var v float64
+		if ok {
+			v = 1
+		}
+		r.gauge("capability."+name,
+			"1 if the backend supports an optional interface natively, 0 if the wrapper falls back").Set(v)
+	}
+}
@@ -0,0 +1,86 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestCapabilities(t *testing.T) {
+	wrappers := map[string][]Option{
+		"unwrapped":   nil,
+		"compressed":  {WithCompression(Flate(1))},
+		"intercepted": {WithInterceptor(NopInterceptor{})},
+		"both":        {WithCompression(Flate(1)), WithInterceptor(NopInterceptor{})},
+	}
+	for name, opts := range wrappers {
+		for _, tc := range []struct {
+			backend          blockstore.Blockstore
+			view, deleteMany float64
+		}{
+			{testutil.New(), 1, 1},
+			{testutil.New().WithoutView(), 0, 1},
+			{testutil.New().Plain(), 0, 0},
+		} {
+			m := New("test", tc.backend, opts...)
+			view, deleteMany := statGauge(m, "capability.view"), statGauge(m, "capability.deletemany")
+			if view != tc.view || deleteMany != tc.deleteMany {
+				t.Errorf("%s %T: capability.view %v, capability.deletemany %v, want %v and %v",
+					name, tc.backend, view, deleteMany, tc.view, tc.deleteMany)
+			}
+			if got := statGauge(m, "capability.ttl"); got != 0 {
+				t.Errorf("%s %T: capability.ttl = %v, want 0", name, tc.backend, got)
+			}
+		}
+	}
+}
+
+// TestCapabilitiesWrapped checks that optional interfaces are still used
+// through compression and interceptors.
+func TestCapabilitiesWrapped(t *testing.T) {
+	ctx := context.Background()
+	fb := &ttlBackend{Blockstore: testutil.New()}
+	qd := &queuedBackend{ttlBackend: fb, depth: 3}
+	m := New("test", qd, WithCompression(Flate(1)), WithInterceptor(NopInterceptor{}))
+	if got := statGauge(m, "capability.ttl"); got != 1 {
+		t.Fatalf("capability.ttl = %v, want 1", got)
+	}
+
+	blk := blocks.NewBlock(bytes.Repeat([]byte("compressible "), 100))
+	if err := m.PutWithTTL(ctx, blk, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if len(fb.ttls) != 1 {
+		t.Fatal("TTL write didn't reach the backend")
+	}
+	got, err := m.Get(ctx, blk.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.RawData()) != string(blk.RawData()) {
+		t.Fatalf("read %q, want %q", got.RawData(), blk.RawData())
+	}
+	stored, err := fb.Get(ctx, blk.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stored.RawData()) == string(blk.RawData()) {
+		t.Fatal("TTL write wasn't compressed like a Put")
+	}
+	if got := statGauge(m, "backend.queue_depth"); got != 3 {
+		t.Fatalf("backend.queue_depth = %v, want 3", got)
+	}
+}
+
+type queuedBackend struct {
+	*ttlBackend
+	depth int
+}
+
+func (b *queuedBackend) QueueDepth() int { return b.depth }
@@ -0,0 +1,256 @@
+package measure
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// Chain is a blockstore made of several backends, typically ordered from
+// fastest to slowest. Reads try each backend in order and return the
+// first hit; a hit on backend i > 0 is counted in
+// chain.level<i>.fallback_total, and a block no backend has in
+// chain.all_miss_total.
+//
+// A read error other than not-found stops the chain and is returned, so
+// that a failing fast backend doesn't silently move all traffic to the
+// slow ones. Writes go to the first backend unless changed with WriteTo;
+// deletes go to every backend so that a deleted block can't resurface
+// from a lower level. AllKeysChan lists each backend in turn and may
+// repeat keys stored in more than one of them.
+//
+// Wrap a Chain with New to also get the per-operation metrics.
+type Chain struct {
+	backends []blockstore.Blockstore
+	writeTo  []int
+	reg      *registry
+
+	fallback []metrics.Counter
+	allMiss  metrics.Counter
+
+	// Set by Tiered.
+	hits       []metrics.Counter
+	promote    bool
+	promoted   metrics.Counter
+	promoteErr metrics.Counter
+}
+
+var _ blockstore.Blockstore = (*Chain)(nil)
+
+// NewChain returns a chain of the given backends. Its metrics are
+// registered with names starting with prefix and a dot. It panics
+// without backends.
+func NewChain(prefix string, backends ...blockstore.Blockstore) *Chain {
+	if len(backends) == 0 {
+		panic("measure: chain without backends")
+	}
+	r := newRegistry(prefix, newMetricsRecorder())
+	c := &Chain{
+		backends: backends,
+		writeTo:  []int{0},
+		reg:      r,
+		fallback: make([]metrics.Counter, len(backends)),
+		allMiss:  r.counter("chain.all_miss_total", "Number of chain reads no backend could serve"),
+	}
+	for i := 1; i < len(backends); i++ {
+		c.fallback[i] = r.counter(fmt.Sprintf("chain.level%d.fallback_total", i),
+			fmt.Sprintf("Number of chain reads served by backend %d", i))
+	}
+	return c
+}
+
+// WriteTo sets the indexes of the backends Put and PutMany write to. It
+// must be called before the chain is used, and panics on an index
+// without backend.
+func (c *Chain) WriteTo(levels ...int) {
+	for _, l := range levels {
+		if l < 0 || l >= len(c.backends) {
+			panic(fmt.Sprintf("measure: invalid chain level %d", l))
+		}
+	}
+	c.writeTo = levels
+}
+
+// Stats returns a snapshot of the chain's metrics.
+func (c *Chain) Stats() Stats {
+	return c.reg.snapshot()
+}
+
+// read runs f against each backend in order until one finds the block,
+// and returns the index of that backend.
+func (c *Chain) read(f func(level int, bs blockstore.Blockstore) error) (int, error) {
+	var err error
+	for i, bs := range c.backends {
+		err = f(i, bs)
+		if err == nil {
+			if i > 0 {
+				c.fallback[i].Inc()
+			}
+			if c.hits != nil {
+				c.hits[i].Inc()
+			}
+			return i, nil
+		}
+		if !format.IsNotFound(err) {
+			return i, err
+		}
+	}
+	c.allMiss.Inc()
+	return -1, err
+}
+
+// promoteBlock copies blk, found in a lower backend, to the first one.
+func (c *Chain) promoteBlock(ctx context.Context, blk blocks.Block) {
+	if err := c.backends[0].Put(ctx, blk); err != nil {
+		c.promoteErr.Inc()
+		return
+	}
+	c.promoted.Inc()
+}
+
+func (c *Chain) Get(ctx context.Context, k cid.Cid) (blocks.Block, error) {
+	var blk blocks.Block
+	level, err := c.read(func(_ int, bs blockstore.Blockstore) (err error) {
+		blk, err = bs.Get(ctx, k)
+		return err
+	})
+	if err == nil && level > 0 && c.promote {
+		c.promoteBlock(ctx, blk)
+	}
+	return blk, err
+}
+
+func (c *Chain) Has(ctx context.Context, k cid.Cid) (bool, error) {
+	_, err := c.read(func(_ int, bs blockstore.Blockstore) error {
+		has, err := bs.Has(ctx, k)
+		if err == nil && !has {
+			return format.ErrNotFound{Cid: k}
+		}
+		return err
+	})
+	if format.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *Chain) GetSize(ctx context.Context, k cid.Cid) (int, error) {
+	size := -1
+	_, err := c.read(func(_ int, bs blockstore.Blockstore) (err error) {
+		size, err = bs.GetSize(ctx, k)
+		return err
+	})
+	return size, err
+}
+
+func (c *Chain) View(ctx context.Context, k cid.Cid, f func([]byte) error) error {
+	var promote blocks.Block
+	_, err := c.read(func(level int, bs blockstore.Blockstore) error {
+		if v, ok := bs.(blockstore.Viewer); ok {
+			if level == 0 || !c.promote {
+				return v.View(ctx, k, f)
+			}
+			return v.View(ctx, k, func(data []byte) error {
+				// The data is only valid during the callback.
+				promote, _ = blocks.NewBlockWithCid(append([]byte(nil), data...), k)
+				return f(data)
+			})
+		}
+		blk, err := bs.Get(ctx, k)
+		if err != nil {
+			return err
+		}
+		if level > 0 && c.promote {
+			promote = blk
+		}
+		return f(blk.RawData())
+	})
+	if err == nil && promote != nil {
+		c.promoteBlock(ctx, promote)
+	}
+	return err
+}
+
+func (c *Chain) Put(ctx context.Context, blk blocks.Block) error {
+	for _, i := range c.writeTo {
+		if err := c.backends[i].Put(ctx, blk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Chain) PutMany(ctx context.Context, blks []blocks.Block) error {
+	for _, i := range c.writeTo {
+		if err := c.backends[i].PutMany(ctx, blks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Chain) DeleteBlock(ctx context.Context, k cid.Cid) error {
+	var firstErr error
+	for _, bs := range c.backends {
+		if err := bs.DeleteBlock(ctx, k); err != nil && !format.IsNotFound(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (c *Chain) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	// Cancelling ctx stops the enumerations already started when a
+	// later backend fails, and those left unread once out is closed.
+	ctx, cancel := context.WithCancel(ctx)
+	ins := make([]<-chan cid.Cid, len(c.backends))
+	for i, bs := range c.backends {
+		ch, err := bs.AllKeysChan(ctx)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		ins[i] = ch
+	}
+	out := make(chan cid.Cid)
+	go func() {
+		defer cancel()
+		defer close(out)
+		for _, in := range ins {
+			for k := range in {
+				select {
+				case out <- k:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (c *Chain) HashOnRead(enabled bool) {
+	for _, bs := range c.backends {
+		bs.HashOnRead(enabled)
+	}
+}
+
+// Close closes every backend that can be closed and returns the first
+// error.
+func (c *Chain) Close() error {
+	var firstErr error
+	for _, bs := range c.backends {
+		if cl, ok := bs.(io.Closer); ok {
+			if err := cl.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,94 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+	fast, slow := testutil.New(), testutil.New()
+	c := NewChain("test", fast, slow)
+	blks := mkBlocks(3)
+	c.Put(ctx, blks[0])
+	slow.Put(ctx, blks[1])
+
+	for _, b := range blks[:2] {
+		if _, err := c.Get(ctx, b.Cid()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Get(ctx, blks[2].Cid()); !format.IsNotFound(err) {
+		t.Fatalf("got %v for a block no backend has, want not found", err)
+	}
+	if ok, _ := slow.Has(ctx, blks[0].Cid()); ok {
+		t.Fatal("Put wrote past the first backend")
+	}
+	s := c.Stats()
+	if got := s.Counters["chain.level1.fallback_total"]; got != 1 {
+		t.Fatalf("chain.level1.fallback_total = %v, want 1", got)
+	}
+	if got := s.Counters["chain.all_miss_total"]; got != 1 {
+		t.Fatalf("chain.all_miss_total = %v, want 1", got)
+	}
+
+	// Deletes reach every backend.
+	slow.Put(ctx, blks[0])
+	if err := c.DeleteBlock(ctx, blks[0].Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := c.Has(ctx, blks[0].Cid()); ok {
+		t.Fatal("deleted block resurfaced from the slow backend")
+	}
+}
+
+// ctxBackend records the context of its last AllKeysChan.
+type ctxBackend struct {
+	*testutil.Blockstore
+	ctx context.Context
+}
+
+func (b *ctxBackend) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	b.ctx = ctx
+	return b.Blockstore.AllKeysChan(ctx)
+}
+
+func TestChainAllKeysChanError(t *testing.T) {
+	ctx := context.Background()
+	first := &ctxBackend{Blockstore: testutil.New()}
+	first.Put(ctx, mkBlocks(1)[0])
+	failing := testutil.New()
+	failing.FailCall(testutil.AllKeysChan, 1, nil)
+	c := NewChain("test", first, failing)
+
+	if _, err := c.AllKeysChan(ctx); err != testutil.ErrScheduled {
+		t.Fatalf("got %v, want ErrScheduled", err)
+	}
+	select {
+	case <-first.ctx.Done():
+	default:
+		t.Fatal("enumeration of the first backend left running")
+	}
+}
+
+func TestChainInvalid(t *testing.T) {
+	for name, f := range map[string]func(){
+		"no backends":    func() { NewChain("test") },
+		"negative level": func() { NewChain("test", testutil.New()).WriteTo(-1) },
+		"missing level":  func() { NewChain("test", testutil.New()).WriteTo(0, 1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
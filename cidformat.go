@@ -0,0 +1,33 @@
+package measure
+
+import "github.com/ipfs/go-cid"
+
+// WithCidFormatter sets how CIDs are rendered in the text the wrapper
+// produces, such as journal records and the dry-run delete log. The
+// default is FullCid.
+func WithCidFormatter(f func(cid.Cid) string) Option {
+	return func(cfg *config) {
+		cfg.cidFormat = f
+	}
+}
+
+// FullCid renders a CID in full, in its default base (base32 for CIDv1).
+func FullCid(c cid.Cid) string {
+	return c.String()
+}
+
+// TruncatedCid returns a formatter keeping the last n characters of the
+// full form, which is where CIDs of the same type and hash differ.
+func TruncatedCid(n int) func(cid.Cid) string {
+	return func(c cid.Cid) string {
+		s := c.String()
+		if len(s) <= n {
+			return s
+		}
+		return "..." + s[len(s)-n:]
+	}
+}
+
+func (m *measure) formatCid(c cid.Cid) string {
+	return m.cidFormat(c)
+}
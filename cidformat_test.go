@@ -0,0 +1,23 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestCidFormatter(t *testing.T) {
+	var log bytes.Buffer
+	m := New("cf", testutil.New(), WithDryRunDeletes(), WithDryRunLog(&log),
+		WithCidFormatter(func(c cid.Cid) string { return "X" + TruncatedCid(6)(c) }))
+	m.DeleteBlock(context.Background(), blocks.NewBlock([]byte("a")).Cid())
+	if !strings.HasPrefix(log.String(), "X...") || len(log.String()) != 11 {
+		t.Fatal(log.String())
+	}
+}
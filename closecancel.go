@@ -0,0 +1,65 @@
+package measure
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// closeBinding is the cancellation of a running operation by Close.
+type closeBinding struct {
+	cancel context.CancelFunc
+	// byClose is set when Close cancelled the operation.
+	byClose int32
+}
+
+// closeCanceller holds the operations that Close must cancel.
+type closeCanceller struct {
+	mu        sync.Mutex
+	running   map[*closeBinding]struct{}
+	cancelled bool
+}
+
+// bindClose returns a context derived from ctx that is also cancelled
+// when the wrapper closes without waiting for running operations, and
+// a function to call with the result of the operation once it is done.
+// Operations failing after such a cancellation are counted in
+// close.cancelled_inflight_total.
+func (m *measure) bindClose(ctx context.Context) (context.Context, func(*error)) {
+	ctx, cancel := context.WithCancel(ctx)
+	b := &closeBinding{cancel: cancel}
+	cc := &m.closeCanceller
+	cc.mu.Lock()
+	if cc.cancelled {
+		b.byClose = 1
+		cancel()
+	} else {
+		if cc.running == nil {
+			cc.running = make(map[*closeBinding]struct{})
+		}
+		cc.running[b] = struct{}{}
+	}
+	cc.mu.Unlock()
+	return ctx, func(err *error) {
+		cc.mu.Lock()
+		delete(cc.running, b)
+		cc.mu.Unlock()
+		cancel()
+		if *err != nil && atomic.LoadInt32(&b.byClose) != 0 {
+			m.closeCancelled.Inc()
+		}
+	}
+}
+
+// cancelRunning cancels the contexts of the running operations and of
+// those yet to bind.
+func (m *measure) cancelRunning() {
+	cc := &m.closeCanceller
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.cancelled = true
+	for b := range cc.running {
+		atomic.StoreInt32(&b.byClose, 1)
+		b.cancel()
+	}
+}
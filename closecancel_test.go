@@ -0,0 +1,47 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type ctxWaitBS struct {
+	*testutil.Blockstore
+	started chan struct{}
+}
+
+func (s ctxWaitBS) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	close(s.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCloseCancelsInflight(t *testing.T) {
+	bs := ctxWaitBS{testutil.New(), make(chan struct{})}
+	m := New("cc", bs)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := m.Get(context.Background(), mkBlocks(1)[0].Cid())
+		errc <- err
+	}()
+	<-bs.started
+	m.Close()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not cancelled")
+	}
+	if n := m.Stats().Counters["close.cancelled_inflight_total"]; n != 1 {
+		t.Fatal(n)
+	}
+}
@@ -0,0 +1,219 @@
+// Command bsbench runs synthetic workloads against a blockstore wrapped
+// in measure and reports throughput, latency and error counts taken from
+// the wrapper's stats snapshot.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+
+	measure "github.com/whyrusleeping/go-bs-measure"
+	"github.com/whyrusleeping/go-bs-measure/internal/backend"
+)
+
+var (
+	backendFlag = flag.String("backend", "mem", "backend to benchmark: "+backend.Kinds)
+	pathFlag    = flag.String("path", "", "directory for the flatfs and badger backends")
+	workload    = flag.String("workload", "mixed", "workload to run: put, get or mixed")
+	ops         = flag.Int("ops", 10000, "total number of operations to run")
+	keys        = flag.Int("keys", 1000, "number of blocks preloaded for get and mixed workloads")
+	readRatio   = flag.Float64("read-ratio", 0.9, "fraction of reads in the mixed workload")
+	batch       = flag.Int("batch", 1, "blocks per write; values above 1 use PutMany")
+	minSize     = flag.Int("min-size", 1<<10, "minimum block size in bytes")
+	maxSize     = flag.Int("max-size", 256<<10, "maximum block size in bytes")
+	concurrency = flag.Int("concurrency", 1, "number of concurrent workers")
+	seed        = flag.Int64("seed", 1, "seed for block contents and access patterns")
+	jsonOut     = flag.Bool("json", false, "print the report as JSON")
+)
+
+// ops reported, in order, with the metric names measure uses for them.
+var reportedOps = []string{"put", "putmany", "get", "has", "getsize", "delete", "deletemany", "view"}
+
+type report struct {
+	Backend     string     `json:"backend"`
+	Workload    string     `json:"workload"`
+	Seed        int64      `json:"seed"`
+	Concurrency int        `json:"concurrency"`
+	Elapsed     float64    `json:"elapsed_seconds"`
+	Ops         []opReport `json:"ops"`
+}
+
+type opReport struct {
+	Op         string  `json:"op"`
+	Calls      uint64  `json:"calls"`
+	Errors     uint64  `json:"errors"`
+	Throughput float64 `json:"calls_per_second"`
+	Mean       float64 `json:"latency_mean_ms"`
+	P50        float64 `json:"latency_p50_ms"`
+	P90        float64 `json:"latency_p90_ms"`
+	P99        float64 `json:"latency_p99_ms"`
+}
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "bsbench:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if *minSize <= 0 || *maxSize < *minSize {
+		return fmt.Errorf("invalid block size range [%d, %d]", *minSize, *maxSize)
+	}
+	if *concurrency < 1 || *batch < 1 {
+		return fmt.Errorf("concurrency and batch must be at least 1")
+	}
+
+	ds, err := backend.Open(*backendFlag, *pathFlag)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+	bs := blockstore.NewBlockstore(ds)
+
+	ctx := context.Background()
+	var keyspace []cid.Cid
+	switch *workload {
+	case "put":
+	case "get", "mixed":
+		if *keys < 1 {
+			return fmt.Errorf("%s workload requires at least one key", *workload)
+		}
+		// Preload through the unwrapped store so that setup does not
+		// show up in the report.
+		keyspace, err = preload(ctx, bs, rand.New(rand.NewSource(*seed)), *keys)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown workload %q", *workload)
+	}
+
+	m := measure.New("bsbench", bs)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < *concurrency; w++ {
+		n := *ops / *concurrency
+		if w < *ops%*concurrency {
+			n++
+		}
+		wg.Add(1)
+		go func(w, n int) {
+			defer wg.Done()
+			worker(ctx, m, rand.New(rand.NewSource(*seed+int64(w)+1)), keyspace, n)
+		}(w, n)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	rep := buildReport(m.Stats(), elapsed)
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	return printReport(os.Stdout, rep)
+}
+
+func randomBlock(r *rand.Rand) blocks.Block {
+	size := *minSize
+	if *maxSize > *minSize {
+		size += r.Intn(*maxSize - *minSize + 1)
+	}
+	data := make([]byte, size)
+	r.Read(data)
+	return blocks.NewBlock(data)
+}
+
+func preload(ctx context.Context, bs blockstore.Blockstore, r *rand.Rand, n int) ([]cid.Cid, error) {
+	keyspace := make([]cid.Cid, 0, n)
+	for i := 0; i < n; i++ {
+		blk := randomBlock(r)
+		if err := bs.Put(ctx, blk); err != nil {
+			return nil, fmt.Errorf("preloading: %w", err)
+		}
+		keyspace = append(keyspace, blk.Cid())
+	}
+	return keyspace, nil
+}
+
+// worker runs n operations. Errors are deliberately ignored: they are
+// counted by the measure wrapper and show up in the report.
+func worker(ctx context.Context, bs blockstore.Blockstore, r *rand.Rand, keyspace []cid.Cid, n int) {
+	for i := 0; i < n; i++ {
+		read := false
+		switch *workload {
+		case "get":
+			read = true
+		case "mixed":
+			read = r.Float64() < *readRatio
+		}
+
+		if read {
+			_, _ = bs.Get(ctx, keyspace[r.Intn(len(keyspace))])
+			continue
+		}
+		if *batch == 1 {
+			_ = bs.Put(ctx, randomBlock(r))
+			continue
+		}
+		blks := make([]blocks.Block, *batch)
+		for j := range blks {
+			blks[j] = randomBlock(r)
+		}
+		_ = bs.PutMany(ctx, blks)
+	}
+}
+
+func buildReport(s measure.Stats, elapsed time.Duration) report {
+	rep := report{
+		Backend:     *backendFlag,
+		Workload:    *workload,
+		Seed:        *seed,
+		Concurrency: *concurrency,
+		Elapsed:     elapsed.Seconds(),
+	}
+	for _, op := range reportedOps {
+		calls := uint64(s.Counters[op+"_total"])
+		if calls == 0 {
+			continue
+		}
+		h := s.Histograms[op+".latency_seconds"]
+		rep.Ops = append(rep.Ops, opReport{
+			Op:         op,
+			Calls:      calls,
+			Errors:     uint64(s.Counters[op+".errors_total"]),
+			Throughput: float64(calls) / elapsed.Seconds(),
+			Mean:       h.Mean() * 1e3,
+			P50:        h.Quantile(0.5) * 1e3,
+			P90:        h.Quantile(0.9) * 1e3,
+			P99:        h.Quantile(0.99) * 1e3,
+		})
+	}
+	return rep
+}
+
+func printReport(w io.Writer, rep report) error {
+	fmt.Fprintf(w, "backend=%s workload=%s seed=%d concurrency=%d elapsed=%.3fs\n\n",
+		rep.Backend, rep.Workload, rep.Seed, rep.Concurrency, rep.Elapsed)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tcalls\terrors\tcalls/s\tmean ms\tp50 ms\tp90 ms\tp99 ms\t")
+	for _, o := range rep.Ops {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%.3f\t%.3f\t%.3f\t%.3f\t\n",
+			o.Op, o.Calls, o.Errors, o.Throughput, o.Mean, o.P50, o.P90, o.P99)
+	}
+	return tw.Flush()
+}
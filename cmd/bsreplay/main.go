@@ -0,0 +1,84 @@
+// Command bsreplay replays an operation journal recorded with
+// measure.WithJournal against a candidate backend and reports the
+// latencies it observed.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+
+	"github.com/whyrusleeping/go-bs-measure/internal/backend"
+	"github.com/whyrusleeping/go-bs-measure/replay"
+)
+
+var (
+	journalFlag = flag.String("journal", "", "journal file to replay (- for stdin)")
+	backendFlag = flag.String("backend", "mem", "backend to replay against: "+backend.Kinds)
+	pathFlag    = flag.String("path", "", "directory for the flatfs and badger backends")
+	realTime    = flag.Bool("realtime", false, "keep the recorded gaps between operations")
+)
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "bsreplay:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if *journalFlag == "" {
+		return fmt.Errorf("-journal is required")
+	}
+	in := os.Stdin
+	if *journalFlag != "-" {
+		f, err := os.Open(*journalFlag)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	ds, err := backend.Open(*backendFlag, *pathFlag)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	res, err := replay.Replay(context.Background(), in, blockstore.NewBlockstore(ds),
+		replay.Options{RealTime: *realTime})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("ops=%d missing=%d errors=%d skipped=%d elapsed=%s\n\n",
+		res.Ops, res.Missing, res.Errors, res.Skipped, res.Elapsed)
+	var ops []string
+	for name := range res.Stats.Counters {
+		if strings.HasSuffix(name, "_total") && !strings.Contains(name, ".") {
+			ops = append(ops, strings.TrimSuffix(name, "_total"))
+		}
+	}
+	sort.Strings(ops)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tcalls\terrors\tmean ms\tp50 ms\tp90 ms\tp99 ms\t")
+	for _, op := range ops {
+		calls := res.Stats.Counters[op+"_total"]
+		if calls == 0 {
+			continue
+		}
+		h := res.Stats.Histograms[op+".latency_seconds"]
+		fmt.Fprintf(tw, "%s\t%.0f\t%.0f\t%.3f\t%.3f\t%.3f\t%.3f\t\n", op, calls,
+			res.Stats.Counters[op+".errors_total"], h.Mean()*1e3, h.Quantile(0.5)*1e3, h.Quantile(0.9)*1e3, h.Quantile(0.99)*1e3)
+	}
+	return tw.Flush()
+}
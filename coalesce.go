@@ -0,0 +1,218 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// ErrClosed is returned by operations on a wrapper that has been closed.
+var ErrClosed = errors.New("measure: blockstore is closed")
+
+// WithWriteCoalescing makes Put hand blocks to a background flusher that
+// writes them to the backend with PutMany, once maxBatch blocks are
+// pending or maxDelay has passed since the first of them arrived. Put
+// still returns the backend's error: it blocks until its batch has been
+// written, so durability is unchanged and writes just take up to
+// maxDelay longer, as recorded in coalesce.wait.latency_seconds. Pending
+// blocks are flushed on Close before it returns.
+//
+// At most maxBatch blocks wait to join a batch while one is written;
+// Puts arriving when the queue is full block, which is counted in
+// coalesce.enqueue_blocked_total and timed in
+// coalesce.enqueue.latency_seconds. The number of blocks queued or in
+// the batch being formed is reported in coalesce.queue_depth.
+//
+// It panics if maxBatch is less than 2 or maxDelay is not positive.
+func WithWriteCoalescing(maxBatch int, maxDelay time.Duration) Option {
+	if maxBatch < 2 {
+		panic(fmt.Sprintf("measure: invalid coalescing batch size %d", maxBatch))
+	}
+	if maxDelay <= 0 {
+		panic(fmt.Sprintf("measure: invalid coalescing delay %v", maxDelay))
+	}
+	return func(cfg *config) {
+		cfg.coalesceMaxBatch = maxBatch
+		cfg.coalesceMaxDelay = maxDelay
+	}
+}
+
+type coalesceReq struct {
+	blk      blocks.Block
+	enqueued time.Time
+	done     chan error
+}
+
+type coalescer struct {
+	backend  blockstore.Blockstore
+	clock    Clock
+	maxBatch int
+	maxDelay time.Duration
+
+	flushNum     metrics.Counter
+	flushFull    metrics.Counter
+	flushDelay   metrics.Counter
+	flushClose   metrics.Counter
+	batchSize    metrics.Histogram
+	flushLatency metrics.Histogram
+	wait         metrics.Histogram
+
+	queueDepth     metrics.Gauge
+	enqueueBlocked metrics.Counter
+	enqueueLatency metrics.Histogram
+
+	mu     sync.RWMutex
+	closed bool
+	reqs   chan *coalesceReq
+	done   chan struct{}
+}
+
+func newCoalescer(m *measure, maxBatch int, maxDelay time.Duration) *coalescer {
+	c := &coalescer{
+		backend:  m.backend,
+		clock:    m.clock,
+		maxBatch: maxBatch,
+		maxDelay: maxDelay,
+
+		flushNum:   m.reg.counter("coalesce.flush_total", "Number of coalesced batches written"),
+		flushFull:  m.reg.counter("coalesce.flush.full_total", "Number of coalesced batches written because they were full"),
+		flushDelay: m.reg.counter("coalesce.flush.delay_total", "Number of coalesced batches written because the delay expired"),
+		flushClose: m.reg.counter("coalesce.flush.close_total", "Number of coalesced batches written on close"),
+		batchSize: m.reg.histogram("coalesce.batch_size",
+			"Size distribution of coalesced batches", batchSizeBuckets),
+		flushLatency: m.reg.latency("coalesce.flush.latency",
+			"Latency distribution of coalesced batch writes"),
+		wait: m.reg.latency("coalesce.wait.latency",
+			"Distribution of the time Puts were held before their batch was written"),
+
+		queueDepth: m.reg.gauge("coalesce.queue_depth",
+			"Number of blocks waiting to be written by the coalescer"),
+		enqueueBlocked: m.reg.counter("coalesce.enqueue_blocked_total",
+			"Number of Puts that found the coalescing queue full"),
+		enqueueLatency: m.reg.latency("coalesce.enqueue.latency",
+			"Distribution of the time Puts waited for room in a full coalescing queue"),
+
+		reqs: make(chan *coalesceReq, maxBatch),
+		done: make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// put queues blk and waits until it has been written.
+func (c *coalescer) put(ctx context.Context, blk blocks.Block) error {
+	req := &coalesceReq{blk: blk, enqueued: c.clock.Now(), done: make(chan error, 1)}
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return ErrClosed
+	}
+	c.queueDepth.Inc()
+	select {
+	case c.reqs <- req:
+	default:
+		c.enqueueBlocked.Inc()
+		select {
+		case c.reqs <- req:
+			recordLatency(c.clock, c.enqueueLatency, req.enqueued)
+		case <-ctx.Done():
+			c.mu.RUnlock()
+			c.queueDepth.Dec()
+			recordLatency(c.clock, c.enqueueLatency, req.enqueued)
+			return ctx.Err()
+		}
+	}
+	c.mu.RUnlock()
+
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		// The block may still be written with its batch.
+		return ctx.Err()
+	}
+}
+
+func (c *coalescer) run() {
+	defer close(c.done)
+
+	// Each batch gets its own timer, so a stopped timer that already
+	// fired can't cut the next batch short.
+	var (
+		batch []*coalesceReq
+		timer *time.Timer
+		delay <-chan time.Time
+	)
+	for {
+		select {
+		case req, ok := <-c.reqs:
+			if !ok {
+				if timer != nil {
+					timer.Stop()
+				}
+				c.flush(batch, c.flushClose)
+				return
+			}
+			batch = append(batch, req)
+			if len(batch) == 1 {
+				timer = time.NewTimer(c.maxDelay)
+				delay = timer.C
+			}
+			if len(batch) >= c.maxBatch {
+				timer.Stop()
+				timer, delay = nil, nil
+				c.flush(batch, c.flushFull)
+				batch = nil
+			}
+		case <-delay:
+			timer, delay = nil, nil
+			c.flush(batch, c.flushDelay)
+			batch = nil
+		}
+	}
+}
+
+// flush writes batch, counting the flush in reason.
+func (c *coalescer) flush(batch []*coalesceReq, reason metrics.Counter) {
+	if len(batch) == 0 {
+		return
+	}
+	start := c.clock.Now()
+	blks := make([]blocks.Block, len(batch))
+	for i, req := range batch {
+		blks[i] = req.blk
+		recordLatency(c.clock, c.wait, req.enqueued)
+	}
+
+	c.flushNum.Inc()
+	reason.Inc()
+	c.batchSize.Observe(float64(len(blks)))
+	// The batch mixes blocks from several callers, so none of their
+	// contexts applies to it.
+	err := c.backend.PutMany(context.Background(), blks)
+	recordLatency(c.clock, c.flushLatency, start)
+	c.queueDepth.Sub(float64(len(blks)))
+
+	for _, req := range batch {
+		req.done <- err
+	}
+}
+
+// close stops accepting blocks and flushes the pending ones.
+func (c *coalescer) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.reqs)
+	c.mu.Unlock()
+	<-c.done
+}
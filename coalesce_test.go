@@ -0,0 +1,150 @@
+package measure
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestCoalesce(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	m := New("test", fb, WithWriteCoalescing(4, time.Hour))
+	var wg sync.WaitGroup
+	for _, b := range mkBlocks(4) {
+		wg.Add(1)
+		go func(b blocks.Block) {
+			defer wg.Done()
+			if err := m.Put(ctx, b); err != nil {
+				t.Error(err)
+			}
+		}(b)
+	}
+	wg.Wait()
+	if fb.Count(testutil.PutMany) != 1 || fb.Count(testutil.Put) != 0 || fb.Len() != 4 {
+		t.Fatalf("backend saw %v", fb.Calls())
+	}
+	if got := statCounter(m, "coalesce.flush.full_total"); got != 1 {
+		t.Fatalf("coalesce.flush.full_total = %v, want 1", got)
+	}
+
+	// Close flushes a partial batch, even though the waiting Put has its
+	// context cancelled.
+	done := make(chan error, 1)
+	go func() { done <- m.Put(ctx, blocks.NewBlock([]byte("pending"))) }()
+	waitGauge(t, m, "coalesce.queue_depth", 1)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if fb.Len() != 5 {
+		t.Fatalf("backend holds %d blocks, want 5", fb.Len())
+	}
+	if got := statCounter(m, "coalesce.flush.close_total"); got != 1 {
+		t.Fatalf("coalesce.flush.close_total = %v, want 1", got)
+	}
+	if err := m.Put(ctx, blocks.NewBlock([]byte("late"))); err != ErrClosed {
+		t.Fatalf("got %v after Close, want ErrClosed", err)
+	}
+}
+
+// TestCoalesceDelay checks that a batch following full ones still waits
+// for the delay to expire.
+func TestCoalesceDelay(t *testing.T) {
+	ctx := context.Background()
+	const delay = 50 * time.Millisecond
+	fb := testutil.New()
+	m := New("test", fb, WithWriteCoalescing(2, delay))
+	defer m.Close()
+	blks := mkBlocks(9)
+
+	for i := 0; i < 8; i += 2 {
+		var wg sync.WaitGroup
+		for _, b := range blks[i : i+2] {
+			wg.Add(1)
+			go func(b blocks.Block) {
+				defer wg.Done()
+				m.Put(ctx, b)
+			}(b)
+		}
+		wg.Wait()
+	}
+	start := time.Now()
+	if err := m.Put(ctx, blks[8]); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < delay {
+		t.Fatalf("lone Put flushed after %s, before the %s delay", d, delay)
+	}
+	if got := statCounter(m, "coalesce.flush.delay_total"); got < 1 {
+		t.Fatalf("coalesce.flush.delay_total = %v, want at least 1", got)
+	}
+	if fb.Len() != 9 {
+		t.Fatalf("backend holds %d blocks, want 9", fb.Len())
+	}
+}
+
+func TestCoalesceBackpressure(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	fb.SetLatency(testutil.PutMany, testutil.Fixed(100*time.Millisecond))
+	m := New("test", fb, WithWriteCoalescing(2, time.Millisecond))
+	defer m.Close()
+
+	var wg sync.WaitGroup
+	for _, b := range mkBlocks(6) {
+		wg.Add(1)
+		go func(b blocks.Block) {
+			defer wg.Done()
+			if err := m.Put(ctx, b); err != nil {
+				t.Error(err)
+			}
+		}(b)
+	}
+	wg.Wait()
+	if got := statCounter(m, "coalesce.enqueue_blocked_total"); got == 0 {
+		t.Fatal("no Put found the queue full")
+	}
+	if got := statCount(m, "coalesce.enqueue.latency_seconds"); got == 0 {
+		t.Fatal("no enqueue latency recorded")
+	}
+	if got := statGauge(m, "coalesce.queue_depth"); got != 0 {
+		t.Fatalf("coalesce.queue_depth = %v, want 0", got)
+	}
+	if fb.Len() != 6 {
+		t.Fatalf("backend holds %d blocks, want 6", fb.Len())
+	}
+}
+
+func TestCoalesceInvalid(t *testing.T) {
+	for name, f := range map[string]func(){
+		"batch of one": func() { WithWriteCoalescing(1, time.Millisecond) },
+		"no delay":     func() { WithWriteCoalescing(4, 0) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+// waitGauge waits for the named gauge to reach v.
+func waitGauge(t *testing.T, m *measure, name string, v float64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for statGauge(m, name) != v {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %v, want %v", name, statGauge(m, name), v)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,95 @@
+package measure
+
+import (
+	"fmt"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithCodecSizes breaks the blocks written by Put and PutMany down by the
+// codec of their CID: put.codec.<codec>.blocks_total and
+// put.codec.<codec>.bytes_total count them and their bytes, and the
+// put.codec.<codec>.avg_size_bytes gauge holds their average size. This shows for example how much smaller dag-cbor
+// blocks are than dag-pb ones. Common codecs are named as in the
+// multicodec table, others by their hexadecimal code.
+func WithCodecSizes() Option {
+	return func(cfg *config) {
+		cfg.codecSizes = true
+	}
+}
+
+type codecSizes struct {
+	reg *registry
+
+	mu      sync.Mutex
+	byCodec map[uint64]*codecSize
+}
+
+type codecSize struct {
+	n, bytes int64
+
+	blocks  metrics.Counter
+	written metrics.Counter
+	avg     metrics.Gauge
+}
+
+func newCodecSizes(r *registry) *codecSizes {
+	return &codecSizes{reg: r, byCodec: make(map[uint64]*codecSize)}
+}
+
+// codecNames names the common codecs, as in the multicodec table.
+var codecNames = map[uint64]string{
+	cid.Raw:         "raw",
+	cid.DagProtobuf: "dag-pb",
+	cid.DagCBOR:     "dag-cbor",
+	cid.DagJSON:     "dag-json",
+	cid.Libp2pKey:   "libp2p-key",
+	cid.GitRaw:      "git-raw",
+	cid.DagJOSE:     "dag-jose",
+}
+
+// codecName returns the name of codec used in metric names.
+func codecName(codec uint64) string {
+	if name, ok := codecNames[codec]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", codec)
+}
+
+// get returns the sizes of codec, creating them on first use. c.mu must
+// be held.
+func (c *codecSizes) get(codec uint64) *codecSize {
+	s, ok := c.byCodec[codec]
+	if !ok {
+		name := "put.codec." + codecName(codec)
+		s = &codecSize{
+			blocks:  c.reg.counter(name+".blocks_total", "Number of blocks of one codec written"),
+			written: c.reg.counter(name+".bytes_total", "Number of bytes written in blocks of one codec"),
+			avg:     c.reg.gauge(name+".avg_size_bytes", "Average size of the written blocks of one codec"),
+		}
+		c.byCodec[codec] = s
+	}
+	return s
+}
+
+// observeCodecSizes counts blks, just written, by codec.
+func (m *measure) observeCodecSizes(blks ...blocks.Block) {
+	c := m.codecSizes
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, blk := range blks {
+		s := c.get(blk.Cid().Type())
+		size := len(blk.RawData())
+		s.n++
+		s.bytes += int64(size)
+		s.blocks.Inc()
+		s.written.Add(float64(size))
+		s.avg.Set(float64(s.bytes) / float64(s.n))
+	}
+}
@@ -0,0 +1,35 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func codecBlock(t *testing.T, codec uint64, data string) blocks.Block {
+	c, err := cid.Prefix{Version: 1, Codec: codec, MhType: 0x12, MhLength: -1}.Sum([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blk, _ := blocks.NewBlockWithCid([]byte(data), c)
+	return blk
+}
+
+func TestCodecSizes(t *testing.T) {
+	ctx := context.Background()
+	m := New("cs", testutil.New(), WithCodecSizes())
+	m.Put(ctx, codecBlock(t, cid.DagCBOR, "ab"))
+	m.Put(ctx, codecBlock(t, cid.DagCBOR, "abcd"))
+	m.PutMany(ctx, []blocks.Block{codecBlock(t, cid.Raw, "0123456789"), codecBlock(t, cid.Raw, "01234567890123456789")})
+	s := m.Stats()
+	if s.Gauges["put.codec.dag-cbor.avg_size_bytes"] != 3 || s.Gauges["put.codec.raw.avg_size_bytes"] != 15 {
+		t.Fatal(s.Gauges)
+	}
+	if s.Counters["put.codec.raw.bytes_total"] != 30 || s.Counters["put.codec.dag-cbor.blocks_total"] != 2 {
+		t.Fatal(s.Counters)
+	}
+}
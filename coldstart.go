@@ -0,0 +1,57 @@
+package measure
+
+import (
+	"sync/atomic"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// coldStart diverts the first latency observation of each operation type
+// to cold_start.latency_seconds, keeping warmup costs such as opening
+// files or filling backend caches out of the steady-state histograms.
+type coldStart struct {
+	latency metrics.Histogram
+	ops     []*coldHistogram
+}
+
+func newColdStart(r *registry) *coldStart {
+	return &coldStart{
+		latency: r.latency("cold_start.latency",
+			"Latency distribution of the first operation of each type"),
+	}
+}
+
+// wrap returns h with its first observation going to the cold start
+// histogram instead.
+func (cs *coldStart) wrap(h metrics.Histogram) metrics.Histogram {
+	ch := &coldHistogram{Histogram: h, cold: cs.latency}
+	cs.ops = append(cs.ops, ch)
+	return ch
+}
+
+type coldHistogram struct {
+	metrics.Histogram
+	cold metrics.Histogram
+	seen int32
+}
+
+func (h *coldHistogram) Observe(v float64) {
+	h.target().Observe(v)
+}
+
+// target returns the histogram the next observation goes to.
+func (h *coldHistogram) target() metrics.Histogram {
+	if atomic.CompareAndSwapInt32(&h.seen, 0, 1) {
+		return h.cold
+	}
+	return h.Histogram
+}
+
+// ResetColdStart makes the next operation of each type count as a cold
+// start again, for example after the backend was reopened or its caches
+// dropped.
+func (m *measure) ResetColdStart() {
+	for _, h := range m.coldStart.ops {
+		atomic.StoreInt32(&h.seen, 0)
+	}
+}
@@ -0,0 +1,28 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestColdStart(t *testing.T) {
+	ctx := context.Background()
+	m := New("cs", testutil.New())
+	c := blocks.NewBlock([]byte("x")).Cid()
+	m.Get(ctx, c)
+	m.Get(ctx, c)
+	m.Get(ctx, c)
+	st := m.Stats()
+	if st.Histograms["cold_start.latency_seconds"].Count != 1 || st.Histograms["get.latency_seconds"].Count != 2 {
+		t.Fatal(st.Histograms)
+	}
+	m.ResetColdStart()
+	m.Get(ctx, c)
+	if m.Stats().Histograms["cold_start.latency_seconds"].Count != 2 {
+		t.Fatal("reset")
+	}
+}
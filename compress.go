@@ -0,0 +1,381 @@
+package measure
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// Compressor compresses block data for WithCompression.
+type Compressor interface {
+	// ID identifies the compressor in stored values. It must never
+	// change, and must differ between compressors used on one store.
+	ID() byte
+	Compress(data []byte) ([]byte, error)
+	// Decompress returns the size bytes compressed in data.
+	Decompress(data []byte, size int) ([]byte, error)
+}
+
+// CompressionOption configures WithCompression.
+type CompressionOption func(*compressionConfig)
+
+type compressionConfig struct {
+	compressor    Compressor
+	decompressors map[byte]Compressor
+	logicalSizes  bool
+}
+
+// LogicalSizes makes GetSize report the uncompressed size of blocks,
+// at the cost of reading the stored value instead of only its size.
+func LogicalSizes() CompressionOption {
+	return func(cfg *compressionConfig) {
+		cfg.logicalSizes = true
+	}
+}
+
+// AlsoDecompress lets the wrapper read values written with other
+// compressors, for stores moving from one compressor to another.
+func AlsoDecompress(cs ...Compressor) CompressionOption {
+	return func(cfg *compressionConfig) {
+		for _, c := range cs {
+			cfg.decompressors[c.ID()] = c
+		}
+	}
+}
+
+// WithCompression stores block data compressed with c. Values are
+// stored with a small header naming the compressor and are decompressed
+// transparently when read, so callers always see the data matching the
+// CID. Values that don't shrink are stored as they are.
+//
+// Values stored without compression, such as those written before
+// compression was enabled, are read as they are, so an existing store
+// can turn compression on and keep working; reads of such values are
+// counted in compression.raw_reads_total, which tells how much of the
+// store is left uncompressed. Blocks are only compressed when written.
+//
+// The compression ratio of written blocks (stored size over block size)
+// is observed in compression.ratio, the bytes saved counted in
+// compression.saved_bytes_total, and the time spent in
+// compression.compress.latency and compression.decompress.latency.
+//
+// The backend sees the compressed values, so its own HashOnRead must be
+// left disabled: HashOnRead on the wrapper checks the data after
+// decompression instead. GetSize reports the stored size unless
+// LogicalSizes is given. TTL writes aren't passed to the backend, and
+// are only supported with WithExpiry.
+//
+// Flate is a compressor from the standard library. Others, such as
+// zstd, are plugged in by implementing Compressor.
+func WithCompression(c Compressor, opts ...CompressionOption) Option {
+	return func(cfg *config) {
+		cfg.compression = &compressionConfig{
+			compressor:    c,
+			decompressors: map[byte]Compressor{c.ID(): c},
+		}
+		for _, o := range opts {
+			o(cfg.compression)
+		}
+	}
+}
+
+// compressedMagic starts every compressed value. It is followed by the
+// compressor ID and the uncompressed size as a uvarint.
+var compressedMagic = []byte{0xff, 'B', 'Z'}
+
+var errUnknownCompressor = errors.New("measure: value compressed with an unknown compressor")
+
+// compressedStore compresses the values of the blockstore it wraps.
+type compressedStore struct {
+	blockstore.Blockstore
+	cfg        compressionConfig
+	hashOnRead bool
+	clock      Clock
+
+	ratio             metrics.Histogram
+	saved             metrics.Counter
+	rawReads          metrics.Counter
+	compressLatency   metrics.Histogram
+	decompressLatency metrics.Histogram
+}
+
+var compressionRatioBuckets = []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1}
+
+func newCompressedStore(r *registry, bs blockstore.Blockstore, cfg compressionConfig) *compressedStore {
+	return &compressedStore{
+		Blockstore: bs,
+		cfg:        cfg,
+		clock:      r.clock,
+		ratio: r.histogram("compression.ratio",
+			"Distribution of the stored size of written blocks over their size", compressionRatioBuckets),
+		saved:    r.counter("compression.saved_bytes_total", "Bytes saved by compressing written blocks"),
+		rawReads: r.counter("compression.raw_reads_total", "Number of reads of values stored uncompressed"),
+		compressLatency: r.latency("compression.compress.latency",
+			"Latency distribution of compressing a block"),
+		decompressLatency: r.latency("compression.decompress.latency",
+			"Latency distribution of decompressing a block"),
+	}
+}
+
+func (s *compressedStore) Unwrap() blockstore.Blockstore {
+	return s.Blockstore
+}
+
+// encode returns the block to store for blk.
+func (s *compressedStore) encode(blk blocks.Block) (blocks.Block, error) {
+	data := blk.RawData()
+	start := s.clock.Now()
+	compressed, err := s.cfg.compressor.Compress(data)
+	recordLatency(s.clock, s.compressLatency, start)
+	if err != nil {
+		return nil, err
+	}
+	hdr := make([]byte, len(compressedMagic)+1+binary.MaxVarintLen64)
+	n := copy(hdr, compressedMagic)
+	hdr[n] = s.cfg.compressor.ID()
+	n++
+	n += binary.PutUvarint(hdr[n:], uint64(len(data)))
+
+	if n+len(compressed) >= len(data) && !bytes.HasPrefix(data, compressedMagic) {
+		if len(data) > 0 {
+			s.ratio.Observe(1)
+		}
+		return blk, nil
+	}
+	stored := make([]byte, 0, n+len(compressed))
+	stored = append(append(stored, hdr[:n]...), compressed...)
+	if len(data) > 0 {
+		s.ratio.Observe(float64(len(stored)) / float64(len(data)))
+	}
+	if len(stored) < len(data) {
+		s.saved.Add(float64(len(data) - len(stored)))
+	}
+	return blocks.NewBlockWithCid(stored, blk.Cid())
+}
+
+// header parses the header of a stored value. ok is false for values
+// stored uncompressed.
+func (s *compressedStore) header(stored []byte) (c Compressor, size, n int, ok bool, err error) {
+	if !bytes.HasPrefix(stored, compressedMagic) || len(stored) <= len(compressedMagic) {
+		return nil, len(stored), 0, false, nil
+	}
+	id := stored[len(compressedMagic)]
+	c, known := s.cfg.decompressors[id]
+	if !known {
+		return nil, 0, 0, false, errUnknownCompressor
+	}
+	v, vn := binary.Uvarint(stored[len(compressedMagic)+1:])
+	if vn <= 0 {
+		return nil, 0, 0, false, errors.New("measure: corrupt compressed value header")
+	}
+	return c, int(v), len(compressedMagic) + 1 + vn, true, nil
+}
+
+// decode returns the block data stored for c.
+func (s *compressedStore) decode(c cid.Cid, stored []byte) ([]byte, error) {
+	comp, size, n, ok, err := s.header(stored)
+	data := stored
+	if err == nil && ok {
+		start := s.clock.Now()
+		data, err = comp.Decompress(stored[n:], size)
+		recordLatency(s.clock, s.decompressLatency, start)
+	}
+	if err != nil {
+		// An uncompressed value that happens to start like a
+		// compressed one, written before compression was enabled.
+		if h, herr := c.Prefix().Sum(stored); herr != nil || !h.Equals(c) {
+			return nil, err
+		}
+		data, ok = stored, false
+	}
+	if !ok {
+		s.rawReads.Inc()
+	}
+	if s.hashOnRead {
+		if h, err := c.Prefix().Sum(data); err != nil || !h.Equals(c) {
+			return nil, blockstore.ErrHashMismatch
+		}
+	}
+	return data, nil
+}
+
+func (s *compressedStore) Put(ctx context.Context, blk blocks.Block) error {
+	stored, err := s.encode(blk)
+	if err != nil {
+		return err
+	}
+	return s.Blockstore.Put(ctx, stored)
+}
+
+func (s *compressedStore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	stored := make([]blocks.Block, len(blks))
+	for i, blk := range blks {
+		var err error
+		if stored[i], err = s.encode(blk); err != nil {
+			return err
+		}
+	}
+	return s.Blockstore.PutMany(ctx, stored)
+}
+
+// PutWithTTL compresses blk and writes it with the backend's
+// PutWithTTL.
+func (s *compressedStore) PutWithTTL(ctx context.Context, blk blocks.Block, ttl time.Duration) error {
+	tp, ok := s.Blockstore.(ttlPutter)
+	if !ok {
+		return ErrTTLUnsupported
+	}
+	stored, err := s.encode(blk)
+	if err != nil {
+		return err
+	}
+	return tp.PutWithTTL(ctx, stored, ttl)
+}
+
+func (s *compressedStore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := s.Blockstore.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.decode(c, blk.RawData())
+	if err != nil {
+		return nil, err
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
+
+func (s *compressedStore) View(ctx context.Context, c cid.Cid, f func([]byte) error) error {
+	v, ok := s.Blockstore.(bsViewer)
+	if !ok {
+		blk, err := s.Get(ctx, c)
+		if err != nil {
+			return err
+		}
+		return f(blk.RawData())
+	}
+	return v.View(ctx, c, func(stored []byte) error {
+		data, err := s.decode(c, stored)
+		if err != nil {
+			return err
+		}
+		return f(data)
+	})
+}
+
+func (s *compressedStore) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	if !s.cfg.logicalSizes {
+		return s.Blockstore.GetSize(ctx, c)
+	}
+	size := -1
+	read := func(stored []byte) error {
+		_, n, _, _, err := s.header(stored)
+		size = n
+		return err
+	}
+	if v, ok := s.Blockstore.(bsViewer); ok {
+		if err := v.View(ctx, c, read); err != nil {
+			return -1, err
+		}
+		return size, nil
+	}
+	blk, err := s.Blockstore.Get(ctx, c)
+	if err != nil {
+		return -1, err
+	}
+	if err := read(blk.RawData()); err != nil {
+		return -1, err
+	}
+	return size, nil
+}
+
+func (s *compressedStore) HashOnRead(enabled bool) {
+	s.hashOnRead = enabled
+}
+
+func (s *compressedStore) DeleteMany(ctx context.Context, cids []cid.Cid) error {
+	if dm, ok := s.Blockstore.(batchDeleter); ok {
+		return dm.DeleteMany(ctx, cids)
+	}
+	for _, c := range cids {
+		if err := s.Blockstore.DeleteBlock(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *compressedStore) CreatedAt(ctx context.Context, c cid.Cid) (time.Time, error) {
+	if ct, ok := s.Blockstore.(CreationTimer); ok {
+		return ct.CreatedAt(ctx, c)
+	}
+	return time.Time{}, nil
+}
+
+// AllKeysShard passes shards through to the backend, or lists all keys
+// in shard 0 if it can't enumerate shards.
+func (s *compressedStore) AllKeysShard(ctx context.Context, shard, shards int) (<-chan cid.Cid, error) {
+	if sl, ok := s.Blockstore.(shardedKeyLister); ok {
+		return sl.AllKeysShard(ctx, shard, shards)
+	}
+	if shard == 0 {
+		return s.Blockstore.AllKeysChan(ctx)
+	}
+	ch := make(chan cid.Cid)
+	close(ch)
+	return ch, nil
+}
+
+func (s *compressedStore) Close() error {
+	if c, ok := s.Blockstore.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// flateCompressor is the Compressor returned by Flate.
+type flateCompressor int
+
+// Flate returns a Compressor using DEFLATE at the given level, see
+// compress/flate.
+func Flate(level int) Compressor {
+	return flateCompressor(level)
+}
+
+func (flateCompressor) ID() byte { return 1 }
+
+func (l flateCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, int(l))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (flateCompressor) Decompress(data []byte, size int) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, int64(size)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) != size {
+		return nil, errors.New("measure: decompressed value has the wrong size")
+	}
+	return out, nil
+}
@@ -0,0 +1,112 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestCompression(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	raw := blocks.NewBlock([]byte("old raw value"))
+	fb.Put(ctx, raw)
+	m := New("test", fb, WithCompression(Flate(5), LogicalSizes()))
+	data := bytes.Repeat([]byte(`{"hello":"world"},`), 200)
+	blk := blocks.NewBlock(data)
+
+	if err := m.Put(ctx, blk); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := fb.Get(ctx, blk.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.RawData()) >= len(data) {
+		t.Fatalf("stored %d bytes for %d", len(stored.RawData()), len(data))
+	}
+	got, err := m.Get(ctx, blk.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.RawData(), data) {
+		t.Fatal("Get returned other data")
+	}
+	err = m.View(ctx, blk.Cid(), func(d []byte) error {
+		if !bytes.Equal(d, data) {
+			t.Fatal("View returned other data")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Values written before compression was enabled are read as is.
+	got, err = m.Get(ctx, raw.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.RawData(), raw.RawData()) {
+		t.Fatal("uncompressed value altered")
+	}
+	m.HashOnRead(true)
+	if _, err := m.Get(ctx, blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if got := statCounter(m, "compression.raw_reads_total"); got != 1 {
+		t.Fatalf("compression.raw_reads_total = %v, want 1", got)
+	}
+	if got := statCounter(m, "compression.saved_bytes_total"); got <= 0 {
+		t.Fatalf("compression.saved_bytes_total = %v", got)
+	}
+	if got := statCount(m, "compression.ratio"); got != 1 {
+		t.Fatalf("%d compression ratios, want 1", got)
+	}
+
+	// Raw data starting like a compressed value round trips.
+	odd := blocks.NewBlock([]byte{0xff, 'B', 'Z', 9, 'x'})
+	if err := m.Put(ctx, odd); err != nil {
+		t.Fatal(err)
+	}
+	got, err = m.Get(ctx, odd.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.RawData(), odd.RawData()) {
+		t.Fatal("magic-prefixed value altered")
+	}
+}
+
+func TestCompressionLogicalSizes(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("abc"), 1000)
+	blk := blocks.NewBlock(data)
+	missing := mkBlocks(1)[0]
+	for _, tc := range []struct {
+		name    string
+		backend blockstore.Blockstore
+	}{
+		{"view", testutil.New()},
+		{"get", testutil.New().Plain()},
+	} {
+		m := New("test", tc.backend, WithCompression(Flate(5), LogicalSizes()))
+		m.Put(ctx, blk)
+		size, err := m.GetSize(ctx, blk.Cid())
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if size != len(data) {
+			t.Fatalf("%s: GetSize = %d, want %d", tc.name, size, len(data))
+		}
+		if size, err := m.GetSize(ctx, missing.Cid()); !format.IsNotFound(err) || size != -1 {
+			t.Fatalf("%s: GetSize of a missing block = %d, %v", tc.name, size, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package measure
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// Concurrency levels of WithConcurrencyLatency, with the number of
+// operations in flight they cover.
+var concurrencyLevels = []struct {
+	name string
+	max  int64 // inclusive, 0 for no limit
+}{
+	{"1", 1},
+	{"2to4", 4},
+	{"5to16", 16},
+	{"17to64", 64},
+	{"65plus", 0},
+}
+
+// WithConcurrencyLatency also records the latency of Put, Get, Has,
+// GetSize and View calls by the number of operations in flight on the
+// wrapper when they completed, themselves included, in
+// <op>.concurrency_<level>.latency_seconds for the levels 1, 2to4,
+// 5to16, 17to64 and 65plus. Comparing the levels shows whether the
+// backend scales or contends under load. The aggregate histograms are
+// unchanged.
+func WithConcurrencyLatency() Option {
+	return func(cfg *config) {
+		cfg.concurrencyLatency = true
+	}
+}
+
+// newConcurrencyLatencies returns the histograms of
+// WithConcurrencyLatency, indexed like concurrencyLevels.
+func newConcurrencyLatencies(r *registry) map[Op][]metrics.Histogram {
+	hs := make(map[Op][]metrics.Histogram)
+	for _, op := range []Op{OpPut, OpGet, OpHas, OpGetSize, OpView} {
+		for _, level := range concurrencyLevels {
+			hs[op] = append(hs[op], r.latency(string(op)+".concurrency_"+level.name+".latency",
+				"Latency distribution of calls completed at one level of concurrency"))
+		}
+	}
+	return hs
+}
+
+// observeConcurrency records the latency of op in the histogram of the
+// current concurrency level.
+func (m *measure) observeConcurrency(op Op, start time.Time) {
+	if m.concurrencyLatencies == nil {
+		return
+	}
+	hs, ok := m.concurrencyLatencies[op]
+	if !ok {
+		return
+	}
+	n := atomic.LoadInt64(&m.life.inflight)
+	for i, level := range concurrencyLevels {
+		if level.max == 0 || n <= level.max {
+			recordLatency(m.clock, hs[i], start)
+			return
+		}
+	}
+}
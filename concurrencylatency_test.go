@@ -0,0 +1,52 @@
+package measure
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type gatedGetBS struct {
+	*testutil.Blockstore
+	gate chan struct{}
+}
+
+func (g gatedGetBS) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	<-g.gate
+	return g.Blockstore.Get(ctx, c)
+}
+
+func TestConcurrencyLatency(t *testing.T) {
+	ctx := context.Background()
+	bs := gatedGetBS{testutil.New(), make(chan struct{})}
+	m := New("cl", bs, WithConcurrencyLatency())
+	b := mkBlocks(1)[0]
+	bs.Blockstore.Put(ctx, b)
+	// cold start takes the first one
+	go func() { bs.gate <- struct{}{}; bs.gate <- struct{}{} }()
+	m.Get(ctx, b.Cid())
+	m.Get(ctx, b.Cid())
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Get(ctx, b.Cid())
+		}()
+	}
+	for m.Stats().Gauges["inflight"] < 8 {
+		time.Sleep(time.Millisecond)
+	}
+	close(bs.gate)
+	wg.Wait()
+	s := m.Stats()
+	if s.Histograms["get.concurrency_1.latency_seconds"].Count == 0 || s.Histograms["get.concurrency_5to16.latency_seconds"].Count == 0 {
+		t.Fatal(s.Histograms["get.concurrency_1.latency_seconds"], s.Histograms["get.concurrency_5to16.latency_seconds"])
+	}
+}
@@ -0,0 +1,87 @@
+package measure
+
+import (
+	"context"
+	"errors"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+// ErrConflict is returned, possibly wrapped, by backends that reject a
+// PutMany conflicting with a concurrent one.
+var ErrConflict = errors.New("measure: write conflicts with a concurrent one")
+
+// ConflictError is implemented by conflict errors that tell which blocks
+// of the batch conflicted, the others having been written.
+type ConflictError interface {
+	error
+	ConflictingCids() []cid.Cid
+}
+
+// WithConflictRetries makes PutMany retry up to n times when the backend
+// reports a conflict, writing again only the conflicting blocks if the
+// error is a ConflictError and the whole batch otherwise.
+//
+// Whether retried or not, every conflict is counted in
+// putmany.conflict_total, and a PutMany failing with one is counted
+// there rather than in putmany.errors_total.
+func WithConflictRetries(n int) Option {
+	return func(cfg *config) {
+		cfg.conflictRetries = n
+	}
+}
+
+// isConflict reports whether err is a write conflict.
+func isConflict(err error) bool {
+	var ce ConflictError
+	return errors.Is(err, ErrConflict) || errors.As(err, &ce)
+}
+
+// retryConflicts counts the conflict reported by err, the result of
+// writing blks, and retries the conflicting blocks as configured. It
+// returns the error of the last attempt.
+func (m *measure) retryConflicts(ctx context.Context, blks []blocks.Block, err error) error {
+	for i := 0; isConflict(err); i++ {
+		m.reg.counter("putmany.conflict_total", "Number of PutMany calls rejected by the backend for conflicting with a concurrent one").Inc()
+		if i >= m.conflictRetries {
+			break
+		}
+		err = m.backend.PutMany(ctx, conflicting(blks, err))
+	}
+	return err
+}
+
+// conflicting returns the blocks of blks err reports as conflicting, or
+// all of them if it doesn't tell.
+func conflicting(blks []blocks.Block, err error) []blocks.Block {
+	var ce ConflictError
+	if !errors.As(err, &ce) {
+		return blks
+	}
+	cids := ce.ConflictingCids()
+	if len(cids) == 0 {
+		return blks
+	}
+	set := make(map[cid.Cid]struct{}, len(cids))
+	for _, c := range cids {
+		set[c] = struct{}{}
+	}
+	var out []blocks.Block
+	for _, blk := range blks {
+		if _, ok := set[blk.Cid()]; ok {
+			out = append(out, blk)
+		}
+	}
+	return out
+}
+
+// countPutManyError is countError for PutMany, leaving out conflicts,
+// already counted by retryConflicts.
+func (m *measure) countPutManyError(err error) {
+	if isConflict(err) {
+		m.noteError(OpPutMany, cid.Undef, err)
+		return
+	}
+	m.countError(OpPutMany, m.putManyErr, cid.Undef, err)
+}
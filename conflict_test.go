@@ -0,0 +1,56 @@
+package measure
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type conflictErr struct{ cids []cid.Cid }
+
+func (e conflictErr) Error() string              { return "conflict" }
+func (e conflictErr) ConflictingCids() []cid.Cid { return e.cids }
+
+type conflictBS struct {
+	*testutil.Blockstore
+	failures int
+	batches  [][]blocks.Block
+}
+
+func (c *conflictBS) PutMany(ctx context.Context, blks []blocks.Block) error {
+	c.batches = append(c.batches, blks)
+	if c.failures > 0 {
+		c.failures--
+		return fmt.Errorf("backend: %w", conflictErr{[]cid.Cid{blks[0].Cid()}})
+	}
+	return c.Blockstore.PutMany(ctx, blks)
+}
+
+func TestPutManyConflict(t *testing.T) {
+	ctx := context.Background()
+	blks := mkBlocks(3)
+
+	bs := &conflictBS{Blockstore: testutil.New(), failures: 1}
+	m := New("cf", bs)
+	if err := m.PutMany(ctx, blks); !isConflict(err) {
+		t.Fatal(err)
+	}
+	s := m.Stats()
+	if s.Counters["putmany.conflict_total"] != 1 || s.Counters["putmany.errors_total"] != 0 {
+		t.Fatal(s.Counters)
+	}
+
+	bs = &conflictBS{Blockstore: testutil.New(), failures: 1}
+	m = New("cf2", bs, WithConflictRetries(2))
+	if err := m.PutMany(ctx, blks); err != nil {
+		t.Fatal(err)
+	}
+	if m.Stats().Counters["putmany.conflict_total"] != 1 || len(bs.batches) != 2 || len(bs.batches[1]) != 1 {
+		t.Fatal(m.Stats().Counters, bs.batches)
+	}
+}
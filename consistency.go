@@ -0,0 +1,53 @@
+package measure
+
+import (
+	"context"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// Consistency is a read consistency level of a backend replicating
+// blocks.
+type Consistency string
+
+const (
+	// ConsistencyLocal reads from the nearest replica.
+	ConsistencyLocal Consistency = "local"
+	// ConsistencyQuorum reads from a quorum of replicas.
+	ConsistencyQuorum Consistency = "quorum"
+)
+
+// ConsistentGetter is implemented by backends with tunable read
+// consistency.
+type ConsistentGetter interface {
+	GetWithConsistency(ctx context.Context, c cid.Cid, level Consistency) (blocks.Block, error)
+}
+
+// GetWithConsistency reads the block c at the consistency level when the
+// backend is a ConsistentGetter, and with Get, recorded as such,
+// otherwise. Calls are counted in get.consistency_<level>_total and
+// timed in get.consistency_<level>.latency_seconds, with the level
+// "default" for the Get fallback, showing the latency cost of stronger
+// consistency. Failures other than not-found are counted in
+// get.consistency_<level>.errors_total.
+func (m *measure) GetWithConsistency(ctx context.Context, c cid.Cid, level Consistency) (blk blocks.Block, err error) {
+	cg, ok := m.backend.(ConsistentGetter)
+	if !ok {
+		level = "default"
+	}
+	name := "get.consistency_" + string(level)
+	m.reg.counter(name+"_total", "Number of reads at one consistency level").Inc()
+	defer recordLatency(m.clock, m.reg.latency(name+".latency", "Latency distribution of reads at one consistency level"), m.clock.Now())
+	defer func() {
+		if err != nil && !format.IsNotFound(err) {
+			m.reg.counter(name+".errors_total", "Number of failed reads at one consistency level").Inc()
+		}
+	}()
+
+	if !ok {
+		return m.Get(ctx, c)
+	}
+	return cg.GetWithConsistency(ctx, c, level)
+}
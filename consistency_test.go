@@ -0,0 +1,48 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type consistentBS struct {
+	*testutil.Blockstore
+	levels map[Consistency]int
+}
+
+func (b consistentBS) GetWithConsistency(ctx context.Context, c cid.Cid, level Consistency) (blocks.Block, error) {
+	b.levels[level]++
+	return b.Blockstore.Get(ctx, c)
+}
+
+func TestGetWithConsistency(t *testing.T) {
+	ctx := context.Background()
+	bs := consistentBS{testutil.New(), map[Consistency]int{}}
+	blk := mkBlocks(1)[0]
+	bs.Blockstore.Put(ctx, blk)
+	m := New("gc", bs)
+	if _, err := m.GetWithConsistency(ctx, blk.Cid(), ConsistencyQuorum); err != nil {
+		t.Fatal(err)
+	}
+	m.GetWithConsistency(ctx, blk.Cid(), ConsistencyLocal)
+	m.GetWithConsistency(ctx, blk.Cid(), ConsistencyLocal)
+	s := m.Stats()
+	if s.Histograms["get.consistency_quorum.latency_seconds"].Count != 1 || s.Histograms["get.consistency_local.latency_seconds"].Count != 2 || bs.levels[ConsistencyLocal] != 2 {
+		t.Fatal(s.Histograms, bs.levels)
+	}
+	plain := testutil.New()
+	plain.Put(ctx, blk)
+	n := New("gc2", plain)
+	if _, err := n.GetWithConsistency(ctx, blk.Cid(), ConsistencyQuorum); err != nil {
+		t.Fatal(err)
+	}
+	s = n.Stats()
+	if s.Histograms["get.consistency_default.latency_seconds"].Count != 1 || s.Counters["get_total"] != 1 {
+		t.Fatal(s.Histograms, s.Counters)
+	}
+}
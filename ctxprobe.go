@@ -0,0 +1,32 @@
+package measure
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ipfs/go-cid"
+)
+
+// ProbeContextSupport checks whether the backend honors contexts, by
+// calling its Has with an already cancelled context: a backend that does
+// fails with the context's error, one that ignores it runs the lookup.
+// The outcome is reported, and recorded in the backend.respects_context
+// gauge, 1 or 0. When it is 0, the timeouts and cancellations of callers,
+// and of Close, only take effect once backend calls return. ctx bounds
+// the probe itself.
+func (m *measure) ProbeContextSupport(ctx context.Context) bool {
+	probe, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: 0x12, MhLength: -1}.Sum([]byte("measure: context probe"))
+	if err != nil {
+		return false
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = m.backend.Has(cctx, probe)
+	respects := errors.Is(err, context.Canceled)
+	var v float64
+	if respects {
+		v = 1
+	}
+	m.reg.gauge("backend.respects_context", "1 if the backend fails calls made with a cancelled context, 0 if it ignores the context").Set(v)
+	return respects
+}
@@ -0,0 +1,34 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type ctxHasBS struct{ *testutil.Blockstore }
+
+func (b ctxHasBS) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return b.Blockstore.Has(ctx, c)
+}
+
+func TestProbeContextSupport(t *testing.T) {
+	ctx := context.Background()
+	m := New("cp", ctxHasBS{testutil.New()})
+	if !m.ProbeContextSupport(ctx) || m.Stats().Gauges["backend.respects_context"] != 1 {
+		t.Fatal("respecting backend")
+	}
+	n := New("cp2", testutil.New())
+	if n.ProbeContextSupport(ctx) {
+		t.Fatal("ignoring backend")
+	}
+	if v, ok := n.Stats().Gauges["backend.respects_context"]; !ok || v != 0 {
+		t.Fatal(v, ok)
+	}
+}
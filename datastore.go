@@ -0,0 +1,216 @@
+package measure
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// dsOp holds the metrics of one datastore operation.
+type dsOp struct {
+	num     metrics.Counter
+	err     metrics.Counter
+	latency metrics.Histogram
+	// errLatency is nil unless WithErrorLatencySplit is given.
+	errLatency metrics.Histogram
+	clock      Clock
+}
+
+func newDsOp(r *registry, op, method string, splitErrors bool) dsOp {
+	o := dsOp{
+		num: r.counter(op+"_total", "Total number of Datastore."+method+" calls"),
+		err: r.counter(op+".errors_total", "Number of errored Datastore."+method+" calls"),
+		latency: r.latency(op+".latency",
+			"Latency distribution of Datastore."+method+" calls"),
+		clock: r.clock,
+	}
+	if splitErrors {
+		o.errLatency = r.latency(op+".error_latency",
+			"Latency distribution of failed Datastore."+method+" calls")
+	}
+	return o
+}
+
+// done records a call started at start that returned err. Not-found
+// isn't an error.
+func (o dsOp) done(start time.Time, err error) {
+	failed := err != nil && err != datastore.ErrNotFound
+	h := o.latency
+	if failed && o.errLatency != nil {
+		h = o.errLatency
+	}
+	recordLatency(o.clock, h, start)
+	if failed {
+		o.err.Inc()
+	}
+}
+
+// measuredDatastore is the datastore counterpart of measure.
+type measuredDatastore struct {
+	backend datastore.Batching
+	reg     *registry
+
+	put, get, has, getSize, delete, query, sync, commit dsOp
+
+	putSize     metrics.Histogram
+	getSizeHist metrics.Histogram
+	batchPut    metrics.Counter
+	batchDelete metrics.Counter
+}
+
+var _ datastore.Batching = (*measuredDatastore)(nil)
+
+// NewDatastore wraps ds, providing metrics on its operations under names
+// starting with prefix and a dot. Of the options, only those about how
+// metrics are recorded apply: WithLatencyUnit, WithAdaptiveBuckets,
+// WithoutLatencyHistograms, WithLatencyCeiling, WithRecorder,
+// WithoutPushMetrics, WithClock and WithErrorLatencySplit.
+func NewDatastore(prefix string, ds datastore.Batching, opts ...Option) datastore.Batching {
+	cfg := defaultConfig()
+	for _, o := range opts {
+		o(&cfg)
+	}
+	r := newRegistry(prefix, cfg.newRecorder())
+	r.latencyUnit = cfg.latencyUnit
+	r.adaptiveBuckets = cfg.adaptiveBuckets
+	r.latencySums = cfg.latencySums
+	r.latencyCeiling = cfg.latencyCeiling
+	r.clock = cfg.clock
+	split := cfg.errorLatencySplit
+	return &measuredDatastore{
+		backend: ds,
+		reg:     r,
+		put:     newDsOp(r, "put", "Put", split),
+		get:     newDsOp(r, "get", "Get", split),
+		has:     newDsOp(r, "has", "Has", split),
+		getSize: newDsOp(r, "getsize", "GetSize", split),
+		delete:  newDsOp(r, "delete", "Delete", split),
+		query:   newDsOp(r, "query", "Query", split),
+		sync:    newDsOp(r, "sync", "Sync", split),
+		commit:  newDsOp(r, "batch.commit", "Batch.Commit", split),
+		putSize: r.histogram("put.size_bytes",
+			"Size distribution of stored byte slices", datastoreSizeBuckets),
+		getSizeHist: r.histogram("get.size_bytes",
+			"Size distribution of retrieved byte slices", datastoreSizeBuckets),
+		batchPut:    r.counter("batch.put_total", "Number of Batch.Put calls"),
+		batchDelete: r.counter("batch.delete_total", "Number of Batch.Delete calls"),
+	}
+}
+
+// NewStack measures both layers of the usual blockstore construction: ds
+// is wrapped with NewDatastore under the prefix <prefix>.ds, turned into
+// a blockstore with blockstore.NewBlockstore, and that is wrapped with
+// New under prefix. The blockstore wrapper registers no metric names
+// starting with "ds.", so the two layers can't collide. opts are given
+// to both wrappers.
+func NewStack(prefix string, ds datastore.Batching, opts ...Option) blockstore.Blockstore {
+	mds := NewDatastore(prefix+".ds", ds, opts...)
+	return New(prefix, blockstore.NewBlockstore(mds), opts...)
+}
+
+// Stats returns a snapshot of all metrics recorded by d.
+func (d *measuredDatastore) Stats() Stats {
+	return d.reg.snapshot()
+}
+
+func (d *measuredDatastore) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	start := d.reg.clock.Now()
+	d.put.num.Inc()
+	d.putSize.Observe(float64(len(value)))
+	err := d.backend.Put(ctx, key, value)
+	d.put.done(start, err)
+	return err
+}
+
+func (d *measuredDatastore) Get(ctx context.Context, key datastore.Key) (value []byte, err error) {
+	start := d.reg.clock.Now()
+	d.get.num.Inc()
+	value, err = d.backend.Get(ctx, key)
+	d.get.done(start, err)
+	if err == nil {
+		d.getSizeHist.Observe(float64(len(value)))
+	}
+	return value, err
+}
+
+func (d *measuredDatastore) Has(ctx context.Context, key datastore.Key) (bool, error) {
+	start := d.reg.clock.Now()
+	d.has.num.Inc()
+	exists, err := d.backend.Has(ctx, key)
+	d.has.done(start, err)
+	return exists, err
+}
+
+func (d *measuredDatastore) GetSize(ctx context.Context, key datastore.Key) (int, error) {
+	start := d.reg.clock.Now()
+	d.getSize.num.Inc()
+	size, err := d.backend.GetSize(ctx, key)
+	d.getSize.done(start, err)
+	return size, err
+}
+
+func (d *measuredDatastore) Delete(ctx context.Context, key datastore.Key) error {
+	start := d.reg.clock.Now()
+	d.delete.num.Inc()
+	err := d.backend.Delete(ctx, key)
+	d.delete.done(start, err)
+	return err
+}
+
+// Query records the time taken to start the query, not to consume its
+// results.
+func (d *measuredDatastore) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	start := d.reg.clock.Now()
+	d.query.num.Inc()
+	res, err := d.backend.Query(ctx, q)
+	d.query.done(start, err)
+	return res, err
+}
+
+func (d *measuredDatastore) Sync(ctx context.Context, prefix datastore.Key) error {
+	start := d.reg.clock.Now()
+	d.sync.num.Inc()
+	err := d.backend.Sync(ctx, prefix)
+	d.sync.done(start, err)
+	return err
+}
+
+func (d *measuredDatastore) Close() error {
+	return d.backend.Close()
+}
+
+func (d *measuredDatastore) Batch(ctx context.Context) (datastore.Batch, error) {
+	b, err := d.backend.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &measuredBatch{d: d, b: b}, nil
+}
+
+type measuredBatch struct {
+	d *measuredDatastore
+	b datastore.Batch
+}
+
+func (mb *measuredBatch) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	mb.d.batchPut.Inc()
+	mb.d.putSize.Observe(float64(len(value)))
+	return mb.b.Put(ctx, key, value)
+}
+
+func (mb *measuredBatch) Delete(ctx context.Context, key datastore.Key) error {
+	mb.d.batchDelete.Inc()
+	return mb.b.Delete(ctx, key)
+}
+
+func (mb *measuredBatch) Commit(ctx context.Context) error {
+	start := mb.d.reg.clock.Now()
+	mb.d.commit.num.Inc()
+	err := mb.b.Commit(ctx)
+	mb.d.commit.done(start, err)
+	return err
+}
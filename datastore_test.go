@@ -0,0 +1,139 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+func TestDatastore(t *testing.T) {
+	ctx := context.Background()
+	d := NewDatastore("test", datastore.NewMapDatastore()).(*measuredDatastore)
+	key := datastore.NewKey("a")
+	if err := d.Put(ctx, key, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.Get(ctx, key); err != nil || string(v) != "hello" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	if ok, err := d.Has(ctx, key); !ok || err != nil {
+		t.Fatalf("Has = %v, %v", ok, err)
+	}
+	if n, err := d.GetSize(ctx, key); n != 5 || err != nil {
+		t.Fatalf("GetSize = %d, %v", n, err)
+	}
+	if _, err := d.Get(ctx, datastore.NewKey("missing")); err != datastore.ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	b, err := d.Batch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Put(ctx, datastore.NewKey("b"), []byte("batched"))
+	if err := b.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("query returned %d entries, want 2", len(entries))
+	}
+	if err := d.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	s := d.Stats()
+	for name, want := range map[string]float64{
+		"put_total":          1,
+		"get_total":          2,
+		"get.errors_total":   0,
+		"has_total":          1,
+		"getsize_total":      1,
+		"query_total":        1,
+		"delete_total":       1,
+		"batch.put_total":    1,
+		"batch.commit_total": 1,
+	} {
+		if got := s.Counters[name]; got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	if got := s.Histograms["put.size_bytes"].Count; got != 2 {
+		t.Errorf("put.size_bytes count = %d, want 2", got)
+	}
+	if got := s.Histograms["get.latency_seconds"].Count; got != 2 {
+		t.Errorf("get.latency_seconds count = %d, want 2", got)
+	}
+}
+
+func TestStack(t *testing.T) {
+	ctx := context.Background()
+	rec := &fakeRecorder{counters: map[string]float64{}, gauges: map[string]float64{}, observed: map[string]int{}}
+	bs := NewStack("test", datastore.NewMapDatastore(), WithRecorder(rec))
+	blk := mkBlocks(1)[0]
+	if err := bs.Put(ctx, blk); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bs.Get(ctx, blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each layer reports its own calls under its own prefix.
+	for name, want := range map[string]float64{
+		"test.put_total":    1,
+		"test.get_total":    1,
+		"test.ds.put_total": 1,
+		"test.ds.get_total": 1,
+	} {
+		if got := rec.counters[name]; got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	for name := range bs.(*measure).Stats().Counters {
+		if strings.HasPrefix(name, "ds.") {
+			t.Errorf("blockstore metric %s collides with the datastore layer", name)
+		}
+	}
+}
+
+type slowFailDS struct {
+	*datastore.MapDatastore
+	fail bool
+}
+
+func (d *slowFailDS) Put(ctx context.Context, k datastore.Key, v []byte) error {
+	if d.fail {
+		return errors.New("fast fail")
+	}
+	time.Sleep(20 * time.Millisecond)
+	return d.MapDatastore.Put(ctx, k, v)
+}
+
+func TestDatastoreErrorLatencySplit(t *testing.T) {
+	ctx := context.Background()
+	ds := &slowFailDS{MapDatastore: datastore.NewMapDatastore(), fail: true}
+	d := NewDatastore("dsel", ds, WithErrorLatencySplit()).(*measuredDatastore)
+	d.Put(ctx, datastore.NewKey("a"), []byte("x"))
+	ds.fail = false
+	d.Put(ctx, datastore.NewKey("a"), []byte("x"))
+	st := d.Stats().Histograms
+	e, s := st["put.error_latency_seconds"], st["put.latency_seconds"]
+	if e.Count != 1 || s.Count != 1 || e.Sum >= s.Sum {
+		t.Fatal(e, s)
+	}
+	if d.Stats().Counters["put.errors_total"] != 1 {
+		t.Fatal("errors")
+	}
+}
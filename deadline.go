@@ -0,0 +1,62 @@
+package measure
+
+import (
+	"context"
+)
+
+// sort remaining deadlines in buckets with following upper bounds in
+// seconds, from a microsecond to five minutes
+var deadlineBuckets = []float64{1e-6, 1e-5, 1e-4, 1e-3, 5e-3, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// WithDeadlineTracking observes, at the start of every Get, Has, GetSize
+// and View, how much time the context has left before its deadline in
+// <op>.deadline_remaining_seconds. Calls without a deadline are counted
+// in <op>.no_deadline_total instead. Calls arriving with their deadline
+// already passed are observed in the lowest bucket.
+//
+// It also observes, for every operation with a deadline, the time left
+// when it completes in <op>.deadline_headroom_seconds. Operations that
+// completed after their deadline are counted in
+// <op>.deadline_missed_total instead.
+func WithDeadlineTracking() Option {
+	return func(cfg *config) {
+		cfg.deadlineTracking = true
+	}
+}
+
+// observeDeadline records the deadline budget ctx has for op.
+func (m *measure) observeDeadline(ctx context.Context, op Op) {
+	if !m.deadlineTracking {
+		return
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		m.reg.counter(string(op)+".no_deadline_total",
+			"Number of calls whose context had no deadline").Inc()
+		return
+	}
+	m.reg.histogram(string(op)+".deadline_remaining_seconds",
+		"Distribution of the time left before the context deadline when calls start",
+		deadlineBuckets).Observe(deadline.Sub(m.clock.Now()).Seconds())
+}
+
+// observeHeadroom records how much of the deadline of ctx was left when
+// op completed. It is meant to be deferred.
+func (m *measure) observeHeadroom(ctx context.Context, op Op) {
+	if !m.deadlineTracking {
+		return
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	headroom := deadline.Sub(m.clock.Now())
+	if headroom < 0 {
+		m.reg.counter(string(op)+".deadline_missed_total",
+			"Number of calls that completed after their context deadline").Inc()
+		return
+	}
+	m.reg.histogram(string(op)+".deadline_headroom_seconds",
+		"Distribution of the time left before the context deadline when calls complete",
+		deadlineBuckets).Observe(headroom.Seconds())
+}
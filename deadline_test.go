@@ -0,0 +1,35 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestDeadlineTracking(t *testing.T) {
+	m := New("dl", testutil.New(), WithDeadlineTracking())
+	c := blocks.NewBlock([]byte("x")).Cid()
+	m.Has(context.Background(), c)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m.Has(ctx, c)
+	st := m.Stats()
+	if st.Counters["has.no_deadline_total"] != 1 || st.Histograms["has.deadline_remaining_seconds"].Count != 1 {
+		t.Fatal(st)
+	}
+}
+
+func TestHeadroom(t *testing.T) {
+	m := New("hr", testutil.New(), WithDeadlineTracking())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m.Get(ctx, blocks.NewBlock([]byte("x")).Cid())
+	h := m.Stats().Histograms["get.deadline_headroom_seconds"]
+	if h.Count != 1 || h.Sum <= 0.5 {
+		t.Fatal(h)
+	}
+}
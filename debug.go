@@ -0,0 +1,222 @@
+package measure
+
+import (
+	"encoding/json"
+	"html/template"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// debugSlowOps is the number of slowest operations DebugHandler
+	// lists.
+	debugSlowOps = 10
+	// debugTopErrors is the number of distinct errors DebugHandler
+	// lists.
+	debugTopErrors = 10
+)
+
+// DebugInfo is what DebugHandler serves.
+type DebugInfo struct {
+	Prefix  string    `json:"prefix"`
+	Backend string    `json:"backend"`
+	Created time.Time `json:"created"`
+	// Status is "ok", or "disabled" while SetEnabled(false) is in
+	// effect, or "closed" once Close was called.
+	Status    string  `json:"status"`
+	ErrorRate float64 `json:"error_rate"`
+	Inflight  int64   `json:"inflight"`
+	// Capabilities tells which optional backend interfaces are
+	// implemented natively, see the capability.<name> gauges.
+	Capabilities map[string]bool `json:"capabilities"`
+
+	Counters   map[string]float64        `json:"counters"`
+	Gauges     map[string]float64        `json:"gauges"`
+	Histograms map[string]DebugHistogram `json:"histograms"`
+
+	// SlowOps holds the slowest operations kept by WithEventTrace,
+	// slowest first. It is empty without WithEventTrace.
+	SlowOps []DebugOp `json:"slow_ops"`
+	// TopErrors holds the most frequent errors kept by WithErrorHistory,
+	// most frequent first, and LastErrors the latest error of each
+	// operation.
+	TopErrors  []DebugError          `json:"top_errors"`
+	LastErrors map[string]DebugError `json:"last_errors"`
+}
+
+// DebugHistogram summarizes a histogram in DebugInfo.
+type DebugHistogram struct {
+	Count uint64  `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P99   float64 `json:"p99"`
+}
+
+// DebugOp is an operation listed in DebugInfo.
+type DebugOp struct {
+	Op       string        `json:"op"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration_ns"`
+	Failed   bool          `json:"failed"`
+}
+
+// DebugError is an error listed in DebugInfo.
+type DebugError struct {
+	Op      string    `json:"op"`
+	Message string    `json:"message"`
+	Cid     string    `json:"cid,omitempty"`
+	Time    time.Time `json:"time"`
+	// Count is the number of occurrences in the error history, for
+	// TopErrors.
+	Count int `json:"count,omitempty"`
+}
+
+// DebugHandler returns a handler serving, in one page, the state of the
+// wrapper: its status, capabilities and metrics, along with its slowest
+// recent operations and most frequent errors when WithEventTrace and
+// WithErrorHistory are set. It serves DebugInfo as JSON, or as an HTML
+// page when the format query parameter is "html". It can be served while
+// the wrapper is in use.
+func (m *measure) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := m.debugInfo()
+		if r.URL.Query().Get("format") == "html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if err := debugPage.Execute(w, info); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(info); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func (m *measure) debugInfo() DebugInfo {
+	s := m.Stats()
+	info := DebugInfo{
+		Prefix:       s.Prefix,
+		Backend:      s.Backend,
+		Created:      s.Created,
+		Status:       "ok",
+		ErrorRate:    s.Gauges["error_rate"],
+		Inflight:     atomic.LoadInt64(&m.life.inflight),
+		Capabilities: make(map[string]bool),
+		Counters:     s.Counters,
+		Gauges:       s.Gauges,
+		Histograms:   make(map[string]DebugHistogram, len(s.Histograms)),
+		SlowOps:      []DebugOp{},
+		TopErrors:    []DebugError{},
+		LastErrors:   make(map[string]DebugError, len(s.LastErrors)),
+	}
+	switch {
+	case atomic.LoadInt32(&m.life.closed) != 0:
+		info.Status = "closed"
+	case atomic.LoadInt32(&m.enabled.disabled) == 1:
+		info.Status = "disabled"
+	}
+	for name, v := range s.Gauges {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			// Not representable in JSON.
+			delete(info.Gauges, name)
+			continue
+		}
+		if strings.HasPrefix(name, "capability.") {
+			info.Capabilities[strings.TrimPrefix(name, "capability.")] = v == 1
+		}
+	}
+	for name, h := range s.Histograms {
+		info.Histograms[name] = DebugHistogram{Count: h.Count, Mean: h.Mean(), P50: h.Quantile(0.5), P99: h.Quantile(0.99)}
+	}
+	for op, e := range s.LastErrors {
+		info.LastErrors[string(op)] = m.debugError(e)
+	}
+	if m.eventTrace != nil {
+		events := m.eventTrace.snapshot()
+		sort.Slice(events, func(i, j int) bool { return events[i].duration > events[j].duration })
+		if len(events) > debugSlowOps {
+			events = events[:debugSlowOps]
+		}
+		for _, ev := range events {
+			info.SlowOps = append(info.SlowOps, DebugOp{Op: ev.op, Start: ev.start, Duration: ev.duration, Failed: ev.failed})
+		}
+	}
+	info.TopErrors = m.topErrors()
+	return info
+}
+
+// topErrors groups the error history by operation and message.
+func (m *measure) topErrors() []DebugError {
+	type key struct{ op, msg string }
+	counts := make(map[key]*DebugError)
+	var top []DebugError
+	// Errors returns the newest first, so the first of each group is its
+	// latest occurrence.
+	for _, e := range m.Errors(int(^uint(0) >> 1)) {
+		k := key{string(e.Op), e.Message}
+		if d, ok := counts[k]; ok {
+			d.Count++
+			continue
+		}
+		d := m.debugError(e)
+		d.Count = 1
+		counts[k] = &d
+	}
+	for _, d := range counts {
+		top = append(top, *d)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Time.After(top[j].Time)
+	})
+	if len(top) > debugTopErrors {
+		top = top[:debugTopErrors]
+	}
+	if top == nil {
+		top = []DebugError{}
+	}
+	return top
+}
+
+func (m *measure) debugError(e ErrInfo) DebugError {
+	d := DebugError{Op: string(e.Op), Message: e.Message, Time: e.Time}
+	if e.Cid.Defined() {
+		d.Cid = m.cidFormat(e.Cid)
+	}
+	return d
+}
+
+var debugPage = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html><head><title>measure {{.Prefix}}</title></head><body>
+<h1>measure {{.Prefix}}</h1>
+<p>Backend {{.Backend}}, created {{.Created}}. Status <b>{{.Status}}</b>, error rate {{.ErrorRate}}, {{.Inflight}} operations in flight.</p>
+<h2>Capabilities</h2>
+<ul>{{range $name, $ok := .Capabilities}}<li>{{$name}}: {{$ok}}</li>{{end}}</ul>
+<h2>Slowest operations</h2>
+{{if .SlowOps}}<table><tr><th>op</th><th>start</th><th>duration</th><th>failed</th></tr>
+{{range .SlowOps}}<tr><td>{{.Op}}</td><td>{{.Start}}</td><td>{{.Duration}}</td><td>{{.Failed}}</td></tr>
+{{end}}</table>{{else}}<p>Not recorded, see WithEventTrace.</p>{{end}}
+<h2>Top errors</h2>
+{{if .TopErrors}}<table><tr><th>count</th><th>op</th><th>message</th><th>latest</th></tr>
+{{range .TopErrors}}<tr><td>{{.Count}}</td><td>{{.Op}}</td><td>{{.Message}}</td><td>{{.Time}}</td></tr>
+{{end}}</table>{{else}}<p>None recorded, see WithErrorHistory.</p>{{end}}
+<h2>Counters</h2>
+<table>{{range $name, $v := .Counters}}<tr><td>{{$name}}</td><td>{{$v}}</td></tr>{{end}}</table>
+<h2>Gauges</h2>
+<table>{{range $name, $v := .Gauges}}<tr><td>{{$name}}</td><td>{{$v}}</td></tr>{{end}}</table>
+<h2>Histograms</h2>
+<table><tr><th>name</th><th>count</th><th>mean</th><th>p50</th><th>p99</th></tr>
+{{range $name, $h := .Histograms}}<tr><td>{{$name}}</td><td>{{$h.Count}}</td><td>{{$h.Mean}}</td><td>{{$h.P50}}</td><td>{{$h.P99}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
@@ -0,0 +1,44 @@
+package measure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestDebugHandler(t *testing.T) {
+	ctx := context.Background()
+	m := New("dbg", testutil.New().Plain(), WithEventTrace(16), WithErrorHistory(8))
+	blk := mkBlocks(1)[0]
+	m.Put(ctx, blk)
+	m.Get(ctx, blk.Cid())
+	m.Get(ctx, mkBlocks(2)[1].Cid())
+	rec := httptest.NewRecorder()
+	m.DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	var info DebugInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if info.Status != "ok" || info.Counters["put_total"] != 1 || info.Histograms["get.latency_seconds"].Count != 1 || len(info.SlowOps) != 3 {
+		t.Fatal(rec.Body.String())
+	}
+	if ok, present := info.Capabilities["view"]; ok || !present {
+		t.Fatal(info.Capabilities)
+	}
+	rec = httptest.NewRecorder()
+	m.DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/?format=html", nil))
+	if !strings.Contains(rec.Body.String(), "put_total") {
+		t.Fatal(rec.Body.String())
+	}
+	plain := New("dbg2", testutil.New())
+	plain.Close()
+	rec = httptest.NewRecorder()
+	plain.DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil || info.Status != "closed" || len(info.SlowOps) != 0 {
+		t.Fatal(err, rec.Body.String())
+	}
+}
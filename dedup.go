@@ -0,0 +1,76 @@
+package measure
+
+import (
+	"sync"
+
+	"github.com/ipfs/go-cid"
+)
+
+// WithDedupKeys makes AllKeysChan and AllKeysParallel drop keys they
+// already delivered, counting them in allkeys.duplicates_dropped_total,
+// for backends that can list a key twice. Every enumeration remembers
+// all the keys it delivered, so its memory grows with the number of
+// keys in the store unless bounded with WithAllKeysMaxTrackedKeys.
+func WithDedupKeys() Option {
+	return func(cfg *config) {
+		cfg.dedupKeys = true
+	}
+}
+
+// WithAllKeysMaxTrackedKeys bounds the keys an enumeration remembers to
+// n. An enumeration delivering more keys than that forgets them all and
+// stops deduplicating, counting it in allkeys.tracking_overflow_total:
+// the rest of its keys are still delivered, but may include duplicates.
+func WithAllKeysMaxTrackedKeys(n int) Option {
+	return func(cfg *config) {
+		cfg.allKeysMaxTracked = n
+	}
+}
+
+// keySet remembers the keys of one enumeration.
+type keySet struct {
+	mu   sync.Mutex
+	seen map[cid.Cid]struct{}
+	// max is the number of keys seen may hold, 0 for no limit. Once
+	// exceeded, seen is dropped and overflowed set.
+	max        int
+	overflowed bool
+}
+
+// newKeySet returns a set for a new enumeration, or nil when keys aren't
+// deduplicated.
+func (m *measure) newKeySet() *keySet {
+	if !m.dedupKeys {
+		return nil
+	}
+	return &keySet{seen: make(map[cid.Cid]struct{}), max: m.allKeysMaxTracked}
+}
+
+// duplicate reports whether c was already delivered, counting it if so.
+func (m *measure) duplicate(s *keySet, c cid.Cid) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	if s.overflowed {
+		s.mu.Unlock()
+		return false
+	}
+	_, dup := s.seen[c]
+	overflow := !dup && s.max > 0 && len(s.seen) >= s.max
+	if overflow {
+		s.seen = nil
+		s.overflowed = true
+	} else {
+		s.seen[c] = struct{}{}
+	}
+	s.mu.Unlock()
+	if overflow {
+		m.reg.counter("allkeys.tracking_overflow_total",
+			"Number of key enumerations that stopped deduplicating because they tracked too many keys").Inc()
+	}
+	if dup {
+		m.reg.counter("allkeys.duplicates_dropped_total", "Number of duplicate keys dropped from key enumerations").Inc()
+	}
+	return dup
+}
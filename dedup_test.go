@@ -0,0 +1,58 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type dupKeysBS struct {
+	*testutil.Blockstore
+	keys []cid.Cid
+}
+
+func (d dupKeysBS) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	ch := make(chan cid.Cid, len(d.keys))
+	for _, c := range d.keys {
+		ch <- c
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestDedupKeys(t *testing.T) {
+	a, b := blocks.NewBlock([]byte("a")).Cid(), blocks.NewBlock([]byte("b")).Cid()
+	m := New("dd", dupKeysBS{testutil.New(), []cid.Cid{a, b, a}}, WithDedupKeys())
+	ch, _ := m.AllKeysChan(context.Background())
+	var got []cid.Cid
+	for c := range ch {
+		got = append(got, c)
+	}
+	if len(got) != 2 || m.Stats().Counters["allkeys.duplicates_dropped_total"] != 1 {
+		t.Fatal(got)
+	}
+}
+
+func TestAllKeysMaxTracked(t *testing.T) {
+	ctx := context.Background()
+	mem := testutil.New()
+	for _, b := range mkBlocks(10) {
+		mem.Put(ctx, b)
+	}
+	m := New("mt", mem, WithDedupKeys(), WithAllKeysMaxTrackedKeys(4))
+	ch, err := m.AllKeysChan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != 10 || m.Stats().Counters["allkeys.tracking_overflow_total"] != 1 {
+		t.Fatal(n, m.Stats().Counters)
+	}
+}
@@ -0,0 +1,45 @@
+package measure
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// deleteEfficiency compares the cost of DeleteMany with that of deleting
+// the same blocks one at a time. The deletemany.efficiency_ratio gauge
+// is set after every successful native DeleteMany to the mean latency
+// of the successful DeleteBlock calls so far times the batch size,
+// divided by the latency of the batch. It is an estimate: above 1 the
+// batch was cheaper than individual deletes would have been. It stays
+// unset until at least one DeleteBlock reached the backend.
+type deleteEfficiency struct {
+	// singles and singleNanos add up the backend DeleteBlock calls.
+	singles     int64 // updated atomically
+	singleNanos int64 // updated atomically
+	ratio       metrics.Gauge
+}
+
+func newDeleteEfficiency(r *registry) *deleteEfficiency {
+	return &deleteEfficiency{
+		ratio: r.gauge("deletemany.efficiency_ratio",
+			"Estimated cost of deleting the blocks of the last DeleteMany one by one, over its actual cost"),
+	}
+}
+
+// single records a successful DeleteBlock that took d.
+func (e *deleteEfficiency) single(d time.Duration) {
+	atomic.AddInt64(&e.singleNanos, int64(d))
+	atomic.AddInt64(&e.singles, 1)
+}
+
+// batch records a successful DeleteMany of n blocks that took d.
+func (e *deleteEfficiency) batch(n int, d time.Duration) {
+	singles := atomic.LoadInt64(&e.singles)
+	if singles == 0 || d <= 0 {
+		return
+	}
+	mean := float64(atomic.LoadInt64(&e.singleNanos)) / float64(singles)
+	e.ratio.Set(mean * float64(n) / float64(d))
+}
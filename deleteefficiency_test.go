@@ -0,0 +1,46 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type batchDelBS struct{ *testutil.Blockstore }
+
+func (b batchDelBS) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	time.Sleep(5 * time.Millisecond)
+	return b.Blockstore.DeleteBlock(ctx, c)
+}
+
+func (b batchDelBS) DeleteMany(ctx context.Context, cids []cid.Cid) error {
+	time.Sleep(5 * time.Millisecond)
+	for _, c := range cids {
+		b.Blockstore.DeleteBlock(ctx, c)
+	}
+	return nil
+}
+
+func TestDeleteEfficiency(t *testing.T) {
+	ctx := context.Background()
+	m := New("de", batchDelBS{testutil.New()})
+	blks := mkBlocks(10)
+	var cids []cid.Cid
+	for _, b := range blks {
+		cids = append(cids, b.Cid())
+	}
+	m.DeleteMany(ctx, cids)
+	if r := m.Stats().Gauges["deletemany.efficiency_ratio"]; r != 0 {
+		t.Fatal(r)
+	}
+	m.DeleteBlock(ctx, cids[0])
+	m.DeleteBlock(ctx, cids[1])
+	m.DeleteMany(ctx, cids)
+	if r := m.Stats().Gauges["deletemany.efficiency_ratio"]; r < 3 {
+		t.Fatal(r)
+	}
+}
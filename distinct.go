@@ -0,0 +1,126 @@
+package measure
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// DefaultDistinctPrecision is the precision WithDistinctReads uses when
+// given zero.
+const DefaultDistinctPrecision = 14
+
+// WithDistinctReads estimates the number of distinct CIDs passed to Get
+// and View since the wrapper was created, found or not, in the
+// get.distinct_cids_estimate gauge, for example to size a cache.
+//
+// The estimate comes from a HyperLogLog sketch of 2^precision one-byte
+// registers, between 4 and 18, so memory use doesn't grow with the
+// number of blocks. Its typical relative error is 1.04/sqrt(2^precision):
+// the default precision of 14 takes 16KiB for an error of about 0.8%,
+// and each step down halves the memory and multiplies the error by 1.4.
+func WithDistinctReads(precision int) Option {
+	return func(cfg *config) {
+		if precision == 0 {
+			precision = DefaultDistinctPrecision
+		}
+		if precision < 4 {
+			precision = 4
+		}
+		if precision > 18 {
+			precision = 18
+		}
+		cfg.distinctPrecision = precision
+	}
+}
+
+// hyperLogLog estimates the cardinality of the CIDs added to it.
+type hyperLogLog struct {
+	gauge     metrics.Gauge
+	precision uint
+
+	mu        sync.Mutex
+	registers []uint8
+	// sum is the sum of 2^-register over all registers and zeros the
+	// number of registers still zero, kept up to date so that adding a
+	// CID doesn't need a pass over the registers.
+	sum   float64
+	zeros int
+}
+
+func newHyperLogLog(r *registry, precision int) *hyperLogLog {
+	m := 1 << uint(precision)
+	return &hyperLogLog{
+		gauge:     r.gauge("get.distinct_cids_estimate", "Estimated number of distinct blocks read"),
+		precision: uint(precision),
+		registers: make([]uint8, m),
+		sum:       float64(m),
+		zeros:     m,
+	}
+}
+
+// add adds c to the sketch, updating the gauge if the estimate changed.
+func (h *hyperLogLog) add(c cid.Cid) {
+	f := fnv.New64a()
+	f.Write(c.Bytes())
+	x := mix64(f.Sum64())
+	i := x >> (64 - h.precision)
+	rank := uint8(bits.LeadingZeros64(x<<h.precision|1<<(h.precision-1)) + 1)
+
+	h.mu.Lock()
+	old := h.registers[i]
+	if rank <= old {
+		h.mu.Unlock()
+		return
+	}
+	h.registers[i] = rank
+	h.sum += math.Ldexp(1, -int(rank)) - math.Ldexp(1, -int(old))
+	if old == 0 {
+		h.zeros--
+	}
+	est := h.estimate()
+	h.mu.Unlock()
+	h.gauge.Set(est)
+}
+
+// estimate returns the estimated cardinality, using linear counting for
+// small ones as the original HyperLogLog does.
+func (h *hyperLogLog) estimate() float64 {
+	m := float64(len(h.registers))
+	alpha := 0.7213 / (1 + 1.079/m)
+	switch len(h.registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	}
+	est := alpha * m * m / h.sum
+	if est <= 2.5*m && h.zeros > 0 {
+		est = m * math.Log(m/float64(h.zeros))
+	}
+	return est
+}
+
+// mix64 is the finalizer of splitmix64, spreading the bits of FNV
+// hashes, whose high bits depend little on the last bytes hashed.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// observeDistinct adds the CID of a read to the sketch.
+func (m *measure) observeDistinct(c cid.Cid) {
+	if m.distinct != nil {
+		m.distinct.add(c)
+	}
+}
@@ -0,0 +1,32 @@
+package measure
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestDistinctReads(t *testing.T) {
+	ctx := context.Background()
+	m := New("dr", testutil.New(), WithDistinctReads(0))
+	blks := mkBlocks(20000)
+	for r := 0; r < 3; r++ {
+		for _, b := range blks {
+			m.Get(ctx, b.Cid())
+		}
+	}
+	est := m.Stats().Gauges["get.distinct_cids_estimate"]
+	if math.Abs(est-20000)/20000 > 0.03 {
+		t.Fatal(est)
+	}
+	small := New("dr2", testutil.New(), WithDistinctReads(10))
+	for _, b := range blks[:100] {
+		small.View(ctx, b.Cid(), func([]byte) error { return nil })
+		small.Get(ctx, b.Cid())
+	}
+	if est := small.Stats().Gauges["get.distinct_cids_estimate"]; math.Abs(est-100) > 10 {
+		t.Fatal(est)
+	}
+}
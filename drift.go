@@ -0,0 +1,119 @@
+package measure
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// p99DriftSlots is the number of p99 snapshots kept by WithP99Drift,
+// taken every quarter of the interval, so that one from at least an
+// interval ago is always at hand.
+const p99DriftSlots = 8
+
+// WithP99Drift snapshots the p99 latency of Get every quarter of
+// interval, read from the wrapper's clock, and reports in
+// get.p99_drift_seconds how much it rose since the snapshot taken an
+// interval earlier. A steadily positive drift shows the backend
+// degrading before the latency crosses any absolute threshold. The p99
+// comes from the sample of WithLatencyReservoir if set, and from the
+// get.latency histogram otherwise, so it covers every Get since the
+// wrapper was created; without a reservoir, nothing is reported under
+// WithAdaptiveBuckets or WithoutLatencyHistograms. Snapshots are taken
+// by Stats and Gets.
+func WithP99Drift(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.p99DriftInterval = interval
+	}
+}
+
+type p99Snapshot struct {
+	at  time.Time
+	p99 float64
+}
+
+type p99Drift struct {
+	interval time.Duration
+	clock    Clock
+	drift    metrics.Gauge
+
+	mu sync.Mutex
+	// ring holds the latest snapshots, next being the index of the
+	// oldest, overwritten first.
+	ring [p99DriftSlots]p99Snapshot
+	next int
+}
+
+func newP99Drift(r *registry, interval time.Duration, clock Clock) *p99Drift {
+	return &p99Drift{
+		interval: interval,
+		clock:    clock,
+		drift: r.gauge("get.p99_drift_seconds",
+			"Change of the p99 latency of Get over the drift interval, in seconds"),
+	}
+}
+
+// latencyQuantile returns the q-th quantile, in seconds, of the latency
+// histogram created as name, if it has observations.
+func (r *registry) latencyQuantile(name string, q float64) (float64, bool) {
+	suffix, scale := "_seconds", 1.0
+	if r.latencyUnit == Milliseconds {
+		suffix, scale = "_milliseconds", 1e-3
+	}
+	r.mu.Lock()
+	h, ok := r.histograms[name+suffix]
+	r.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	s := h.snapshot()
+	if s.Count == 0 {
+		return 0, false
+	}
+	return s.Quantile(q) * scale, true
+}
+
+// getP99 returns the current p99 latency of Get in seconds, if known.
+func (m *measure) getP99() (float64, bool) {
+	if m.reservoirs != nil {
+		p99 := m.Percentile(OpGet, 0.99)
+		return p99.Seconds(), p99 > 0
+	}
+	return m.reg.latencyQuantile("get.latency", 0.99)
+}
+
+// refreshP99Drift takes a p99 snapshot if one is due, and updates
+// get.p99_drift_seconds.
+func (m *measure) refreshP99Drift() {
+	d := m.p99Drift
+	if d == nil {
+		return
+	}
+	now := d.clock.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	latest := d.ring[(d.next+p99DriftSlots-1)%p99DriftSlots]
+	if !latest.at.IsZero() && now.Sub(latest.at) < d.interval/4 {
+		return
+	}
+	p99, ok := m.getP99()
+	if !ok {
+		return
+	}
+	var base *p99Snapshot
+	for i := range d.ring {
+		s := &d.ring[i]
+		if s.at.IsZero() || now.Sub(s.at) < d.interval {
+			continue
+		}
+		if base == nil || s.at.After(base.at) {
+			base = s
+		}
+	}
+	if base != nil {
+		d.drift.Set(p99 - base.p99)
+	}
+	d.ring[d.next] = p99Snapshot{at: now, p99: p99}
+	d.next = (d.next + 1) % p99DriftSlots
+}
@@ -0,0 +1,35 @@
+package measure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestP99Drift(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := New("dr", testutil.New(), WithP99Drift(time.Minute), WithClock(settableClock{&now}))
+	feed := func(d time.Duration, n int) {
+		for i := 0; i < n; i++ {
+			recordLatency(m.clock, m.getLatency, now.Add(-d))
+		}
+	}
+	feed(time.Millisecond, 100)
+	m.Stats()
+	for i := 0; i < 4; i++ {
+		now = now.Add(15 * time.Second)
+		m.Stats()
+	}
+	if g := m.Stats().Gauges["get.p99_drift_seconds"]; g != 0 {
+		t.Fatal("stable drift", g)
+	}
+	for step := 1; step <= 4; step++ {
+		feed(time.Duration(step)*100*time.Millisecond, 50)
+		now = now.Add(15 * time.Second)
+		m.Stats()
+	}
+	if g := m.Stats().Gauges["get.p99_drift_seconds"]; g <= 0 {
+		t.Fatal(g)
+	}
+}
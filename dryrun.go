@@ -0,0 +1,67 @@
+package measure
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ipfs/go-cid"
+)
+
+// WithDryRunDeletes starts the wrapper with deletes disabled: DeleteBlock
+// and DeleteMany leave the backend alone and report success, counting
+// the blocks they would have removed in delete.dryrun_total and their
+// size in delete.dryrun_bytes_total. It can be turned on and off later
+// with SetDryRunDeletes.
+func WithDryRunDeletes() Option {
+	return func(cfg *config) {
+		cfg.dryRunDeletes = true
+	}
+}
+
+// WithDryRunLog writes the CID of every block a dry-run delete would have
+// removed to w, one per line. Write errors are ignored.
+func WithDryRunLog(w io.Writer) Option {
+	return func(cfg *config) {
+		cfg.dryRunLog = w
+	}
+}
+
+type dryRun struct {
+	enabled int32
+
+	mu  sync.Mutex
+	log io.Writer
+}
+
+// SetDryRunDeletes turns dry-run deletes on or off, see WithDryRunDeletes.
+func (m *measure) SetDryRunDeletes(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&m.dryRun.enabled, v)
+}
+
+func (m *measure) dryRunDeletes() bool {
+	return atomic.LoadInt32(&m.dryRun.enabled) == 1
+}
+
+// dryRunDelete records the deletion of cids without doing it.
+func (m *measure) dryRunDelete(ctx context.Context, cids ...cid.Cid) error {
+	num := m.reg.counter("delete.dryrun_total", "Number of blocks not deleted because of dry-run mode")
+	size := m.reg.counter("delete.dryrun_bytes_total", "Bytes of blocks not deleted because of dry-run mode")
+	for _, c := range cids {
+		num.Inc()
+		if n, err := m.backend.GetSize(ctx, c); err == nil {
+			size.Add(float64(n))
+		}
+		if m.dryRun.log != nil {
+			m.dryRun.mu.Lock()
+			io.WriteString(m.dryRun.log, m.formatCid(c)+"\n")
+			m.dryRun.mu.Unlock()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	var log bytes.Buffer
+	m := New("dr", testutil.New(), WithDryRunDeletes(), WithDryRunLog(&log))
+	b := blocks.NewBlock([]byte("abc"))
+	m.Put(ctx, b)
+	m.DeleteMany(ctx, []cid.Cid{b.Cid()})
+	if ok, _ := m.Has(ctx, b.Cid()); !ok {
+		t.Fatal("deleted")
+	}
+	st := m.Stats()
+	if st.Counters["delete.dryrun_total"] != 1 || st.Counters["delete.dryrun_bytes_total"] != 3 || log.String() != b.Cid().String()+"\n" {
+		t.Fatal(st.Counters, log.String())
+	}
+	m.SetDryRunDeletes(false)
+	m.DeleteBlock(ctx, b.Cid())
+	if ok, _ := m.Has(ctx, b.Cid()); ok {
+		t.Fatal("not deleted")
+	}
+}
@@ -0,0 +1,55 @@
+package measure
+
+import (
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// DurabilityNotifier is implemented by backends that acknowledge a Put
+// before the block is durably persisted. NotifyDurable arranges for f to
+// be called once, from any goroutine, when the block c written by the
+// last Put is durable; if it already is, f may be called right away.
+type DurabilityNotifier interface {
+	NotifyDurable(c cid.Cid, f func())
+}
+
+// durability times how long a DurabilityNotifier backend takes to make
+// acknowledged Puts durable, in put.durability.latency_seconds.
+type durability struct {
+	backend DurabilityNotifier
+	latency metrics.Histogram
+}
+
+// newDurability returns a recorder for the durability of the writes to
+// bs, looking through wrappers, or nil if bs doesn't report it.
+func newDurability(r *registry, bs blockstore.Blockstore) *durability {
+	for {
+		if dn, ok := bs.(DurabilityNotifier); ok {
+			return &durability{
+				backend: dn,
+				latency: r.latency("put.durability.latency",
+					"Time from the acknowledgment of Blockstore.Put calls to the block being durable"),
+			}
+		}
+		u, ok := bs.(unwrapper)
+		if !ok {
+			return nil
+		}
+		bs = u.Unwrap()
+	}
+}
+
+// awaitDurable records the durability latency of c, acknowledged by the
+// backend now.
+func (m *measure) awaitDurable(c cid.Cid) {
+	if m.durability == nil {
+		return
+	}
+	acked := time.Now()
+	m.durability.backend.NotifyDurable(c, func() {
+		m.durability.latency.Observe(time.Since(acked).Seconds())
+	})
+}
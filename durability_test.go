@@ -0,0 +1,37 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type durableBS struct {
+	*testutil.Blockstore
+	done chan struct{}
+}
+
+func (d durableBS) NotifyDurable(c cid.Cid, f func()) {
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		f()
+		close(d.done)
+	}()
+}
+
+func TestDurabilityLatency(t *testing.T) {
+	bs := durableBS{testutil.New(), make(chan struct{})}
+	m := New("dur", bs)
+	if err := m.Put(context.Background(), mkBlocks(1)[0]); err != nil {
+		t.Fatal(err)
+	}
+	<-bs.done
+	h := m.Stats().Histograms["put.durability.latency_seconds"]
+	if h.Count != 1 || h.Sum < 0.02 {
+		t.Fatal(h)
+	}
+}
@@ -0,0 +1,120 @@
+package measure
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+type enabledState struct {
+	// disabled is read atomically by every operation.
+	disabled int32
+
+	mu            sync.Mutex
+	disabledSince time.Time
+	disabledTime  metrics.Counter
+}
+
+// SetEnabled turns the instrumentation on or off. While it is off, calls
+// go straight to the backend without being measured, and the time spent
+// disabled is added to instrumentation.disabled_seconds_total when it is
+// turned back on. Operations already running when it is toggled finish
+// the way they started.
+//
+// Write-behind, write coalescing, expiry, delete audits and fencing
+// would be skipped by going straight to the backend, so wrappers using
+// them stay instrumented; so do deletes while dry-run deletes are on. The read and
+// not-found caches are kept consistent with writes made while disabled.
+func (m *measure) SetEnabled(enabled bool) {
+	m.enabled.mu.Lock()
+	defer m.enabled.mu.Unlock()
+	now := m.clock.Now()
+	switch {
+	case !enabled && atomic.CompareAndSwapInt32(&m.enabled.disabled, 0, 1):
+		m.enabled.disabledSince = now
+	case enabled && atomic.CompareAndSwapInt32(&m.enabled.disabled, 1, 0):
+		m.enabled.disabledTime.Add(now.Sub(m.enabled.disabledSince).Seconds())
+	}
+}
+
+// bypass reports whether calls should go straight to the backend.
+func (m *measure) bypass() bool {
+	return atomic.LoadInt32(&m.enabled.disabled) == 1 &&
+		m.writeBehind == nil && m.coalescer == nil && m.expiry == nil && m.audit == nil &&
+		m.fence == nil
+}
+
+// bypassDeletes is bypass for deletes.
+func (m *measure) bypassDeletes() bool {
+	return m.bypass() && !m.dryRunDeletes()
+}
+
+// putDirect writes blk with write, or the backend's Put if nil.
+func (m *measure) putDirect(ctx context.Context, blk blocks.Block, write PutFunc) error {
+	if write == nil {
+		write = m.backend.Put
+	}
+	m.bloomAdd(blk.Cid())
+	err := write(ctx, blk)
+	m.invalidateMissing(blk.Cid())
+	return err
+}
+
+func (m *measure) putManyDirect(ctx context.Context, blks []blocks.Block) error {
+	for _, blk := range blks {
+		m.bloomAdd(blk.Cid())
+	}
+	err := m.backend.PutMany(ctx, blks)
+	for _, blk := range blks {
+		m.invalidateMissing(blk.Cid())
+	}
+	return err
+}
+
+func (m *measure) deleteDirect(ctx context.Context, c cid.Cid) error {
+	err := m.backend.DeleteBlock(ctx, c)
+	if err == nil {
+		m.uncache(c)
+		m.forgetPresent(c)
+		m.bloomDelete(c)
+	}
+	return err
+}
+
+func (m *measure) deleteManyDirect(ctx context.Context, cids []cid.Cid) error {
+	var err error
+	if m.deleter != nil {
+		err = m.deleter.DeleteMany(ctx, cids)
+	} else {
+		for _, c := range cids {
+			if err = m.backend.DeleteBlock(ctx, c); err != nil {
+				break
+			}
+		}
+	}
+	// Drop every block, as some may have been deleted before a failure.
+	for _, c := range cids {
+		m.uncache(c)
+		m.forgetPresent(c)
+		if err == nil {
+			m.bloomDelete(c)
+		}
+	}
+	return err
+}
+
+func (m *measure) viewDirect(ctx context.Context, c cid.Cid, f func([]byte) error) error {
+	if m.viewer != nil {
+		return m.viewer.View(ctx, c, f)
+	}
+	blk, err := m.backend.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+	return f(blk.RawData())
+}
@@ -0,0 +1,30 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestSetEnabled(t *testing.T) {
+	ctx := context.Background()
+	clk := &fakeClock{t: time.Unix(1000, 0)}
+	m := New("en", testutil.New(), WithClock(clk), WithNotFoundCache(10, time.Minute))
+	b := blocks.NewBlock([]byte("x"))
+	m.Has(ctx, b.Cid())
+	m.SetEnabled(false)
+	m.Put(ctx, b)
+	clk.Advance(5 * time.Second)
+	m.SetEnabled(true)
+	st := m.Stats().Counters
+	if st["put_total"] != 0 || st["instrumentation.disabled_seconds_total"] != 5 {
+		t.Fatal(st)
+	}
+	if ok, _ := m.Has(ctx, b.Cid()); !ok {
+		t.Fatal("stale not-found cache")
+	}
+}
@@ -0,0 +1,109 @@
+package measure
+
+import (
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// maxErrMessage is the number of bytes of an error message kept in the
+// error history.
+const maxErrMessage = 512
+
+// ErrRecord is an error kept in the error history, see Errors.
+type ErrRecord = ErrInfo
+
+// ErrorHistoryOption configures WithErrorHistory.
+type ErrorHistoryOption func(*errorHistoryConfig)
+
+type errorHistoryConfig struct {
+	size            int
+	includeNotFound bool
+}
+
+// IncludeNotFound also keeps not-found errors in the error history.
+func IncludeNotFound() ErrorHistoryOption {
+	return func(cfg *errorHistoryConfig) {
+		cfg.includeNotFound = true
+	}
+}
+
+// WithErrorHistory keeps the last size errors returned by any operation,
+// for Errors. Not-found errors are left out unless IncludeNotFound is
+// given. Messages are truncated to 512 bytes.
+func WithErrorHistory(size int, opts ...ErrorHistoryOption) Option {
+	return func(cfg *config) {
+		cfg.errorHistory = &errorHistoryConfig{size: size}
+		for _, o := range opts {
+			o(cfg.errorHistory)
+		}
+	}
+}
+
+type errorHistory struct {
+	includeNotFound bool
+
+	mu   sync.Mutex
+	ring []ErrRecord
+	// next is the index the next record is written at; the ring is full
+	// once n reaches len(ring).
+	next, n int
+}
+
+func newErrorHistory(cfg errorHistoryConfig) *errorHistory {
+	return &errorHistory{
+		includeNotFound: cfg.includeNotFound,
+		ring:            make([]ErrRecord, cfg.size),
+	}
+}
+
+func (h *errorHistory) add(rec ErrRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ring[h.next] = rec
+	h.next = (h.next + 1) % len(h.ring)
+	if h.n < len(h.ring) {
+		h.n++
+	}
+}
+
+// Errors returns up to limit of the most recent errors, newest first. It
+// returns nil unless WithErrorHistory is set.
+func (m *measure) Errors(limit int) []ErrRecord {
+	h := m.errHistory
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if limit > h.n {
+		limit = h.n
+	}
+	recs := make([]ErrRecord, 0, limit)
+	for i := 1; i <= limit; i++ {
+		recs = append(recs, h.ring[(h.next-i+len(h.ring))%len(h.ring)])
+	}
+	return recs
+}
+
+// recordOutcome follows the outcome of op on c, as found in *err once
+// the operation returns. It is meant to be deferred. The error_rate
+// gauge is updated with the fraction of the operations of the last
+// minute, by the wrapper's clock, that failed; not-found errors count as
+// successes.
+func (m *measure) recordOutcome(op Op, c cid.Cid, err *error) {
+	m.trackRecovery(op, *err)
+	m.errorRate.Set(m.errorWindow.add(m.clock.Now(), *err != nil && !format.IsNotFound(*err)))
+	if *err == nil || m.errHistory == nil {
+		return
+	}
+	if format.IsNotFound(*err) && !m.errHistory.includeNotFound {
+		return
+	}
+	msg := (*err).Error()
+	if len(msg) > maxErrMessage {
+		msg = msg[:maxErrMessage]
+	}
+	m.errHistory.add(ErrRecord{Op: op, Message: msg, Time: m.clock.Now(), Cid: c})
+}
@@ -0,0 +1,50 @@
+package measure
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestErrors(t *testing.T) {
+	bs := &flakyBS{Blockstore: testutil.New(), fail: true}
+	m := New("eh", bs, WithErrorHistory(2))
+	c := blocks.NewBlock([]byte("x")).Cid()
+	for i := 0; i < 3; i++ {
+		m.Has(context.Background(), c)
+	}
+	m.Get(context.Background(), c)
+	recs := m.Errors(5)
+	if len(recs) != 2 || recs[0].Op != OpHas || !strings.Contains(recs[0].Message, "boom") {
+		t.Fatal(recs)
+	}
+}
+
+func TestErrorRate(t *testing.T) {
+	ctx := context.Background()
+	clk := &fakeClock{t: time.Unix(1000, 0)}
+	m := New("er", &flakyBS{Blockstore: testutil.New(), fail: true}, WithClock(clk))
+	b := blocks.NewBlock([]byte("e"))
+	for i := 0; i < 3; i++ {
+		m.Put(ctx, b)
+		clk.Advance(time.Second)
+	}
+	m.Has(ctx, b.Cid())
+	if r := m.Stats().Gauges["error_rate"]; r != 0.25 {
+		t.Fatal(r)
+	}
+	clk.Advance(59 * time.Second)
+	m.Has(ctx, b.Cid())
+	if r := m.Stats().Gauges["error_rate"]; r != 1 {
+		t.Fatal(r)
+	}
+	m.Get(ctx, blocks.NewBlock([]byte("missing")).Cid())
+	if r := m.Stats().Gauges["error_rate"]; r != 2.0/3 {
+		t.Fatal(r)
+	}
+}
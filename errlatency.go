@@ -0,0 +1,50 @@
+package measure
+
+import (
+	"context"
+	"time"
+
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithErrorLatencySplit keeps failed operations out of the latency
+// histograms: their latency goes to <op>.error_latency instead, so that
+// fast failures and timeouts don't distort the distribution of
+// successes. Not-found counts as a success. NewDatastore honours it
+// too, for each of its operations.
+func WithErrorLatencySplit() Option {
+	return func(cfg *config) {
+		cfg.errorLatencySplit = true
+	}
+}
+
+func newErrorLatencies(r *registry) map[Op]metrics.Histogram {
+	hs := make(map[Op]metrics.Histogram)
+	for _, op := range []Op{OpPut, OpPutMany, OpGet, OpHas, OpGetSize, OpDelete, OpDeleteMany, OpView} {
+		hs[op] = r.latency(string(op)+".error_latency", "Latency distribution of failed calls")
+	}
+	return hs
+}
+
+// recordOpLatency is recordLatency for op, which returned *err, also
+// sampling the stack depth of slow operations. size points at the size
+// of the block handled, if the op has one, see WithLatencyThresholdSize.
+// It is meant to be deferred.
+func (m *measure) recordOpLatency(ctx context.Context, op Op, h metrics.Histogram, start time.Time, size *int, err *error) {
+	m.observeSLO(op, start, *err)
+	m.observeBaseline(op, start, *err)
+	m.setLastLatency(op, start)
+	m.observeReservoir(op, start)
+	if !m.belowLatencyThreshold(size, *err) {
+		if m.errorLatencies != nil && *err != nil && !format.IsNotFound(*err) {
+			h = m.errorLatencies[op]
+		}
+		m.recordLatencyExemplar(ctx, h, start)
+		m.observeSizeClass(op, size, start, *err)
+		m.observeLatencyPerMB(op, size, start, *err)
+		m.observeConcurrency(op, start)
+		m.observeHour(op, start)
+	}
+	m.observeStackDepth(start)
+}
@@ -0,0 +1,33 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestErrorLatencySplit(t *testing.T) {
+	ctx := context.Background()
+	bs := &flakyBS{Blockstore: testutil.New(), fail: true}
+	m := New("els", bs, WithErrorLatencySplit())
+	c := blocks.NewBlock([]byte("x")).Cid()
+	m.Has(ctx, c)
+	m.Has(ctx, c)
+	bs.fail = false
+	m.Has(ctx, c)
+	m.Has(ctx, c)
+	st := m.Stats().Histograms
+	// first success observation goes to cold start
+	if st["has.error_latency_seconds"].Count != 2 || st["has.latency_seconds"].Count != 1 {
+		t.Fatal(st["has.error_latency_seconds"], st["has.latency_seconds"])
+	}
+	n := New("els2", &flakyBS{Blockstore: testutil.New(), fail: true})
+	n.Has(ctx, c)
+	n.Has(ctx, c)
+	if _, ok := n.Stats().Histograms["has.error_latency_seconds"]; ok || n.Stats().Histograms["has.latency_seconds"].Count != 1 {
+		t.Fatal("default changed")
+	}
+}
@@ -0,0 +1,115 @@
+package measure
+
+import (
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// Logger receives structured log entries. It is satisfied by go-log and
+// zap sugared loggers.
+type Logger interface {
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// ErrorLoggingOption configures WithErrorLogging.
+type ErrorLoggingOption func(*errorLoggingConfig)
+
+type errorLoggingConfig struct {
+	logger    Logger
+	perMinute int
+	notFound  bool
+	canceled  bool
+}
+
+// LogNotFound also logs operations that failed with not-found.
+func LogNotFound() ErrorLoggingOption {
+	return func(cfg *errorLoggingConfig) {
+		cfg.notFound = true
+	}
+}
+
+// LogCanceled also logs operations whose context was cancelled or ran
+// past its deadline.
+func LogCanceled() ErrorLoggingOption {
+	return func(cfg *errorLoggingConfig) {
+		cfg.canceled = true
+	}
+}
+
+// WithErrorLogging logs every failed operation to logger with the fields
+// op, cid (or items for batches), duration and error. Each error class
+// (see errorClass) may log up to perMinute entries a minute, with bursts
+// of as many; entries beyond that are counted in
+// errorlog.suppressed_total. Not-found and cancelled operations are not
+// logged unless asked for with LogNotFound and LogCanceled.
+func WithErrorLogging(logger Logger, perMinute int, opts ...ErrorLoggingOption) Option {
+	return func(cfg *config) {
+		cfg.errorLogging = &errorLoggingConfig{logger: logger, perMinute: perMinute}
+		for _, o := range opts {
+			o(cfg.errorLogging)
+		}
+	}
+}
+
+type errorLogger struct {
+	cfg        errorLoggingConfig
+	clock      Clock
+	formatCid  func(cid.Cid) string
+	suppressed metrics.Counter
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newErrorLogger(m *measure, cfg errorLoggingConfig) *errorLogger {
+	return &errorLogger{
+		cfg:        cfg,
+		clock:      m.clock,
+		formatCid:  m.formatCid,
+		suppressed: m.reg.counter("errorlog.suppressed_total", "Number of errored operations not logged because of the rate limit"),
+		buckets:    make(map[string]*tokenBucket),
+	}
+}
+
+// record is an event sink logging failed operations.
+func (l *errorLogger) record(ev *opEvent) {
+	class := errorClass(ev.Err)
+	switch class {
+	case "":
+		return
+	case "notfound":
+		if !l.cfg.notFound {
+			return
+		}
+	case "canceled", "deadline":
+		if !l.cfg.canceled {
+			return
+		}
+	}
+
+	now := l.clock.Now()
+	l.mu.Lock()
+	b, ok := l.buckets[class]
+	if !ok {
+		n := float64(l.cfg.perMinute)
+		b = &tokenBucket{tokens: n, capacity: n, rate: n / 60, last: now}
+		l.buckets[class] = b
+	}
+	allowed := b.take(now)
+	l.mu.Unlock()
+	if !allowed {
+		l.suppressed.Inc()
+		return
+	}
+
+	kv := []interface{}{"op", ev.Op}
+	if ev.Cid.Defined() {
+		kv = append(kv, "cid", l.formatCid(ev.Cid))
+	} else {
+		kv = append(kv, "items", ev.Items)
+	}
+	kv = append(kv, "duration", ev.Duration, "error", ev.Err.Error())
+	l.cfg.logger.Errorw("blockstore operation failed", kv...)
+}
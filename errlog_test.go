@@ -0,0 +1,31 @@
+package measure
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type elLogger struct{ lines []string }
+
+func (l *elLogger) Errorw(msg string, kv ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprint(msg, kv))
+}
+
+func TestErrorLogging(t *testing.T) {
+	l := &elLogger{}
+	bs := &flakyBS{Blockstore: testutil.New(), fail: true}
+	m := New("el", bs, WithErrorLogging(l, 3))
+	c := blocks.NewBlock([]byte("x")).Cid()
+	for i := 0; i < 10; i++ {
+		m.Has(context.Background(), c)
+	}
+	if len(l.lines) != 3 {
+		t.Fatal(l.lines)
+	}
+	t.Log(l.lines[0])
+}
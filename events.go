@@ -0,0 +1,69 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// opEvent describes a single completed operation. Events are only built
+// when at least one sink consumes them.
+type opEvent struct {
+	Ctx      context.Context
+	Op       string
+	Cid      cid.Cid        // undefined for batch operations
+	Items    int            // number of blocks for batch operations
+	Blocks   []blocks.Block // written by PutMany
+	Cids     []cid.Cid      // deleted by DeleteMany
+	Bytes    int
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+func (e *opEvent) setBytes(n int) {
+	if e != nil {
+		e.Bytes = n
+	}
+}
+
+// startEvent returns a new event for op, or nil when nobody listens.
+func (m *measure) startEvent(ctx context.Context, op string, c cid.Cid, items int) *opEvent {
+	if len(m.sinks) == 0 {
+		return nil
+	}
+	return &opEvent{Ctx: ctx, Op: op, Cid: c, Items: items, Start: time.Now()}
+}
+
+// finishEvent completes ev with the outcome in *err and hands it to the
+// sinks. It is meant to be deferred.
+func (m *measure) finishEvent(ev *opEvent, err *error) {
+	if ev == nil {
+		return
+	}
+	ev.Duration = time.Since(ev.Start)
+	ev.Err = *err
+	for _, sink := range m.sinks {
+		sink(ev)
+	}
+}
+
+// errorClass buckets errors into a small fixed set of names.
+func errorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case format.IsNotFound(err):
+		return "notfound"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline"
+	default:
+		return "other"
+	}
+}
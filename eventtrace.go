@@ -0,0 +1,159 @@
+package measure
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Formats of ExportTrace.
+const (
+	// TraceFormatChrome is the Trace Event JSON format read by
+	// chrome://tracing and Perfetto.
+	TraceFormatChrome = "chrome"
+	// TraceFormatFolded is the folded stacks format read by flamegraph
+	// tools, with the time spent in each operation in microseconds.
+	TraceFormatFolded = "folded"
+)
+
+// WithEventTrace keeps the start and duration of the last capacity
+// operations in memory, to be exported with ExportTrace as a timeline
+// or flame graph.
+func WithEventTrace(capacity int) Option {
+	return func(cfg *config) {
+		cfg.eventTraceSize = capacity
+	}
+}
+
+// traceEvent is an operation kept by WithEventTrace.
+type traceEvent struct {
+	op       string
+	start    time.Time
+	duration time.Duration
+	failed   bool
+}
+
+// eventTrace is a ring of the latest operations.
+type eventTrace struct {
+	mu     sync.Mutex
+	events []traceEvent
+	next   int
+	full   bool
+}
+
+func newEventTrace(capacity int) *eventTrace {
+	return &eventTrace{events: make([]traceEvent, capacity)}
+}
+
+// record is an event sink keeping every operation.
+func (t *eventTrace) record(ev *opEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events[t.next] = traceEvent{op: ev.Op, start: ev.Start, duration: ev.Duration, failed: ev.Err != nil}
+	t.next = (t.next + 1) % len(t.events)
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// snapshot returns the events kept, oldest first.
+func (t *eventTrace) snapshot() []traceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.full {
+		return append([]traceEvent(nil), t.events[:t.next]...)
+	}
+	return append(append([]traceEvent(nil), t.events[t.next:]...), t.events[:t.next]...)
+}
+
+// chromeEvent is a complete event of the Trace Event format.
+type chromeEvent struct {
+	Name  string            `json:"name"`
+	Phase string            `json:"ph"`
+	Ts    float64           `json:"ts"`
+	Dur   float64           `json:"dur"`
+	Pid   int               `json:"pid"`
+	Tid   int               `json:"tid"`
+	Args  map[string]string `json:"args,omitempty"`
+}
+
+// ExportTrace writes the operations kept by WithEventTrace to w in
+// format, TraceFormatChrome or TraceFormatFolded. In the Chrome format,
+// concurrent operations are spread over as many threads as needed for
+// none to overlap. Without WithEventTrace nothing is kept and an empty
+// trace is written.
+func (m *measure) ExportTrace(w io.Writer, format string) error {
+	var events []traceEvent
+	if m.eventTrace != nil {
+		events = m.eventTrace.snapshot()
+	}
+	switch format {
+	case TraceFormatChrome:
+		return writeChromeTrace(w, events)
+	case TraceFormatFolded:
+		return writeFoldedTrace(w, m.reg.prefix, events)
+	}
+	return fmt.Errorf("measure: unknown trace format %q", format)
+}
+
+func writeChromeTrace(w io.Writer, events []traceEvent) error {
+	sort.Slice(events, func(i, j int) bool { return events[i].start.Before(events[j].start) })
+	// ends holds the end of the last event of each thread.
+	var ends []time.Time
+	out := make([]chromeEvent, 0, len(events))
+	for _, ev := range events {
+		tid := len(ends)
+		for i, end := range ends {
+			if !end.After(ev.start) {
+				tid = i
+				break
+			}
+		}
+		end := ev.start.Add(ev.duration)
+		if tid == len(ends) {
+			ends = append(ends, end)
+		} else {
+			ends[tid] = end
+		}
+		ce := chromeEvent{
+			Name:  ev.op,
+			Phase: "X",
+			Ts:    float64(ev.start.UnixNano()) / 1e3,
+			Dur:   float64(ev.duration) / 1e3,
+			Pid:   1,
+			Tid:   tid + 1,
+		}
+		if ev.failed {
+			ce.Args = map[string]string{"error": "true"}
+		}
+		out = append(out, ce)
+	}
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}{out})
+}
+
+func writeFoldedTrace(w io.Writer, prefix string, events []traceEvent) error {
+	totals := make(map[string]time.Duration)
+	for _, ev := range events {
+		stack := prefix + ";" + ev.op
+		if ev.failed {
+			stack += ";error"
+		}
+		totals[stack] += ev.duration
+	}
+	stacks := make([]string, 0, len(totals))
+	for stack := range totals {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", stack, totals[stack].Microseconds()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestEventTraceExport(t *testing.T) {
+	m := New("t", testutil.New(), WithEventTrace(3))
+	blks := mkBlocks(5)
+	for _, b := range blks {
+		if err := m.Put(context.Background(), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := m.ExportTrace(&buf, TraceFormatChrome); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		TraceEvents []map[string]interface{} `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.TraceEvents) != 3 {
+		t.Fatalf("got %d events", len(out.TraceEvents))
+	}
+	buf.Reset()
+	if err := m.ExportTrace(&buf, TraceFormatFolded); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "t;put ") {
+		t.Fatalf("folded: %q", buf.String())
+	}
+	if err := m.ExportTrace(&buf, "nope"); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,106 @@
+package measure
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// Exemplar links a histogram observation to the trace of the operation
+// that made it.
+type Exemplar struct {
+	TraceID string
+	Value   float64
+	Time    time.Time
+}
+
+// ExemplarRecorder is implemented by Recorders that can attach exemplars
+// to histogram observations. Observations carrying a trace ID are passed
+// to ObserveHistogramExemplar instead of ObserveHistogram.
+type ExemplarRecorder interface {
+	Recorder
+	ObserveHistogramExemplar(name string, v float64, traceID string)
+}
+
+// WithExemplars attaches the trace ID returned by traceID, if not empty,
+// to the latency observation of each operation as an exemplar. The
+// latest exemplar of every bucket is kept in HistogramStats.Exemplars,
+// and exemplars are passed to Recorders implementing ExemplarRecorder.
+// Other recorders get plain observations.
+func WithExemplars(traceID func(context.Context) string) Option {
+	return func(cfg *config) {
+		cfg.traceID = traceID
+	}
+}
+
+// exemplarObserver is implemented by histograms that accept exemplars,
+// including those wrapping another histogram, which pass them on.
+type exemplarObserver interface {
+	observeExemplar(v float64, traceID string)
+}
+
+// observeExemplar is h.Observe(v), attaching traceID as an exemplar when
+// h supports them.
+func observeExemplar(h metrics.Histogram, v float64, traceID string) {
+	if e, ok := h.(exemplarObserver); ok && traceID != "" {
+		e.observeExemplar(v, traceID)
+		return
+	}
+	h.Observe(v)
+}
+
+// recordLatencyExemplar is recordLatency with the trace ID of ctx, if
+// any, as exemplar.
+func (m *measure) recordLatencyExemplar(ctx context.Context, h metrics.Histogram, start time.Time) {
+	var id string
+	if m.traceID != nil {
+		id = m.traceID(ctx)
+	}
+	observeExemplar(h, m.clock.Now().Sub(start).Seconds(), id)
+}
+
+// exemplars holds the latest exemplar of each bucket of a histogram.
+type exemplars struct {
+	mu sync.Mutex
+	ex []Exemplar
+}
+
+func (h *histogram) observeExemplar(v float64, traceID string) {
+	h.observe(v)
+	h.ex.mu.Lock()
+	if h.ex.ex == nil {
+		h.ex.ex = make([]Exemplar, len(h.counts))
+	}
+	h.ex.ex[sort.SearchFloat64s(h.bounds, v)] = Exemplar{TraceID: traceID, Value: v, Time: time.Now()}
+	h.ex.mu.Unlock()
+	if er, ok := h.rec.(ExemplarRecorder); ok {
+		er.ObserveHistogramExemplar(h.name, v, traceID)
+	} else if h.rec != nil {
+		h.rec.ObserveHistogram(h.name, v)
+	}
+}
+
+// snapshot returns a copy of the exemplars, or nil if there are none.
+func (e *exemplars) snapshot() []Exemplar {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ex == nil {
+		return nil
+	}
+	return append([]Exemplar(nil), e.ex...)
+}
+
+func (h scaledHistogram) observeExemplar(v float64, traceID string) {
+	observeExemplar(h.Histogram, v*h.scale, traceID)
+}
+
+func (h *coldHistogram) observeExemplar(v float64, traceID string) {
+	observeExemplar(h.target(), v, traceID)
+}
+
+func (h *warmupHistogram) observeExemplar(v float64, traceID string) {
+	observeExemplar(h.target(), v, traceID)
+}
@@ -0,0 +1,63 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type traceKey struct{}
+
+type exRec struct {
+	plain, ex int
+	id        string
+}
+
+func (r *exRec) IncCounter(string, float64)       {}
+func (r *exRec) SetGauge(string, float64)         {}
+func (r *exRec) ObserveHistogram(string, float64) { r.plain++ }
+func (r *exRec) ObserveHistogramExemplar(name string, v float64, id string) {
+	r.ex++
+	r.id = id
+}
+
+func TestExemplars(t *testing.T) {
+	rec := &exRec{}
+	fb := testutil.New()
+	fb.SetLatency(testutil.Get, testutil.Fixed(30*time.Millisecond))
+	m := New("ex", fb, WithRecorder(rec), WithExemplars(func(ctx context.Context) string {
+		id, _ := ctx.Value(traceKey{}).(string)
+		return id
+	}))
+	b := blocks.NewBlock([]byte("x"))
+	m.Put(context.Background(), b)
+	ctx := context.WithValue(context.Background(), traceKey{}, "abc")
+	m.Get(ctx, b.Cid()) // cold start
+	m.Get(ctx, b.Cid())
+	h := m.Stats().Histograms["get.latency_seconds"]
+	found := false
+	for i, e := range h.Exemplars {
+		if e.TraceID == "abc" && h.Counts[i] == 1 && e.Value >= 0.03 {
+			found = true
+		}
+	}
+	if !found || rec.id != "abc" || rec.ex != 2 {
+		t.Fatal(h.Exemplars, rec)
+	}
+	if m.Stats().Histograms["cold_start.latency_seconds"].Exemplars == nil {
+		t.Fatal("cold")
+	}
+	if m.Stats().Histograms["put.latency_seconds"].Exemplars != nil {
+		t.Fatal("put has exemplar")
+	}
+	n := New("ex2", testutil.New(), WithLatencyUnit(Milliseconds), WithExemplars(func(context.Context) string { return "t" }))
+	n.Put(ctx, b)
+	n.Put(ctx, b)
+	if e := n.Stats().Histograms["put.latency_milliseconds"].Exemplars; e == nil {
+		t.Fatal("scaled")
+	}
+}
@@ -0,0 +1,177 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// ErrFaultInjected is returned by calls failed by WithFaultInjection
+// when FaultSpec.Err is nil.
+var ErrFaultInjected = errors.New("measure: injected fault")
+
+// FaultSpec describes the faults injected into the backend calls of an
+// operation.
+type FaultSpec struct {
+	// ErrorProbability is the probability, from 0 to 1, of a call
+	// failing with Err, or ErrFaultInjected if Err is nil, without
+	// reaching the backend.
+	ErrorProbability float64
+	Err              error
+	// DelayProbability is the probability of a call being delayed by
+	// Delay plus a uniformly distributed extra of up to Jitter before
+	// it reaches the backend.
+	DelayProbability float64
+	Delay            time.Duration
+	Jitter           time.Duration
+}
+
+// FaultConfig configures WithFaultInjection.
+type FaultConfig struct {
+	// Faults holds the faults of each operation. View is injected as
+	// Get, and operations without faults are left alone.
+	Faults map[Op]FaultSpec
+	// Seed seeds the random decisions, so that a sequence of calls is
+	// affected reproducibly.
+	Seed int64
+}
+
+// WithFaultInjection makes backend calls fail or slow down at random,
+// as configured, to check how callers and dashboards react to a
+// misbehaving store. It is meant for resilience testing, never for
+// production. Faults are injected by the last interceptor, see
+// WithInterceptor, so they show in the operation metrics like real
+// ones; to tell them apart, injected errors are counted in
+// fault.injected_errors_total and as wrapper errors rather than backend
+// errors, and injected delays in fault.injected_delays_total.
+func WithFaultInjection(fc FaultConfig) Option {
+	return func(cfg *config) {
+		cfg.faults = &fc
+	}
+}
+
+// faultInjector is the Interceptor injecting the faults of a
+// FaultConfig.
+type faultInjector struct {
+	faults map[Op]FaultSpec
+	errors metrics.Counter
+	delays metrics.Counter
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newFaultInjector(r *registry, fc FaultConfig) *faultInjector {
+	return &faultInjector{
+		faults: fc.Faults,
+		errors: r.counter("fault.injected_errors_total", "Number of errors injected into backend calls"),
+		delays: r.counter("fault.injected_delays_total", "Number of delays injected into backend calls"),
+		rng:    rand.New(rand.NewSource(fc.Seed)),
+	}
+}
+
+// inject applies the faults of op, returning the error the call must
+// fail with, if any.
+func (fi *faultInjector) inject(ctx context.Context, op Op) error {
+	spec, ok := fi.faults[op]
+	if !ok {
+		return nil
+	}
+	var delay time.Duration
+	fi.mu.Lock()
+	delayed := fi.rng.Float64() < spec.DelayProbability
+	if delayed {
+		delay = spec.Delay
+		if spec.Jitter > 0 {
+			delay += time.Duration(fi.rng.Int63n(int64(spec.Jitter)))
+		}
+	}
+	failed := fi.rng.Float64() < spec.ErrorProbability
+	fi.mu.Unlock()
+
+	if delayed {
+		fi.delays.Inc()
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if !failed {
+		return nil
+	}
+	fi.errors.Inc()
+	if spec.Err != nil {
+		return &injectedError{spec.Err}
+	}
+	return ErrFaultInjected
+}
+
+// injectedError marks a FaultSpec.Err as injected, so that it is counted
+// as a wrapper error.
+type injectedError struct {
+	err error
+}
+
+func (e *injectedError) Error() string { return e.err.Error() }
+
+func (e *injectedError) Unwrap() error { return e.err }
+
+func (e *injectedError) Is(target error) bool { return target == ErrFaultInjected }
+
+func (fi *faultInjector) Put(ctx context.Context, blk blocks.Block, next PutFunc) error {
+	if err := fi.inject(ctx, OpPut); err != nil {
+		return err
+	}
+	return next(ctx, blk)
+}
+
+func (fi *faultInjector) PutMany(ctx context.Context, blks []blocks.Block, next PutManyFunc) error {
+	if err := fi.inject(ctx, OpPutMany); err != nil {
+		return err
+	}
+	return next(ctx, blks)
+}
+
+func (fi *faultInjector) Get(ctx context.Context, c cid.Cid, next GetFunc) (blocks.Block, error) {
+	if err := fi.inject(ctx, OpGet); err != nil {
+		return nil, err
+	}
+	return next(ctx, c)
+}
+
+func (fi *faultInjector) Has(ctx context.Context, c cid.Cid, next HasFunc) (bool, error) {
+	if err := fi.inject(ctx, OpHas); err != nil {
+		return false, err
+	}
+	return next(ctx, c)
+}
+
+func (fi *faultInjector) GetSize(ctx context.Context, c cid.Cid, next GetSizeFunc) (int, error) {
+	if err := fi.inject(ctx, OpGetSize); err != nil {
+		return -1, err
+	}
+	return next(ctx, c)
+}
+
+func (fi *faultInjector) DeleteBlock(ctx context.Context, c cid.Cid, next DeleteFunc) error {
+	if err := fi.inject(ctx, OpDelete); err != nil {
+		return err
+	}
+	return next(ctx, c)
+}
+
+func (fi *faultInjector) DeleteMany(ctx context.Context, cids []cid.Cid, next DeleteManyFunc) error {
+	if err := fi.inject(ctx, OpDeleteMany); err != nil {
+		return err
+	}
+	return next(ctx, cids)
+}
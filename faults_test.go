@@ -0,0 +1,37 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestFaultInjection(t *testing.T) {
+	ctx := context.Background()
+	boom := errors.New("boom")
+	m := New("fi", testutil.New(), WithFaultInjection(FaultConfig{Faults: map[Op]FaultSpec{
+		OpGet: {ErrorProbability: 1},
+		OpHas: {ErrorProbability: 1, Err: boom, DelayProbability: 1, Delay: time.Millisecond},
+	}}))
+	b := blocks.NewBlock([]byte("f"))
+	if err := m.Put(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := m.Get(ctx, b.Cid()); err != ErrFaultInjected {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.Has(ctx, b.Cid()); !errors.Is(err, boom) {
+		t.Fatal(err)
+	}
+	c := m.Stats().Counters
+	if c["fault.injected_errors_total"] != 6 || c["fault.injected_delays_total"] != 1 || c["get.errors_total"] != 0 || c["get.wrapper_errors_total"] != 5 {
+		t.Fatal(c)
+	}
+}
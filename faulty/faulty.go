@@ -0,0 +1,262 @@
+// Package faulty provides a blockstore wrapper that injects latency and
+// errors, for testing how callers and dashboards react to a misbehaving
+// store. It can be stacked under or over a measure wrapper.
+package faulty
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// Op names a blockstore operation faults can be configured for.
+type Op string
+
+const (
+	Put         Op = "put"
+	PutMany     Op = "putmany"
+	Get         Op = "get"
+	Has         Op = "has"
+	GetSize     Op = "getsize"
+	View        Op = "view"
+	DeleteBlock Op = "delete"
+	AllKeysChan Op = "allkeys"
+)
+
+// Kind is the type of a fault.
+type Kind string
+
+const (
+	// Latency delays the call before it reaches the backend.
+	Latency Kind = "latency"
+	// NotFound fails the call with a not-found error.
+	NotFound Kind = "notfound"
+	// Error fails the call with Fault.Err.
+	Error Kind = "error"
+	// Drop makes writes report success without reaching the backend. It
+	// has no effect on reads.
+	Drop Kind = "drop"
+)
+
+var kinds = []Kind{Latency, NotFound, Error, Drop}
+
+// ErrInjected is returned by Error faults that don't set Err.
+var ErrInjected = errors.New("faulty: injected error")
+
+// Fault describes one way a call may misbehave.
+type Fault struct {
+	Kind Kind
+	// Probability of the fault being injected into a call, from 0 to 1.
+	Probability float64
+	// Delay added by Latency faults, plus a uniformly distributed extra
+	// of up to Jitter.
+	Delay  time.Duration
+	Jitter time.Duration
+	// Err is returned by Error faults.
+	Err error
+}
+
+// Blockstore wraps a blockstore and injects the faults configured with
+// SetFaults.
+type Blockstore struct {
+	backend blockstore.Blockstore
+
+	injected map[Kind]*injectedCounter
+
+	mu     sync.Mutex
+	rng    *rand.Rand
+	faults map[Op][]Fault
+}
+
+type injectedCounter struct {
+	n uint64
+	c metrics.Counter
+}
+
+var _ blockstore.Blockstore = (*Blockstore)(nil)
+
+// New wraps bs. Fault decisions are drawn from a generator seeded with
+// seed, so a given sequence of calls is affected reproducibly. Injected
+// faults are counted in metrics named prefix.fault.<kind>.injected_total.
+func New(prefix string, bs blockstore.Blockstore, seed int64) *Blockstore {
+	f := &Blockstore{
+		backend:  bs,
+		injected: make(map[Kind]*injectedCounter, len(kinds)),
+		rng:      rand.New(rand.NewSource(seed)),
+		faults:   make(map[Op][]Fault),
+	}
+	for _, k := range kinds {
+		f.injected[k] = &injectedCounter{
+			c: metrics.New(prefix+".fault."+string(k)+".injected_total",
+				"Number of injected "+string(k)+" faults").Counter(),
+		}
+	}
+	return f
+}
+
+// SetFaults replaces the faults for op. It is safe to call while the
+// blockstore is in use. Faults are evaluated in order; latency faults
+// are cumulative, the first failing fault that triggers ends the call.
+func (f *Blockstore) SetFaults(op Op, faults ...Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults[op] = append([]Fault(nil), faults...)
+}
+
+// Injected returns how many faults of the given kind were injected.
+func (f *Blockstore) Injected(kind Kind) uint64 {
+	ic, ok := f.injected[kind]
+	if !ok {
+		return 0
+	}
+	return atomic.LoadUint64(&ic.n)
+}
+
+func (f *Blockstore) count(kind Kind) {
+	ic := f.injected[kind]
+	atomic.AddUint64(&ic.n, 1)
+	ic.c.Inc()
+}
+
+// inject applies the faults configured for op. It returns a non-nil
+// error if the call must fail with it, and drop if a write must be
+// skipped.
+func (f *Blockstore) inject(ctx context.Context, op Op, c cid.Cid) (drop bool, err error) {
+	var delay time.Duration
+	f.mu.Lock()
+	for _, fault := range f.faults[op] {
+		if f.rng.Float64() >= fault.Probability {
+			continue
+		}
+		switch fault.Kind {
+		case Latency:
+			delay += fault.Delay
+			if fault.Jitter > 0 {
+				delay += time.Duration(f.rng.Int63n(int64(fault.Jitter)))
+			}
+			f.count(Latency)
+		case NotFound:
+			err = format.ErrNotFound{Cid: c}
+		case Error:
+			err = fault.Err
+			if err == nil {
+				err = ErrInjected
+			}
+		case Drop:
+			switch op {
+			case Put, PutMany, DeleteBlock:
+				drop = true
+			default:
+				continue
+			}
+		default:
+			continue
+		}
+		if err != nil || drop {
+			f.count(fault.Kind)
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	return drop, err
+}
+
+func (f *Blockstore) Put(ctx context.Context, blk blocks.Block) error {
+	drop, err := f.inject(ctx, Put, blk.Cid())
+	if err != nil || drop {
+		return err
+	}
+	return f.backend.Put(ctx, blk)
+}
+
+func (f *Blockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	drop, err := f.inject(ctx, PutMany, cid.Undef)
+	if err != nil || drop {
+		return err
+	}
+	return f.backend.PutMany(ctx, blks)
+}
+
+func (f *Blockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if _, err := f.inject(ctx, Get, c); err != nil {
+		return nil, err
+	}
+	return f.backend.Get(ctx, c)
+}
+
+func (f *Blockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	if _, err := f.inject(ctx, Has, c); err != nil {
+		if format.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return f.backend.Has(ctx, c)
+}
+
+func (f *Blockstore) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	if _, err := f.inject(ctx, GetSize, c); err != nil {
+		return -1, err
+	}
+	return f.backend.GetSize(ctx, c)
+}
+
+func (f *Blockstore) View(ctx context.Context, c cid.Cid, cb func([]byte) error) error {
+	if _, err := f.inject(ctx, View, c); err != nil {
+		return err
+	}
+	if v, ok := f.backend.(blockstore.Viewer); ok {
+		return v.View(ctx, c, cb)
+	}
+	blk, err := f.backend.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+	return cb(blk.RawData())
+}
+
+func (f *Blockstore) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	drop, err := f.inject(ctx, DeleteBlock, c)
+	if err != nil || drop {
+		return err
+	}
+	return f.backend.DeleteBlock(ctx, c)
+}
+
+func (f *Blockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	if _, err := f.inject(ctx, AllKeysChan, cid.Undef); err != nil {
+		return nil, err
+	}
+	return f.backend.AllKeysChan(ctx)
+}
+
+func (f *Blockstore) HashOnRead(enabled bool) {
+	f.backend.HashOnRead(enabled)
+}
+
+func (f *Blockstore) Close() error {
+	if c, ok := f.backend.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package faulty
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	format "github.com/ipfs/go-ipld-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestFaults(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	f := New("test", fb, 1)
+	blk := blocks.NewBlock([]byte("block"))
+
+	f.SetFaults(Put, Fault{Kind: Drop, Probability: 1})
+	if err := f.Put(ctx, blk); err != nil {
+		t.Fatal(err)
+	}
+	if fb.Len() != 0 {
+		t.Fatal("dropped write reached the backend")
+	}
+	f.SetFaults(Put)
+	if err := f.Put(ctx, blk); err != nil || fb.Len() != 1 {
+		t.Fatalf("write after clearing faults: %v, %d blocks", err, fb.Len())
+	}
+
+	f.SetFaults(Get, Fault{Kind: NotFound, Probability: 1})
+	if _, err := f.Get(ctx, blk.Cid()); !format.IsNotFound(err) {
+		t.Fatalf("got %v, want not found", err)
+	}
+	f.SetFaults(Has, Fault{Kind: NotFound, Probability: 1})
+	if ok, err := f.Has(ctx, blk.Cid()); ok || err != nil {
+		t.Fatalf("Has = %v, %v with a not-found fault", ok, err)
+	}
+
+	errBoom := errors.New("boom")
+	f.SetFaults(Get, Fault{Kind: Error, Probability: 1, Err: errBoom})
+	if _, err := f.Get(ctx, blk.Cid()); err != errBoom {
+		t.Fatalf("got %v, want %v", err, errBoom)
+	}
+	f.SetFaults(GetSize, Fault{Kind: Error, Probability: 1})
+	if _, err := f.GetSize(ctx, blk.Cid()); err != ErrInjected {
+		t.Fatalf("got %v, want ErrInjected", err)
+	}
+	// Drop doesn't affect reads.
+	f.SetFaults(Get, Fault{Kind: Drop, Probability: 1})
+	if _, err := f.Get(ctx, blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	for kind, want := range map[Kind]uint64{Drop: 1, NotFound: 2, Error: 2, Latency: 0} {
+		if got := f.Injected(kind); got != want {
+			t.Errorf("Injected(%s) = %d, want %d", kind, got, want)
+		}
+	}
+}
+
+func TestLatencyFault(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	f := New("test", fb, 1)
+	blk := blocks.NewBlock([]byte("block"))
+	fb.Put(ctx, blk)
+
+	f.SetFaults(Get, Fault{Kind: Latency, Probability: 1, Delay: 20 * time.Millisecond})
+	start := time.Now()
+	if _, err := f.Get(ctx, blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Fatalf("Get took %v, want at least 20ms", d)
+	}
+
+	f.SetFaults(Get, Fault{Kind: Latency, Probability: 1, Delay: time.Hour})
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := f.Get(cctx, blk.Cid()); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want the context's error", err)
+	}
+	if got := f.Injected(Latency); got != 2 {
+		t.Fatalf("Injected(latency) = %d, want 2", got)
+	}
+}
+
+func TestSeeded(t *testing.T) {
+	ctx := context.Background()
+	blk := blocks.NewBlock([]byte("block"))
+	outcomes := func(seed int64) []bool {
+		fb := testutil.New()
+		fb.Put(ctx, blk)
+		f := New("test", fb, seed)
+		f.SetFaults(Get, Fault{Kind: Error, Probability: 0.5})
+		var out []bool
+		for i := 0; i < 64; i++ {
+			_, err := f.Get(ctx, blk.Cid())
+			out = append(out, err != nil)
+		}
+		return out
+	}
+
+	a, b := outcomes(42), outcomes(42)
+	var failed int
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("call %d differs between runs with the same seed", i)
+		}
+		if a[i] {
+			failed++
+		}
+	}
+	if failed == 0 || failed == len(a) {
+		t.Fatalf("%d of %d calls failed with probability 0.5", failed, len(a))
+	}
+}
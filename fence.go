@@ -0,0 +1,60 @@
+package measure
+
+import (
+	"errors"
+	"math"
+	"sync/atomic"
+)
+
+// ErrFenced is returned by writes made with an older generation than one
+// already seen, see WithFencingToken.
+var ErrFenced = errors.New("measure: write fenced by a newer generation")
+
+// WithFencingToken fences off writes from stale writers, such as a
+// former leader that hasn't noticed it lost an election. Every Put,
+// PutMany, PutWithTTL, DeleteBlock and DeleteMany calls token for the
+// generation it is made under. The wrapper remembers the highest
+// generation seen, from writes or from ObserveGeneration, and fails
+// writes made under a lower one with ErrFenced, counting them in
+// write.fenced_total.
+//
+// Only writes going through this wrapper are fenced, and only those
+// starting after the newer generation was seen; a write already running
+// completes. Reads are never fenced.
+func WithFencingToken(token func() int64) Option {
+	return func(cfg *config) {
+		cfg.fencingToken = token
+	}
+}
+
+type fence struct {
+	highest int64 // updated atomically
+	token   func() int64
+}
+
+func newFence(token func() int64) *fence {
+	return &fence{highest: math.MinInt64, token: token}
+}
+
+// ObserveGeneration tells the wrapper that generation gen exists, so
+// that writes made under older generations are fenced from now on even
+// if no write under gen went through the wrapper yet.
+func (m *measure) ObserveGeneration(gen int64) {
+	if m.fence != nil {
+		raiseTo(&m.fence.highest, gen)
+	}
+}
+
+// fenced returns ErrFenced if a write by op must be rejected.
+func (m *measure) fenced(op Op) error {
+	if m.fence == nil {
+		return nil
+	}
+	gen := m.fence.token()
+	raiseTo(&m.fence.highest, gen)
+	if gen >= atomic.LoadInt64(&m.fence.highest) {
+		return nil
+	}
+	m.reg.counter("write.fenced_total", "Number of writes rejected because a newer generation was seen").Inc()
+	return ErrFenced
+}
@@ -0,0 +1,33 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestFencing(t *testing.T) {
+	ctx := context.Background()
+	gen := int64(1)
+	m := New("fe", testutil.New(), WithFencingToken(func() int64 { return gen }))
+	if err := m.Put(ctx, blocks.NewBlock([]byte("a"))); err != nil {
+		t.Fatal(err)
+	}
+	m.ObserveGeneration(2)
+	err := m.Put(ctx, blocks.NewBlock([]byte("b")))
+	if !errors.Is(err, ErrFenced) {
+		t.Fatal(err)
+	}
+	st := m.Stats().Counters
+	if st["write.fenced_total"] != 1 || st["put.wrapper_errors_total"] != 1 || st["put.errors_total"] != 0 {
+		t.Fatal(st)
+	}
+	gen = 2
+	if err := m.Put(ctx, blocks.NewBlock([]byte("c"))); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,153 @@
+package measure
+
+import (
+	"sync"
+	"time"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// lazyFreeSpaceEvery is how often writes refresh the free space when
+// WithFreeSpaceMonitor is given no interval.
+const lazyFreeSpaceEvery = time.Second
+
+// FreeSpacer is implemented by backends able to tell how much space is
+// left for them, such as the free bytes of the file system they are on.
+type FreeSpacer interface {
+	FreeSpace() (int64, error)
+}
+
+// WithFreeSpaceMonitor reports the free space of a FreeSpacer backend,
+// found by looking through wrappers, in the backend.free_bytes gauge.
+// It is refreshed every interval by a goroutine stopped by Close, or, if
+// interval is zero, after writes at most once a second. Every time the
+// free space drops below lowBytes, backend.low_space_total is
+// incremented; it must rise back above before being counted again.
+// Failures to read the free space are counted in
+// backend.free_space_errors_total. Backends that aren't FreeSpacers
+// report nothing.
+func WithFreeSpaceMonitor(interval time.Duration, lowBytes int64) Option {
+	return func(cfg *config) {
+		cfg.freeSpace = true
+		cfg.freeSpaceInterval = interval
+		cfg.freeSpaceLow = lowBytes
+	}
+}
+
+type freeSpaceMonitor struct {
+	backend FreeSpacer
+	low     int64
+	clock   Clock
+	free    metrics.Gauge
+	lowHits metrics.Counter
+	errors  metrics.Counter
+
+	mu sync.Mutex
+	// last is when the free space was last read by a write, and isLow
+	// whether it was below low then.
+	last  time.Time
+	isLow bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newFreeSpaceMonitor returns a monitor of the free space of bs, looking
+// through wrappers, or nil if bs doesn't report it.
+func newFreeSpaceMonitor(r *registry, bs blockstore.Blockstore, interval time.Duration, low int64, clock Clock) *freeSpaceMonitor {
+	var fs FreeSpacer
+	for {
+		if f, ok := bs.(FreeSpacer); ok {
+			fs = f
+			break
+		}
+		u, ok := bs.(unwrapper)
+		if !ok {
+			return nil
+		}
+		bs = u.Unwrap()
+	}
+	f := &freeSpaceMonitor{
+		backend: fs,
+		low:     low,
+		clock:   clock,
+		free:    r.gauge("backend.free_bytes", "Free space left for the backend, in bytes"),
+		lowHits: r.counter("backend.low_space_total", "Number of times the free space of the backend dropped below the threshold"),
+		errors:  r.counter("backend.free_space_errors_total", "Number of failures to read the free space of the backend"),
+	}
+	f.refresh()
+	if interval > 0 {
+		f.stop = make(chan struct{})
+		f.done = make(chan struct{})
+		go f.run(interval)
+	}
+	return f
+}
+
+func (f *freeSpaceMonitor) run(interval time.Duration) {
+	defer close(f.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			f.refresh()
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// refresh reads the free space and updates the metrics.
+func (f *freeSpaceMonitor) refresh() {
+	free, err := f.backend.FreeSpace()
+	if err != nil {
+		f.errors.Inc()
+		return
+	}
+	f.free.Set(float64(free))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.last = f.clock.Now()
+	low := free < f.low
+	if low && !f.isLow {
+		f.lowHits.Inc()
+	}
+	f.isLow = low
+}
+
+// afterWrite refreshes the free space if it isn't refreshed
+// periodically and wasn't for a second.
+func (f *freeSpaceMonitor) afterWrite() {
+	if f.stop != nil {
+		return
+	}
+	f.mu.Lock()
+	due := f.clock.Now().Sub(f.last) >= lazyFreeSpaceEvery
+	f.mu.Unlock()
+	if due {
+		f.refresh()
+	}
+}
+
+// close stops the periodic refreshes.
+func (f *freeSpaceMonitor) close() {
+	if f.stop == nil {
+		return
+	}
+	select {
+	case <-f.stop:
+		return
+	default:
+	}
+	close(f.stop)
+	<-f.done
+}
+
+// observeFreeSpace refreshes the free space after a write.
+func (m *measure) observeFreeSpace() {
+	if m.freeSpace != nil {
+		m.freeSpace.afterWrite()
+	}
+}
@@ -0,0 +1,48 @@
+package measure
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type shrinkingBS struct {
+	*testutil.Blockstore
+	free int64
+}
+
+func (s *shrinkingBS) FreeSpace() (int64, error) { return atomic.LoadInt64(&s.free), nil }
+
+func TestFreeSpace(t *testing.T) {
+	ctx := context.Background()
+	clk := &fakeClock{t: time.Unix(0, 0)}
+	bs := &shrinkingBS{Blockstore: testutil.New(), free: 1000}
+	m := New("fs", bs, WithFreeSpaceMonitor(0, 500), WithClock(clk))
+	blks := mkBlocks(4)
+	for i, free := range []int64{800, 400, 300, 600} {
+		atomic.StoreInt64(&bs.free, free)
+		m.Put(ctx, blks[i])
+		clk.Advance(2 * time.Second)
+	}
+	atomic.StoreInt64(&bs.free, 100)
+	m.Put(ctx, blks[0])
+	st := m.Stats()
+	if st.Gauges["backend.free_bytes"] != 100 || st.Counters["backend.low_space_total"] != 2 {
+		t.Fatal(st.Gauges, st.Counters)
+	}
+
+	bg := &shrinkingBS{Blockstore: testutil.New(), free: 1000}
+	n := New("fs2", bg, WithFreeSpaceMonitor(time.Millisecond, 500))
+	atomic.StoreInt64(&bg.free, 10)
+	time.Sleep(50 * time.Millisecond)
+	n.Close()
+	if n.Stats().Counters["backend.low_space_total"] != 1 {
+		t.Fatal(n.Stats().Counters)
+	}
+	if _, ok := New("fs3", testutil.New(), WithFreeSpaceMonitor(0, 1)).Stats().Gauges["backend.free_bytes"]; ok {
+		t.Fatal("gauge without capability")
+	}
+}
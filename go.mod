@@ -6,7 +6,10 @@ require (
 	github.com/ipfs/go-block-format v0.0.3
 	github.com/ipfs/go-cid v0.2.0
 	github.com/ipfs/go-datastore v0.5.1
+	github.com/ipfs/go-ds-badger v0.3.0
+	github.com/ipfs/go-ds-flatfs v0.5.1
 	github.com/ipfs/go-ipfs-blockstore v1.2.0
 	github.com/ipfs/go-ipld-format v0.4.0
 	github.com/ipfs/go-metrics-interface v0.0.1
+	github.com/prometheus/client_golang v1.12.2
 )
@@ -0,0 +1,21 @@
+package measure
+
+// CombinedHitRate returns the hit rate of a cache wrapped as cache in
+// front of a backing store wrapped as backing, both with New: one minus
+// the reads (Get and View calls) the backing store served over those the
+// cache served. It assumes the backing store is only read on cache
+// misses, and by nothing else; reads of the backing store made for other
+// reasons lower the rate, which is clamped to 0. It returns 0 before the
+// cache is read.
+func CombinedHitRate(cache, backing *measure) float64 {
+	cacheReads := counterValue(cache.getNum) + counterValue(cache.viewNum)
+	if cacheReads == 0 {
+		return 0
+	}
+	backingReads := counterValue(backing.getNum) + counterValue(backing.viewNum)
+	rate := 1 - backingReads/cacheReads
+	if rate < 0 {
+		return 0
+	}
+	return rate
+}
@@ -0,0 +1,45 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type readThroughBS struct {
+	*testutil.Blockstore
+	backing *measure
+}
+
+func (r readThroughBS) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if blk, err := r.Blockstore.Get(ctx, c); err == nil {
+		return blk, nil
+	}
+	blk, err := r.backing.Get(ctx, c)
+	if err == nil {
+		r.Blockstore.Put(ctx, blk)
+	}
+	return blk, err
+}
+
+func TestCombinedHitRate(t *testing.T) {
+	ctx := context.Background()
+	backing := New("backing", testutil.New())
+	cache := New("cache", readThroughBS{testutil.New(), backing})
+	blks := mkBlocks(2)
+	for _, b := range blks {
+		backing.Put(ctx, b)
+	}
+	for i := 0; i < 4; i++ {
+		for _, b := range blks {
+			cache.Get(ctx, b.Cid())
+		}
+	}
+	if r := CombinedHitRate(cache, backing); r != 0.75 {
+		t.Fatal(r)
+	}
+}
@@ -0,0 +1,151 @@
+package measure
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithHotBlocks tracks how many Get and View calls are running at once
+// for each CID. The highest such concurrency seen for any CID is kept in
+// the get.max_concurrent_per_cid gauge, and the top hottest CIDs are
+// returned by HotBlocks. At most size CIDs are tracked; when more are
+// read, the coldest ones not being read are forgotten.
+func WithHotBlocks(size, top int) Option {
+	return func(cfg *config) {
+		cfg.hotSize = size
+		cfg.hotTop = top
+	}
+}
+
+type hotEntry struct {
+	// inflight, peak and reads are updated atomically, and come first
+	// for alignment. inflight is only incremented with the tracker's
+	// lock held.
+	inflight int64
+	peak     int64
+	reads    uint64
+	c        cid.Cid
+}
+
+// hotter orders entries by peak concurrency, then by number of reads.
+func (e *hotEntry) hotter(o *hotEntry) bool {
+	ep, op := atomic.LoadInt64(&e.peak), atomic.LoadInt64(&o.peak)
+	if ep != op {
+		return ep > op
+	}
+	return atomic.LoadUint64(&e.reads) > atomic.LoadUint64(&o.reads)
+}
+
+type hotTracker struct {
+	max       int64 // updated atomically
+	size, top int
+	maxGauge  metrics.Gauge
+
+	mu      sync.Mutex
+	entries map[cid.Cid]*hotEntry
+}
+
+func newHotTracker(r *registry, size, top int) *hotTracker {
+	return &hotTracker{
+		size:     size,
+		top:      top,
+		maxGauge: r.gauge("get.max_concurrent_per_cid", "Highest number of concurrent Get and View calls seen for a single CID"),
+		entries:  make(map[cid.Cid]*hotEntry),
+	}
+}
+
+// enterHot records the start of a read of c, returning what exitHot
+// needs to record its end.
+func (m *measure) enterHot(c cid.Cid) *hotEntry {
+	h := m.hot
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	e, ok := h.entries[c]
+	if !ok {
+		if len(h.entries) >= h.size {
+			h.evict()
+		}
+		e = &hotEntry{c: c}
+		h.entries[c] = e
+	}
+	n := atomic.AddInt64(&e.inflight, 1)
+	h.mu.Unlock()
+
+	atomic.AddUint64(&e.reads, 1)
+	raiseTo(&e.peak, n)
+	if raiseTo(&h.max, n) {
+		h.maxGauge.Set(float64(n))
+	}
+	return e
+}
+
+// exitHot records the end of a read started with enterHot.
+func (m *measure) exitHot(e *hotEntry) {
+	if e != nil {
+		atomic.AddInt64(&e.inflight, -1)
+	}
+}
+
+// raiseTo sets *v to n if that is higher, and reports whether it did.
+func raiseTo(v *int64, n int64) bool {
+	for {
+		old := atomic.LoadInt64(v)
+		if n <= old {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(v, old, n) {
+			return true
+		}
+	}
+}
+
+// evict forgets the coldest quarter of the entries not being read, so
+// that the sort is paid for once every few insertions.
+func (h *hotTracker) evict() {
+	idle := make([]*hotEntry, 0, len(h.entries))
+	for _, e := range h.entries {
+		if atomic.LoadInt64(&e.inflight) == 0 {
+			idle = append(idle, e)
+		}
+	}
+	sort.Slice(idle, func(i, j int) bool { return idle[j].hotter(idle[i]) })
+	n := len(h.entries) - h.size*3/4
+	if n > len(idle) {
+		n = len(idle)
+	}
+	for _, e := range idle[:n] {
+		delete(h.entries, e.c)
+	}
+}
+
+// HotBlocks returns the hottest CIDs tracked by WithHotBlocks, hottest
+// first: those with the most concurrent reads, then the most reads. It
+// returns nil if hot blocks aren't tracked.
+func (m *measure) HotBlocks() []cid.Cid {
+	h := m.hot
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	entries := make([]*hotEntry, 0, len(h.entries))
+	for _, e := range h.entries {
+		entries = append(entries, e)
+	}
+	h.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].hotter(entries[j]) })
+	if len(entries) > h.top {
+		entries = entries[:h.top]
+	}
+	cids := make([]cid.Cid, len(entries))
+	for i, e := range entries {
+		cids[i] = e.c
+	}
+	return cids
+}
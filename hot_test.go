@@ -0,0 +1,42 @@
+package measure
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestHotBlocks(t *testing.T) {
+	ctx := context.Background()
+	mem := testutil.New()
+	m := New("hot", mem, WithHotBlocks(8, 2))
+	hot := blocks.NewBlock([]byte("hot"))
+	m.Put(ctx, hot)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				m.Get(ctx, hot.Cid())
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		b := blocks.NewBlock([]byte{byte(i)})
+		m.Put(ctx, b)
+		m.Get(ctx, b.Cid())
+	}
+	wg.Wait()
+	hb := m.HotBlocks()
+	if len(hb) != 2 || hb[0] != hot.Cid() {
+		t.Fatal(hb)
+	}
+	if m.Stats().Gauges["get.max_concurrent_per_cid"] < 1 {
+		t.Fatal("gauge")
+	}
+}
@@ -0,0 +1,45 @@
+package measure
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithHourlyLatency also records the latency of every operation by the
+// UTC hour of the day, read from the wrapper's clock, at which it
+// completed, in <op>.hour_<hh>.latency_seconds for the hours 00 to 23.
+// This shows diurnal patterns that the aggregate histograms average
+// away, such as peak hours being slower than nights. It adds 24
+// histograms per operation, each with all the latency buckets, so it
+// multiplies the number of exported series accordingly. The aggregate
+// histograms are unchanged.
+func WithHourlyLatency() Option {
+	return func(cfg *config) {
+		cfg.hourlyLatency = true
+	}
+}
+
+// newHourlyLatencies returns the histograms of WithHourlyLatency,
+// indexed by hour.
+func newHourlyLatencies(r *registry) map[Op][]metrics.Histogram {
+	hs := make(map[Op][]metrics.Histogram)
+	for _, op := range []Op{OpPut, OpPutMany, OpGet, OpHas, OpGetSize, OpDelete, OpDeleteMany, OpView} {
+		for hour := 0; hour < 24; hour++ {
+			hs[op] = append(hs[op], r.latency(fmt.Sprintf("%s.hour_%02d.latency", op, hour),
+				"Latency distribution of calls completed at one hour of the day, UTC"))
+		}
+	}
+	return hs
+}
+
+// observeHour records the latency of op in the histogram of the current
+// hour.
+func (m *measure) observeHour(op Op, start time.Time) {
+	hs, ok := m.hourlyLatencies[op]
+	if !ok {
+		return
+	}
+	recordLatency(m.clock, hs[m.clock.Now().UTC().Hour()], start)
+}
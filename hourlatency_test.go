@@ -0,0 +1,29 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type settableClock struct{ t *time.Time }
+
+func (c settableClock) Now() time.Time { return *c.t }
+
+func TestHourlyLatency(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	m := New("hl", testutil.New(), WithHourlyLatency(), WithClock(settableClock{&now}))
+	blk := mkBlocks(1)[0]
+	m.Put(ctx, blk)
+	m.Get(ctx, blk.Cid())
+	now = now.Add(14 * time.Hour)
+	m.Get(ctx, blk.Cid())
+	m.Get(ctx, blk.Cid())
+	s := m.Stats()
+	if s.Histograms["get.hour_03.latency_seconds"].Count != 1 || s.Histograms["get.hour_17.latency_seconds"].Count != 2 || s.Histograms["put.hour_03.latency_seconds"].Count != 1 {
+		t.Fatal(s.Histograms["get.hour_03.latency_seconds"], s.Histograms["get.hour_17.latency_seconds"])
+	}
+}
@@ -0,0 +1,36 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestIdentityCid(t *testing.T) {
+	c, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: 0, MhLength: -1}.Sum([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := testutil.New()
+	m := New("id", mem, WithIdentityShortCircuit())
+	blk, _ := blocks.NewBlockWithCid([]byte("hello"), c)
+	if err := m.Put(context.Background(), blk); err != nil {
+		t.Fatal(err)
+	}
+	calls := mem.Count(testutil.Get)
+	got, err := m.Get(context.Background(), c)
+	if err != nil || string(got.RawData()) != "hello" {
+		t.Fatal(got, err)
+	}
+	if mem.Count(testutil.Get) != calls {
+		t.Fatal("backend called")
+	}
+	s := m.Stats()
+	if s.Counters["get.identity_total"] != 1 || s.Counters["put.identity_total"] != 1 || s.Counters["get_total"] != 0 || s.Counters["put_total"] != 0 {
+		t.Fatal(s.Counters)
+	}
+}
@@ -0,0 +1,139 @@
+package measure
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+)
+
+// DefaultImportBatchSize is the number of blocks per PutMany used by
+// ImportBlocks when ImportOptions.BatchSize is zero.
+const DefaultImportBatchSize = 256
+
+// ImportOptions configures ImportBlocks.
+type ImportOptions struct {
+	// BatchSize is the maximum number of blocks written per PutMany.
+	BatchSize int
+	// BatchBytes, if positive, also ends a batch once its blocks hold
+	// that many bytes.
+	BatchBytes int
+	// SkipExisting checks every block with Has and leaves out those
+	// already stored.
+	SkipExisting bool
+}
+
+// ImportStats describes the progress of an import.
+type ImportStats struct {
+	// Blocks and Bytes count the blocks written.
+	Blocks int
+	Bytes  int64
+	// Skipped counts the blocks left out because they were stored
+	// already, see ImportOptions.SkipExisting.
+	Skipped int
+	// Done is the number of blocks received from the source that were
+	// written or skipped. An import can be resumed by sending the
+	// source's blocks from index Done on.
+	Done     int
+	Duration time.Duration
+}
+
+// ImportError is returned by ImportBlocks when an import stops early,
+// with the progress made until then.
+type ImportError struct {
+	Stats ImportStats
+	Err   error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("measure: import stopped after %d blocks: %v", e.Stats.Done, e.Err)
+}
+
+func (e *ImportError) Unwrap() error { return e.Err }
+
+// ImportBlocks writes the blocks received from src with PutMany, in
+// batches, until src is closed. It stops between batches when ctx is
+// done. Progress is published in the import.blocks_done,
+// import.bytes_done and import.rate (blocks per second) gauges, which
+// are reset when a new import starts.
+func (m *measure) ImportBlocks(ctx context.Context, src <-chan blocks.Block, opts ImportOptions) (ImportStats, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatchSize
+	}
+	blocksDone := m.reg.gauge("import.blocks_done", "Number of blocks written by the current import")
+	bytesDone := m.reg.gauge("import.bytes_done", "Number of bytes written by the current import")
+	rate := m.reg.gauge("import.rate", "Rate at which the current import writes blocks, per second")
+	blocksDone.Set(0)
+	bytesDone.Set(0)
+	rate.Set(0)
+
+	var st ImportStats
+	start := time.Now()
+	fail := func(err error) (ImportStats, error) {
+		st.Duration = time.Since(start)
+		return st, &ImportError{Stats: st, Err: err}
+	}
+
+	batch := make([]blocks.Block, 0, batchSize)
+	var batchBytes, skipped int
+	flush := func() error {
+		if len(batch) > 0 {
+			if err := m.PutMany(ctx, batch); err != nil {
+				return err
+			}
+		}
+		st.Blocks += len(batch)
+		st.Bytes += int64(batchBytes)
+		st.Skipped += skipped
+		st.Done += len(batch) + skipped
+		batch, batchBytes, skipped = batch[:0], 0, 0
+
+		blocksDone.Set(float64(st.Blocks))
+		bytesDone.Set(float64(st.Bytes))
+		if d := time.Since(start).Seconds(); d > 0 {
+			rate.Set(float64(st.Blocks) / d)
+		}
+		return nil
+	}
+
+	for {
+		var blk blocks.Block
+		var ok bool
+		select {
+		case blk, ok = <-src:
+		case <-ctx.Done():
+			return fail(ctx.Err())
+		}
+		if !ok {
+			break
+		}
+		if opts.SkipExisting {
+			has, err := m.Has(ctx, blk.Cid())
+			if err != nil {
+				return fail(err)
+			}
+			if has {
+				skipped++
+				continue
+			}
+		}
+		batch = append(batch, blk)
+		batchBytes += len(blk.RawData())
+		if len(batch) < batchSize && (opts.BatchBytes <= 0 || batchBytes < opts.BatchBytes) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+		if err := flush(); err != nil {
+			return fail(err)
+		}
+	}
+	if err := flush(); err != nil {
+		return fail(err)
+	}
+	st.Duration = time.Since(start)
+	return st, nil
+}
@@ -0,0 +1,56 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestImportBlocks(t *testing.T) {
+	ctx := context.Background()
+	mem := testutil.New()
+	m := New("imp", mem)
+	blks := mkBlocks(25)
+	m.Put(ctx, blks[3])
+	src := make(chan blocks.Block)
+	go func() {
+		for _, b := range blks {
+			src <- b
+		}
+		close(src)
+	}()
+	st, err := m.ImportBlocks(ctx, src, ImportOptions{BatchSize: 10, SkipExisting: true})
+	if err != nil || st.Blocks != 24 || st.Skipped != 1 || st.Done != 25 {
+		t.Fatal(st, err)
+	}
+	if mem.Count(testutil.PutMany) != 3 || m.Stats().Gauges["import.blocks_done"] != 24 {
+		t.Fatal(mem.Calls(), m.Stats().Gauges)
+	}
+
+	f := &flakyBS{Blockstore: testutil.New()}
+	n := New("imp2", f)
+	src = make(chan blocks.Block, 25)
+	for i, b := range blks {
+		src <- b
+		if i == 12 {
+			f.fail = true
+		}
+	}
+	close(src)
+	f.fail = false
+	_, err = n.ImportBlocks(ctx, src, ImportOptions{BatchSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = n.ImportBlocks(cctx, make(chan blocks.Block), ImportOptions{})
+	var ie *ImportError
+	if !errors.As(err, &ie) || !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
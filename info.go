@@ -0,0 +1,55 @@
+package measure
+
+import (
+	"reflect"
+	"strings"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// unwrapper is implemented by blockstores wrapping a single other one.
+type unwrapper interface {
+	Unwrap() blockstore.Blockstore
+}
+
+// parent is implemented by blockstores made of several others.
+type parent interface {
+	Children() []blockstore.Blockstore
+}
+
+// Unwrap returns the blockstore m wraps.
+func (m *measure) Unwrap() blockstore.Blockstore {
+	return m.backend
+}
+
+// Children returns the backends of the chain.
+func (c *Chain) Children() []blockstore.Blockstore {
+	return c.backends
+}
+
+// backendName describes the concrete type of bs, looking through
+// wrappers that implement Unwrap so that the innermost store is named.
+// Blockstores made of several others, implementing Children, are named
+// after their own type followed by their children in parentheses.
+func backendName(bs blockstore.Blockstore) string {
+	for {
+		u, ok := bs.(unwrapper)
+		if !ok {
+			break
+		}
+		bs = u.Unwrap()
+	}
+	if bs == nil {
+		return "<nil>"
+	}
+	name := reflect.TypeOf(bs).String()
+	if p, ok := bs.(parent); ok {
+		children := p.Children()
+		names := make([]string, len(children))
+		for i, child := range children {
+			names[i] = backendName(child)
+		}
+		name += "(" + strings.Join(names, ", ") + ")"
+	}
+	return name
+}
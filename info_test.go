@@ -0,0 +1,21 @@
+package measure
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestInfo(t *testing.T) {
+	inner := New("in", testutil.New())
+	m := New("out", NewChain("c", inner, testutil.New()))
+	s := m.Stats()
+	if !strings.HasPrefix(s.Backend, "*measure.Chain(") || strings.Contains(s.Backend, "measure.measure") || s.Created.IsZero() {
+		t.Fatal(s.Backend)
+	}
+	if _, ok := s.Gauges["uptime_seconds"]; !ok {
+		t.Fatal(s.Gauges)
+	}
+	t.Log(s.Backend)
+}
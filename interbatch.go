@@ -0,0 +1,75 @@
+package measure
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// interBatchWeight is the weight of each new interval in the moving
+// mean and variance behind putmany.arrival_regularity.
+const interBatchWeight = 0.1
+
+// WithInterBatchTiming records the time between the starts of
+// consecutive PutMany calls, read from the wrapper's clock, in
+// putmany.interbatch_seconds, and their coefficient of variation, the
+// standard deviation over the mean of exponentially weighted moving
+// averages of the intervals, in putmany.arrival_regularity. A value near
+// 0 means batches arrive at regular intervals, for example from a
+// scheduler; around 1 or above they arrive at random or in bursts. This
+// helps size the buffering of ingest pipelines.
+func WithInterBatchTiming() Option {
+	return func(cfg *config) {
+		cfg.interBatchTiming = true
+	}
+}
+
+type interBatchTimer struct {
+	interval   metrics.Histogram
+	regularity metrics.Gauge
+
+	mu             sync.Mutex
+	last           time.Time
+	mean, variance float64
+	intervals      int
+}
+
+func newInterBatchTimer(r *registry) *interBatchTimer {
+	return &interBatchTimer{
+		interval: r.latency("putmany.interbatch",
+			"Distribution of the time between the starts of consecutive PutMany calls"),
+		regularity: r.gauge("putmany.arrival_regularity",
+			"Coefficient of variation of the time between PutMany calls, low for regular arrivals"),
+	}
+}
+
+// observeInterBatch records the arrival of a PutMany call.
+func (m *measure) observeInterBatch() {
+	t := m.interBatch
+	if t == nil {
+		return
+	}
+	now := m.clock.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last := t.last
+	t.last = now
+	if last.IsZero() {
+		return
+	}
+	d := now.Sub(last).Seconds()
+	t.interval.Observe(d)
+	t.intervals++
+	if t.intervals == 1 {
+		t.mean = d
+		return
+	}
+	diff := d - t.mean
+	t.mean += interBatchWeight * diff
+	t.variance = (1 - interBatchWeight) * (t.variance + interBatchWeight*diff*diff)
+	if t.mean > 0 {
+		t.regularity.Set(math.Sqrt(t.variance) / t.mean)
+	}
+}
@@ -0,0 +1,36 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestInterBatchRegularity(t *testing.T) {
+	ctx := context.Background()
+	run := func(gaps []time.Duration) float64 {
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		m := New("ib", testutil.New(), WithInterBatchTiming(), WithClock(settableClock{&now}))
+		m.PutMany(ctx, mkBlocks(2))
+		for _, g := range gaps {
+			now = now.Add(g)
+			m.PutMany(ctx, mkBlocks(2))
+		}
+		s := m.Stats()
+		if s.Histograms["putmany.interbatch_seconds"].Count != uint64(len(gaps)) {
+			t.Fatal(s.Histograms["putmany.interbatch_seconds"])
+		}
+		return s.Gauges["putmany.arrival_regularity"]
+	}
+	var regular, irregular []time.Duration
+	for i := 0; i < 20; i++ {
+		regular = append(regular, time.Second)
+		irregular = append(irregular, time.Duration(1+(i*7)%5)*time.Second/time.Duration(1+i%3))
+	}
+	r, ir := run(regular), run(irregular)
+	if r > 0.01 || ir < 0.2 {
+		t.Fatal(r, ir)
+	}
+}
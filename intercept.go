@@ -0,0 +1,322 @@
+package measure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// The next functions given to an Interceptor call the following
+// interceptor, or the backend after the last one.
+type (
+	PutFunc        func(ctx context.Context, blk blocks.Block) error
+	PutManyFunc    func(ctx context.Context, blks []blocks.Block) error
+	GetFunc        func(ctx context.Context, c cid.Cid) (blocks.Block, error)
+	HasFunc        func(ctx context.Context, c cid.Cid) (bool, error)
+	GetSizeFunc    func(ctx context.Context, c cid.Cid) (int, error)
+	DeleteFunc     func(ctx context.Context, c cid.Cid) error
+	DeleteManyFunc func(ctx context.Context, cids []cid.Cid) error
+)
+
+// Interceptor wraps the calls the wrapper makes to the backend. Each
+// method may change its arguments or results, or return without calling
+// next at all, for example to enforce a quota. Embed NopInterceptor to
+// implement only some of the methods.
+type Interceptor interface {
+	Put(ctx context.Context, blk blocks.Block, next PutFunc) error
+	PutMany(ctx context.Context, blks []blocks.Block, next PutManyFunc) error
+	Get(ctx context.Context, c cid.Cid, next GetFunc) (blocks.Block, error)
+	Has(ctx context.Context, c cid.Cid, next HasFunc) (bool, error)
+	GetSize(ctx context.Context, c cid.Cid, next GetSizeFunc) (int, error)
+	DeleteBlock(ctx context.Context, c cid.Cid, next DeleteFunc) error
+	DeleteMany(ctx context.Context, cids []cid.Cid, next DeleteManyFunc) error
+}
+
+// NopInterceptor is an Interceptor passing every call on unchanged.
+type NopInterceptor struct{}
+
+func (NopInterceptor) Put(ctx context.Context, blk blocks.Block, next PutFunc) error {
+	return next(ctx, blk)
+}
+
+func (NopInterceptor) PutMany(ctx context.Context, blks []blocks.Block, next PutManyFunc) error {
+	return next(ctx, blks)
+}
+
+func (NopInterceptor) Get(ctx context.Context, c cid.Cid, next GetFunc) (blocks.Block, error) {
+	return next(ctx, c)
+}
+
+func (NopInterceptor) Has(ctx context.Context, c cid.Cid, next HasFunc) (bool, error) {
+	return next(ctx, c)
+}
+
+func (NopInterceptor) GetSize(ctx context.Context, c cid.Cid, next GetSizeFunc) (int, error) {
+	return next(ctx, c)
+}
+
+func (NopInterceptor) DeleteBlock(ctx context.Context, c cid.Cid, next DeleteFunc) error {
+	return next(ctx, c)
+}
+
+func (NopInterceptor) DeleteMany(ctx context.Context, cids []cid.Cid, next DeleteManyFunc) error {
+	return next(ctx, cids)
+}
+
+// WithInterceptor adds i to the interceptors of the backend calls.
+// Interceptors are called in the order they were added, and the
+// operation metrics cover the whole chain. The time spent in each
+// interceptor itself, not counting the rest of the chain, is recorded in
+// interceptor.<n>.latency_seconds, n being its position from 0.
+func WithInterceptor(i Interceptor) Option {
+	return func(cfg *config) {
+		cfg.interceptors = append(cfg.interceptors, i)
+	}
+}
+
+// interceptedStore calls the blockstore it wraps through interceptors.
+type interceptedStore struct {
+	blockstore.Blockstore
+	interceptors []Interceptor
+	latencies    []metrics.Histogram
+}
+
+func newInterceptedStore(r *registry, bs blockstore.Blockstore, is []Interceptor) *interceptedStore {
+	s := &interceptedStore{Blockstore: bs, interceptors: is}
+	for n := range is {
+		s.latencies = append(s.latencies, r.latency(fmt.Sprintf("interceptor.%d.latency", n),
+			"Latency distribution of an interceptor, excluding the calls it makes"))
+	}
+	return s
+}
+
+func (s *interceptedStore) Unwrap() blockstore.Blockstore {
+	return s.Blockstore
+}
+
+// selfTimer measures the time spent in an interceptor, less the time
+// spent in the next function.
+type selfTimer struct {
+	start time.Time
+	inner time.Duration
+}
+
+func startSelfTimer() *selfTimer {
+	return &selfTimer{start: time.Now()}
+}
+
+// next adds the time since start, when the interceptor called next.
+func (t *selfTimer) next(start time.Time) {
+	t.inner += time.Since(start)
+}
+
+func (t *selfTimer) done(h metrics.Histogram) {
+	h.Observe((time.Since(t.start) - t.inner).Seconds())
+}
+
+func (s *interceptedStore) Put(ctx context.Context, blk blocks.Block) error {
+	return s.put(0)(ctx, blk)
+}
+
+// PutWithTTL goes through the Put interceptors, and then the backend's
+// PutWithTTL.
+func (s *interceptedStore) PutWithTTL(ctx context.Context, blk blocks.Block, ttl time.Duration) error {
+	tp, ok := s.Blockstore.(ttlPutter)
+	if !ok {
+		return ErrTTLUnsupported
+	}
+	return s.putWith(0, func(ctx context.Context, blk blocks.Block) error {
+		return tp.PutWithTTL(ctx, blk, ttl)
+	})(ctx, blk)
+}
+
+func (s *interceptedStore) put(n int) PutFunc {
+	return s.putWith(n, s.Blockstore.Put)
+}
+
+// putWith chains the Put interceptors from the n-th on, ending with
+// write.
+func (s *interceptedStore) putWith(n int, write PutFunc) PutFunc {
+	if n == len(s.interceptors) {
+		return write
+	}
+	return func(ctx context.Context, blk blocks.Block) error {
+		t := startSelfTimer()
+		defer t.done(s.latencies[n])
+		next := s.putWith(n+1, write)
+		return s.interceptors[n].Put(ctx, blk, func(ctx context.Context, blk blocks.Block) error {
+			defer t.next(time.Now())
+			return next(ctx, blk)
+		})
+	}
+}
+
+func (s *interceptedStore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	return s.putMany(0)(ctx, blks)
+}
+
+func (s *interceptedStore) putMany(n int) PutManyFunc {
+	if n == len(s.interceptors) {
+		return s.Blockstore.PutMany
+	}
+	return func(ctx context.Context, blks []blocks.Block) error {
+		t := startSelfTimer()
+		defer t.done(s.latencies[n])
+		next := s.putMany(n + 1)
+		return s.interceptors[n].PutMany(ctx, blks, func(ctx context.Context, blks []blocks.Block) error {
+			defer t.next(time.Now())
+			return next(ctx, blks)
+		})
+	}
+}
+
+func (s *interceptedStore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return s.get(0)(ctx, c)
+}
+
+func (s *interceptedStore) get(n int) GetFunc {
+	if n == len(s.interceptors) {
+		return s.Blockstore.Get
+	}
+	return func(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+		t := startSelfTimer()
+		defer t.done(s.latencies[n])
+		next := s.get(n + 1)
+		return s.interceptors[n].Get(ctx, c, func(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+			defer t.next(time.Now())
+			return next(ctx, c)
+		})
+	}
+}
+
+// View goes through the Get interceptors, so that they apply to every
+// read.
+func (s *interceptedStore) View(ctx context.Context, c cid.Cid, f func([]byte) error) error {
+	blk, err := s.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+	return f(blk.RawData())
+}
+
+func (s *interceptedStore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	return s.has(0)(ctx, c)
+}
+
+func (s *interceptedStore) has(n int) HasFunc {
+	if n == len(s.interceptors) {
+		return s.Blockstore.Has
+	}
+	return func(ctx context.Context, c cid.Cid) (bool, error) {
+		t := startSelfTimer()
+		defer t.done(s.latencies[n])
+		next := s.has(n + 1)
+		return s.interceptors[n].Has(ctx, c, func(ctx context.Context, c cid.Cid) (bool, error) {
+			defer t.next(time.Now())
+			return next(ctx, c)
+		})
+	}
+}
+
+func (s *interceptedStore) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	return s.getSize(0)(ctx, c)
+}
+
+func (s *interceptedStore) getSize(n int) GetSizeFunc {
+	if n == len(s.interceptors) {
+		return s.Blockstore.GetSize
+	}
+	return func(ctx context.Context, c cid.Cid) (int, error) {
+		t := startSelfTimer()
+		defer t.done(s.latencies[n])
+		next := s.getSize(n + 1)
+		return s.interceptors[n].GetSize(ctx, c, func(ctx context.Context, c cid.Cid) (int, error) {
+			defer t.next(time.Now())
+			return next(ctx, c)
+		})
+	}
+}
+
+func (s *interceptedStore) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	return s.deleteBlock(0)(ctx, c)
+}
+
+func (s *interceptedStore) deleteBlock(n int) DeleteFunc {
+	if n == len(s.interceptors) {
+		return s.Blockstore.DeleteBlock
+	}
+	return func(ctx context.Context, c cid.Cid) error {
+		t := startSelfTimer()
+		defer t.done(s.latencies[n])
+		next := s.deleteBlock(n + 1)
+		return s.interceptors[n].DeleteBlock(ctx, c, func(ctx context.Context, c cid.Cid) error {
+			defer t.next(time.Now())
+			return next(ctx, c)
+		})
+	}
+}
+
+func (s *interceptedStore) DeleteMany(ctx context.Context, cids []cid.Cid) error {
+	return s.deleteMany(0)(ctx, cids)
+}
+
+func (s *interceptedStore) deleteMany(n int) DeleteManyFunc {
+	if n == len(s.interceptors) {
+		return s.backendDeleteMany
+	}
+	return func(ctx context.Context, cids []cid.Cid) error {
+		t := startSelfTimer()
+		defer t.done(s.latencies[n])
+		next := s.deleteMany(n + 1)
+		return s.interceptors[n].DeleteMany(ctx, cids, func(ctx context.Context, cids []cid.Cid) error {
+			defer t.next(time.Now())
+			return next(ctx, cids)
+		})
+	}
+}
+
+func (s *interceptedStore) backendDeleteMany(ctx context.Context, cids []cid.Cid) error {
+	if dm, ok := s.Blockstore.(batchDeleter); ok {
+		return dm.DeleteMany(ctx, cids)
+	}
+	for _, c := range cids {
+		if err := s.Blockstore.DeleteBlock(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *interceptedStore) CreatedAt(ctx context.Context, c cid.Cid) (time.Time, error) {
+	if ct, ok := s.Blockstore.(CreationTimer); ok {
+		return ct.CreatedAt(ctx, c)
+	}
+	return time.Time{}, nil
+}
+
+// AllKeysShard passes shards through to the backend, or lists all keys
+// in shard 0 if it can't enumerate shards.
+func (s *interceptedStore) AllKeysShard(ctx context.Context, shard, shards int) (<-chan cid.Cid, error) {
+	if sl, ok := s.Blockstore.(shardedKeyLister); ok {
+		return sl.AllKeysShard(ctx, shard, shards)
+	}
+	if shard == 0 {
+		return s.Blockstore.AllKeysChan(ctx)
+	}
+	ch := make(chan cid.Cid)
+	close(ch)
+	return ch, nil
+}
+
+func (s *interceptedStore) Close() error {
+	if c, ok := s.Blockstore.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
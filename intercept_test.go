@@ -0,0 +1,68 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+var errQuota = errors.New("quota")
+
+type quota struct {
+	NopInterceptor
+	left  int
+	order *[]string
+	name  string
+}
+
+func (q *quota) Put(ctx context.Context, blk blocks.Block, next PutFunc) error {
+	*q.order = append(*q.order, q.name)
+	if q.left == 0 {
+		return errQuota
+	}
+	q.left--
+	return next(ctx, blk)
+}
+
+type slowI struct{ NopInterceptor }
+
+func (slowI) Get(ctx context.Context, c cid.Cid, next GetFunc) (blocks.Block, error) {
+	time.Sleep(20 * time.Millisecond)
+	return next(ctx, c)
+}
+
+func TestInterceptors(t *testing.T) {
+	ctx := context.Background()
+	var order []string
+	mem := testutil.New()
+	m := New("ic", mem, WithInterceptor(&quota{left: 1, order: &order, name: "a"}),
+		WithInterceptor(&quota{left: 5, order: &order, name: "b"}), WithInterceptor(slowI{}))
+	b1, b2 := blocks.NewBlock([]byte("1")), blocks.NewBlock([]byte("2"))
+	if err := m.Put(ctx, b1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Put(ctx, b2); err != errQuota {
+		t.Fatal(err)
+	}
+	if len(order) != 3 || order[0] != "a" || order[1] != "b" || order[2] != "a" {
+		t.Fatal(order)
+	}
+	if mem.Count(testutil.Put) != 1 || m.Stats().Counters["put.errors_total"] != 1 {
+		t.Fatal(mem.Calls())
+	}
+	m.Get(ctx, b1.Cid())
+	m.View(ctx, b1.Cid(), func([]byte) error { return nil })
+	st := m.Stats().Histograms
+	if st["interceptor.2.latency_seconds"].Sum < 0.04 || st["interceptor.0.latency_seconds"].Sum > 0.02 {
+		t.Fatal(st["interceptor.2.latency_seconds"], st["interceptor.0.latency_seconds"])
+	}
+	if m.Stats().Counters["view_total"] != 1 {
+		t.Fatal("view")
+	}
+}
@@ -0,0 +1,36 @@
+// Package backend opens the datastores the command line tools can run
+// against.
+package backend
+
+import (
+	"fmt"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	badger "github.com/ipfs/go-ds-badger"
+	flatfs "github.com/ipfs/go-ds-flatfs"
+)
+
+// Kinds lists the accepted values for the kind argument of Open.
+const Kinds = "mem, flatfs or badger"
+
+// Open returns a datastore of the given kind. The flatfs and badger
+// backends are stored in the directory at path.
+func Open(kind, path string) (datastore.Batching, error) {
+	switch kind {
+	case "mem":
+		return dssync.MutexWrap(datastore.NewMapDatastore()), nil
+	case "flatfs":
+		if path == "" {
+			return nil, fmt.Errorf("flatfs backend requires a path")
+		}
+		return flatfs.CreateOrOpen(path, flatfs.NextToLast(2), true)
+	case "badger":
+		if path == "" {
+			return nil, fmt.Errorf("badger backend requires a path")
+		}
+		return badger.NewDatastore(path, &badger.DefaultOptions)
+	default:
+		return nil, fmt.Errorf("unknown backend %q", kind)
+	}
+}
@@ -0,0 +1,130 @@
+package measure
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// invariantLogInterval is the minimum time between two logged violations
+// of the same kind.
+const invariantLogInterval = time.Minute
+
+// hasWindow is how long after Has reported a block present a not-found
+// from Get is considered a contradiction, unless it was deleted.
+const hasWindow = time.Second
+
+// Kinds of backend contract violations.
+const (
+	violationValueAndError  = "value_and_error"
+	violationNegativeSize   = "negative_size"
+	violationCidMismatch    = "cid_mismatch"
+	violationZeroCid        = "zero_cid"
+	violationHasThenMissing = "has_then_missing"
+)
+
+// WithInvariantChecks checks backend results against the blockstore
+// contract and counts violations in invariant_violations_total and, per
+// kind, in invariant_violations.<kind>_total. The kinds are:
+//
+//	value_and_error   Get returned both a block and an error
+//	negative_size     GetSize succeeded with a negative size
+//	cid_mismatch      Get returned a block with another CID
+//	zero_cid          AllKeysChan yielded an undefined CID
+//	has_then_missing  Get reported missing a block Has found just before
+//
+// Violations are passed to logf, if not nil, at most once a minute per
+// kind.
+func WithInvariantChecks(logf func(format string, args ...interface{})) Option {
+	return func(cfg *config) {
+		cfg.invariants = true
+		cfg.invariantLog = logf
+	}
+}
+
+type invariantChecker struct {
+	logf func(format string, args ...interface{})
+	// present holds the blocks Has recently found.
+	present *cidLRU
+
+	mu     sync.Mutex
+	logged map[string]time.Time
+}
+
+func newInvariantChecker(logf func(string, ...interface{})) *invariantChecker {
+	return &invariantChecker{
+		logf:    logf,
+		present: newCidLRU(1024, hasWindow),
+		logged:  make(map[string]time.Time),
+	}
+}
+
+func (m *measure) violation(kind string, c cid.Cid) {
+	m.reg.counter("invariant_violations_total", "Number of backend contract violations").Inc()
+	m.reg.counter("invariant_violations."+kind+"_total", "Number of backend contract violations of one kind").Inc()
+
+	ic := m.invariants
+	if ic.logf == nil {
+		return
+	}
+	now := m.clock.Now()
+	ic.mu.Lock()
+	last, seen := ic.logged[kind]
+	if seen && now.Sub(last) < invariantLogInterval {
+		ic.mu.Unlock()
+		return
+	}
+	ic.logged[kind] = now
+	ic.mu.Unlock()
+	ic.logf("measure %s: backend contract violation %s for %s", m.reg.prefix, kind, m.formatCid(c))
+}
+
+// backendGet is backend.Get, counting the cache hint of the result and
+// checking it when invariant checks are enabled.
+func (m *measure) backendGet(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := m.backend.Get(ctx, c)
+	m.observeCacheHint(blk)
+	if m.invariants == nil {
+		return blk, err
+	}
+	switch {
+	case blk != nil && err != nil:
+		m.violation(violationValueAndError, c)
+	case err == nil && blk != nil && !blk.Cid().Equals(c):
+		m.violation(violationCidMismatch, c)
+	case format.IsNotFound(err) && m.invariants.present.contains(c, m.clock.Now()):
+		m.violation(violationHasThenMissing, c)
+	}
+	return blk, err
+}
+
+// checkHas remembers blocks Has found, for has_then_missing.
+func (m *measure) checkHas(c cid.Cid, exists bool, err error) {
+	if m.invariants != nil && err == nil && exists {
+		m.invariants.present.add(c, m.clock.Now())
+	}
+}
+
+func (m *measure) checkGetSize(c cid.Cid, size int, err error) {
+	if m.invariants != nil && err == nil && size < 0 {
+		m.violation(violationNegativeSize, c)
+	}
+}
+
+// forgetPresent drops c from the blocks Has found, once it is deleted.
+func (m *measure) forgetPresent(c cid.Cid) {
+	if m.invariants != nil {
+		m.invariants.present.remove(c)
+	}
+}
+
+// checkKey counts c if it is undefined.
+func (m *measure) checkKey(c cid.Cid) {
+	if m.invariants != nil && !c.Defined() {
+		m.violation(violationZeroCid, c)
+	}
+}
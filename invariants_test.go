@@ -0,0 +1,32 @@
+package measure
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type liarBS struct{ *testutil.Blockstore }
+
+func (l liarBS) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return blocks.NewBlock([]byte("other")), nil
+}
+func (l liarBS) GetSize(ctx context.Context, c cid.Cid) (int, error) { return -3, nil }
+
+func TestInvariants(t *testing.T) {
+	var logs []string
+	m := New("inv", liarBS{testutil.New()}, WithInvariantChecks(func(f string, a ...interface{}) { logs = append(logs, fmt.Sprintf(f, a...)) }))
+	c := blocks.NewBlock([]byte("x")).Cid()
+	m.Get(context.Background(), c)
+	m.Get(context.Background(), c)
+	m.GetSize(context.Background(), c)
+	cs := m.Stats().Counters
+	if cs["invariant_violations_total"] != 3 || cs["invariant_violations.cid_mismatch_total"] != 2 || len(logs) != 2 {
+		t.Fatal(cs, logs)
+	}
+}
@@ -0,0 +1,26 @@
+package measure
+
+// WithIsolatedRegistry keeps the wrapper's metrics to itself: they are
+// not registered with go-metrics-interface, whose registrations last for
+// the life of the process, and are all dropped by Close. This suits
+// short-lived wrappers, such as one per request, which would otherwise
+// grow the global registry without bound. The tradeoff is that isolated
+// metrics don't show on the process-wide scrape endpoint: they must be
+// gathered explicitly, with Stats or the prom subpackage, before Close.
+// A Recorder set with WithRecorder still receives every update.
+func WithIsolatedRegistry() Option {
+	return func(cfg *config) {
+		cfg.isolated = true
+	}
+}
+
+// discard drops every metric of r, for isolated wrappers being closed.
+func (r *registry) discard() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.help = make(map[string]string)
+	r.counters = make(map[string]*counter)
+	r.gauges = make(map[string]*gauge)
+	r.histograms = make(map[string]*histogram)
+	r.adaptives = make(map[string]*adaptiveHistogram)
+}
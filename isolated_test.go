@@ -0,0 +1,32 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestIsolatedRegistry(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		m := New("iso", testutil.New(), WithIsolatedRegistry())
+		if m.reg.rec != nil {
+			t.Fatal("registered globally")
+		}
+		blk := mkBlocks(1)[0]
+		m.Put(ctx, blk)
+		if m.Stats().Counters["put_total"] != 1 {
+			t.Fatal("not counted")
+		}
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(m.Stats().Counters); n != 0 {
+			t.Fatal(n)
+		}
+	}
+	if New("glob", testutil.New()).reg.rec == nil {
+		t.Fatal("default not pushed")
+	}
+}
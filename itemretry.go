@@ -0,0 +1,81 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	blocks "github.com/ipfs/go-block-format"
+)
+
+// WithFailedItemRetries makes PutMany retry up to n times the blocks a
+// backend error implementing ItemErrors reports as failed, leaving out
+// the blocks that were written. Retried blocks are counted in
+// putmany.item_retries_total. Errors that don't tell which blocks failed
+// are not retried.
+func WithFailedItemRetries(n int) Option {
+	return func(cfg *config) {
+		cfg.failedItemRetries = n
+	}
+}
+
+// itemErrors is an ItemErrors error from a retry, with the indexes of the
+// failed items mapped back to the original batch.
+type itemErrors struct {
+	error
+	failed map[int]error
+}
+
+func (e *itemErrors) ItemErrors() map[int]error { return e.failed }
+
+func (e *itemErrors) Unwrap() error { return e.error }
+
+// retryFailedItems retries the blocks of blks err reports as failed, as
+// configured, and returns the error of the last attempt.
+func (m *measure) retryFailedItems(ctx context.Context, blks []blocks.Block, err error) error {
+	for i := 0; i < m.failedItemRetries; i++ {
+		var ie ItemErrors
+		if !errors.As(err, &ie) || len(ie.ItemErrors()) == 0 {
+			break
+		}
+		idx := make([]int, 0, len(ie.ItemErrors()))
+		for j := range ie.ItemErrors() {
+			if j >= 0 && j < len(blks) {
+				idx = append(idx, j)
+			}
+		}
+		sort.Ints(idx)
+		retry := make([]blocks.Block, len(idx))
+		for k, j := range idx {
+			retry[k] = blks[j]
+		}
+		m.reg.counter("putmany.item_retries_total", "Number of blocks written again after a PutMany reported them failed").Add(float64(len(retry)))
+		err = m.backend.PutMany(ctx, retry)
+		if err == nil || !errors.As(err, &ie) {
+			return err
+		}
+		failed := make(map[int]error, len(ie.ItemErrors()))
+		for j, e := range ie.ItemErrors() {
+			if j >= 0 && j < len(idx) {
+				failed[idx[j]] = e
+			}
+		}
+		err = &itemErrors{err, failed}
+	}
+	return err
+}
+
+// countFailedItems counts in putmany.partial_failed_items the blocks of
+// blks that err, returned by the backend, failed: those it reports when
+// it implements ItemErrors, and the whole batch otherwise.
+func (m *measure) countFailedItems(blks []blocks.Block, err error) {
+	if isWrapperError(err) {
+		return
+	}
+	n := len(blks)
+	var ie ItemErrors
+	if errors.As(err, &ie) {
+		n = len(ie.ItemErrors())
+	}
+	m.reg.counter("putmany.partial_failed_items", "Number of blocks PutMany failed to write").Add(float64(n))
+}
@@ -0,0 +1,82 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type itemFailErr struct{ failed map[int]error }
+
+func (e itemFailErr) Error() string             { return "partial" }
+func (e itemFailErr) ItemErrors() map[int]error { return e.failed }
+
+// itemFailBS fails the blocks at odd indexes of the first fails batches.
+type itemFailBS struct {
+	*testutil.Blockstore
+	fails *int
+}
+
+func (p itemFailBS) PutMany(ctx context.Context, blks []blocks.Block) error {
+	if *p.fails == 0 {
+		return p.Blockstore.PutMany(ctx, blks)
+	}
+	*p.fails--
+	failed := map[int]error{}
+	for i, b := range blks {
+		if i%2 == 1 {
+			failed[i] = errors.New("nope")
+			continue
+		}
+		p.Blockstore.Put(ctx, b)
+	}
+	return itemFailErr{failed}
+}
+
+func TestPartialFailedItems(t *testing.T) {
+	ctx := context.Background()
+	fails := 1
+	m := New("pf", itemFailBS{testutil.New(), &fails})
+	if err := m.PutMany(ctx, mkBlocks(5)); err == nil {
+		t.Fatal("no error")
+	}
+	fails = 1
+	m.PutMany(ctx, mkBlocks(1))
+	s := m.Stats()
+	if s.Counters["putmany.partial_failed_items"] != 2 {
+		t.Fatal(s.Counters["putmany.partial_failed_items"])
+	}
+
+	fails = 2
+	bs := itemFailBS{testutil.New(), &fails}
+	m = New("pf2", bs, WithFailedItemRetries(3), WithBatchErrors())
+	blks := mkBlocks(5)
+	if err := m.PutMany(ctx, blks); err != nil {
+		t.Fatal(err)
+	}
+	s = m.Stats()
+	// 2 retried after the first call, then index 1 of those (block 3) again.
+	if s.Counters["putmany.item_retries_total"] != 3 || s.Counters["putmany.partial_failed_items"] != 0 {
+		t.Fatal(s.Counters)
+	}
+	for _, b := range blks {
+		if ok, _ := bs.Blockstore.Has(ctx, b.Cid()); !ok {
+			t.Fatal("missing")
+		}
+	}
+
+	fails = 10
+	m = New("pf3", itemFailBS{testutil.New(), &fails}, WithFailedItemRetries(1), WithBatchErrors())
+	err := m.PutMany(ctx, mkBlocks(5))
+	var be *BatchError
+	if !errors.As(err, &be) || len(be.Failed) != 1 || be.Failed[3] == nil || be.Written != 3 {
+		t.Fatal(err, be)
+	}
+	if c := m.Stats().Counters["putmany.partial_failed_items"]; c != 1 {
+		t.Fatal(c)
+	}
+}
@@ -0,0 +1,121 @@
+package measure
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// journalQueueSize is the number of records that may be waiting to be
+// written before new ones are dropped.
+const journalQueueSize = 4096
+
+// WithJournal appends one JSON record per operation to w (see
+// JournalRecord). Records are written asynchronously by a background
+// goroutine so that a slow writer never stalls blockstore calls; when it
+// can't keep up, records are dropped and counted in
+// journal.dropped_total. The journal is flushed on Close, and w is closed
+// too if it implements io.Closer.
+func WithJournal(w io.Writer) Option {
+	return func(cfg *config) {
+		cfg.journal = w
+	}
+}
+
+// JournalRecord is the format of a journal line.
+type JournalRecord struct {
+	Time     time.Time     `json:"ts"`
+	Op       string        `json:"op"`
+	Cid      string        `json:"cid,omitempty"`
+	Items    int           `json:"items,omitempty"`
+	Bytes    int           `json:"bytes,omitempty"`
+	Duration time.Duration `json:"dur_ns"`
+	Error    string        `json:"err,omitempty"`
+}
+
+type journal struct {
+	w         io.Writer
+	cidFormat func(cid.Cid) string
+	dropped   metrics.Counter
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan JournalRecord
+	done   chan struct{}
+}
+
+func newJournal(w io.Writer, cidFormat func(cid.Cid) string, dropped metrics.Counter) *journal {
+	j := &journal{
+		w:         w,
+		cidFormat: cidFormat,
+		dropped:   dropped,
+		queue:     make(chan JournalRecord, journalQueueSize),
+		done:      make(chan struct{}),
+	}
+	go j.run()
+	return j
+}
+
+func (j *journal) record(ev *opEvent) {
+	rec := JournalRecord{
+		Time:     ev.Start,
+		Op:       ev.Op,
+		Items:    ev.Items,
+		Bytes:    ev.Bytes,
+		Duration: ev.Duration,
+		Error:    errorClass(ev.Err),
+	}
+	if ev.Cid.Defined() {
+		rec.Cid = j.cidFormat(ev.Cid)
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if j.closed {
+		return
+	}
+	select {
+	case j.queue <- rec:
+	default:
+		j.dropped.Inc()
+	}
+}
+
+func (j *journal) run() {
+	defer close(j.done)
+	bw := bufio.NewWriter(j.w)
+	enc := json.NewEncoder(bw)
+	for rec := range j.queue {
+		// Write errors are not fatal to the blockstore; keep draining so
+		// that record never blocks.
+		_ = enc.Encode(rec)
+		if len(j.queue) == 0 {
+			_ = bw.Flush()
+		}
+	}
+	_ = bw.Flush()
+}
+
+// close stops accepting records, waits for the queue to be written out
+// and closes the underlying writer if possible.
+func (j *journal) close() error {
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		return nil
+	}
+	j.closed = true
+	close(j.queue)
+	j.mu.Unlock()
+
+	<-j.done
+	if c, ok := j.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
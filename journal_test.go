@@ -0,0 +1,26 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestJournal(t *testing.T) {
+	var buf bytes.Buffer
+	m := New("t", testutil.New(), WithJournal(&buf))
+	ctx := context.Background()
+	blk := blocks.NewBlock([]byte("hello"))
+	m.Put(ctx, blk)
+	m.Get(ctx, blk.Cid())
+	m.Close()
+	if strings.Count(buf.String(), "\n") != 2 {
+		t.Fatal(buf.String())
+	}
+	t.Log(buf.String())
+}
@@ -0,0 +1,35 @@
+package measure
+
+import (
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithInterKeyGaps records the time between consecutive keys delivered
+// by AllKeysChan in allkeys.interkey_gap_seconds. Long gaps point at
+// backends stalling mid-scan, for example over sparse or deleted ranges.
+// The gaps include the time the caller took to receive each key.
+func WithInterKeyGaps() Option {
+	return func(cfg *config) {
+		cfg.interKeyGaps = true
+	}
+}
+
+func newInterKeyGapHistogram(r *registry) metrics.Histogram {
+	return r.latency("allkeys.interkey_gap",
+		"Distribution of the time between consecutive keys delivered by AllKeysChan")
+}
+
+// observeKeyGap records the gap since last, when the previous key was
+// delivered, and returns the time of the key just delivered.
+func (m *measure) observeKeyGap(last time.Time) time.Time {
+	if m.interKeyGap == nil {
+		return last
+	}
+	now := time.Now()
+	if !last.IsZero() {
+		m.interKeyGap.Observe(now.Sub(last).Seconds())
+	}
+	return now
+}
@@ -0,0 +1,45 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type pausingKeysBS struct {
+	*testutil.Blockstore
+	keys []cid.Cid
+}
+
+func (p pausingKeysBS) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	ch := make(chan cid.Cid)
+	go func() {
+		defer close(ch)
+		for i, c := range p.keys {
+			if i == 2 {
+				time.Sleep(30 * time.Millisecond)
+			}
+			ch <- c
+		}
+	}()
+	return ch, nil
+}
+
+func TestInterKeyGaps(t *testing.T) {
+	var keys []cid.Cid
+	for _, b := range mkBlocks(4) {
+		keys = append(keys, b.Cid())
+	}
+	m := New("kg", pausingKeysBS{testutil.New(), keys}, WithInterKeyGaps())
+	ch, _ := m.AllKeysChan(context.Background())
+	for range ch {
+	}
+	h := m.Stats().Histograms["allkeys.interkey_gap_seconds"]
+	if h.Count != 3 || h.Sum < 0.03 {
+		t.Fatal(h)
+	}
+}
@@ -0,0 +1,174 @@
+package measure
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// tokenBucket holds up to capacity tokens, refilled at rate per second.
+type tokenBucket struct {
+	tokens, capacity, rate float64
+	last                   time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// take takes a token if one is available.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// reserve takes a token, going into debt if there is none, and returns
+// how long to wait until the token would have been available.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// WithKeyScanRateLimit paces the keys delivered by AllKeysChan and
+// AllKeysParallel to keysPerSecond in total across all enumerations, so
+// that a full scan of a large store doesn't starve other reads of disk
+// time. Zero means no limit. The limit can be changed at runtime with
+// SetKeyScanRateLimit.
+//
+// The rate keys are delivered at is reported in allkeys.keys_per_second,
+// and the time enumerations spent waiting for the limit in
+// allkeys.throttled_seconds_total. The distribution of the individual
+// waits is recorded in allkeys.throttle.latency_seconds.
+func WithKeyScanRateLimit(keysPerSecond int) Option {
+	return func(cfg *config) {
+		cfg.keyScanRate = keysPerSecond
+	}
+}
+
+// WithAllKeysRateLimit is WithKeyScanRateLimit, named after the
+// AllKeysChan calls it throttles.
+func WithAllKeysRateLimit(keysPerSecond int) Option {
+	return WithKeyScanRateLimit(keysPerSecond)
+}
+
+type keyLimiter struct {
+	rateGauge metrics.Gauge
+	throttled metrics.Counter
+	waits     metrics.Histogram
+
+	mu     sync.Mutex
+	limit  int
+	bucket tokenBucket
+	// changed is closed when the limit changes, releasing the waiters.
+	changed chan struct{}
+	// active counts running enumerations. Keys delivered since
+	// windowStart are reported in rateGauge.
+	active      int
+	delivered   int
+	windowStart time.Time
+}
+
+func newKeyLimiter(r *registry, keysPerSecond int) *keyLimiter {
+	l := &keyLimiter{
+		rateGauge: r.gauge("allkeys.keys_per_second", "Rate at which key enumerations deliver keys"),
+		throttled: r.counter("allkeys.throttled_seconds_total", "Time key enumerations spent waiting for the key scan rate limit"),
+		waits: r.latency("allkeys.throttle.latency",
+			"Latency distribution of waits for the key scan rate limit"),
+		changed: make(chan struct{}),
+	}
+	l.setLimit(keysPerSecond)
+	return l
+}
+
+// SetKeyScanRateLimit changes the limit set with WithKeyScanRateLimit.
+// Enumerations waiting for the previous limit resume immediately.
+func (m *measure) SetKeyScanRateLimit(keysPerSecond int) {
+	m.keyScan.setLimit(keysPerSecond)
+}
+
+func (l *keyLimiter) setLimit(keysPerSecond int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = keysPerSecond
+	// A second's worth of burst, starting full.
+	n := float64(keysPerSecond)
+	l.bucket = tokenBucket{tokens: n, capacity: n, rate: n, last: time.Now()}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// begin and end bracket an enumeration. The rate drops to zero when the
+// last one ends.
+func (l *keyLimiter) begin() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active++
+}
+
+func (l *keyLimiter) end() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	if l.active == 0 {
+		l.rateGauge.Set(0)
+		l.delivered = 0
+		l.windowStart = time.Time{}
+	}
+}
+
+// wait is called before delivering each key. It returns early with the
+// context's error if ctx is done first.
+func (l *keyLimiter) wait(ctx context.Context) error {
+	now := time.Now()
+	l.mu.Lock()
+	l.delivered++
+	if l.windowStart.IsZero() {
+		l.windowStart = now
+	} else if d := now.Sub(l.windowStart); d >= time.Second {
+		l.rateGauge.Set(float64(l.delivered) / d.Seconds())
+		l.delivered = 0
+		l.windowStart = now
+	}
+	if l.limit <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	delay := l.bucket.reserve(now)
+	changed := l.changed
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	defer func() {
+		// The wait is on a real timer, so it is timed with the wall
+		// clock.
+		d := time.Since(now).Seconds()
+		l.throttled.Add(d)
+		l.waits.Observe(d)
+	}()
+	select {
+	case <-t.C:
+		return nil
+	case <-changed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,55 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestKeyScanRateLimit(t *testing.T) {
+	ctx := context.Background()
+	m := New("ks", testutil.New(), WithAllKeysRateLimit(50))
+	for i := 0; i < 80; i++ {
+		m.Put(ctx, blocks.NewBlock([]byte{byte(i)}))
+	}
+	start := time.Now()
+	ch, _ := m.AllKeysChan(ctx)
+	n := 0
+	for range ch {
+		n++
+		if n == 60 {
+			m.SetKeyScanRateLimit(0)
+		}
+	}
+	if n != 80 {
+		t.Fatalf("got %d keys, want 80", n)
+	}
+	// The last 10 of the first 60 keys wait for the limit.
+	if el := time.Since(start); el < 150*time.Millisecond || el > 2*time.Second {
+		t.Fatalf("enumeration took %v, want between 150ms and 2s", el)
+	}
+	if got := statCounter(m, "allkeys.throttled_seconds_total"); got <= 0 {
+		t.Fatalf("allkeys.throttled_seconds_total = %v, want > 0", got)
+	}
+	if got := statCount(m, "allkeys.throttle.latency_seconds"); got == 0 {
+		t.Fatalf("allkeys.throttle.latency_seconds count = %v, want > 0", got)
+	}
+
+	// Cancellation releases a throttled enumeration promptly.
+	m.SetKeyScanRateLimit(1)
+	cctx, cancel := context.WithCancel(ctx)
+	ch, _ = m.AllKeysChan(cctx)
+	<-ch
+	<-ch
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	for range ch {
+	}
+	if el := time.Since(start); el > 500*time.Millisecond {
+		t.Fatalf("enumeration ended %v after the start of the wait, want less than 500ms", el)
+	}
+}
@@ -0,0 +1,76 @@
+package measure
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// Op names a blockstore operation, as used in metric names.
+type Op string
+
+const (
+	OpPut        Op = "put"
+	OpPutMany    Op = "putmany"
+	OpGet        Op = "get"
+	OpHas        Op = "has"
+	OpGetSize    Op = "getsize"
+	OpDelete     Op = "delete"
+	OpDeleteMany Op = "deletemany"
+	OpView       Op = "view"
+)
+
+// ErrInfo describes the most recent error of an operation. Only the
+// message is kept, not the error itself, so that large values wrapped
+// in errors aren't retained.
+type ErrInfo struct {
+	Op      Op
+	Message string
+	Time    time.Time
+	// Cid is undefined for batch operations.
+	Cid cid.Cid
+}
+
+type lastErrors struct {
+	mu   sync.Mutex
+	errs map[Op]ErrInfo
+}
+
+// noteError remembers err as the last error of op, unless it is a
+// not-found, and publishes its time in <op>.last_error_timestamp_seconds.
+func (m *measure) noteError(op Op, c cid.Cid, err error) {
+	if format.IsNotFound(err) {
+		return
+	}
+	info := ErrInfo{Op: op, Message: err.Error(), Time: m.clock.Now(), Cid: c}
+	m.lastErrs.mu.Lock()
+	if m.lastErrs.errs == nil {
+		m.lastErrs.errs = make(map[Op]ErrInfo)
+	}
+	m.lastErrs.errs[op] = info
+	m.lastErrs.mu.Unlock()
+
+	m.reg.gauge(string(op)+".last_error_timestamp_seconds",
+		"Unix time of the last error of the operation").Set(float64(info.Time.UnixNano()) / 1e9)
+}
+
+// LastError returns the most recent error of op other than not-found, if
+// there was one.
+func (m *measure) LastError(op Op) (ErrInfo, bool) {
+	m.lastErrs.mu.Lock()
+	defer m.lastErrs.mu.Unlock()
+	info, ok := m.lastErrs.errs[op]
+	return info, ok
+}
+
+func (m *measure) lastErrorsSnapshot() map[Op]ErrInfo {
+	m.lastErrs.mu.Lock()
+	defer m.lastErrs.mu.Unlock()
+	errs := make(map[Op]ErrInfo, len(m.lastErrs.errs))
+	for op, info := range m.lastErrs.errs {
+		errs[op] = info
+	}
+	return errs
+}
@@ -0,0 +1,26 @@
+package measure
+
+import (
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// newLastLatencies returns the <op>.last_latency_seconds gauges, holding
+// the latency of the latest call of each operation. Unlike the
+// histograms, they give a single pollable number showing the current
+// responsiveness of the backend, without smoothing.
+func newLastLatencies(r *registry) map[Op]metrics.Gauge {
+	gs := make(map[Op]metrics.Gauge)
+	for _, op := range []Op{OpPut, OpPutMany, OpGet, OpHas, OpGetSize, OpDelete, OpDeleteMany, OpView} {
+		gs[op] = r.gauge(string(op)+".last_latency_seconds", "Latency of the latest call")
+	}
+	return gs
+}
+
+// setLastLatency records the latency of a call of op started at start.
+func (m *measure) setLastLatency(op Op, start time.Time) {
+	if g, ok := m.lastLatencies[op]; ok {
+		g.Set(m.clock.Now().Sub(start).Seconds())
+	}
+}
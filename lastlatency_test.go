@@ -0,0 +1,27 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestLastLatency(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	m := New("ll", fb)
+	b := mkBlocks(1)[0]
+	fb.Put(ctx, b)
+	fb.SetLatency(testutil.Get, testutil.Fixed(30*time.Millisecond))
+	m.Get(ctx, b.Cid())
+	if g := m.Stats().Gauges["get.last_latency_seconds"]; g < 0.03 {
+		t.Fatal(g)
+	}
+	fb.SetLatency(testutil.Get, nil)
+	m.Get(ctx, b.Cid())
+	if g := m.Stats().Gauges["get.last_latency_seconds"]; g >= 0.03 {
+		t.Fatal(g)
+	}
+}
@@ -0,0 +1,153 @@
+package measure
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// LatencyUnit is the unit latency histograms are recorded in.
+type LatencyUnit int
+
+const (
+	// Seconds is the default, following the Prometheus conventions.
+	Seconds LatencyUnit = iota
+	// Milliseconds is for dashboards built around millisecond latencies.
+	Milliseconds
+)
+
+func (u LatencyUnit) String() string {
+	switch u {
+	case Seconds:
+		return "seconds"
+	case Milliseconds:
+		return "milliseconds"
+	}
+	return fmt.Sprintf("LatencyUnit(%d)", int(u))
+}
+
+// WithLatencyUnit sets the unit of all latency histograms. It changes
+// both the observed values and the metric names, which end in
+// _milliseconds instead of _seconds. It panics on an unknown unit.
+func WithLatencyUnit(unit LatencyUnit) Option {
+	if unit != Seconds && unit != Milliseconds {
+		panic(fmt.Sprintf("measure: invalid latency unit %d", int(unit)))
+	}
+	return func(cfg *config) {
+		cfg.latencyUnit = unit
+	}
+}
+
+// latencyBucketsSeconds are datastoreLatencyBuckets in seconds.
+var latencyBucketsSeconds = scaleBuckets(datastoreLatencyBuckets, 1e-3)
+
+func scaleBuckets(buckets []float64, scale float64) []float64 {
+	scaled := make([]float64, len(buckets))
+	for i, b := range buckets {
+		scaled[i] = b * scale
+	}
+	return scaled
+}
+
+// latency returns a histogram named name followed by the suffix of the
+// configured unit, e.g. "get.latency_seconds" for "get.latency". It is
+// observed in seconds, as recordLatency does, and converts to the unit.
+func (r *registry) latency(name, help string) metrics.Histogram {
+	suffix, buckets := "_seconds", latencyBucketsSeconds
+	if r.latencyUnit == Milliseconds {
+		suffix, buckets = "_milliseconds", datastoreLatencyBuckets
+	}
+	var h metrics.Histogram
+	switch {
+	case r.latencySums:
+		h = sumHistogram{r.counter(name+"_sum"+suffix+"_total", help+", summed")}
+	case r.adaptiveBuckets:
+		h = r.adaptive(name+suffix, help)
+	default:
+		h = r.histogram(name+suffix, help, buckets)
+	}
+	if r.latencyUnit == Milliseconds {
+		h = scaledHistogram{Histogram: h, scale: 1e3}
+	}
+	r.anomaliesOnce.Do(func() {
+		r.anomalies = r.counter("latency.anomaly_total",
+			"Number of latencies dropped because they were negative or above the ceiling")
+	})
+	return saneHistogram{Histogram: h, ceiling: r.latencyCeiling, anomalies: r.anomalies}
+}
+
+// DefaultLatencyCeiling is the longest latency recorded unless changed
+// with WithLatencyCeiling.
+const DefaultLatencyCeiling = time.Hour
+
+// WithLatencyCeiling sets the longest latency latency histograms accept.
+// Longer latencies, and negative ones, which a clock going backwards
+// can produce, are counted in latency.anomaly_total instead of being
+// observed, so that they don't distort the sums of the histograms. Zero
+// or less disables the ceiling, negative latencies still being counted
+// as anomalies.
+func WithLatencyCeiling(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.latencyCeiling = d
+	}
+}
+
+// WithoutLatencyHistograms replaces every latency histogram with a
+// counter of the total time spent, named after the histogram with
+// _sum_seconds_total instead of _seconds, e.g.
+// get.latency_sum_seconds_total. Divided by the matching call counter,
+// such as get_total, it gives the mean latency with two series instead
+// of one per bucket.
+func WithoutLatencyHistograms() Option {
+	return func(cfg *config) {
+		cfg.latencySums = true
+	}
+}
+
+// sumHistogram adds up its observations in a counter.
+type sumHistogram struct {
+	sum metrics.Counter
+}
+
+func (h sumHistogram) Observe(v float64) {
+	h.sum.Add(v)
+}
+
+// saneHistogram drops the latencies, in seconds, that are negative or
+// above the ceiling, counting them in anomalies.
+type saneHistogram struct {
+	metrics.Histogram
+	ceiling   time.Duration
+	anomalies metrics.Counter
+}
+
+func (h saneHistogram) Observe(v float64) {
+	if h.sane(v) {
+		h.Histogram.Observe(v)
+	}
+}
+
+func (h saneHistogram) observeExemplar(v float64, traceID string) {
+	if h.sane(v) {
+		observeExemplar(h.Histogram, v, traceID)
+	}
+}
+
+func (h saneHistogram) sane(v float64) bool {
+	if v >= 0 && (h.ceiling <= 0 || v <= h.ceiling.Seconds()) {
+		return true
+	}
+	h.anomalies.Inc()
+	return false
+}
+
+// scaledHistogram multiplies observations before recording them.
+type scaledHistogram struct {
+	metrics.Histogram
+	scale float64
+}
+
+func (h scaledHistogram) Observe(v float64) {
+	h.Histogram.Observe(v * h.scale)
+}
@@ -0,0 +1,108 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestLatencyUnit(t *testing.T) {
+	ctx := context.Background()
+	c := mkBlocks(1)[0].Cid()
+	for _, tc := range []struct {
+		unit     LatencyUnit
+		name     string
+		min, max float64
+	}{
+		{Seconds, "has.latency_seconds", 0.019, 1},
+		{Milliseconds, "has.latency_milliseconds", 19, 1000},
+	} {
+		fb := testutil.New()
+		fb.SetLatency(testutil.Has, testutil.Fixed(20*time.Millisecond))
+		m := New("test", fb, WithLatencyUnit(tc.unit))
+		// The first call is a cold start.
+		m.Has(ctx, c)
+		m.Has(ctx, c)
+		h, ok := m.reg.snapshot().Histograms[tc.name]
+		if !ok || h.Count != 1 || h.Sum < tc.min || h.Sum > tc.max {
+			t.Fatalf("%s: %+v", tc.name, h)
+		}
+	}
+}
+
+func TestLatencyAnomaly(t *testing.T) {
+	ctx := context.Background()
+	blk := mkBlocks(1)[0]
+	for _, tc := range []struct {
+		name    string
+		skew    time.Duration
+		opts    []Option
+		anomaly float64
+	}{
+		{"backwards", -time.Second, nil, 1},
+		{"above ceiling", 2 * time.Minute, []Option{WithLatencyCeiling(time.Minute)}, 1},
+		{"below ceiling", 2 * time.Minute, nil, 0},
+		{"no ceiling", 2 * DefaultLatencyCeiling, []Option{WithLatencyCeiling(0)}, 0},
+	} {
+		clock := newFakeClock()
+		fb := testutil.New()
+		fb.SetClock(clock)
+		fb.Put(ctx, blk)
+		m := New("test", fb, append(tc.opts, WithClock(clock))...)
+		if _, ok := m.reg.snapshot().Counters["latency.anomaly_total"]; !ok {
+			t.Fatalf("%s: latency.anomaly_total not registered before an anomaly", tc.name)
+		}
+		// The first call is a cold start.
+		m.Get(ctx, blk.Cid())
+
+		fb.SetLatency(testutil.Get, testutil.Fixed(tc.skew))
+		if _, err := m.Get(ctx, blk.Cid()); err != nil {
+			t.Fatal(err)
+		}
+		if got := statCounter(m, "latency.anomaly_total"); got != tc.anomaly {
+			t.Fatalf("%s: latency.anomaly_total = %v, want %v", tc.name, got, tc.anomaly)
+		}
+		h := m.reg.snapshot().Histograms["get.latency_seconds"]
+		if tc.anomaly > 0 && h.Count != 0 {
+			t.Fatalf("%s: anomalous latency observed: %+v", tc.name, h)
+		}
+		if tc.anomaly == 0 && (h.Count != 1 || h.Sum != tc.skew.Seconds()) {
+			t.Fatalf("%s: latency not observed as measured by the clock: %+v", tc.name, h)
+		}
+	}
+}
+
+type sumRec struct {
+	counters map[string]float64
+	hists    int
+}
+
+func (r *sumRec) IncCounter(name string, d float64) { r.counters[name] += d }
+func (r *sumRec) ObserveHistogram(string, float64)  { r.hists++ }
+func (r *sumRec) SetGauge(string, float64)          {}
+
+func TestLatencySums(t *testing.T) {
+	ctx := context.Background()
+	rec := &sumRec{counters: map[string]float64{}}
+	m := New("ls", testutil.New(), WithRecorder(rec), WithoutLatencyHistograms())
+	b := blocks.NewBlock([]byte("x"))
+	m.Put(ctx, b)
+	m.Get(ctx, b.Cid())
+	m.Get(ctx, b.Cid())
+	if rec.counters["ls.get_total"] != 2 || rec.counters["ls.get.latency_sum_seconds_total"] <= 0 {
+		t.Fatal(rec.counters)
+	}
+	if _, ok := m.Stats().Histograms["get.latency_seconds"]; ok {
+		t.Fatal("histogram")
+	}
+	rec2 := &sumRec{counters: map[string]float64{}}
+	n := New("ls2", testutil.New(), WithRecorder(rec2))
+	n.Put(ctx, b)
+	if _, ok := rec2.counters["ls2.put.latency_sum_seconds_total"]; ok || rec2.hists == 0 {
+		t.Fatal("sums by default")
+	}
+}
@@ -0,0 +1,161 @@
+package measure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// lifecycle tracks in-flight operations and whether the wrapper has been
+// closed, so that closing can wait for running operations and reject new
+// ones.
+type lifecycle struct {
+	inflight int64
+	closed   int32
+	// drained is signalled when the last operation exits after close.
+	drained chan struct{}
+	// drainTimeout is how long Close waits for running operations.
+	drainTimeout time.Duration
+
+	inflightGauge metrics.Gauge
+}
+
+// WithDrainTimeout makes Close wait up to d for running operations to
+// finish before closing the backend, as CloseContext does. By default
+// Close doesn't wait.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.drainTimeout = d
+	}
+}
+
+// enter registers a new op. It fails with ErrClosed once the wrapper is
+// closing; otherwise exit must be called when the operation is done.
+func (m *measure) enter(op Op) error {
+	atomic.AddInt64(&m.life.inflight, 1)
+	if atomic.LoadInt32(&m.life.closed) != 0 {
+		m.exit()
+		m.wrapperError(op)
+		return ErrClosed
+	}
+	m.life.inflightGauge.Inc()
+	m.enterReentrant(op)
+	return nil
+}
+
+func (m *measure) exit() {
+	if atomic.AddInt64(&m.life.inflight, -1) == 0 && atomic.LoadInt32(&m.life.closed) != 0 {
+		select {
+		case m.life.drained <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// exitOp is exit for operations that made it past enter.
+func (m *measure) exitOp() {
+	m.exitReentrant()
+	m.life.inflightGauge.Dec()
+	m.exit()
+}
+
+// Close rejects new operations and closes the backend. Unless
+// WithDrainTimeout was given, it doesn't wait for running ones: their
+// contexts are cancelled before the backend is closed.
+func (m *measure) Close() error {
+	if m.life.drainTimeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), m.life.drainTimeout)
+		defer cancel()
+		return m.CloseContext(ctx)
+	}
+	atomic.StoreInt32(&m.life.closed, 1)
+	m.cancelRunning()
+	return m.closeBackend()
+}
+
+// CloseWithTimeout is CloseContext.
+//
+// Deprecated: use CloseContext.
+func (m *measure) CloseWithTimeout(ctx context.Context) error {
+	return m.CloseContext(ctx)
+}
+
+// CloseContext rejects new operations with ErrClosed, waits until the
+// running ones are done or ctx expires, and then closes the backend.
+// The wait is recorded in close.drain.latency_seconds; when ctx expires
+// first, close.drain_timeout_total is incremented, the number of
+// operations left running is set in close.drain_abandoned_ops and,
+// unless closing the backend fails, an error is returned. The contexts
+// of the operations left running are cancelled before the backend is
+// closed.
+func (m *measure) CloseContext(ctx context.Context) error {
+	atomic.StoreInt32(&m.life.closed, 1)
+
+	start := m.clock.Now()
+	var timeoutErr error
+	for atomic.LoadInt64(&m.life.inflight) > 0 && timeoutErr == nil {
+		select {
+		case <-m.life.drained:
+		case <-ctx.Done():
+			m.drainTimeout.Inc()
+			n := atomic.LoadInt64(&m.life.inflight)
+			m.drainAbandoned.Set(float64(n))
+			timeoutErr = fmt.Errorf("measure: closing with %d operations still running: %w",
+				n, ctx.Err())
+		}
+	}
+	recordLatency(m.clock, m.drainLatency, start)
+	m.cancelRunning()
+
+	if err := m.closeBackend(); err != nil {
+		return err
+	}
+	return timeoutErr
+}
+
+func (m *measure) closeBackend() error {
+	m.stopBloom()
+	if m.freeSpace != nil {
+		m.freeSpace.close()
+	}
+	if m.coalescer != nil {
+		m.coalescer.close()
+	}
+	var err error
+	if m.writeBehind != nil {
+		err = m.writeBehind.close()
+	}
+	if c, ok := m.backend.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if m.journal != nil {
+		if jerr := m.journal.close(); err == nil {
+			err = jerr
+		}
+	}
+	if m.opLog != nil {
+		if oerr := m.opLog.close(); err == nil {
+			err = oerr
+		}
+	}
+	if m.audit != nil {
+		if aerr := m.audit.close(); err == nil {
+			err = aerr
+		}
+	}
+	if m.persister != nil {
+		if perr := m.persister.close(); err == nil {
+			err = perr
+		}
+	}
+	if m.isolated {
+		m.reg.discard()
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+// slowPuts returns a backend whose Puts take 200ms.
+func slowPuts() *testutil.Blockstore {
+	fb := testutil.New()
+	fb.SetLatency(testutil.Put, testutil.Fixed(200*time.Millisecond))
+	return fb
+}
+
+func TestDrain(t *testing.T) {
+	m := New("t", slowPuts())
+	go m.Put(context.Background(), blocks.NewBlock([]byte("a")))
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.CloseWithTimeout(ctx); err == nil {
+		t.Fatal("expected timeout")
+	}
+	if m.Stats().Counters["close.drain_timeout_total"] != 1 {
+		t.Fatal("counter")
+	}
+	if err := m.Put(context.Background(), blocks.NewBlock([]byte("b"))); err != ErrClosed {
+		t.Fatal(err)
+	}
+}
+
+func TestDrainOption(t *testing.T) {
+	m := New("t2", slowPuts(), WithDrainTimeout(time.Second))
+	done := make(chan error, 1)
+	go func() { done <- m.Put(context.Background(), blocks.NewBlock([]byte("a"))) }()
+	time.Sleep(10 * time.Millisecond)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	n := New("t3", slowPuts(), WithDrainTimeout(20*time.Millisecond))
+	go n.Put(context.Background(), blocks.NewBlock([]byte("a")))
+	time.Sleep(10 * time.Millisecond)
+	if err := n.Close(); err == nil {
+		t.Fatal("expected timeout")
+	}
+	if n.Stats().Gauges["close.drain_abandoned_ops"] != 1 {
+		t.Fatal(n.Stats().Gauges)
+	}
+}
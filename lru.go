@@ -0,0 +1,114 @@
+package measure
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// cidLRU is a bounded set of CIDs whose entries are forgotten once they
+// are older than ttl, or when room is needed for newer ones.
+type cidLRU struct {
+	max int
+	ttl time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List // of *lruEntry, most recent first
+	items map[cid.Cid]*list.Element
+}
+
+type lruEntry struct {
+	c     cid.Cid
+	added time.Time
+}
+
+func newCidLRU(max int, ttl time.Duration) *cidLRU {
+	return &cidLRU{
+		max:   max,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[cid.Cid]*list.Element),
+	}
+}
+
+// add records c as of now, refreshing it if already present.
+func (l *cidLRU) add(c cid.Cid, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[c]; ok {
+		e.Value.(*lruEntry).added = now
+		l.ll.MoveToFront(e)
+		return
+	}
+	l.items[c] = l.ll.PushFront(&lruEntry{c: c, added: now})
+	for l.ll.Len() > l.max {
+		l.removeElement(l.ll.Back())
+	}
+	l.evictExpired(now)
+}
+
+// contains reports whether c was added less than ttl ago.
+func (l *cidLRU) contains(c cid.Cid, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lookup(c, now) != nil
+}
+
+// take is contains, also removing c.
+func (l *cidLRU) take(c cid.Cid, now time.Time) bool {
+	_, ok := l.takeAdded(c, now)
+	return ok
+}
+
+// takeAdded is take, also returning when c was added.
+func (l *cidLRU) takeAdded(c cid.Cid, now time.Time) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := l.lookup(c, now)
+	if e == nil {
+		return time.Time{}, false
+	}
+	l.removeElement(e)
+	return e.Value.(*lruEntry).added, true
+}
+
+// remove forgets c.
+func (l *cidLRU) remove(c cid.Cid) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[c]; ok {
+		l.removeElement(e)
+	}
+}
+
+func (l *cidLRU) lookup(c cid.Cid, now time.Time) *list.Element {
+	e, ok := l.items[c]
+	if !ok {
+		return nil
+	}
+	if l.ttl > 0 && now.Sub(e.Value.(*lruEntry).added) >= l.ttl {
+		l.removeElement(e)
+		return nil
+	}
+	return e
+}
+
+// evictExpired drops entries older than ttl, starting from the oldest.
+func (l *cidLRU) evictExpired(now time.Time) {
+	if l.ttl <= 0 {
+		return
+	}
+	for e := l.ll.Back(); e != nil; e = l.ll.Back() {
+		if now.Sub(e.Value.(*lruEntry).added) < l.ttl {
+			return
+		}
+		l.removeElement(e)
+	}
+}
+
+func (l *cidLRU) removeElement(e *list.Element) {
+	l.ll.Remove(e)
+	delete(l.items, e.Value.(*lruEntry).c)
+}
@@ -0,0 +1,122 @@
+package measure
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+)
+
+// maintenanceBuckets are the bounds, in seconds, of the latency
+// histograms of Check and Scrub, which take from seconds to hours.
+var maintenanceBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600, 2 * 3600, 4 * 3600}
+
+// UnsupportedError is returned by Check and Scrub when nothing the
+// wrapper can reach implements the operation.
+type UnsupportedError struct {
+	// Op is "check" or "scrub".
+	Op string
+	// Backend names the wrapped blockstore, as in Stats.
+	Backend string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("measure: %s is not supported by %s", e.Op, e.Backend)
+}
+
+// checker and scrubber are the maintenance methods of
+// datastore.CheckedDatastore and datastore.ScrubbedDatastore, on their
+// own so that blockstores can implement them too.
+type checker interface {
+	Check(ctx context.Context) error
+}
+
+type scrubber interface {
+	Scrub(ctx context.Context) error
+}
+
+// Check runs the integrity check of the backend, as implemented by
+// datastore.CheckedDatastore. The backend is used if it has a Check
+// method itself; otherwise it is searched through Unwrap, and through
+// Children for backends made of several blockstores or built on
+// datastores, such as datastore.Shims, that expose them.
+// Calls are counted in check_total, failures in check.errors_total, and
+// timed in check.latency_seconds, always in seconds whatever the
+// latency unit. Without a backend to run it, Check returns an
+// *UnsupportedError and records nothing.
+func (m *measure) Check(ctx context.Context) error {
+	c, ok := findMaintainer(m.backend, func(v interface{}) bool {
+		_, ok := v.(checker)
+		return ok
+	}).(checker)
+	if !ok {
+		return &UnsupportedError{Op: "check", Backend: m.backendName}
+	}
+	return m.maintain("check", func() error { return c.Check(ctx) })
+}
+
+// Scrub runs the scrub of the backend, as implemented by
+// datastore.ScrubbedDatastore, found like Check finds its backend.
+// Calls are counted in scrub_total, failures in scrub.errors_total, and
+// timed in scrub.latency_seconds.
+func (m *measure) Scrub(ctx context.Context) error {
+	s, ok := findMaintainer(m.backend, func(v interface{}) bool {
+		_, ok := v.(scrubber)
+		return ok
+	}).(scrubber)
+	if !ok {
+		return &UnsupportedError{Op: "scrub", Backend: m.backendName}
+	}
+	return m.maintain("scrub", func() error { return s.Scrub(ctx) })
+}
+
+// maintain runs the maintenance operation op and records it.
+func (m *measure) maintain(op string, run func() error) error {
+	m.reg.counter(op+"_total", "Number of "+op+" calls").Inc()
+	start := time.Now()
+	err := run()
+	m.reg.histogram(op+".latency_seconds", "Latency distribution of "+op+" calls",
+		maintenanceBuckets).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.reg.counter(op+".errors_total", "Number of failed "+op+" calls").Inc()
+	}
+	return err
+}
+
+// dsParent is implemented by stores built on datastores, such as
+// datastore.Shim.
+type dsParent interface {
+	Children() []datastore.Datastore
+}
+
+// findMaintainer returns the first of v, the stores it wraps and their
+// children, depth first, that supports, or nil.
+func findMaintainer(v interface{}, supports func(interface{}) bool) interface{} {
+	for v != nil {
+		if supports(v) {
+			return v
+		}
+		switch s := v.(type) {
+		case unwrapper:
+			v = s.Unwrap()
+		case dsParent:
+			for _, child := range s.Children() {
+				if found := findMaintainer(child, supports); found != nil {
+					return found
+				}
+			}
+			return nil
+		case parent:
+			for _, child := range s.Children() {
+				if found := findMaintainer(child, supports); found != nil {
+					return found
+				}
+			}
+			return nil
+		default:
+			return nil
+		}
+	}
+	return nil
+}
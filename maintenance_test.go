@@ -0,0 +1,54 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type checkedBS struct {
+	*testutil.Blockstore
+	n int
+}
+
+func (c *checkedBS) Check(context.Context) error { c.n++; return errors.New("bad") }
+
+type dsHolder struct {
+	*testutil.Blockstore
+	ds []datastore.Datastore
+}
+
+func (d *dsHolder) Children() []datastore.Datastore { return d.ds }
+
+type scrubDS struct {
+	datastore.Datastore
+	n int
+}
+
+func (s *scrubDS) Scrub(context.Context) error { s.n++; return nil }
+
+func TestMaintenance(t *testing.T) {
+	ctx := context.Background()
+	c := &checkedBS{Blockstore: testutil.New()}
+	m := New("mt", c)
+	if err := m.Check(ctx); err == nil || c.n != 1 {
+		t.Fatal(err)
+	}
+	var ue *UnsupportedError
+	if err := m.Scrub(ctx); !errors.As(err, &ue) || ue.Op != "scrub" {
+		t.Fatal(err)
+	}
+	st := m.Stats()
+	if st.Counters["check_total"] != 1 || st.Counters["check.errors_total"] != 1 || st.Histograms["check.latency_seconds"].Count != 1 {
+		t.Fatal(st.Counters)
+	}
+	sd := &scrubDS{}
+	n := New("mt2", &dsHolder{Blockstore: testutil.New(), ds: []datastore.Datastore{sd}})
+	if err := n.Scrub(ctx); err != nil || sd.n != 1 {
+		t.Fatal(err)
+	}
+}
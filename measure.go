@@ -4,7 +4,6 @@ package measure
 
 import (
 	"context"
-	"io"
 	"time"
 
 	blocks "github.com/ipfs/go-block-format"
@@ -21,73 +20,524 @@ var (
 
 	// sort sizes in buckets with following upper bounds in bytes
 	datastoreSizeBuckets = []float64{1 << 6, 1 << 12, 1 << 18, 1 << 24}
+
+	// sort batch sizes in buckets with following upper bounds in items
+	batchSizeBuckets = []float64{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384}
 )
 
 var _ blockstore.Blockstore = (*measure)(nil)
 
 // New wraps the datastore, providing metrics on the operations. The
 // metrics are registered with names starting with prefix and a dot.
-func New(prefix string, bs blockstore.Blockstore) *measure {
+func New(prefix string, bs blockstore.Blockstore, opts ...Option) *measure {
+	cfg := defaultConfig()
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	r := newRegistry(prefix, cfg.newRecorder())
+	r.latencyUnit = cfg.latencyUnit
+	r.adaptiveBuckets = cfg.adaptiveBuckets
+	r.latencySums = cfg.latencySums
+	r.latencyCeiling = cfg.latencyCeiling
+	r.clock = cfg.clock
+	var restored bool
+	if cfg.persistStore != nil {
+		r.restored, restored = loadCounters(cfg.persistStore)
+	}
+	raw := bs
+	if cfg.compression != nil {
+		bs = newCompressedStore(r, bs, *cfg.compression)
+	}
+	interceptors := cfg.interceptors
+	if cfg.overheadRate > 0 {
+		interceptors = append(interceptors[:len(interceptors):len(interceptors)], overheadTimer{})
+	}
+	if cfg.faults != nil {
+		interceptors = append(interceptors[:len(interceptors):len(interceptors)], newFaultInjector(r, *cfg.faults))
+	}
+	if len(interceptors) > 0 {
+		bs = newInterceptedStore(r, bs, interceptors)
+	}
 	m := &measure{
 		backend: bs,
+		reg:     r,
+		clock:   cfg.clock,
+		life: lifecycle{
+			drained:       make(chan struct{}, 1),
+			drainTimeout:  cfg.drainTimeout,
+			inflightGauge: r.gauge("inflight", "Number of operations currently running"),
+		},
+		cidFormat: cfg.cidFormat,
+
+		maxBatchSize:    cfg.maxBatchSize,
+		rejectOversized: cfg.rejectOversized,
+		panicRecovery:   cfg.panicRecovery,
+		dedupKeys:       cfg.dedupKeys,
+
+		allKeysMaxTracked: cfg.allKeysMaxTracked,
+		conflictRetries:   cfg.conflictRetries,
+		failedItemRetries: cfg.failedItemRetries,
+		isolated:          cfg.isolated,
+
+		putExistenceCheck:    cfg.putExistenceCheck,
+		compareOverwriteSize: cfg.compareOverwriteSize,
+		batchErrors:          cfg.batchErrors,
+		partialWriteProbe:    cfg.partialWriteProbe,
+		traceID:              cfg.traceID,
+		latencyMinSize:       cfg.latencyMinSize,
+		labels:               cfg.labels,
+		sizeEstimator:        cfg.sizeEstimator,
+
+		putNum: r.counter("put_total", "Total number of Datastore.Put calls"),
+		putErr: r.counter("put.errors_total", "Number of errored Blockstore.Put calls"),
+		putLatency: r.latency("put.latency",
+			"Latency distribution of Blockstore.Put calls"),
+		putSize: r.histogram("put.size_bytes",
+			"Size distribution of stored byte slices", datastoreSizeBuckets),
+
+		putManyNum: r.counter("putmany_total", "Total number of Datastore.PutMany calls"),
+		putManyErr: r.counter("putmany.errors_total", "Number of errored Blockstore.PutMany calls"),
+		putManyLatency: r.latency("putmany.latency",
+			"Latency distribution of Blockstore.PutMany calls"),
+		putManySize: r.histogram(cfg.putManySizeName(),
+			"Size distribution of Blockstore.PutMany batch sizes", batchSizeBuckets),
+		putManySizeAvg: r.gauge("putmany.batch_size_avg",
+			"Average Blockstore.PutMany batch size over the last minute"),
+		putManyPerBlock: r.latency("putmany.per_block_latency",
+			"Distribution of the latency of successful Blockstore.PutMany calls divided by their number of blocks"),
+		errorRate: r.gauge("error_rate",
+			"Fraction of the operations of the last minute that failed, not counting not-found errors"),
+
+		syncNum: r.counter("sync_total", "Total number of Blockstore.Sync calls"),
+		syncErr: r.counter("sync.errors_total", "Number of errored Blockstore.Sync calls"),
+		syncLatency: r.latency("sync.latency",
+			"Latency distribution of Blockstore.Sync calls"),
 
-		putNum: metrics.New(prefix+".put_total", "Total number of Datastore.Put calls").Counter(),
-		putErr: metrics.New(prefix+".put.errors_total", "Number of errored Blockstore.Put calls").Counter(),
-		putLatency: metrics.New(prefix+".put.latency_seconds",
-			"Latency distribution of Blockstore.Put calls").Histogram(datastoreLatencyBuckets),
-		putSize: metrics.New(prefix+".put.size_bytes",
-			"Size distribution of stored byte slices").Histogram(datastoreSizeBuckets),
-
-		putManyNum: metrics.New(prefix+".putmany_total", "Total number of Datastore.PutMany calls").Counter(),
-		putManyErr: metrics.New(prefix+".putmany.errors_total", "Number of errored Blockstore.PutMany calls").Counter(),
-		putManyLatency: metrics.New(prefix+".putmany.latency_seconds",
-			"Latency distribution of Blockstore.PutMany calls").Histogram(datastoreLatencyBuckets),
-		putManySize: metrics.New(prefix+".putmany.size_bytes",
-			"Size distribution of Blockstore.PutMany batch sizes").Histogram(datastoreSizeBuckets),
-
-		syncNum: metrics.New(prefix+".sync_total", "Total number of Blockstore.Sync calls").Counter(),
-		syncErr: metrics.New(prefix+".sync.errors_total", "Number of errored Blockstore.Sync calls").Counter(),
-		syncLatency: metrics.New(prefix+".sync.latency_seconds",
-			"Latency distribution of Blockstore.Sync calls").Histogram(datastoreLatencyBuckets),
-
-		getNum: metrics.New(prefix+".get_total", "Total number of Blockstore.Get calls").Counter(),
-		getErr: metrics.New(prefix+".get.errors_total", "Number of errored Blockstore.Get calls").Counter(),
-		getLatency: metrics.New(prefix+".get.latency_seconds",
-			"Latency distribution of Blockstore.Get calls").Histogram(datastoreLatencyBuckets),
-		getSize: metrics.New(prefix+".get.size_bytes",
-			"Size distribution of retrieved byte slices").Histogram(datastoreSizeBuckets),
-
-		hasNum: metrics.New(prefix+".has_total", "Total number of Blockstore.Has calls").Counter(),
-		hasErr: metrics.New(prefix+".has.errors_total", "Number of errored Blockstore.Has calls").Counter(),
-		hasLatency: metrics.New(prefix+".has.latency_seconds",
-			"Latency distribution of Blockstore.Has calls").Histogram(datastoreLatencyBuckets),
-		getsizeNum: metrics.New(prefix+".getsize_total", "Total number of Blockstore.GetSize calls").Counter(),
-		getsizeErr: metrics.New(prefix+".getsize.errors_total", "Number of errored Blockstore.GetSize calls").Counter(),
-		getsizeLatency: metrics.New(prefix+".getsize.latency_seconds",
-			"Latency distribution of Blockstore.GetSize calls").Histogram(datastoreLatencyBuckets),
-
-		deleteNum: metrics.New(prefix+".delete_total", "Total number of Blockstore.Delete calls").Counter(),
-		deleteErr: metrics.New(prefix+".delete.errors_total", "Number of errored Blockstore.Delete calls").Counter(),
-		deleteLatency: metrics.New(prefix+".delete.latency_seconds",
-			"Latency distribution of Blockstore.Delete calls").Histogram(datastoreLatencyBuckets),
-
-		deleteManyNum: metrics.New(prefix+".deletemany_total", "Total number of Blockstore.DeleteMany calls").Counter(),
-		deleteManyErr: metrics.New(prefix+".deletemany.errors_total", "Number of errored Blockstore.DeleteMany calls").Counter(),
-		deleteManyLatency: metrics.New(prefix+".deletemany.latency_seconds",
-			"Latency distribution of Blockstore.DeleteMany calls").Histogram(datastoreLatencyBuckets),
-		deleteManySize: metrics.New(prefix+".deletemany.size_items",
-			"Size distribution of batch delete calls").Histogram(datastoreSizeBuckets),
-
-		viewNum: metrics.New(prefix+".view_total", "Total number of Blockstore.View calls").Counter(),
-		viewErr: metrics.New(prefix+".view.errors_total", "Number of errored Blockstore.View calls").Counter(),
-		viewLatency: metrics.New(prefix+".view.latency_seconds",
-			"Latency distribution of Blockstore.View calls").Histogram(datastoreLatencyBuckets),
+		getNum: r.counter("get_total", "Total number of Blockstore.Get calls"),
+		getErr: r.counter("get.errors_total", "Number of errored Blockstore.Get calls"),
+		getLatency: r.latency("get.latency",
+			"Latency distribution of Blockstore.Get calls"),
+		getSize: r.histogram("get.size_bytes",
+			"Size distribution of retrieved byte slices", datastoreSizeBuckets),
+
+		hasNum: r.counter("has_total", "Total number of Blockstore.Has calls"),
+		hasErr: r.counter("has.errors_total", "Number of errored Blockstore.Has calls"),
+		hasLatency: r.latency("has.latency",
+			"Latency distribution of Blockstore.Has calls"),
+		hasFoundLatency: r.latency("has.found.latency",
+			"Latency distribution of Blockstore.Has calls that found the block"),
+		hasMissingLatency: r.latency("has.missing.latency",
+			"Latency distribution of Blockstore.Has calls that didn't find the block"),
+		getsizeNum: r.counter("getsize_total", "Total number of Blockstore.GetSize calls"),
+		getsizeErr: r.counter("getsize.errors_total", "Number of errored Blockstore.GetSize calls"),
+		getsizeLatency: r.latency("getsize.latency",
+			"Latency distribution of Blockstore.GetSize calls"),
+
+		deleteNum: r.counter("delete_total", "Total number of Blockstore.Delete calls"),
+		deleteErr: r.counter("delete.errors_total", "Number of errored Blockstore.Delete calls"),
+		deleteLatency: r.latency("delete.latency",
+			"Latency distribution of Blockstore.Delete calls"),
+
+		deleteManyNum: r.counter("deletemany_total", "Total number of Blockstore.DeleteMany calls"),
+		deleteManyErr: r.counter("deletemany.errors_total", "Number of errored Blockstore.DeleteMany calls"),
+		deleteManyLatency: r.latency("deletemany.latency",
+			"Latency distribution of Blockstore.DeleteMany calls"),
+		deleteManySize: r.histogram("deletemany.size_items",
+			"Size distribution of batch delete calls", batchSizeBuckets),
+
+		viewNum: r.counter("view_total", "Total number of Blockstore.View calls"),
+		viewErr: r.counter("view.errors_total", "Number of errored Blockstore.View calls"),
+		viewLatency: r.latency("view.latency",
+			"Latency distribution of Blockstore.View calls"),
+
+		allKeysParallelLatency: r.latency("allkeys.parallel.latency",
+			"Latency distribution of complete AllKeysParallel enumerations"),
+		allKeysFirstKeyLatency: r.latency("allkeys.first_key.latency",
+			"Distribution of the time AllKeysChan enumerations took to deliver their first key"),
+
+		allKeysActive: r.gauge("allkeys.active", "Number of key enumerations currently open"),
+		allKeysAbandoned: r.counter("allkeys.abandoned_total",
+			"Number of key enumerations stopped by their context before the end"),
+
+		drainLatency: r.latency("close.drain.latency",
+			"Time spent waiting for running operations when closing"),
+		drainTimeout: r.counter("close.drain_timeout_total",
+			"Number of closes that timed out waiting for running operations"),
+		drainAbandoned: r.gauge("close.drain_abandoned_ops",
+			"Number of operations still running when a close timed out"),
+		closeCancelled: r.counter("close.cancelled_inflight_total",
+			"Number of operations failed after their context was cancelled by Close"),
+
+		expiredNum: r.counter("expired_total", "Number of reads of blocks whose TTL had expired"),
+	}
+	m.streaks = newFailureStreaks()
+	m.keyScan = newKeyLimiter(r, cfg.keyScanRate)
+	m.backendName = backendName(bs)
+	// Compression and interceptors wrap the backend in a blockstore
+	// implementing View, DeleteMany and PutWithTTL whatever the backend
+	// supports, so the backend itself tells which to use.
+	if _, ok := raw.(batchDeleter); ok {
+		m.deleter = bs.(batchDeleter)
+	}
+	if _, ok := raw.(bsViewer); ok {
+		m.viewer = bs.(bsViewer)
+	}
+	if _, ok := raw.(ttlPutter); ok {
+		m.ttlPutter = bs.(ttlPutter)
+	}
+	if m.viewer != nil {
+		m.readPaths = newReadPaths(r)
+	}
+	m.prefixViewer, _ = bs.(PrefixViewer)
+	m.reportCapabilities(r)
+	m.readOnly = cfg.readOnly
+	m.putManyCheckRate = cfg.putManyCheckRate
+	m.deleteEfficiency = newDeleteEfficiency(r)
+	m.identity = newIdentityOps(r, cfg.identityShortCircuit)
+	m.lastLatencies = newLastLatencies(r)
+	if cfg.sizeClassLatency {
+		m.sizeClassLatencies = newSizeClassLatencies(r)
+	}
+	if cfg.concurrencyLatency {
+		m.concurrencyLatencies = newConcurrencyLatencies(r)
+	}
+	if cfg.hourlyLatency {
+		m.hourlyLatencies = newHourlyLatencies(r)
+	}
+	if cfg.readSequences > 0 {
+		m.readSequences = newReadSequences(r, cfg.readSequences, cfg.clock)
+	}
+	if cfg.putCountSize > 0 {
+		m.putCounts = newPutCounter(r, cfg.putCountSize, cfg.putCountTop)
+	}
+	if cfg.putConcurrency {
+		m.putConcurrency = newPutConcurrency(r)
+	}
+	if cfg.distinctPrecision > 0 {
+		m.distinct = newHyperLogLog(r, cfg.distinctPrecision)
+	}
+	m.queueDepth = newQueueDepth(r, bs)
+	m.durability = newDurability(r, bs)
+	if cfg.freeSpace {
+		m.freeSpace = newFreeSpaceMonitor(r, bs, cfg.freeSpaceInterval, cfg.freeSpaceLow, cfg.clock)
+	}
+	if cfg.tombstones {
+		m.tombstones = newTombstoneMonitor(r, bs, cfg.tombstoneRatio, cfg.clock)
+	}
+	m.hashOnRead.gauge = r.gauge("hash_on_read", "Whether blocks are verified on read, 1 if so")
+	m.created = cfg.clock.Now()
+	r.gauge("start_time_seconds", "Unix time at which the wrapper was created").
+		Set(float64(m.created.UnixNano()) / 1e9)
+	m.uptime = r.gauge("uptime_seconds", "Seconds since the wrapper was created, updated by Stats and Snapshot")
+	m.viewRatio = newViewRatio(r)
+	m.enabled.disabledTime = r.counter("instrumentation.disabled_seconds_total",
+		"Time the instrumentation was turned off with SetEnabled")
+	m.deadlineTracking = cfg.deadlineTracking
+	if cfg.tagExtract != nil {
+		m.tags = &tagger{
+			extract: cfg.tagExtract,
+			max:     cfg.maxTags,
+			seen:    make(map[string]struct{}),
+		}
+	}
+	m.coldStart = newColdStart(r)
+	var warmupComplete metrics.Gauge
+	if cfg.warmupOps > 0 {
+		warmupComplete = r.gauge("warmup_complete_timestamp_seconds",
+			"Unix time at which an operation type last finished warming up")
+	}
+	for op, h := range map[Op]*metrics.Histogram{
+		OpPut: &m.putLatency, OpPutMany: &m.putManyLatency, OpGet: &m.getLatency,
+		OpHas: &m.hasLatency, OpGetSize: &m.getsizeLatency, OpDelete: &m.deleteLatency,
+		OpDeleteMany: &m.deleteManyLatency, OpView: &m.viewLatency,
+	} {
+		if cfg.warmupOps > 0 {
+			*h = m.newWarmupHistogram(op, *h, cfg.warmupOps, warmupComplete)
+		}
+		*h = m.coldStart.wrap(*h)
+	}
+	if cfg.expiryMax > 0 {
+		m.expiry = &expiryTracker{
+			max:           cfg.expiryMax,
+			deleteExpired: cfg.expiryDelete,
+			expires:       make(map[cid.Cid]time.Time),
+		}
+	}
+	if cfg.opLog != nil {
+		m.opLog = newOpLog(cfg.opLog,
+			r.counter("oplog.write_errors_total", "Number of operation log records that failed to be written"))
+		m.sinks = append(m.sinks, m.opLog.record)
+	}
+	if cfg.journal != nil {
+		m.journal = newJournal(cfg.journal, cfg.cidFormat,
+			r.counter("journal.dropped_total", "Number of journal records dropped because the queue was full"))
+		m.sinks = append(m.sinks, m.journal.record)
+	}
+	if cfg.errorLogging != nil && cfg.errorLogging.logger != nil {
+		m.sinks = append(m.sinks, newErrorLogger(m, *cfg.errorLogging).record)
+	}
+	if cfg.spanExporter != nil {
+		m.sinks = append(m.sinks, newTailTracer(r, cfg.spanExporter, cfg.spanThreshold).record)
+	}
+	if cfg.eventTraceSize > 0 {
+		m.eventTrace = newEventTrace(cfg.eventTraceSize)
+		m.sinks = append(m.sinks, m.eventTrace.record)
+	}
+	if cfg.traceLogRate > 0 && cfg.traceLogger != nil {
+		m.sinks = append(m.sinks, newTraceLog(m, cfg.traceLogRate, cfg.traceLogger).record)
+	}
+	if cfg.allocRate > 0 {
+		m.alloc = newAllocSampler(r, cfg.allocRate)
+	}
+	if cfg.sizeCheckRate > 0 {
+		m.sizeCheck = newSizeChecker(r, cfg.sizeCheckRate, cfg.sizeCheckLogf)
+	}
+	if cfg.maxBlockSizeAlarm > 0 {
+		m.sizeAlarm = newBlockSizeAlarm(r, cfg.maxBlockSizeAlarm, cfg.rejectTooLarge, cfg.blockSizeAlarmLogf)
+	}
+	if cfg.readdSize > 0 {
+		m.readd = newReaddTracker(r, cfg.readdSize, cfg.readdWindow)
+	}
+	if cfg.notFoundSize > 0 {
+		m.notFound = newNotFoundCache(r, cfg.notFoundSize, cfg.notFoundTTL)
+	}
+	if cfg.readCacheBytes > 0 {
+		m.cache = newReadCache(r, cfg.readCacheBytes)
+	}
+	if cfg.deleteAudit != nil {
+		m.audit = newDeleteAudit(r, *cfg.deleteAudit)
+	}
+	if cfg.persistStore != nil {
+		m.persister = newPersister(r, cfg.persistStore, cfg.persistInterval, restored)
+	}
+	if cfg.errorHistory != nil && cfg.errorHistory.size > 0 {
+		m.errHistory = newErrorHistory(*cfg.errorHistory)
+	}
+	if cfg.bloomKeys > 0 {
+		m.bloom = newBloomFilter(r, cfg.bloomKeys, cfg.bloomFPRate)
+	}
+	if cfg.stackDepthRate > 0 {
+		m.stackDepth = newStackDepthSampler(r, cfg.stackDepthThreshold, cfg.stackDepthRate)
+	}
+	if cfg.errorLatencySplit {
+		m.errorLatencies = newErrorLatencies(r)
+	}
+	if cfg.fencingToken != nil {
+		m.fence = newFence(cfg.fencingToken)
+	}
+	if cfg.hotSize > 0 {
+		m.hot = newHotTracker(r, cfg.hotSize, cfg.hotTop)
+	}
+	if cfg.rawSize > 0 {
+		m.raw = newReadAfterWrite(r, cfg.rawRate, cfg.rawSize)
+	}
+	if cfg.invariants {
+		m.invariants = newInvariantChecker(cfg.invariantLog)
+	}
+	if cfg.reentrancy {
+		m.reentrancy = newReentrancyDetector(cfg.reentrancyLog)
+	}
+	m.dryRun.log = cfg.dryRunLog
+	m.SetDryRunDeletes(cfg.dryRunDeletes)
+	if cfg.blockAge {
+		m.blockAge = newBlockAgeHistogram(r)
+	}
+	if cfg.interKeyGaps {
+		m.interKeyGap = newInterKeyGapHistogram(r)
+	}
+	if cfg.latencyPerMB {
+		m.latencyPerMB = newLatencyPerMBHistogram(r)
+	}
+	if cfg.interBatchTiming {
+		m.interBatch = newInterBatchTimer(r)
+	}
+	if cfg.p99DriftInterval > 0 {
+		m.p99Drift = newP99Drift(r, cfg.p99DriftInterval, cfg.clock)
+	}
+	if cfg.ackOrdering {
+		m.ackOrder = newAckOrder(r)
+	}
+	if cfg.sizeEntropy {
+		m.sizeEntropy = newSizeEntropy(r)
+	}
+	if cfg.codecSizes {
+		m.codecSizes = newCodecSizes(r)
+	}
+	if cfg.reservoirSize > 0 {
+		m.reservoirs = newReservoirs(cfg.reservoirSize)
+	}
+	if cfg.staleReadSize > 0 {
+		m.staleReads = newStaleReads(r, cfg.staleReadSize)
+	}
+	if cfg.overheadRate > 0 {
+		m.overheadRate = cfg.overheadRate
+		m.overhead = newOverheadHistogram(r)
+	}
+	if len(cfg.sloTargets) > 0 {
+		m.sloTargets = newSLOTargets(r, cfg.sloTargets)
+	}
+	if cfg.baselineFactor > 0 {
+		m.baselines = newLatencyBaselines(r, cfg.baselineFactor)
+	}
+	if cfg.deleteAge {
+		m.deleteAge = newDeleteAgeHistogram(r)
+	}
+	if cfg.singleflight {
+		m.flights = newFlightGroup(r)
+	}
+	if cfg.writeBehind != nil {
+		m.writeBehind = newWriteBehind(m, *cfg.writeBehind)
+	} else if cfg.coalesceMaxBatch > 0 {
+		m.coalescer = newCoalescer(m, cfg.coalesceMaxBatch, cfg.coalesceMaxDelay)
 	}
 	return m
 }
 
 type measure struct {
 	backend blockstore.Blockstore
+	reg     *registry
+	clock   Clock
+	life    lifecycle
+	expiry  *expiryTracker
+	journal *journal
+	opLog   *opLog
+
+	coalescer   *coalescer
+	writeBehind *writeBehind
+	sizeCheck   *sizeChecker
+	sizeAlarm   *blockSizeAlarm
+	flights     *flightGroup
+	readd       *readdTracker
+	notFound    *notFoundCache
+	cache       *readCache
+	dryRun      dryRun
+	enabled     enabledState
+	coldStart   *coldStart
+	lastErrs    lastErrors
+	streaks     failureStreaks
+	audit       *deleteAudit
+	tags        *tagger
+	invariants  *invariantChecker
+	reentrancy  *reentrancyDetector
+	distinct    *hyperLogLog
+	errHistory  *errorHistory
+	persister   *persister
+	raw         *readAfterWrite
+	hot         *hotTracker
+	keyScan     *keyLimiter
+
+	putConcurrency   *putConcurrency
+	deleteEfficiency *deleteEfficiency
+	putCounts        *putCounter
+
+	deadlineTracking bool
+	readOnly         bool
+	putManyCheckRate float64
+
+	// maxBatchSize limits batch sizes, see WithMaxBatchSize.
+	maxBatchSize    int
+	rejectOversized bool
+	panicRecovery   bool
+	dedupKeys       bool
+	fence           *fence
+	stackDepth      *stackDepthSampler
+	bloom           *bloomFilter
+
+	// allKeysMaxTracked bounds the keys remembered by an enumeration.
+	allKeysMaxTracked int
+	// conflictRetries is set by WithConflictRetries.
+	conflictRetries int
+	// failedItemRetries is set by WithFailedItemRetries.
+	failedItemRetries int
+	// isolated is set by WithIsolatedRegistry.
+	isolated bool
+
+	// putExistenceCheck and compareOverwriteSize are set by
+	// WithPutExistenceCheck.
+	putExistenceCheck    bool
+	compareOverwriteSize bool
+
+	// batchErrors and partialWriteProbe are set by WithBatchErrors.
+	batchErrors       bool
+	partialWriteProbe int
+
+	// labels are reported in Stats, see Set.
+	labels map[string]string
+
+	hashOnRead hashOnRead
+
+	// sizeEstimator is set by WithSizeEstimator.
+	sizeEstimator func(blocks.Block) int
+
+	// alloc is nil unless WithAllocSampling is set.
+	alloc *allocSampler
+
+	// latencyMinSize is set by WithLatencyThresholdSize.
+	latencyMinSize int
+
+	// deleter, viewer and ttlPutter are the backend if it implements
+	// DeleteMany, View or PutWithTTL, and nil otherwise.
+	deleter   batchDeleter
+	viewer    bsViewer
+	ttlPutter ttlPutter
+
+	// prefixViewer is the backend if it implements ViewPrefix.
+	prefixViewer PrefixViewer
+
+	// queueDepth is nil unless the backend is a QueueDepther.
+	queueDepth *queueDepth
+
+	// durability is nil unless the backend is a DurabilityNotifier.
+	durability *durability
+
+	// freeSpace is nil unless WithFreeSpaceMonitor is set and the
+	// backend is a FreeSpacer.
+	freeSpace *freeSpaceMonitor
+	// tombstones is nil unless WithTombstoneMonitor is set and the
+	// backend is a TombstoneCounter.
+	tombstones *tombstoneMonitor
+
+	// traceID extracts exemplar trace IDs, see WithExemplars.
+	traceID func(context.Context) string
+
+	// errorLatencies holds the <op>.error_latency histograms, see
+	// WithErrorLatencySplit.
+	errorLatencies map[Op]metrics.Histogram
+
+	// sizeClassLatencies holds the histograms of WithSizeClassLatency.
+	sizeClassLatencies map[Op][]metrics.Histogram
+
+	// concurrencyLatencies holds the histograms of
+	// WithConcurrencyLatency.
+	concurrencyLatencies map[Op][]metrics.Histogram
+
+	// hourlyLatencies holds the histograms of WithHourlyLatency.
+	hourlyLatencies map[Op][]metrics.Histogram
+
+	// readSequences is nil unless WithReadSequences is set.
+	readSequences *readSequences
+
+	// backendName and created are reported in Stats, see backendName.
+	backendName string
+	created     time.Time
+	uptime      metrics.Gauge
+
+	// sinks receive an event for every completed operation.
+	sinks []func(*opEvent)
+
+	identity  *identityOps
+	viewRatio *viewRatio
+	// readPaths is nil unless the backend implements View.
+	readPaths *readPaths
+
+	// lastLatencies holds the <op>.last_latency_seconds gauges.
+	lastLatencies map[Op]metrics.Gauge
+
+	// eventTrace is nil unless WithEventTrace is set.
+	eventTrace *eventTrace
+	// cidFormat renders CIDs in journal records and logs.
+	cidFormat func(cid.Cid) string
 
 	putNum     metrics.Counter
 	putErr     metrics.Counter
@@ -98,6 +548,13 @@ type measure struct {
 	putManyErr     metrics.Counter
 	putManyLatency metrics.Histogram
 	putManySize    metrics.Histogram
+	putManySizeAvg metrics.Gauge
+	putManyWindow  batchWindow
+	// putManyPerBlock is set by observePerBlockLatency.
+	putManyPerBlock metrics.Histogram
+
+	errorRate   metrics.Gauge
+	errorWindow errorWindow
 
 	syncNum     metrics.Counter
 	syncErr     metrics.Counter
@@ -111,6 +568,9 @@ type measure struct {
 	hasNum     metrics.Counter
 	hasErr     metrics.Counter
 	hasLatency metrics.Histogram
+	// By outcome, errors excluded.
+	hasFoundLatency   metrics.Histogram
+	hasMissingLatency metrics.Histogram
 
 	getsizeNum     metrics.Counter
 	getsizeErr     metrics.Counter
@@ -128,38 +588,227 @@ type measure struct {
 	viewNum     metrics.Counter
 	viewErr     metrics.Counter
 	viewLatency metrics.Histogram
+
+	allKeysParallelLatency metrics.Histogram
+	allKeysFirstKeyLatency metrics.Histogram
+	allKeysActive          metrics.Gauge
+	allKeysAbandoned       metrics.Counter
+
+	drainLatency   metrics.Histogram
+	drainTimeout   metrics.Counter
+	drainAbandoned metrics.Gauge
+	closeCancelled metrics.Counter
+	closeCanceller closeCanceller
+
+	expiredNum metrics.Counter
+
+	blockAge  metrics.Histogram
+	deleteAge metrics.Histogram
+
+	overheadRate float64
+	overhead     metrics.Histogram
+
+	sizeEntropy *sizeEntropy
+	interKeyGap metrics.Histogram
+	// latencyPerMB is nil unless WithLatencyPerMB is set.
+	latencyPerMB metrics.Histogram
+	// interBatch is nil unless WithInterBatchTiming is set.
+	interBatch *interBatchTimer
+	// p99Drift is nil unless WithP99Drift is set.
+	p99Drift *p99Drift
+	// ackOrder is nil unless WithAckOrdering is set.
+	ackOrder *ackOrder
+
+	// staleReads is nil unless WithStaleReadDetection is set.
+	staleReads *staleReads
+
+	// sloTargets holds the operations given to WithSLOTarget.
+	sloTargets map[Op]*sloTarget
+	// baselines is set by WithLatencyBaseline.
+	baselines map[Op]*latencyBaseline
+	// codecSizes is nil unless WithCodecSizes is set.
+	codecSizes *codecSizes
+	// reservoirs is set by WithLatencyReservoir.
+	reservoirs map[Op]*reservoir
 }
 
-func recordLatency(h metrics.Histogram, start time.Time) {
-	elapsed := time.Since(start)
-	h.Observe(float64(elapsed.Milliseconds()))
+// recordLatency observes in h the time elapsed since start, measured
+// with clock, which start must come from.
+func recordLatency(clock Clock, h metrics.Histogram, start time.Time) {
+	h.Observe(clock.Now().Sub(start).Seconds())
 }
 
 func (m *measure) Put(ctx context.Context, blk blocks.Block) error {
-	defer recordLatency(m.putLatency, time.Now())
+	return m.put(ctx, blk, nil)
+}
+
+// put is Put, writing blk straight to the backend with write if set,
+// skipping write-behind and coalescing.
+func (m *measure) put(ctx context.Context, blk blocks.Block, write PutFunc) (err error) {
+	if m.readOnly {
+		return m.rejectReadOnly(OpPut)
+	}
+	if err = m.checkBlockSizes(blk); err != nil {
+		return err
+	}
+	if m.bypass() {
+		return m.putDirect(ctx, blk, write)
+	}
+	if isIdentity(blk.Cid()) {
+		return m.putIdentity(ctx, blk)
+	}
+	if err = m.enter(OpPut); err != nil {
+		return err
+	}
+	defer m.exitOp()
+	ctx, overhead := m.startOverhead(ctx)
+	defer m.finishOverhead(overhead)
+	ctx, unbind := m.bindClose(ctx)
+	defer unbind(&err)
+	ev := m.startEvent(ctx, "put", blk.Cid(), 0)
+	defer m.finishEvent(ev, &err)
+	defer m.recordOutcome(OpPut, blk.Cid(), &err)
+	defer m.observeHeadroom(ctx, OpPut)
+	size := len(blk.RawData())
+	defer m.recordOpLatency(ctx, OpPut, m.putLatency, m.clock.Now(), &size, &err)
+	defer m.recoverPanic(OpPut, m.putErr, blk.Cid(), &err)
 	m.putNum.Inc()
-	m.putSize.Observe(float64(len(blk.RawData())))
-	err := m.backend.Put(ctx, blk)
+	m.enterPut()
+	defer m.exitPut()
+	m.countTag(ctx, OpPut)
+	m.countOrigin(ctx, OpPut)
+	if err = m.fenced(OpPut); err != nil {
+		m.countError(OpPut, m.putErr, blk.Cid(), err)
+		return err
+	}
+	m.putSize.Observe(float64(m.blockSize(blk)))
+	m.observeSizeEntropy()
+	ev.setBytes(m.blockSize(blk))
+	m.bloomAdd(blk.Cid())
+	seq := m.startAck()
+	switch {
+	case write != nil:
+		err = write(ctx, blk)
+	case m.writeBehind != nil:
+		err = m.writeBehind.enqueue(ctx, blk)
+	case m.coalescer != nil:
+		err = m.coalescer.put(ctx, blk)
+	default:
+		done := m.sampleAlloc(OpPut, 1)
+		err = m.backend.Put(ctx, blk)
+		done()
+		if err == nil {
+			m.awaitDurable(blk.Cid())
+		}
+	}
+	if err == nil {
+		m.ack(seq)
+	}
+	m.observeQueueDepth()
+	m.observeFreeSpace()
+	m.invalidateMissing(blk.Cid())
 	if err != nil {
-		m.putErr.Inc()
+		m.countError(OpPut, m.putErr, blk.Cid(), err)
+		return err
 	}
-	return err
+	m.clearExpiry(blk.Cid())
+	m.noteWritten(blk.Cid())
+	m.sampleWrite(blk.Cid())
+	m.countPut(blk.Cid())
+	m.observeCodecSizes(blk)
+	return nil
 }
 
-func (m *measure) PutMany(ctx context.Context, blks []blocks.Block) error {
-	defer recordLatency(m.putManyLatency, time.Now())
+func (m *measure) PutMany(ctx context.Context, blks []blocks.Block) (err error) {
+	if m.readOnly {
+		return m.rejectReadOnly(OpPutMany)
+	}
+	if err = m.checkBlockSizes(blks...); err != nil {
+		return err
+	}
+	if m.bypass() {
+		return m.putManyDirect(ctx, blks)
+	}
+	if m.oversized(len(blks)) {
+		return m.splitPutMany(ctx, blks)
+	}
+	if err = m.enter(OpPutMany); err != nil {
+		return err
+	}
+	defer m.exitOp()
+	ctx, overhead := m.startOverhead(ctx)
+	defer m.finishOverhead(overhead)
+	ctx, unbind := m.bindClose(ctx)
+	defer unbind(&err)
+	ev := m.startEvent(ctx, "putmany", cid.Undef, len(blks))
+	if ev != nil {
+		ev.Blocks = blks
+	}
+	defer m.finishEvent(ev, &err)
+	defer m.recordOutcome(OpPutMany, cid.Undef, &err)
+	defer m.observeHeadroom(ctx, OpPutMany)
+	defer m.recordOpLatency(ctx, OpPutMany, m.putManyLatency, m.clock.Now(), nil, &err)
+	defer m.observePerBlockLatency(m.clock.Now(), len(blks), &err)
+	defer m.recoverPanic(OpPutMany, m.putManyErr, cid.Undef, &err)
 	m.putManyNum.Inc()
+	m.countTag(ctx, OpPutMany)
+	m.countOrigin(ctx, OpPutMany)
+	if err = m.fenced(OpPutMany); err != nil {
+		m.countError(OpPutMany, m.putManyErr, cid.Undef, err)
+		return err
+	}
 	m.putManySize.Observe(float64(len(blks)))
-	err := m.backend.PutMany(ctx, blks)
+	m.putManySizeAvg.Set(m.putManyWindow.add(m.clock.Now(), len(blks)))
+	m.observeInterBatch()
+	if ev != nil {
+		var total int
+		for _, blk := range blks {
+			total += m.blockSize(blk)
+		}
+		ev.setBytes(total)
+	}
+	if m.bloom != nil {
+		for _, blk := range blks {
+			m.bloomAdd(blk.Cid())
+		}
+	}
+	if m.writeBehind != nil {
+		err = m.writeBehind.enqueue(ctx, blks...)
+	} else {
+		done := m.sampleAlloc(OpPutMany, len(blks))
+		err = m.backend.PutMany(ctx, blks)
+		done()
+		err = m.retryConflicts(ctx, blks, err)
+		err = m.retryFailedItems(ctx, blks, err)
+	}
+	m.observeQueueDepth()
+	m.observeFreeSpace()
+	if m.notFound != nil {
+		for _, blk := range blks {
+			m.invalidateMissing(blk.Cid())
+		}
+	}
 	if err != nil {
-		m.putManyErr.Inc()
+		m.countPutManyError(err)
+		m.countFailedItems(blks, err)
+		return m.putManyError(ctx, blks, err)
 	}
-	return err
+	if m.expiry != nil || m.readd != nil || m.raw != nil || m.putCounts != nil {
+		for _, blk := range blks {
+			m.clearExpiry(blk.Cid())
+			m.noteWritten(blk.Cid())
+			m.sampleWrite(blk.Cid())
+			m.countPut(blk.Cid())
+		}
+	}
+	m.observeCodecSizes(blks...)
+	m.checkPutMany(ctx, blks)
+	return nil
 }
 
 /*
 func (m *measure) Sync(prefix datastore.Key) error {
-	defer recordLatency(m.syncLatency, time.Now())
+	defer recordLatency(m.clock, m.syncLatency, m.clock.Now())
 	m.syncNum.Inc()
 	err := m.backend.Sync(prefix)
 	if err != nil {
@@ -169,47 +818,243 @@ func (m *measure) Sync(prefix datastore.Key) error {
 }
 */
 
-func (m *measure) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
-	defer recordLatency(m.getLatency, time.Now())
+func (m *measure) Get(ctx context.Context, c cid.Cid) (value blocks.Block, err error) {
+	if m.bypass() {
+		return m.backend.Get(ctx, c)
+	}
+	if isIdentity(c) {
+		return m.getIdentity(ctx, c)
+	}
+	if err = m.enter(OpGet); err != nil {
+		return nil, err
+	}
+	defer m.exitOp()
+	ctx, overhead := m.startOverhead(ctx)
+	defer m.finishOverhead(overhead)
+	ctx, unbind := m.bindClose(ctx)
+	defer unbind(&err)
+	defer m.exitHot(m.enterHot(c))
+	ev := m.startEvent(ctx, "get", c, 0)
+	defer m.finishEvent(ev, &err)
+	defer m.recordOutcome(OpGet, c, &err)
+	defer m.observeHeadroom(ctx, OpGet)
+	start := m.clock.Now()
+	var size int
+	defer m.recordOpLatency(ctx, OpGet, m.readLatency(false), start, &size, &err)
+	defer m.observeReadSequence(ctx, OpGet, c, start)
+	defer m.recoverPanic(OpGet, m.getErr, c, &err)
 	m.getNum.Inc()
-	value, err := m.backend.Get(ctx, c)
+	m.countTag(ctx, OpGet)
+	m.countOrigin(ctx, OpGet)
+	m.observeDistinct(c)
+	m.observeViewRatio()
+	m.refreshP99Drift()
+	m.countReadPath(false)
+	m.observeDeadline(ctx, OpGet)
+	if m.expired(ctx, c) {
+		return nil, format.ErrNotFound{Cid: c}
+	}
+	if blk, ok := m.pendingWrite(c); ok {
+		return blk, nil
+	}
+	if m.knownMissing(c) {
+		return nil, format.ErrNotFound{Cid: c}
+	}
+	if m.bloomMiss(c) {
+		return nil, format.ErrNotFound{Cid: c}
+	}
+	epoch := m.missEpoch()
+	done := m.sampleAlloc(OpGet, 1)
+	value, err = m.readBlock(ctx, c, start)
+	done()
+	if format.IsNotFound(err) {
+		m.noteMissing(c, epoch)
+		m.bloomFalsePositive(c)
+		m.observeReadAfterWrite(c, false)
+	} else if err == nil {
+		m.observeReadAfterWrite(c, true)
+	}
 	switch err {
 	case nil:
-		m.getSize.Observe(float64(len(value.RawData())))
+		size = len(value.RawData())
+		m.getSize.Observe(float64(m.blockSize(value)))
+		ev.setBytes(m.blockSize(value))
+		m.observeAge(ctx, c)
+		m.checkStale(value)
 	case datastore.ErrNotFound:
 		// Not really an error.
 	default:
-		m.getErr.Inc()
+		m.countError(OpGet, m.getErr, c, err)
 	}
 	return value, err
 }
 
-func (m *measure) Has(ctx context.Context, c cid.Cid) (bool, error) {
-	defer recordLatency(m.hasLatency, time.Now())
+func (m *measure) Has(ctx context.Context, c cid.Cid) (exists bool, err error) {
+	if m.bypass() {
+		return m.backend.Has(ctx, c)
+	}
+	if err = m.enter(OpHas); err != nil {
+		return false, err
+	}
+	defer m.exitOp()
+	ctx, overhead := m.startOverhead(ctx)
+	defer m.finishOverhead(overhead)
+	ctx, unbind := m.bindClose(ctx)
+	defer unbind(&err)
+	ev := m.startEvent(ctx, "has", c, 0)
+	defer m.finishEvent(ev, &err)
+	defer m.recordOutcome(OpHas, c, &err)
+	defer m.observeHeadroom(ctx, OpHas)
+	start := m.clock.Now()
+	defer m.recordOpLatency(ctx, OpHas, m.hasLatency, start, nil, &err)
+	defer m.observeReadSequence(ctx, OpHas, c, start)
+	defer m.recordHasLatency(start, &exists, &err)
+	defer m.recoverPanic(OpHas, m.hasErr, c, &err)
 	m.hasNum.Inc()
-	exists, err := m.backend.Has(ctx, c)
+	m.countTag(ctx, OpHas)
+	m.countOrigin(ctx, OpHas)
+	m.observeDeadline(ctx, OpHas)
+	if m.expired(ctx, c) {
+		return false, nil
+	}
+	if _, ok := m.pendingWrite(c); ok {
+		return true, nil
+	}
+	if m.knownMissing(c) {
+		return false, nil
+	}
+	if m.bloomMiss(c) {
+		return false, nil
+	}
+	epoch := m.missEpoch()
+	exists, err = m.backend.Has(ctx, c)
+	m.checkHas(c, exists, err)
 	if err != nil {
-		m.hasErr.Inc()
+		m.countError(OpHas, m.hasErr, c, err)
+	} else {
+		m.observeReadAfterWrite(c, exists)
+		if !exists {
+			m.noteMissing(c, epoch)
+			m.bloomFalsePositive(c)
+		}
 	}
 	return exists, err
 }
 
+// recordHasLatency records the latency of a Has call that returned *exists
+// and *err by outcome. It is meant to be deferred.
+func (m *measure) recordHasLatency(start time.Time, exists *bool, err *error) {
+	switch {
+	case *err != nil:
+	case *exists:
+		recordLatency(m.clock, m.hasFoundLatency, start)
+	default:
+		recordLatency(m.clock, m.hasMissingLatency, start)
+	}
+}
+
 func (m *measure) GetSize(ctx context.Context, c cid.Cid) (size int, err error) {
-	defer recordLatency(m.getsizeLatency, time.Now())
+	if m.bypass() {
+		return m.backend.GetSize(ctx, c)
+	}
+	if err = m.enter(OpGetSize); err != nil {
+		return -1, err
+	}
+	defer m.exitOp()
+	ctx, overhead := m.startOverhead(ctx)
+	defer m.finishOverhead(overhead)
+	ctx, unbind := m.bindClose(ctx)
+	defer unbind(&err)
+	ev := m.startEvent(ctx, "getsize", c, 0)
+	defer m.finishEvent(ev, &err)
+	defer m.recordOutcome(OpGetSize, c, &err)
+	defer m.observeHeadroom(ctx, OpGetSize)
+	defer m.recordOpLatency(ctx, OpGetSize, m.getsizeLatency, m.clock.Now(), &size, &err)
+	defer m.recoverPanic(OpGetSize, m.getsizeErr, c, &err)
 	m.getsizeNum.Inc()
+	m.countTag(ctx, OpGetSize)
+	m.countOrigin(ctx, OpGetSize)
+	m.observeDeadline(ctx, OpGetSize)
+	if m.expired(ctx, c) {
+		return -1, format.ErrNotFound{Cid: c}
+	}
+	if blk, ok := m.pendingWrite(c); ok {
+		return len(blk.RawData()), nil
+	}
+	if m.knownMissing(c) {
+		return -1, format.ErrNotFound{Cid: c}
+	}
+	epoch := m.missEpoch()
 	size, err = m.backend.GetSize(ctx, c)
+	m.checkGetSize(c, size, err)
+	if format.IsNotFound(err) {
+		m.noteMissing(c, epoch)
+	}
 	if err != nil && !format.IsNotFound(err) {
-		m.getsizeErr.Inc()
+		m.countError(OpGetSize, m.getsizeErr, c, err)
+	}
+	if err == nil {
+		ev.setBytes(size)
+		m.checkSize(ctx, c, size)
 	}
 	return size, err
 }
 
 func (m *measure) DeleteBlock(ctx context.Context, c cid.Cid) error {
-	defer recordLatency(m.deleteLatency, time.Now())
+	if m.readOnly {
+		return m.rejectReadOnly(OpDelete)
+	}
+	if m.bypassDeletes() {
+		return m.deleteDirect(ctx, c)
+	}
+	return m.deleteBlock(ctx, c, 0)
+}
+
+// deleteBlock is DeleteBlock, auditing the deletion as part of batch.
+func (m *measure) deleteBlock(ctx context.Context, c cid.Cid, batch uint64) (err error) {
+	if err = m.enter(OpDelete); err != nil {
+		return err
+	}
+	defer m.exitOp()
+	ctx, overhead := m.startOverhead(ctx)
+	defer m.finishOverhead(overhead)
+	ctx, unbind := m.bindClose(ctx)
+	defer unbind(&err)
+	if m.dryRunDeletes() {
+		return m.dryRunDelete(ctx, c)
+	}
+	ev := m.startEvent(ctx, "delete", c, 0)
+	defer m.finishEvent(ev, &err)
+	defer m.recordOutcome(OpDelete, c, &err)
+	defer m.observeHeadroom(ctx, OpDelete)
+	defer m.recordOpLatency(ctx, OpDelete, m.deleteLatency, m.clock.Now(), nil, &err)
+	defer m.recoverPanic(OpDelete, m.deleteErr, c, &err)
 	m.deleteNum.Inc()
-	err := m.backend.DeleteBlock(ctx, c)
+	m.countTag(ctx, OpDelete)
+	m.countOrigin(ctx, OpDelete)
+	if err = m.fenced(OpDelete); err != nil {
+		m.countError(OpDelete, m.deleteErr, c, err)
+		return err
+	}
+	size := m.cachedSize(c)
+	created := m.deletedCreatedAt(ctx, c)
+	m.forgetPendingWrites(c)
+	start := m.clock.Now()
+	err = m.backend.DeleteBlock(ctx, c)
 	if err != nil {
-		m.deleteErr.Inc()
+		m.countError(OpDelete, m.deleteErr, c, err)
+		return err
+	}
+	m.deleteEfficiency.single(m.clock.Now().Sub(start))
+	m.observeDeleteAge(created)
+	m.observeTombstones()
+	m.clearExpiry(c)
+	m.noteDeleted(c)
+	m.uncache(c)
+	m.forgetPresent(c)
+	m.bloomDelete(c)
+	if err = m.auditDelete(c, size, batch); err != nil {
+		m.wrapperError(OpDelete)
 	}
 	return err
 }
@@ -218,65 +1063,191 @@ type batchDeleter interface {
 	DeleteMany(context.Context, []cid.Cid) error
 }
 
-func (m *measure) DeleteMany(ctx context.Context, cids []cid.Cid) error {
-	dm, ok := m.backend.(batchDeleter)
-	if !ok {
+func (m *measure) DeleteMany(ctx context.Context, cids []cid.Cid) (err error) {
+	if m.readOnly {
+		return m.rejectReadOnly(OpDeleteMany)
+	}
+	if m.bypassDeletes() {
+		return m.deleteManyDirect(ctx, cids)
+	}
+	if m.oversized(len(cids)) {
+		return m.splitDeleteMany(ctx, cids)
+	}
+	if m.dryRunDeletes() {
+		if err = m.enter(OpDeleteMany); err != nil {
+			return err
+		}
+		defer m.exitOp()
+		return m.dryRunDelete(ctx, cids...)
+	}
+	var batch uint64
+	if m.audit != nil {
+		batch = m.audit.nextBatch()
+	}
+	dm := m.deleter
+	if dm == nil {
 		for _, c := range cids {
-			if err := m.DeleteBlock(ctx, c); err != nil {
+			if err := m.deleteBlock(ctx, c, batch); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
 
-	defer recordLatency(m.deleteManyLatency, time.Now())
+	if err = m.enter(OpDeleteMany); err != nil {
+		return err
+	}
+	defer m.exitOp()
+	ctx, overhead := m.startOverhead(ctx)
+	defer m.finishOverhead(overhead)
+	ctx, unbind := m.bindClose(ctx)
+	defer unbind(&err)
+	ev := m.startEvent(ctx, "deletemany", cid.Undef, len(cids))
+	if ev != nil {
+		ev.Cids = cids
+	}
+	defer m.finishEvent(ev, &err)
+	defer m.recordOutcome(OpDeleteMany, cid.Undef, &err)
+	defer m.observeHeadroom(ctx, OpDeleteMany)
+	defer m.recordOpLatency(ctx, OpDeleteMany, m.deleteManyLatency, m.clock.Now(), nil, &err)
+	defer m.recoverPanic(OpDeleteMany, m.deleteManyErr, cid.Undef, &err)
 	m.deleteManyNum.Inc()
+	m.countTag(ctx, OpDeleteMany)
+	m.countOrigin(ctx, OpDeleteMany)
+	if err = m.fenced(OpDeleteMany); err != nil {
+		m.countError(OpDeleteMany, m.deleteManyErr, cid.Undef, err)
+		return err
+	}
 	m.deleteManySize.Observe(float64(len(cids)))
-	err := dm.DeleteMany(ctx, cids)
+	var sizes []int
+	if m.audit != nil {
+		sizes = make([]int, len(cids))
+		for i, c := range cids {
+			sizes[i] = m.cachedSize(c)
+		}
+	}
+	var created []time.Time
+	if m.deleteAge != nil {
+		created = make([]time.Time, len(cids))
+		for i, c := range cids {
+			created[i] = m.createdAt(ctx, c)
+		}
+	}
+	m.forgetPendingWrites(cids...)
+	start := m.clock.Now()
+	err = dm.DeleteMany(ctx, cids)
 	if err != nil {
-		m.deleteManyErr.Inc()
+		m.countError(OpDeleteMany, m.deleteManyErr, cid.Undef, err)
+		return err
 	}
-	return err
-}
-
-func (m *measure) Close() error {
-	if c, ok := m.backend.(io.Closer); ok {
-		return c.Close()
+	m.deleteEfficiency.batch(len(cids), m.clock.Now().Sub(start))
+	m.observeTombstones()
+	for _, t := range created {
+		m.observeDeleteAge(t)
 	}
-	return nil
+	if m.expiry != nil || m.readd != nil || m.cache != nil || m.audit != nil || m.invariants != nil || m.bloom != nil {
+		for i, c := range cids {
+			m.clearExpiry(c)
+			m.noteDeleted(c)
+			m.uncache(c)
+			m.forgetPresent(c)
+			m.bloomDelete(c)
+			if m.audit != nil {
+				if aerr := m.auditDelete(c, sizes[i], batch); aerr != nil && err == nil {
+					m.wrapperError(OpDeleteMany)
+					err = aerr
+				}
+			}
+		}
+	}
+	return err
 }
 
 type bsViewer interface {
 	View(ctx context.Context, c cid.Cid, f func([]byte) error) error
 }
 
-func (m *measure) View(ctx context.Context, c cid.Cid, f func([]byte) error) error {
-	v, ok := m.backend.(bsViewer)
-	if !ok {
+func (m *measure) View(ctx context.Context, c cid.Cid, f func([]byte) error) (err error) {
+	if m.bypass() {
+		return m.viewDirect(ctx, c, f)
+	}
+	if isIdentity(c) {
+		return m.viewIdentity(ctx, c, f)
+	}
+	v := m.viewer
+	if v == nil {
 		blk, err := m.Get(ctx, c)
 		if err != nil {
 			return err
 		}
+		m.countViewFallback(len(blk.RawData()))
 		return f(blk.RawData())
 	}
 
-	defer recordLatency(m.viewLatency, time.Now())
+	if err = m.enter(OpView); err != nil {
+		return err
+	}
+	defer m.exitOp()
+	ctx, unbind := m.bindClose(ctx)
+	defer unbind(&err)
+	defer m.exitHot(m.enterHot(c))
+	ev := m.startEvent(ctx, "view", c, 0)
+	defer m.finishEvent(ev, &err)
+	defer m.recordOutcome(OpView, c, &err)
+	defer m.observeHeadroom(ctx, OpView)
+	start := m.clock.Now()
+	var size int
+	defer m.recordOpLatency(ctx, OpView, m.readLatency(true), start, &size, &err)
+	defer m.recoverPanic(OpView, m.viewErr, c, &err)
 	m.viewNum.Inc()
-	err := v.View(ctx, c, f)
+	m.countTag(ctx, OpView)
+	m.countOrigin(ctx, OpView)
+	m.observeDistinct(c)
+	m.observeViewRatio()
+	m.countReadPath(true)
+	m.observeDeadline(ctx, OpView)
+	if m.expired(ctx, c) {
+		return format.ErrNotFound{Cid: c}
+	}
+	inner := f
+	f = func(data []byte) error {
+		size = len(data)
+		ev.setBytes(size)
+		return inner(data)
+	}
+	if blk, ok := m.pendingWrite(c); ok {
+		return f(blk.RawData())
+	}
+	if m.knownMissing(c) {
+		return format.ErrNotFound{Cid: c}
+	}
+	epoch := m.missEpoch()
+	done := m.sampleAlloc(OpView, 1)
+	err = m.viewBlock(ctx, v, c, f, start)
+	done()
+	if format.IsNotFound(err) {
+		m.noteMissing(c, epoch)
+	}
 	switch err {
 	case nil, datastore.ErrNotFound:
 		// Not really an error.
 	default:
-		m.viewErr.Inc()
+		m.countError(OpView, m.viewErr, c, err)
 	}
 	return err
 
 }
 
+// AllKeysChan enumerates the keys of the backend. The time until the
+// first key is delivered is recorded in
+// allkeys.first_key.latency_seconds, which shows backends that list
+// everything before delivering anything; enumerations of an empty store
+// aren't recorded.
 func (m *measure) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
-	return m.backend.AllKeysChan(ctx)
-}
-
-func (m *measure) HashOnRead(hor bool) {
-	m.backend.HashOnRead(hor)
+	start := m.clock.Now()
+	keys, err := m.backend.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.proxyKeys(ctx, keys, start), nil
 }
@@ -0,0 +1,239 @@
+package measure
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+// mkBlocks returns n distinct blocks.
+func mkBlocks(n int) []blocks.Block {
+	blks := make([]blocks.Block, n)
+	for i := range blks {
+		blks[i] = blocks.NewBlock([]byte(fmt.Sprint("block ", i)))
+	}
+	return blks
+}
+
+// fakeClock is a Clock moved by hand.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func statCounter(m *measure, name string) float64 {
+	return m.reg.snapshot().Counters[name]
+}
+
+func statGauge(m *measure, name string) float64 {
+	return m.reg.snapshot().Gauges[name]
+}
+
+func statCount(m *measure, name string) uint64 {
+	return m.reg.snapshot().Histograms[name].Count
+}
+
+func TestPutGetCounts(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	m := New("test", fb)
+	blks := mkBlocks(3)
+
+	if err := m.Put(ctx, blks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.PutMany(ctx, blks[1:]); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range blks {
+		got, err := m.Get(ctx, b.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Cid().Equals(b.Cid()) {
+			t.Fatalf("got %s, want %s", got.Cid(), b.Cid())
+		}
+	}
+	if _, err := m.Get(ctx, mkBlocks(4)[3].Cid()); !format.IsNotFound(err) {
+		t.Fatalf("got %v, want not found", err)
+	}
+
+	for name, want := range map[string]float64{
+		"put_total":     1,
+		"putmany_total": 1,
+		"get_total":     4,
+	} {
+		if got := statCounter(m, name); got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	if got := statCount(m, "put.size_bytes"); got != 1 {
+		t.Errorf("put.size_bytes count = %d, want 1", got)
+	}
+	if fb.Count(testutil.Get) != 4 {
+		t.Errorf("backend saw %d Gets, want 4", fb.Count(testutil.Get))
+	}
+}
+
+func TestErrorsCounted(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	fb.FailCall(testutil.Put, 2, nil)
+	m := New("test", fb)
+	blks := mkBlocks(2)
+
+	if err := m.Put(ctx, blks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Put(ctx, blks[1]); err != testutil.ErrScheduled {
+		t.Fatalf("got %v, want the scheduled failure", err)
+	}
+	if got := statCounter(m, "put.errors_total"); got != 1 {
+		t.Fatalf("put.errors_total = %v, want 1", got)
+	}
+	if fb.Len() != 1 {
+		t.Fatalf("backend holds %d blocks, want 1", fb.Len())
+	}
+}
+
+// TestOptionalInterfaces runs View and DeleteMany against backends with
+// and without them, checking the wrapper uses them when available and
+// falls back to Get and DeleteBlock otherwise.
+func TestOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name                  string
+		backend               func(*testutil.Blockstore) blockstore.Blockstore
+		view, deleteMany      bool
+		wantGets, wantDeletes int
+	}{
+		{"native", func(b *testutil.Blockstore) blockstore.Blockstore { return b }, true, true, 0, 0},
+		{"without view", func(b *testutil.Blockstore) blockstore.Blockstore { return b.WithoutView() }, false, true, 1, 0},
+		{"without deletemany", func(b *testutil.Blockstore) blockstore.Blockstore { return b.WithoutDeleteMany() }, true, false, 0, 2},
+		{"plain", func(b *testutil.Blockstore) blockstore.Blockstore { return b.Plain() }, false, false, 1, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fb := testutil.New()
+			blks := mkBlocks(2)
+			for _, b := range blks {
+				fb.Put(ctx, b)
+			}
+			m := New("test", tc.backend(fb))
+
+			var data []byte
+			err := m.View(ctx, blks[0].Cid(), func(b []byte) error {
+				data = append([]byte(nil), b...)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != string(blks[0].RawData()) {
+				t.Fatalf("viewed %q, want %q", data, blks[0].RawData())
+			}
+			if err := m.DeleteMany(ctx, []cid.Cid{blks[0].Cid(), blks[1].Cid()}); err != nil {
+				t.Fatal(err)
+			}
+			if fb.Len() != 0 {
+				t.Fatalf("backend still holds %d blocks", fb.Len())
+			}
+
+			if got := fb.Count(testutil.View); (got == 1) != tc.view {
+				t.Errorf("backend saw %d Views", got)
+			}
+			if got := fb.Count(testutil.DeleteMany); (got == 1) != tc.deleteMany {
+				t.Errorf("backend saw %d DeleteManys", got)
+			}
+			if got := fb.Count(testutil.Get); got != tc.wantGets {
+				t.Errorf("backend saw %d Gets, want %d", got, tc.wantGets)
+			}
+			if got := fb.Count(testutil.DeleteBlock); got != tc.wantDeletes {
+				t.Errorf("backend saw %d DeleteBlocks, want %d", got, tc.wantDeletes)
+			}
+			// Without View, the wrapper reads through Get and counts it
+			// as such.
+			if got := statCounter(m, "view_total") + statCounter(m, "get_total"); got != 1 {
+				t.Errorf("view_total + get_total = %v, want 1", got)
+			}
+		})
+	}
+}
+
+func TestHasOutcomeLatency(t *testing.T) {
+	ctx := context.Background()
+	bs := &flakyBS{Blockstore: testutil.New()}
+	m := New("ho", bs)
+	b := blocks.NewBlock([]byte("x"))
+	m.Has(ctx, b.Cid())
+	m.Put(ctx, b)
+	m.Has(ctx, b.Cid())
+	m.Has(ctx, b.Cid())
+	bs.fail = true
+	m.Has(ctx, b.Cid())
+	st := m.Stats().Histograms
+	if st["has.found.latency_seconds"].Count != 2 || st["has.missing.latency_seconds"].Count != 1 {
+		t.Fatal(st["has.found.latency_seconds"], st["has.missing.latency_seconds"])
+	}
+}
+
+// BenchmarkOptionalInterfaces measures View and DeleteMany through
+// backends with and without native support.
+func BenchmarkOptionalInterfaces(b *testing.B) {
+	ctx := context.Background()
+	blk := mkBlocks(1)[0]
+	for _, bc := range []struct {
+		name    string
+		backend func(*testutil.Blockstore) blockstore.Blockstore
+	}{
+		{"native", func(fb *testutil.Blockstore) blockstore.Blockstore { return fb }},
+		{"plain", func(fb *testutil.Blockstore) blockstore.Blockstore { return fb.Plain() }},
+	} {
+		b.Run(bc.name+"/view", func(b *testing.B) {
+			fb := testutil.New()
+			fb.Put(ctx, blk)
+			m := New("bench", bc.backend(fb))
+			cb := func([]byte) error { return nil }
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := m.View(ctx, blk.Cid(), cb); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(bc.name+"/deletemany", func(b *testing.B) {
+			m := New("bench", bc.backend(testutil.New()))
+			keys := []cid.Cid{blk.Cid()}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := m.DeleteMany(ctx, keys); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
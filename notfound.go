@@ -0,0 +1,89 @@
+package measure
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithNotFoundCache remembers up to size CIDs the backend reported
+// missing from Has, Get, GetSize or View, and answers further lookups of
+// them as not found without asking the backend for ttl. Such answers are
+// counted in notfound_cache.hits_total. Put and PutMany drop the blocks
+// they write from the cache, so a block is visible to every lookup
+// started after its write returned.
+//
+// A miss is only cached if no write completed while the backend was
+// being asked, since that write may have been for the block looked up.
+// Stores with a high write rate will therefore cache fewer misses.
+func WithNotFoundCache(size int, ttl time.Duration) Option {
+	return func(cfg *config) {
+		cfg.notFoundSize = size
+		cfg.notFoundTTL = ttl
+	}
+}
+
+type notFoundCache struct {
+	hits metrics.Counter
+
+	mu sync.Mutex
+	// epoch is incremented by every invalidation.
+	epoch   uint64
+	missing *cidLRU
+}
+
+func newNotFoundCache(r *registry, size int, ttl time.Duration) *notFoundCache {
+	return &notFoundCache{
+		hits:    r.counter("notfound_cache.hits_total", "Number of lookups answered from the not-found cache"),
+		missing: newCidLRU(size, ttl),
+	}
+}
+
+// knownMissing reports whether c is cached as missing.
+func (m *measure) knownMissing(c cid.Cid) bool {
+	if m.notFound == nil {
+		return false
+	}
+	if !m.notFound.missing.contains(c, m.clock.Now()) {
+		return false
+	}
+	m.notFound.hits.Inc()
+	return true
+}
+
+// missEpoch is taken before asking the backend for a block, and handed
+// back to noteMissing if it wasn't found.
+func (m *measure) missEpoch() uint64 {
+	if m.notFound == nil {
+		return 0
+	}
+	m.notFound.mu.Lock()
+	defer m.notFound.mu.Unlock()
+	return m.notFound.epoch
+}
+
+// noteMissing caches c as missing unless a write completed since epoch
+// was taken.
+func (m *measure) noteMissing(c cid.Cid, epoch uint64) {
+	if m.notFound == nil {
+		return
+	}
+	m.notFound.mu.Lock()
+	defer m.notFound.mu.Unlock()
+	if m.notFound.epoch == epoch {
+		m.notFound.missing.add(c, m.clock.Now())
+	}
+}
+
+// invalidateMissing drops c from the cache once it has been written.
+func (m *measure) invalidateMissing(c cid.Cid) {
+	if m.notFound == nil {
+		return
+	}
+	m.notFound.mu.Lock()
+	defer m.notFound.mu.Unlock()
+	m.notFound.epoch++
+	m.notFound.missing.remove(c)
+}
@@ -0,0 +1,53 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+// racyBS lets a Put land between the backend miss and the wrapper caching it.
+type racyBS struct {
+	*testutil.Blockstore
+	onMiss func()
+}
+
+func (r *racyBS) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	ok, err := r.Blockstore.Has(ctx, c)
+	if !ok && r.onMiss != nil {
+		f := r.onMiss
+		r.onMiss = nil
+		f()
+	}
+	return ok, err
+}
+
+func TestNotFoundCache(t *testing.T) {
+	ctx := context.Background()
+	mem := testutil.New()
+	rb := &racyBS{Blockstore: mem}
+	m := New("nf", rb, WithNotFoundCache(10, time.Minute))
+	a := blocks.NewBlock([]byte("a"))
+	m.Has(ctx, a.Cid())
+	m.Has(ctx, a.Cid())
+	if mem.Count(testutil.Has) != 1 || m.Stats().Counters["notfound_cache.hits_total"] != 1 {
+		t.Fatal(mem.Calls())
+	}
+	m.Put(ctx, a)
+	if ok, _ := m.Has(ctx, a.Cid()); !ok {
+		t.Fatal("stale after put")
+	}
+	b := blocks.NewBlock([]byte("b"))
+	rb.onMiss = func() { m.Put(ctx, b) }
+	if ok, _ := m.Has(ctx, b.Cid()); ok {
+		t.Fatal("expected miss")
+	}
+	if ok, _ := m.Has(ctx, b.Cid()); !ok {
+		t.Fatal("miss cached across concurrent put")
+	}
+}
@@ -0,0 +1,224 @@
+package measure
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// opLogHeader is the first line of an operation log, naming its version.
+const opLogHeader = "bs-measure oplog v1"
+
+// WithOperationLog writes every operation to w, in the order they
+// complete, so that the sequence can be replayed against another
+// backend with ReplayOperationLog. Unlike WithJournal, records are
+// written synchronously and never dropped; failed writes are counted in
+// oplog.write_errors_total. w is closed on Close if it implements
+// io.Closer.
+//
+// The log is text: a header line, then one line per operation made of
+// the operation name, its result ("ok" or the error class as in
+// JournalRecord) and the CIDs it was about, each followed by a slash and
+// the size of the block when known:
+//
+//	bs-measure oplog v1
+//	put ok bafk.../1024
+//	get notfound bafk...
+//	deletemany ok bafk... bafk...
+func WithOperationLog(w io.Writer) Option {
+	return func(cfg *config) {
+		cfg.opLog = w
+	}
+}
+
+type opLog struct {
+	errors metrics.Counter
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newOpLog(w io.Writer, errors metrics.Counter) *opLog {
+	l := &opLog{w: w, errors: errors}
+	if _, err := io.WriteString(w, opLogHeader+"\n"); err != nil {
+		errors.Inc()
+	}
+	return l
+}
+
+// record is an event sink writing a line per operation.
+func (l *opLog) record(ev *opEvent) {
+	var sb strings.Builder
+	sb.WriteString(ev.Op)
+	sb.WriteByte(' ')
+	if class := errorClass(ev.Err); class != "" {
+		sb.WriteString(class)
+	} else {
+		sb.WriteString("ok")
+	}
+	item := func(c cid.Cid, size int) {
+		sb.WriteByte(' ')
+		sb.WriteString(c.String())
+		if size >= 0 {
+			sb.WriteByte('/')
+			sb.WriteString(strconv.Itoa(size))
+		}
+	}
+	switch {
+	case ev.Blocks != nil:
+		for _, blk := range ev.Blocks {
+			item(blk.Cid(), len(blk.RawData()))
+		}
+	case ev.Cids != nil:
+		for _, c := range ev.Cids {
+			item(c, -1)
+		}
+	case ev.Cid.Defined():
+		size := -1
+		if ev.Bytes > 0 || ev.Op == "put" {
+			size = ev.Bytes
+		}
+		item(ev.Cid, size)
+	}
+	sb.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.w == nil {
+		return
+	}
+	if _, err := io.WriteString(l.w, sb.String()); err != nil {
+		l.errors.Inc()
+	}
+}
+
+func (l *opLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := l.w
+	l.w = nil
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// ReplayOperationLog executes the operations of a log written with
+// WithOperationLog against target. Successful writes are repeated with
+// blocks of the recorded sizes stored under the recorded CIDs, their
+// content being zeros, so that target ends up holding the same CIDs as
+// the logged backend did; failed writes are skipped. Reads are repeated
+// for their side effects and load, and only fail the replay with errors
+// other than not found.
+func ReplayOperationLog(r io.Reader, target blockstore.Blockstore) error {
+	ctx := context.Background()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 64<<20)
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("measure: empty operation log")
+	}
+	if sc.Text() != opLogHeader {
+		return fmt.Errorf("measure: unsupported operation log %q", sc.Text())
+	}
+	for line := 2; sc.Scan(); line++ {
+		if err := replayOp(ctx, sc.Text(), target); err != nil {
+			return fmt.Errorf("measure: operation log line %d: %w", line, err)
+		}
+	}
+	return sc.Err()
+}
+
+// opLogItem is a CID of an operation log line, with its size or -1.
+type opLogItem struct {
+	c    cid.Cid
+	size int
+}
+
+func replayOp(ctx context.Context, line string, bs blockstore.Blockstore) error {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return fmt.Errorf("malformed record %q", line)
+	}
+	op, result := fields[0], fields[1]
+	items := make([]opLogItem, 0, len(fields)-2)
+	for _, f := range fields[2:] {
+		it := opLogItem{size: -1}
+		s := f
+		if i := strings.IndexByte(f, '/'); i >= 0 {
+			n, err := strconv.Atoi(f[i+1:])
+			if err != nil {
+				return fmt.Errorf("malformed size in %q: %w", f, err)
+			}
+			s, it.size = f[:i], n
+		}
+		c, err := cid.Decode(s)
+		if err != nil {
+			return err
+		}
+		it.c = c
+		items = append(items, it)
+	}
+
+	switch op {
+	case "put", "putmany":
+		if result != "ok" {
+			return nil
+		}
+		blks := make([]blocks.Block, 0, len(items))
+		for _, it := range items {
+			size := it.size
+			if size < 0 {
+				size = 0
+			}
+			blk, err := blocks.NewBlockWithCid(make([]byte, size), it.c)
+			if err != nil {
+				return err
+			}
+			blks = append(blks, blk)
+		}
+		if op == "put" && len(blks) == 1 {
+			return bs.Put(ctx, blks[0])
+		}
+		return bs.PutMany(ctx, blks)
+	case "delete", "deletemany":
+		if result != "ok" {
+			return nil
+		}
+		for _, it := range items {
+			if err := bs.DeleteBlock(ctx, it.c); err != nil && !format.IsNotFound(err) {
+				return err
+			}
+		}
+		return nil
+	case "get", "view", "has", "getsize":
+		for _, it := range items {
+			var err error
+			switch op {
+			case "get", "view":
+				_, err = bs.Get(ctx, it.c)
+			case "has":
+				_, err = bs.Has(ctx, it.c)
+			case "getsize":
+				_, err = bs.GetSize(ctx, it.c)
+			}
+			if err != nil && !format.IsNotFound(err) {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown operation %q", op)
+}
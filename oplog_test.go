@@ -0,0 +1,45 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestOperationLogReplay(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	m := New("ol", testutil.New(), WithOperationLog(&buf))
+	blks := mkBlocks(4)
+	m.Put(ctx, blks[0])
+	m.PutMany(ctx, blks[1:])
+	m.Get(ctx, blks[0].Cid())
+	m.DeleteBlock(ctx, blks[1].Cid())
+	m.DeleteMany(ctx, []cid.Cid{blks[2].Cid()})
+	m.Has(ctx, blks[1].Cid())
+	if !strings.HasPrefix(buf.String(), opLogHeader+"\n") {
+		t.Fatal(buf.String())
+	}
+	target := testutil.New()
+	if err := ReplayOperationLog(strings.NewReader(buf.String()), target); err != nil {
+		t.Fatal(err, buf.String())
+	}
+	for i, want := range []bool{true, false, false, true} {
+		has, _ := target.Has(ctx, blks[i].Cid())
+		if has != want {
+			t.Fatal(i, has, buf.String())
+		}
+	}
+	size, _ := target.GetSize(ctx, blks[3].Cid())
+	if size != len(blks[3].RawData()) {
+		t.Fatal(size)
+	}
+	if err := ReplayOperationLog(strings.NewReader("bs-measure oplog v9\n"), target); err == nil {
+		t.Fatal("expected version error")
+	}
+}
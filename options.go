@@ -0,0 +1,246 @@
+package measure
+
+import (
+	"context"
+	"io"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+// Option configures optional behaviour of a measure wrapper.
+type Option func(*config)
+
+type config struct {
+	clock Clock
+	// cidFormat renders CIDs in journal records and logs.
+	cidFormat func(cid.Cid) string
+	// push reports metrics to recorder, or go-metrics-interface if
+	// that is nil.
+	push     bool
+	recorder Recorder
+
+	latencyUnit     LatencyUnit
+	adaptiveBuckets bool
+
+	expiryMax    int
+	expiryDelete bool
+
+	journal io.Writer
+
+	coalesceMaxBatch int
+	coalesceMaxDelay time.Duration
+
+	sizeCheckRate float64
+	sizeCheckLogf func(format string, args ...interface{})
+
+	writeBehind *WriteBehindConfig
+
+	singleflight bool
+
+	readdSize   int
+	readdWindow time.Duration
+
+	notFoundSize int
+	notFoundTTL  time.Duration
+
+	readCacheBytes int64
+
+	blockAge bool
+
+	dryRunDeletes bool
+	dryRunLog     io.Writer
+
+	deleteAudit *deleteAuditConfig
+
+	deadlineTracking bool
+
+	tagExtract func(context.Context) string
+	maxTags    int
+
+	persistStore    counterStore
+	persistInterval time.Duration
+
+	invariants   bool
+	invariantLog func(format string, args ...interface{})
+
+	errorHistory *errorHistoryConfig
+
+	errorLogging *errorLoggingConfig
+
+	maxBatchSize    int
+	rejectOversized bool
+
+	rawRate float64
+	rawSize int
+
+	panicRecovery bool
+
+	hotSize, hotTop int
+
+	keyScanRate int
+	dedupKeys   bool
+	// allKeysMaxTracked bounds the keys remembered by an enumeration.
+	allKeysMaxTracked int
+
+	compression *compressionConfig
+
+	fencingToken func() int64
+
+	errorLatencySplit bool
+
+	stackDepthThreshold time.Duration
+	stackDepthRate      float64
+
+	bloomKeys   int
+	bloomFPRate float64
+
+	warmupOps int
+
+	drainTimeout time.Duration
+
+	putExistenceCheck    bool
+	compareOverwriteSize bool
+
+	batchErrors       bool
+	partialWriteProbe int
+
+	traceID func(context.Context) string
+
+	interceptors []Interceptor
+
+	spanExporter  SpanExporter
+	spanThreshold time.Duration
+
+	latencyMinSize int
+
+	labels map[string]string
+
+	allocRate float64
+
+	legacyBatchSizeName bool
+
+	latencySums bool
+
+	sizeEstimator func(blocks.Block) int
+
+	reentrancy    bool
+	reentrancyLog func(format string, args ...interface{})
+
+	latencyCeiling time.Duration
+
+	readOnly bool
+
+	distinctPrecision int
+
+	putConcurrency bool
+
+	putCountSize, putCountTop int
+
+	faults *FaultConfig
+
+	putManyCheckRate float64
+
+	traceLogRate int
+	traceLogger  func(map[string]interface{})
+
+	freeSpace         bool
+	freeSpaceInterval time.Duration
+	freeSpaceLow      int64
+
+	sizeClassLatency bool
+
+	eventTraceSize int
+
+	identityShortCircuit bool
+
+	deleteAge bool
+
+	opLog io.Writer
+
+	sloTargets map[Op]time.Duration
+
+	overheadRate float64
+
+	staleReadSize int
+
+	sizeEntropy bool
+
+	concurrencyLatency bool
+
+	conflictRetries int
+
+	interKeyGaps bool
+
+	maxBlockSizeAlarm  int
+	rejectTooLarge     bool
+	blockSizeAlarmLogf func(format string, args ...interface{})
+
+	baselineFactor float64
+
+	codecSizes bool
+
+	reservoirSize int
+
+	failedItemRetries int
+
+	tombstones     bool
+	tombstoneRatio float64
+
+	hourlyLatency bool
+
+	readSequences int
+
+	latencyPerMB bool
+
+	isolated bool
+
+	interBatchTiming bool
+
+	p99DriftInterval time.Duration
+
+	ackOrdering bool
+}
+
+func defaultConfig() config {
+	return config{
+		clock:     systemClock{},
+		cidFormat: FullCid,
+		push:      true,
+		maxTags:   defaultMaxTags,
+
+		latencyCeiling: DefaultLatencyCeiling,
+	}
+}
+
+// Clock tells the wrapper what time it is. It can be replaced with
+// WithClock, mainly so that time dependent behaviour can be tested.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// WithClock replaces the wall clock used by the wrapper, including to
+// time operations for the latency histograms. The clock should be
+// monotonic: latencies it makes negative are counted in
+// latency.anomaly_total.
+func WithClock(c Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = c
+	}
+}
+
+// WithoutPushMetrics keeps metrics inside the wrapper instead of also
+// reporting them to go-metrics-interface, or to the Recorder set with
+// WithRecorder. They remain available through Stats and Snapshot, for
+// example to be exported by a pull-based collector such as the one in
+// the prom subpackage.
+func WithoutPushMetrics() Option {
+	return func(cfg *config) {
+		cfg.push = false
+	}
+}
@@ -0,0 +1,40 @@
+package measure
+
+import (
+	"context"
+)
+
+const (
+	// Origins of operations, see WithBackgroundContext.
+	foregroundOrigin = "foreground"
+	backgroundOrigin = "background"
+)
+
+type backgroundKey struct{}
+
+// WithBackgroundContext returns a context marking the operations made
+// with it as background work, such as garbage collection or compaction,
+// rather than serving users. Every operation is counted per origin in
+// origin.background.<op>_total or origin.foreground.<op>_total, so that
+// housekeeping load can be told apart from user load. Operations made
+// with unmarked contexts are foreground.
+func WithBackgroundContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+// IsBackground reports whether ctx was marked with
+// WithBackgroundContext.
+func IsBackground(ctx context.Context) bool {
+	bg, _ := ctx.Value(backgroundKey{}).(bool)
+	return bg
+}
+
+// countOrigin counts op under the origin of ctx.
+func (m *measure) countOrigin(ctx context.Context, op Op) {
+	origin := foregroundOrigin
+	if IsBackground(ctx) {
+		origin = backgroundOrigin
+	}
+	m.reg.counter("origin."+origin+"."+string(op)+"_total",
+		"Number of operations with the origin").Inc()
+}
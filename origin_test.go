@@ -0,0 +1,24 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestOrigin(t *testing.T) {
+	ctx := context.Background()
+	m := New("or", testutil.New())
+	b := blocks.NewBlock([]byte("o"))
+	m.Put(ctx, b)
+	m.Get(WithBackgroundContext(ctx), b.Cid())
+	m.Get(ctx, b.Cid())
+	m.Get(ctx, b.Cid())
+	c := m.Stats().Counters
+	if c["origin.background.get_total"] != 1 || c["origin.foreground.get_total"] != 2 || c["origin.foreground.put_total"] != 1 {
+		t.Fatal(c)
+	}
+}
@@ -0,0 +1,120 @@
+package measure
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// overheadBuckets are the upper bounds in seconds of
+// wrapper.overhead_seconds, from 100ns to 10ms.
+var overheadBuckets = []float64{1e-7, 2.5e-7, 5e-7, 1e-6, 2.5e-6, 5e-6, 1e-5, 2.5e-5, 5e-5, 1e-4, 2.5e-4, 5e-4, 1e-3, 1e-2}
+
+// WithOverheadSampling measures, for a sampled fraction (0 to 1) of the
+// Put, PutMany, Get, Has, GetSize, DeleteBlock and DeleteMany calls, the
+// time spent in the wrapper itself, that is the duration of the call
+// minus that of the backend calls it made, in wrapper.overhead_seconds.
+// Interceptors added with WithInterceptor count as wrapper, as does the
+// time Puts wait with WithWriteCoalescing. View isn't sampled since the
+// backend runs the caller's callback. Calls not sampled only pay for a
+// random draw.
+func WithOverheadSampling(sampleRate float64) Option {
+	return func(cfg *config) {
+		cfg.overheadRate = sampleRate
+	}
+}
+
+// overheadSample accumulates the time a sampled operation spent in the
+// backend.
+type overheadSample struct {
+	start   time.Time
+	backend int64 // nanoseconds, updated atomically
+}
+
+type overheadKey struct{}
+
+// startOverhead returns ctx carrying a new sample if the operation is
+// sampled, to be passed to finishOverhead when it is done.
+func (m *measure) startOverhead(ctx context.Context) (context.Context, *overheadSample) {
+	if m.overheadRate <= 0 || rand.Float64() >= m.overheadRate {
+		return ctx, nil
+	}
+	s := &overheadSample{start: time.Now()}
+	return context.WithValue(ctx, overheadKey{}, s), s
+}
+
+// finishOverhead records the overhead of the operation sampled in s, if
+// any. It is meant to be deferred.
+func (m *measure) finishOverhead(s *overheadSample) {
+	if s == nil {
+		return
+	}
+	d := time.Since(s.start) - time.Duration(atomic.LoadInt64(&s.backend))
+	if d < 0 {
+		d = 0
+	}
+	m.overhead.Observe(d.Seconds())
+}
+
+// overheadTimer is the interceptor after those of WithInterceptor when
+// overhead is sampled, adding the time spent in the backend to the
+// sample of the operation.
+type overheadTimer struct{}
+
+// time starts timing a backend call made with ctx, returning the
+// function to call once it returned.
+func (overheadTimer) time(ctx context.Context) func() {
+	s, _ := ctx.Value(overheadKey{}).(*overheadSample)
+	if s == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		atomic.AddInt64(&s.backend, int64(time.Since(start)))
+	}
+}
+
+func (t overheadTimer) Put(ctx context.Context, blk blocks.Block, next PutFunc) error {
+	defer t.time(ctx)()
+	return next(ctx, blk)
+}
+
+func (t overheadTimer) PutMany(ctx context.Context, blks []blocks.Block, next PutManyFunc) error {
+	defer t.time(ctx)()
+	return next(ctx, blks)
+}
+
+func (t overheadTimer) Get(ctx context.Context, c cid.Cid, next GetFunc) (blocks.Block, error) {
+	defer t.time(ctx)()
+	return next(ctx, c)
+}
+
+func (t overheadTimer) Has(ctx context.Context, c cid.Cid, next HasFunc) (bool, error) {
+	defer t.time(ctx)()
+	return next(ctx, c)
+}
+
+func (t overheadTimer) GetSize(ctx context.Context, c cid.Cid, next GetSizeFunc) (int, error) {
+	defer t.time(ctx)()
+	return next(ctx, c)
+}
+
+func (t overheadTimer) DeleteBlock(ctx context.Context, c cid.Cid, next DeleteFunc) error {
+	defer t.time(ctx)()
+	return next(ctx, c)
+}
+
+func (t overheadTimer) DeleteMany(ctx context.Context, cids []cid.Cid, next DeleteManyFunc) error {
+	defer t.time(ctx)()
+	return next(ctx, cids)
+}
+
+func newOverheadHistogram(r *registry) metrics.Histogram {
+	return r.histogram("wrapper.overhead_seconds",
+		"Distribution of the time sampled calls spent in the wrapper rather than in the backend", overheadBuckets)
+}
@@ -0,0 +1,26 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestOverheadSampling(t *testing.T) {
+	ctx := context.Background()
+	m := New("ovh", testutil.New(), WithOverheadSampling(1))
+	for _, b := range mkBlocks(10) {
+		m.Put(ctx, b)
+		m.Get(ctx, b.Cid())
+	}
+	h := m.Stats().Histograms["wrapper.overhead_seconds"]
+	if h.Count != 20 || h.Sum/20 > 0.01 {
+		t.Fatal(h)
+	}
+	m2 := New("ovh2", testutil.New())
+	m2.Put(ctx, mkBlocks(1)[0])
+	if _, ok := m2.Stats().Histograms["wrapper.overhead_seconds"]; ok {
+		t.Fatal("overhead recorded without sampling")
+	}
+}
@@ -0,0 +1,41 @@
+package measure
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// ErrPanic is wrapped by the errors returned for operations whose backend
+// panicked, see WithPanicRecovery.
+var ErrPanic = errors.New("measure: backend panicked")
+
+// WithPanicRecovery recovers panics raised by the backend during an
+// operation and returns them as an error wrapping ErrPanic instead,
+// counting them in <op>.panic_total as well as the operation's errors.
+// Without it panics propagate to the caller, after the operation has
+// been accounted for. Panics in the background writes of write-behind
+// and write coalescing are not recovered.
+func WithPanicRecovery() Option {
+	return func(cfg *config) {
+		cfg.panicRecovery = true
+	}
+}
+
+// recoverPanic turns a panic in op, for c, into *err when panic recovery
+// is on. It must be deferred after every other deferred call of the
+// operation so that they see the error.
+func (m *measure) recoverPanic(op Op, errs metrics.Counter, c cid.Cid, err *error) {
+	if !m.panicRecovery {
+		return
+	}
+	p := recover()
+	if p == nil {
+		return
+	}
+	m.reg.counter(string(op)+".panic_total", "Number of backend panics recovered").Inc()
+	*err = fmt.Errorf("%w in %s: %v", ErrPanic, op, p)
+	m.countError(op, errs, c, *err)
+}
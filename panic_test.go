@@ -0,0 +1,35 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type panicBS struct{ *testutil.Blockstore }
+
+func (p panicBS) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) { panic("bad disk") }
+
+func TestPanicRecovery(t *testing.T) {
+	m := New("pr", panicBS{testutil.New()}, WithPanicRecovery(), WithReadSingleflight())
+	c := blocks.NewBlock([]byte("x")).Cid()
+	_, err := m.Get(context.Background(), c)
+	if !errors.Is(err, ErrPanic) {
+		t.Fatal(err)
+	}
+	st := m.Stats()
+	if st.Counters["get.panic_total"] != 1 || st.Counters["get.errors_total"] != 1 || st.Gauges["inflight"] != 0 {
+		t.Fatal(st.Counters, st.Gauges)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	New("pr2", panicBS{testutil.New()}).Get(context.Background(), c)
+}
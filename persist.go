@@ -0,0 +1,184 @@
+package measure
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithPersistentCounters keeps counter totals across restarts. Counters
+// are written as JSON to the file at path every interval and on Close,
+// and New resumes from the values found there. A missing or unreadable
+// file starts every counter from zero, counting the reset in
+// persist.resets_total. Gauges and histograms are not persisted. Failed
+// writes are counted in persist.errors_total.
+func WithPersistentCounters(path string, interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.persistStore = fileStore(path)
+		cfg.persistInterval = interval
+	}
+}
+
+// WithPersistence is WithPersistentCounters, keeping the counters under
+// key in ds instead of in a file.
+func WithPersistence(ds datastore.Datastore, key datastore.Key, interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.persistStore = dsStore{ds: ds, key: key}
+		cfg.persistInterval = interval
+	}
+}
+
+// counterStore holds the persisted counters. store must replace the
+// previous contents atomically.
+type counterStore interface {
+	load() ([]byte, error)
+	store(data []byte) error
+}
+
+type fileStore string
+
+func (f fileStore) load() ([]byte, error) {
+	return os.ReadFile(string(f))
+}
+
+func (f fileStore) store(data []byte) error {
+	return writeFileAtomic(string(f), data)
+}
+
+type dsStore struct {
+	ds  datastore.Datastore
+	key datastore.Key
+}
+
+func (s dsStore) load() ([]byte, error) {
+	return s.ds.Get(context.Background(), s.key)
+}
+
+func (s dsStore) store(data []byte) error {
+	return s.ds.Put(context.Background(), s.key, data)
+}
+
+// counterFileVersion is the version of the format written by save. Files
+// without a version predate it and have the same layout.
+const counterFileVersion = 1
+
+// counterFile is the format of the persisted counters.
+type counterFile struct {
+	Version  int                `json:"version"`
+	Counters map[string]float64 `json:"counters"`
+}
+
+// loadCounters reads the counters persisted in s. It returns nil and
+// false if there are none or they can't be read.
+func loadCounters(s counterStore) (map[string]float64, bool) {
+	data, err := s.load()
+	if err != nil {
+		return nil, false
+	}
+	var f counterFile
+	if err := json.Unmarshal(data, &f); err != nil || f.Version > counterFileVersion {
+		return nil, false
+	}
+	return f.Counters, true
+}
+
+type persister struct {
+	store  counterStore
+	reg    *registry
+	errors metrics.Counter
+
+	// mu serializes writes of the counters.
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newPersister saves the counters of r to s every interval. loaded tells
+// whether the counters of r were resumed from s.
+func newPersister(r *registry, s counterStore, interval time.Duration, loaded bool) *persister {
+	p := &persister{
+		store:  s,
+		reg:    r,
+		errors: r.counter("persist.errors_total", "Number of failed writes of the persisted counters"),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	resets := r.counter("persist.resets_total", "Number of times the persisted counters were missing or unreadable and started from zero")
+	if !loaded {
+		resets.Inc()
+	}
+	if interval > 0 {
+		go p.run(interval)
+	} else {
+		close(p.done)
+	}
+	return p
+}
+
+func (p *persister) run(interval time.Duration) {
+	defer close(p.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p.save()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// save replaces the persisted counters with the current ones, atomically
+// so that a crash mid-write leaves the old totals in place.
+func (p *persister) save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	data, err := json.Marshal(counterFile{
+		Version:  counterFileVersion,
+		Counters: p.reg.snapshot().Counters,
+	})
+	if err == nil {
+		err = p.store.store(data)
+	}
+	if err != nil {
+		p.errors.Inc()
+	}
+	return err
+}
+
+// close stops the periodic writes and writes the final totals.
+func (p *persister) close() error {
+	select {
+	case <-p.stop:
+		return nil
+	default:
+	}
+	close(p.stop)
+	<-p.done
+	return p.save()
+}
+
+// writeFileAtomic writes data to a temporary file renamed over path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,56 @@
+package measure
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	ds "github.com/ipfs/go-datastore"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "c.json")
+	ctx := context.Background()
+	m := New("p", testutil.New(), WithPersistentCounters(path, time.Hour), WithoutPushMetrics())
+	m.Put(ctx, blocks.NewBlock([]byte("a")))
+	m.Put(ctx, blocks.NewBlock([]byte("b")))
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m2 := New("p", testutil.New(), WithPersistentCounters(path, time.Hour), WithoutPushMetrics())
+	m2.Put(ctx, blocks.NewBlock([]byte("c")))
+	if v := m2.Stats().Counters["put_total"]; v != 3 {
+		t.Fatal(v)
+	}
+	os.WriteFile(path, []byte("garbage"), 0644)
+	m3 := New("p", testutil.New(), WithPersistentCounters(path, 0), WithoutPushMetrics())
+	if v := m3.Stats().Counters["put_total"]; v != 0 {
+		t.Fatal(v)
+	}
+}
+
+func TestPersistenceDatastore(t *testing.T) {
+	d := ds.NewMapDatastore()
+	key := ds.NewKey("/measure/counters")
+	m := New("pd", testutil.New(), WithPersistence(d, key, 0))
+	m.Put(context.Background(), blocks.NewBlock([]byte("x")))
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m2 := New("pd", testutil.New(), WithPersistence(d, key, 0))
+	st := m2.Stats().Counters
+	if st["put_total"] != 1 || st["persist.resets_total"] != 1 {
+		t.Fatal(st)
+	}
+	d.Put(context.Background(), key, []byte("garbage"))
+	m3 := New("pd", testutil.New(), WithPersistence(d, key, 0))
+	st = m3.Stats().Counters
+	if st["put_total"] != 0 || st["persist.resets_total"] != 1 {
+		t.Fatal(st)
+	}
+}
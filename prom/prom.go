@@ -0,0 +1,107 @@
+// Package prom exports the metrics of a measure wrapper as a Prometheus
+// collector. Values are read from the wrapper's Snapshot on every scrape,
+// so combined with measure.WithoutPushMetrics the per-operation cost is
+// reduced to updating the wrapper's own counters.
+package prom
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	measure "github.com/whyrusleeping/go-bs-measure"
+)
+
+// Source is anything that can produce a stats snapshot, normally the
+// wrapper returned by measure.New.
+type Source interface {
+	Stats() measure.Stats
+}
+
+// snapshotter is implemented by sources that can be read without side
+// effects, such as the wrapper returned by measure.New. Scrapes use
+// Snapshot when available, so that they don't refresh the metrics Stats
+// derives, such as the tombstone count queried from the backend.
+type snapshotter interface {
+	Snapshot() measure.Stats
+}
+
+type collector struct {
+	src Source
+	set *measure.Set
+}
+
+// NewCollector returns a collector exporting the metrics of src. Metric
+// names are the same as the ones reported through go-metrics-interface
+// with dots replaced by underscores, so dashboards work with either.
+//
+// The set of metrics can grow while the wrapper runs, so the collector
+// is unchecked: it describes no metrics up front. Don't register it
+// while the same wrapper also pushes to a Prometheus-backed
+// go-metrics-interface, or the names will clash.
+func NewCollector(src Source) prometheus.Collector {
+	return &collector{src: src}
+}
+
+// NewSetCollector returns a collector exporting the metrics of every
+// member of set, including those added later. Members sharing metric
+// names are told apart by their labels, see measure.Set.
+func NewSetCollector(set *measure.Set) prometheus.Collector {
+	return &collector{set: set}
+}
+
+func (c *collector) Describe(chan<- *prometheus.Desc) {}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	if c.set != nil {
+		for _, s := range c.set.Snapshot() {
+			c.collect(ch, s)
+		}
+		return
+	}
+	if s, ok := c.src.(snapshotter); ok {
+		c.collect(ch, s.Snapshot())
+		return
+	}
+	c.collect(ch, c.src.Stats())
+}
+
+func (c *collector) collect(ch chan<- prometheus.Metric, s measure.Stats) {
+	if s.Backend != "" {
+		labels := prometheus.Labels{"backend": s.Backend}
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		desc := prometheus.NewDesc(MetricName(s.Prefix, "info"),
+			"Information about the wrapped blockstore, always 1",
+			nil, labels)
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1)
+	}
+	for name, v := range s.Counters {
+		ch <- prometheus.MustNewConstMetric(c.desc(s, name), prometheus.CounterValue, v)
+	}
+	for name, v := range s.Gauges {
+		ch <- prometheus.MustNewConstMetric(c.desc(s, name), prometheus.GaugeValue, v)
+	}
+	for name, h := range s.Histograms {
+		buckets := make(map[float64]uint64, len(h.Bounds))
+		var cumulative uint64
+		for i, bound := range h.Bounds {
+			cumulative += h.Counts[i]
+			buckets[bound] = cumulative
+		}
+		ch <- prometheus.MustNewConstHistogram(c.desc(s, name), h.Count, h.Sum, buckets)
+	}
+}
+
+func (c *collector) desc(s measure.Stats, name string) *prometheus.Desc {
+	return prometheus.NewDesc(MetricName(s.Prefix, name), s.Help[name], nil, s.Labels)
+}
+
+var nameReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// MetricName returns the Prometheus name for the metric called name in a
+// wrapper created with prefix.
+func MetricName(prefix, name string) string {
+	return nameReplacer.Replace(prefix + "." + name)
+}
@@ -0,0 +1,143 @@
+package prom
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/prometheus/client_golang/prometheus"
+
+	measure "github.com/whyrusleeping/go-bs-measure"
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// tombstoneBackend counts the times its tombstones are read.
+type tombstoneBackend struct {
+	*testutil.Blockstore
+	mu    sync.Mutex
+	reads int
+}
+
+func (b *tombstoneBackend) Tombstones() (int64, int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reads++
+	return 1, 3, nil
+}
+
+func (b *tombstoneBackend) readCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reads
+}
+
+// gather scrapes c and returns the value of every counter and gauge.
+func gather(t *testing.T, c prometheus.Collector) map[string]float64 {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			switch {
+			case m.GetCounter() != nil:
+				values[mf.GetName()] = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				values[mf.GetName()] = m.GetGauge().GetValue()
+			case m.GetHistogram() != nil:
+				values[mf.GetName()+"_count"] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return values
+}
+
+func TestCollector(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	fb := &tombstoneBackend{Blockstore: testutil.New()}
+	m := measure.New("test", fb, measure.WithoutPushMetrics(), measure.WithClock(clock),
+		measure.WithTombstoneMonitor(0.5))
+	blk := blocks.NewBlock([]byte("block"))
+	m.Put(ctx, blk)
+	m.Put(ctx, blk)
+	c := NewCollector(m)
+
+	reads := fb.readCount()
+	clock.Advance(time.Minute)
+	values := gather(t, c)
+	if got := values[MetricName("test", "put_total")]; got != 2 {
+		t.Fatalf("put_total = %v, want 2", got)
+	}
+	if got := values[MetricName("test", "uptime_seconds")]; got != 60 {
+		t.Fatalf("uptime_seconds = %v, want 60", got)
+	}
+	if got := values[MetricName("test", "backend.tombstone_ratio")]; got != 0.25 {
+		t.Fatalf("backend.tombstone_ratio = %v, want 0.25", got)
+	}
+	if _, ok := values[MetricName("test", "put.size_bytes")+"_count"]; !ok {
+		t.Fatal("put.size_bytes histogram not exported")
+	}
+
+	// Scrapes leave the metrics derived by Stats alone.
+	gather(t, c)
+	if fb.readCount() != reads {
+		t.Fatalf("scrapes read the tombstones %d times", fb.readCount()-reads)
+	}
+	m.Stats()
+	if fb.readCount() != reads+1 {
+		t.Fatal("Stats didn't refresh the tombstones")
+	}
+}
+
+func TestSetCollector(t *testing.T) {
+	ctx := context.Background()
+	set := measure.NewSet("test", nil, measure.WithoutPushMetrics())
+	for _, name := range []string{"a", "b"} {
+		m := set.Add(name, testutil.New())
+		m.Put(ctx, blocks.NewBlock([]byte(name)))
+	}
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(NewSetCollector(set)); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != MetricName("test", "put_total") {
+			continue
+		}
+		if n := len(mf.GetMetric()); n != 2 {
+			t.Fatalf("%d put_total series, want one per member", n)
+		}
+		return
+	}
+	t.Fatal("put_total not exported")
+}
@@ -0,0 +1,46 @@
+package measure
+
+import (
+	"sync/atomic"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// concurrencyBuckets are the bounds of the put.concurrency histogram.
+var concurrencyBuckets = []float64{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024}
+
+// WithPutConcurrency observes, at the start of every Put, the number of
+// Puts running including itself in the put.concurrency histogram. On a
+// backend serialising writes, a latency growing with the concurrency
+// points at contention rather than at slow storage.
+func WithPutConcurrency() Option {
+	return func(cfg *config) {
+		cfg.putConcurrency = true
+	}
+}
+
+type putConcurrency struct {
+	running int64 // updated atomically
+	hist    metrics.Histogram
+}
+
+func newPutConcurrency(r *registry) *putConcurrency {
+	return &putConcurrency{
+		hist: r.histogram("put.concurrency",
+			"Distribution of the number of Puts running when a Put starts", concurrencyBuckets),
+	}
+}
+
+// enterPut records the start of a Put.
+func (m *measure) enterPut() {
+	if pc := m.putConcurrency; pc != nil {
+		pc.hist.Observe(float64(atomic.AddInt64(&pc.running, 1)))
+	}
+}
+
+// exitPut records the end of a Put started with enterPut.
+func (m *measure) exitPut() {
+	if pc := m.putConcurrency; pc != nil {
+		atomic.AddInt64(&pc.running, -1)
+	}
+}
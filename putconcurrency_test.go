@@ -0,0 +1,31 @@
+package measure
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestPutConcurrency(t *testing.T) {
+	fb := testutil.New()
+	fb.SetLatency(testutil.Put, testutil.Fixed(10*time.Millisecond))
+	m := New("pc", fb, WithPutConcurrency())
+	var wg sync.WaitGroup
+	for _, b := range mkBlocks(16) {
+		wg.Add(1)
+		go func(b blocks.Block) {
+			defer wg.Done()
+			m.Put(context.Background(), b)
+		}(b)
+	}
+	wg.Wait()
+	h := m.Stats().Histograms["put.concurrency"]
+	if h.Count != 16 || h.Counts[0] == 16 || m.putConcurrency.running != 0 {
+		t.Fatal(h)
+	}
+}
@@ -0,0 +1,38 @@
+package measure
+
+import (
+	"context"
+	"math/rand"
+
+	blocks "github.com/ipfs/go-block-format"
+)
+
+// WithPutManyCheck checks, after a sampled fraction (0 to 1) of the
+// successful PutMany calls, that the backend has every block of the
+// batch, to catch backends silently dropping entries. Checked batches
+// are counted in putmany.checks_total and blocks the backend doesn't
+// have right after in putmany.missing_after_write_total. Each check
+// costs a Has per block, made on the caller's goroutine, so the rate
+// should stay low on busy stores. Blocks whose Has fails aren't
+// counted. There is no check with WithWriteBehind.
+func WithPutManyCheck(sampleRate float64) Option {
+	return func(cfg *config) {
+		cfg.putManyCheckRate = sampleRate
+	}
+}
+
+// checkPutMany checks that blks were all written, on a sample of calls.
+func (m *measure) checkPutMany(ctx context.Context, blks []blocks.Block) {
+	// Writes behind haven't reached the backend yet.
+	if m.putManyCheckRate <= 0 || m.writeBehind != nil || rand.Float64() >= m.putManyCheckRate {
+		return
+	}
+	m.reg.counter("putmany.checks_total", "Number of PutMany batches checked for missing blocks").Inc()
+	missing := m.reg.counter("putmany.missing_after_write_total",
+		"Number of blocks missing from the backend right after a successful PutMany")
+	for _, blk := range blks {
+		if has, err := m.backend.Has(ctx, blk.Cid()); err == nil && !has {
+			missing.Inc()
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type dropOneBS struct{ *testutil.Blockstore }
+
+func (d dropOneBS) PutMany(ctx context.Context, blks []blocks.Block) error {
+	return d.Blockstore.PutMany(ctx, blks[1:])
+}
+
+func TestPutManyCheck(t *testing.T) {
+	m := New("pmc", dropOneBS{testutil.New()}, WithPutManyCheck(1))
+	if err := m.PutMany(context.Background(), mkBlocks(5)); err != nil {
+		t.Fatal(err)
+	}
+	c := m.Stats().Counters
+	if c["putmany.missing_after_write_total"] != 1 || c["putmany.checks_total"] != 1 {
+		t.Fatal(c)
+	}
+}
@@ -0,0 +1,82 @@
+package measure
+
+import (
+	"context"
+
+	blocks "github.com/ipfs/go-block-format"
+)
+
+// PutResult describes a block written by PutReport.
+type PutResult struct {
+	// Size is the number of bytes of block data written.
+	Size int
+	// AlreadyExisted tells whether the block was stored before the call.
+	// It is only set with WithPutExistenceCheck.
+	AlreadyExisted bool
+}
+
+// WithPutExistenceCheck makes PutReport find out whether blocks were
+// already stored. It costs a Has call on the backend before every
+// PutReport write. The sizes of the blocks found stored are added up in
+// dedup.bytes_saved_total, an estimate of the space content addressing
+// saved; it only counts the duplicates written with PutReport on this
+// wrapper.
+func WithPutExistenceCheck(opts ...PutExistenceOption) Option {
+	return func(cfg *config) {
+		cfg.putExistenceCheck = true
+		for _, o := range opts {
+			o(cfg)
+		}
+	}
+}
+
+// PutExistenceOption configures WithPutExistenceCheck.
+type PutExistenceOption func(*config)
+
+// CompareOverwriteSize makes PutReport, when the block already exists,
+// compare the size the backend reports for it with the size of the new
+// data, counting differences in put.size_mismatch_on_overwrite_total.
+// Content addressed data can't change size, so any difference points at
+// a bug or corruption. It costs a GetSize call on the backend for every
+// overwrite.
+func CompareOverwriteSize() PutExistenceOption {
+	return func(cfg *config) {
+		cfg.compareOverwriteSize = true
+	}
+}
+
+// PutReport is Put, also telling the caller what was written. It is
+// recorded like Put, and counted in put.report_total.
+func (m *measure) PutReport(ctx context.Context, blk blocks.Block) (PutResult, error) {
+	m.reg.counter("put.report_total", "Number of PutReport calls").Inc()
+	res := PutResult{Size: len(blk.RawData())}
+	if m.putExistenceCheck {
+		existed, err := m.backend.Has(ctx, blk.Cid())
+		if err != nil {
+			return PutResult{}, err
+		}
+		res.AlreadyExisted = existed
+		if existed && m.compareOverwriteSize {
+			m.compareSize(ctx, blk)
+		}
+	}
+	if err := m.Put(ctx, blk); err != nil {
+		return PutResult{}, err
+	}
+	if res.AlreadyExisted {
+		m.reg.counter("dedup.bytes_saved_total",
+			"Bytes of blocks written with PutReport that were already stored").Add(float64(res.Size))
+	}
+	return res, nil
+}
+
+// compareSize counts blk in put.size_mismatch_on_overwrite_total if the
+// backend reports a different size for it.
+func (m *measure) compareSize(ctx context.Context, blk blocks.Block) {
+	size, err := m.backend.GetSize(ctx, blk.Cid())
+	if err != nil || size == len(blk.RawData()) {
+		return
+	}
+	m.reg.counter("put.size_mismatch_on_overwrite_total",
+		"Number of overwrites whose size differed from the stored block").Inc()
+}
@@ -0,0 +1,56 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestPutReport(t *testing.T) {
+	ctx := context.Background()
+	m := New("pr", testutil.New(), WithPutExistenceCheck())
+	b := blocks.NewBlock([]byte("hello"))
+	r, err := m.PutReport(ctx, b)
+	if err != nil || r.Size != 5 || r.AlreadyExisted {
+		t.Fatal(r, err)
+	}
+	r, err = m.PutReport(ctx, b)
+	if err != nil || !r.AlreadyExisted {
+		t.Fatal(r, err)
+	}
+	st := m.Stats().Counters
+	if st["put.report_total"] != 2 || st["put_total"] != 2 {
+		t.Fatal(st)
+	}
+}
+
+func TestOverwriteSizeMismatch(t *testing.T) {
+	ctx := context.Background()
+	m := New("ow", staleSizeBS{testutil.New()}, WithPutExistenceCheck(CompareOverwriteSize()))
+	b := blocks.NewBlock([]byte("hello"))
+	m.PutReport(ctx, b)
+	if m.Stats().Counters["put.size_mismatch_on_overwrite_total"] != 0 {
+		t.Fatal("first write")
+	}
+	m.PutReport(ctx, b)
+	if m.Stats().Counters["put.size_mismatch_on_overwrite_total"] != 1 {
+		t.Fatal("overwrite")
+	}
+}
+
+func TestDedupBytesSaved(t *testing.T) {
+	m := New("ds", testutil.New(), WithPutExistenceCheck())
+	b := blocks.NewBlock(bytes.Repeat([]byte{1}, 1024))
+	for i := 0; i < 3; i++ {
+		if _, err := m.PutReport(context.Background(), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := m.Stats().Counters["dedup.bytes_saved_total"]; n != 2048 {
+		t.Fatal(n)
+	}
+}
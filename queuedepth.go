@@ -0,0 +1,45 @@
+package measure
+
+import (
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// QueueDepther is implemented by backends that queue writes and flush
+// them asynchronously. QueueDepth returns the number of queued writes,
+// which the wrapper reports in backend.queue_depth after every write.
+type QueueDepther interface {
+	QueueDepth() int
+}
+
+// queueDepth samples the write queue of a QueueDepther backend.
+type queueDepth struct {
+	backend QueueDepther
+	depth   metrics.Gauge
+}
+
+// newQueueDepth returns a sampler for the queue of bs, looking through
+// wrappers, or nil if bs doesn't report one.
+func newQueueDepth(r *registry, bs blockstore.Blockstore) *queueDepth {
+	for {
+		if qd, ok := bs.(QueueDepther); ok {
+			return &queueDepth{
+				backend: qd,
+				depth:   r.gauge("backend.queue_depth", "Number of writes queued by the backend"),
+			}
+		}
+		u, ok := bs.(unwrapper)
+		if !ok {
+			return nil
+		}
+		bs = u.Unwrap()
+	}
+}
+
+// observeQueueDepth sets backend.queue_depth after a write.
+func (m *measure) observeQueueDepth() {
+	if m.queueDepth == nil {
+		return
+	}
+	m.queueDepth.depth.Set(float64(m.queueDepth.backend.QueueDepth()))
+}
@@ -0,0 +1,35 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type queuedBS struct {
+	*testutil.Blockstore
+	depth int
+}
+
+func (q *queuedBS) QueueDepth() int { return q.depth }
+
+func TestQueueDepth(t *testing.T) {
+	ctx := context.Background()
+	q := &queuedBS{Blockstore: testutil.New(), depth: 7}
+	m := New("qd", q, WithCompression(Flate(1)))
+	m.Put(ctx, blocks.NewBlock([]byte("a")))
+	if m.Stats().Gauges["backend.queue_depth"] != 7 {
+		t.Fatal(m.Stats().Gauges)
+	}
+	q.depth = 2
+	m.PutMany(ctx, mkBlocks(2))
+	if m.Stats().Gauges["backend.queue_depth"] != 2 {
+		t.Fatal(m.Stats().Gauges)
+	}
+	if _, ok := New("qd2", testutil.New()).Stats().Gauges["backend.queue_depth"]; ok {
+		t.Fatal("gauge without queue")
+	}
+}
@@ -0,0 +1,67 @@
+package measure
+
+import (
+	"math/rand"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithReadAfterWrite times how long written blocks take to become
+// readable. A sampled fraction (0 to 1) of successful writes is
+// remembered, and the next Get or Has of such a block observes the time
+// since its write in read_after_write.latency_seconds if it was found, or
+// counts read_after_write.not_yet_visible_total if it wasn't. At most
+// size writes are remembered; the oldest are forgotten first.
+//
+// This is a consistency diagnostic for eventually consistent backends.
+func WithReadAfterWrite(sampleRate float64, size int) Option {
+	return func(cfg *config) {
+		cfg.rawRate = sampleRate
+		cfg.rawSize = size
+	}
+}
+
+type readAfterWrite struct {
+	rate       float64
+	written    *cidLRU
+	latency    metrics.Histogram
+	notVisible metrics.Counter
+}
+
+func newReadAfterWrite(r *registry, rate float64, size int) *readAfterWrite {
+	return &readAfterWrite{
+		rate:    rate,
+		written: newCidLRU(size, 0),
+		latency: r.latency("read_after_write.latency",
+			"Time from a sampled write to the first read finding the block"),
+		notVisible: r.counter("read_after_write.not_yet_visible_total",
+			"Number of first reads after a sampled write that didn't find the block"),
+	}
+}
+
+// sampleWrite remembers the write of c on a sample of calls.
+func (m *measure) sampleWrite(c cid.Cid) {
+	if m.raw == nil || rand.Float64() >= m.raw.rate {
+		return
+	}
+	m.raw.written.add(c, m.clock.Now())
+}
+
+// observeReadAfterWrite records the first read of a sampled write of c,
+// which found the block or not.
+func (m *measure) observeReadAfterWrite(c cid.Cid, found bool) {
+	if m.raw == nil {
+		return
+	}
+	now := m.clock.Now()
+	written, ok := m.raw.written.takeAdded(c, now)
+	if !ok {
+		return
+	}
+	if found {
+		m.raw.latency.Observe(now.Sub(written).Seconds())
+	} else {
+		m.raw.notVisible.Inc()
+	}
+}
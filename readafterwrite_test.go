@@ -0,0 +1,25 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestReadAfterWrite(t *testing.T) {
+	ctx := context.Background()
+	m := New("raw", testutil.New(), WithReadAfterWrite(1, 10))
+	b := blocks.NewBlock([]byte("x"))
+	m.Put(ctx, b)
+	if _, err := m.Get(ctx, b.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	m.Get(ctx, b.Cid())
+	st := m.Stats()
+	if h := st.Histograms["read_after_write.latency_seconds"]; h.Count != 1 {
+		t.Fatal(st.Histograms)
+	}
+}
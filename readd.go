@@ -0,0 +1,49 @@
+package measure
+
+import (
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithReaddTracking remembers up to size recently deleted CIDs, for at
+// most window (no age limit if zero), and counts in put.readd_total the
+// blocks written again while still remembered. A steadily growing count
+// points at churn: callers deleting blocks they will need again shortly.
+func WithReaddTracking(size int, window time.Duration) Option {
+	return func(cfg *config) {
+		cfg.readdSize = size
+		cfg.readdWindow = window
+	}
+}
+
+type readdTracker struct {
+	deleted *cidLRU
+	readd   metrics.Counter
+}
+
+func newReaddTracker(r *registry, size int, window time.Duration) *readdTracker {
+	return &readdTracker{
+		deleted: newCidLRU(size, window),
+		readd:   r.counter("put.readd_total", "Number of blocks written shortly after being deleted"),
+	}
+}
+
+// noteDeleted records that c was deleted.
+func (m *measure) noteDeleted(c cid.Cid) {
+	if m.readd == nil {
+		return
+	}
+	m.readd.deleted.add(c, m.clock.Now())
+}
+
+// noteWritten counts c as a re-add if it was deleted recently.
+func (m *measure) noteWritten(c cid.Cid) {
+	if m.readd == nil {
+		return
+	}
+	if m.readd.deleted.take(c, m.clock.Now()) {
+		m.readd.readd.Inc()
+	}
+}
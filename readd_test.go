@@ -0,0 +1,28 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestReadd(t *testing.T) {
+	ctx := context.Background()
+	m := New("rd", testutil.New(), WithReaddTracking(10, time.Minute))
+	a, b := blocks.NewBlock([]byte("a")), blocks.NewBlock([]byte("b"))
+	m.Put(ctx, a)
+	m.DeleteBlock(ctx, a.Cid())
+	m.Put(ctx, b)
+	if m.Stats().Counters["put.readd_total"] != 0 {
+		t.Fatal("unrelated")
+	}
+	m.Put(ctx, a)
+	m.Put(ctx, a)
+	if m.Stats().Counters["put.readd_total"] != 1 {
+		t.Fatal("readd")
+	}
+}
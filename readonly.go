@@ -0,0 +1,30 @@
+package measure
+
+import (
+	"errors"
+)
+
+// ErrReadOnly is returned by writes to a read-only wrapper, see
+// WithReadOnly.
+var ErrReadOnly = errors.New("measure: blockstore is read-only")
+
+// WithReadOnly makes the wrapper refuse every write, for example in
+// front of a replica: Put, PutMany, PutWithTTL, DeleteBlock and
+// DeleteMany return ErrReadOnly without reaching the backend, even
+// while the wrapper is disabled or deletes are dry runs. Rejected writes
+// are counted in readonly.rejected_total and, per operation, in
+// readonly.rejected.<op>_total, but not as calls of the operation.
+// Reads are unaffected.
+func WithReadOnly() Option {
+	return func(cfg *config) {
+		cfg.readOnly = true
+	}
+}
+
+// rejectReadOnly counts a write by op rejected by WithReadOnly.
+func (m *measure) rejectReadOnly(op Op) error {
+	m.reg.counter("readonly.rejected_total", "Number of writes rejected because the blockstore is read-only").Inc()
+	m.reg.counter("readonly.rejected."+string(op)+"_total",
+		"Number of writes of one kind rejected because the blockstore is read-only").Inc()
+	return ErrReadOnly
+}
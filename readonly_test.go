@@ -0,0 +1,35 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	mem := testutil.New()
+	b := blocks.NewBlock([]byte("ro"))
+	mem.Put(ctx, b)
+	m := New("ro", mem, WithReadOnly())
+	if m.Put(ctx, b) != ErrReadOnly || m.PutMany(ctx, []blocks.Block{b}) != ErrReadOnly ||
+		m.DeleteBlock(ctx, b.Cid()) != ErrReadOnly || m.DeleteMany(ctx, []cid.Cid{b.Cid()}) != ErrReadOnly ||
+		m.PutWithTTL(ctx, b, time.Hour) != ErrReadOnly {
+		t.Fatal("write allowed")
+	}
+	if mem.Count(testutil.Put)-1+mem.Count(testutil.PutMany)+mem.Count(testutil.DeleteBlock) != 0 {
+		t.Fatal(mem.Calls())
+	}
+	if got, err := m.Get(ctx, b.Cid()); err != nil || !got.Cid().Equals(b.Cid()) {
+		t.Fatal(err)
+	}
+	st := m.Stats()
+	if st.Counters["readonly.rejected_total"] != 5 || st.Counters["readonly.rejected.put_total"] != 2 || st.Counters["put_total"] != 0 {
+		t.Fatal(st.Counters)
+	}
+}
@@ -0,0 +1,116 @@
+package measure
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// readSequenceTTL is how long a Has waits for the Get of the same block
+// in the same request before being forgotten.
+const readSequenceTTL = time.Minute
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a context carrying the ID of the logical
+// request the operations made with it belong to, see WithReadSequences.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the ID set with ContextWithRequestID, or
+// "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithReadSequences records the combined latency of a Has followed by a
+// Get of the same block in the same request, as told by
+// ContextWithRequestID, in read_sequence.latency_seconds: the true cost
+// of checking for a block before reading it. Operations without a
+// request ID are left out. Up to max Has calls wait for their Get at a
+// time, for at most a minute; Has calls beyond that are not tracked.
+func WithReadSequences(max int) Option {
+	return func(cfg *config) {
+		cfg.readSequences = max
+	}
+}
+
+type readSequenceKey struct {
+	request string
+	c       cid.Cid
+}
+
+type pendingHas struct {
+	latency time.Duration
+	at      time.Time
+}
+
+type readSequences struct {
+	max     int
+	clock   Clock
+	latency metrics.Histogram
+
+	mu      sync.Mutex
+	pending map[readSequenceKey]pendingHas
+}
+
+func newReadSequences(r *registry, max int, clock Clock) *readSequences {
+	return &readSequences{
+		max:     max,
+		clock:   clock,
+		latency: r.latency("read_sequence.latency", "Latency distribution of a Has and the following Get of the same block in a request"),
+		pending: make(map[readSequenceKey]pendingHas),
+	}
+}
+
+// expire forgets the Has calls older than readSequenceTTL. s.mu must be
+// held.
+func (s *readSequences) expire(now time.Time) {
+	for k, p := range s.pending {
+		if now.Sub(p.at) >= readSequenceTTL {
+			delete(s.pending, k)
+		}
+	}
+}
+
+// observeReadSequence remembers a Has of c, started at start, or
+// completes the read sequence a Get of c ends.
+func (m *measure) observeReadSequence(ctx context.Context, op Op, c cid.Cid, start time.Time) {
+	s := m.readSequences
+	if s == nil {
+		return
+	}
+	id := RequestIDFromContext(ctx)
+	if id == "" {
+		return
+	}
+	latency := m.clock.Now().Sub(start)
+	key := readSequenceKey{id, c}
+	now := s.clock.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch op {
+	case OpHas:
+		if _, ok := s.pending[key]; !ok && len(s.pending) >= s.max {
+			s.expire(now)
+			if len(s.pending) >= s.max {
+				return
+			}
+		}
+		s.pending[key] = pendingHas{latency: latency, at: now}
+	case OpGet:
+		p, ok := s.pending[key]
+		if !ok {
+			return
+		}
+		delete(s.pending, key)
+		if now.Sub(p.at) < readSequenceTTL {
+			s.latency.Observe((p.latency + latency).Seconds())
+		}
+	}
+}
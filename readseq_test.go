@@ -0,0 +1,27 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestReadSequence(t *testing.T) {
+	fb := testutil.New()
+	fb.SetLatency(testutil.Get, testutil.Fixed(20*time.Millisecond))
+	blk := mkBlocks(1)[0]
+	fb.Put(context.Background(), blk)
+	m := New("rq", fb, WithReadSequences(10))
+	ctx := ContextWithRequestID(context.Background(), "r1")
+	m.Get(context.Background(), blk.Cid())
+	m.Has(ctx, blk.Cid())
+	m.Get(ContextWithRequestID(context.Background(), "r2"), blk.Cid())
+	m.Get(ctx, blk.Cid())
+	m.Get(ctx, blk.Cid())
+	h := m.Stats().Histograms["read_sequence.latency_seconds"]
+	if h.Count != 1 || h.Sum < 0.02 {
+		t.Fatal(h)
+	}
+}
@@ -0,0 +1,88 @@
+package measure
+
+import (
+	"sync"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// Recorder receives every update the wrapper makes to its metrics, under
+// the full metric name, prefix included. Gauges are reported by value.
+// By default updates go to go-metrics-interface; WithRecorder plugs in
+// another sink, such as statsd. Recorders are called concurrently.
+type Recorder interface {
+	IncCounter(name string, delta float64)
+	ObserveHistogram(name string, v float64)
+	SetGauge(name string, v float64)
+}
+
+// WithRecorder sends metric updates to rec instead of
+// go-metrics-interface. Stats still reports every metric.
+func WithRecorder(rec Recorder) Option {
+	return func(cfg *config) {
+		cfg.recorder = rec
+	}
+}
+
+// newRecorder returns the Recorder the configured wrapper reports to, or nil.
+func (cfg *config) newRecorder() Recorder {
+	switch {
+	case !cfg.push:
+		return nil
+	case cfg.recorder != nil:
+		return cfg.recorder
+	case cfg.isolated:
+		return nil
+	default:
+		return newMetricsRecorder()
+	}
+}
+
+// metricDefiner is implemented by recorders that need to know about a
+// metric before it is updated.
+type metricDefiner interface {
+	defineCounter(name, help string)
+	defineGauge(name, help string)
+	defineHistogram(name, help string, buckets []float64)
+}
+
+// metricsRecorder records to go-metrics-interface.
+type metricsRecorder struct {
+	counters   sync.Map // of metrics.Counter
+	gauges     sync.Map // of metrics.Gauge
+	histograms sync.Map // of metrics.Histogram
+}
+
+func newMetricsRecorder() *metricsRecorder {
+	return &metricsRecorder{}
+}
+
+func (mr *metricsRecorder) defineCounter(name, help string) {
+	mr.counters.Store(name, metrics.New(name, help).Counter())
+}
+
+func (mr *metricsRecorder) defineGauge(name, help string) {
+	mr.gauges.Store(name, metrics.New(name, help).Gauge())
+}
+
+func (mr *metricsRecorder) defineHistogram(name, help string, buckets []float64) {
+	mr.histograms.Store(name, metrics.New(name, help).Histogram(buckets))
+}
+
+func (mr *metricsRecorder) IncCounter(name string, delta float64) {
+	if c, ok := mr.counters.Load(name); ok {
+		c.(metrics.Counter).Add(delta)
+	}
+}
+
+func (mr *metricsRecorder) SetGauge(name string, v float64) {
+	if g, ok := mr.gauges.Load(name); ok {
+		g.(metrics.Gauge).Set(v)
+	}
+}
+
+func (mr *metricsRecorder) ObserveHistogram(name string, v float64) {
+	if h, ok := mr.histograms.Load(name); ok {
+		h.(metrics.Histogram).Observe(v)
+	}
+}
@@ -0,0 +1,55 @@
+package measure
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type fakeRecorder struct {
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64
+	observed map[string]int
+}
+
+func (f *fakeRecorder) IncCounter(name string, d float64) {
+	f.mu.Lock()
+	f.counters[name] += d
+	f.mu.Unlock()
+}
+func (f *fakeRecorder) SetGauge(name string, v float64) {
+	f.mu.Lock()
+	f.gauges[name] = v
+	f.mu.Unlock()
+}
+func (f *fakeRecorder) ObserveHistogram(name string, v float64) {
+	f.mu.Lock()
+	f.observed[name]++
+	f.mu.Unlock()
+}
+
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+	rec := &fakeRecorder{counters: map[string]float64{}, gauges: map[string]float64{}, observed: map[string]int{}}
+	m := New("rc", testutil.New(), WithRecorder(rec))
+	b := blocks.NewBlock([]byte("x"))
+	m.Put(ctx, b)
+	m.Get(ctx, b.Cid())
+	m.Get(ctx, b.Cid())
+	if rec.counters["rc.put_total"] != 1 || rec.counters["rc.get_total"] != 2 || rec.observed["rc.put.size_bytes"] != 1 {
+		t.Fatal(rec.counters, rec.observed)
+	}
+	if v, ok := rec.gauges["rc.inflight"]; !ok || v != 0 {
+		t.Fatal(rec.gauges)
+	}
+	n := New("rc2", testutil.New(), WithRecorder(rec), WithoutPushMetrics())
+	n.Put(ctx, b)
+	if rec.counters["rc2.put_total"] != 0 {
+		t.Fatal("pushed")
+	}
+}
@@ -0,0 +1,49 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// sort failure episodes in buckets with following upper bounds in seconds,
+// from a second to a day
+var failureDurationBuckets = []float64{1, 5, 10, 30, 60, 300, 600, 1800, 3600, 3 * 3600, 6 * 3600, 24 * 3600}
+
+// failureStreaks holds, per operation, the time in Unix nanoseconds of
+// the first error of the current failure streak, or 0.
+type failureStreaks map[Op]*int64
+
+func newFailureStreaks() failureStreaks {
+	fs := make(failureStreaks)
+	for _, op := range []Op{OpPut, OpPutMany, OpGet, OpHas, OpGetSize, OpDelete, OpDeleteMany, OpView} {
+		fs[op] = new(int64)
+	}
+	return fs
+}
+
+// trackRecovery follows failure streaks of op. When an operation succeeds
+// after one or more failed, the time since the first failure is observed
+// in <op>.failure_duration_seconds and <op>.recovery_total incremented.
+// Not-found counts as success; cancellations and expired deadlines are
+// the caller's doing and are ignored.
+func (m *measure) trackRecovery(op Op, err error) {
+	since := m.streaks[op]
+	switch {
+	case err == nil || format.IsNotFound(err):
+		start := atomic.SwapInt64(since, 0)
+		if start == 0 {
+			return
+		}
+		d := m.clock.Now().Sub(time.Unix(0, start))
+		m.reg.histogram(string(op)+".failure_duration_seconds",
+			"Duration distribution of failure streaks ended by a success", failureDurationBuckets).Observe(d.Seconds())
+		m.reg.counter(string(op)+".recovery_total", "Number of failure streaks ended by a success").Inc()
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+	default:
+		atomic.CompareAndSwapInt64(since, 0, m.clock.Now().UnixNano())
+	}
+}
@@ -0,0 +1,47 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type flakyBS struct {
+	*testutil.Blockstore
+	fail bool
+}
+
+func (f *flakyBS) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	if f.fail {
+		return false, errors.New("boom")
+	}
+	return f.Blockstore.Has(ctx, c)
+}
+
+func TestRecovery(t *testing.T) {
+	ctx := context.Background()
+	clk := &fakeClock{t: time.Unix(1000, 0)}
+	bs := &flakyBS{Blockstore: testutil.New(), fail: true}
+	m := New("rec", bs, WithClock(clk))
+	c := blocks.NewBlock([]byte("x")).Cid()
+	m.Has(ctx, c)
+	clk.Advance(30 * time.Second)
+	m.Has(ctx, c)
+	if info, ok := m.LastError(OpHas); !ok || info.Message != "boom" {
+		t.Fatal(info)
+	}
+	bs.fail = false
+	clk.Advance(15 * time.Second)
+	m.Has(ctx, c)
+	st := m.Stats()
+	h := st.Histograms["has.failure_duration_seconds"]
+	if h.Count != 1 || h.Sum != 45 || st.Counters["has.recovery_total"] != 1 {
+		t.Fatal(h, st.Counters)
+	}
+}
@@ -0,0 +1,96 @@
+package measure
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// WithReentrancyDetection counts in reentrant_calls_total the operations
+// started while another operation of the same wrapper is running on the
+// same goroutine, which happens when the backend, or a layer between it
+// and the wrapper, calls back into the wrapper. Such calls are counted
+// twice in the in-flight gauges and can deadlock on the backend's own
+// locks. If logf is not nil, the stack of every re-entrant call is
+// passed to it.
+//
+// Goroutines are told apart by parsing their stack header, which costs
+// a few microseconds per operation: this is meant for debugging, not
+// production. Calls back into the wrapper from other goroutines aren't
+// detected.
+func WithReentrancyDetection(logf func(format string, args ...interface{})) Option {
+	return func(cfg *config) {
+		cfg.reentrancy = true
+		cfg.reentrancyLog = logf
+	}
+}
+
+type reentrancyDetector struct {
+	logf func(format string, args ...interface{})
+
+	mu sync.Mutex
+	// depth holds the number of running operations of each goroutine
+	// that has any.
+	depth map[uint64]int
+}
+
+func newReentrancyDetector(logf func(string, ...interface{})) *reentrancyDetector {
+	return &reentrancyDetector{
+		logf:  logf,
+		depth: make(map[uint64]int),
+	}
+}
+
+// enterReentrant records the start of op on the current goroutine.
+func (m *measure) enterReentrant(op Op) {
+	d := m.reentrancy
+	if d == nil {
+		return
+	}
+	id := goroutineID()
+	d.mu.Lock()
+	d.depth[id]++
+	n := d.depth[id]
+	d.mu.Unlock()
+	if n == 1 {
+		return
+	}
+	m.reg.counter("reentrant_calls_total",
+		"Number of operations started while another was running on the same goroutine").Inc()
+	if d.logf != nil {
+		buf := make([]byte, 16<<10)
+		buf = buf[:runtime.Stack(buf, false)]
+		d.logf("measure %s: re-entrant %s at depth %d\n%s", m.reg.prefix, op, n, buf)
+	}
+}
+
+// exitReentrant records the end of an operation started with
+// enterReentrant.
+func (m *measure) exitReentrant() {
+	d := m.reentrancy
+	if d == nil {
+		return
+	}
+	id := goroutineID()
+	d.mu.Lock()
+	if d.depth[id] <= 1 {
+		delete(d.depth, id)
+	} else {
+		d.depth[id]--
+	}
+	d.mu.Unlock()
+}
+
+// goroutineID returns the ID of the current goroutine, read from the
+// "goroutine N [" header of its stack.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
@@ -0,0 +1,46 @@
+package measure
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type reenterBS struct {
+	*testutil.Blockstore
+	outer interface {
+		Has(context.Context, cid.Cid) (bool, error)
+	}
+}
+
+func (r *reenterBS) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	r.outer.Has(ctx, c)
+	return r.Blockstore.Get(ctx, c)
+}
+
+func TestReentrancy(t *testing.T) {
+	ctx := context.Background()
+	bs := &reenterBS{Blockstore: testutil.New()}
+	var logged []string
+	m := New("re", bs, WithReentrancyDetection(func(f string, a ...interface{}) { logged = append(logged, f) }))
+	bs.outer = m
+	b := blocks.NewBlock([]byte("x"))
+	m.Put(ctx, b)
+	m.Has(ctx, b.Cid())
+	if m.Stats().Counters["reentrant_calls_total"] != 0 {
+		t.Fatal("false positive")
+	}
+	m.Get(ctx, b.Cid())
+	m.Get(ctx, b.Cid())
+	if m.Stats().Counters["reentrant_calls_total"] != 2 || len(logged) != 2 || !strings.Contains(logged[0], "re-entrant") {
+		t.Fatal(m.Stats().Counters, logged)
+	}
+	if len(m.reentrancy.depth) != 0 {
+		t.Fatal(m.reentrancy.depth)
+	}
+}
@@ -0,0 +1,103 @@
+package measure
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithPutCounts counts how many times each CID is written with Put or
+// PutMany, which for stores where re-adding a block means pinning it
+// again approximates its reference count. The highest count is kept in
+// the put.max_refcount gauge and the top most written CIDs are returned
+// by MostPut. At most size CIDs are tracked; when more are written, the
+// quarter written the least is forgotten, so rarely written CIDs may be
+// undercounted.
+func WithPutCounts(size, top int) Option {
+	return func(cfg *config) {
+		cfg.putCountSize = size
+		cfg.putCountTop = top
+	}
+}
+
+// PutCount is the number of times a CID was written, see WithPutCounts.
+type PutCount struct {
+	Cid   cid.Cid
+	Count uint64
+}
+
+type putCounter struct {
+	size, top int
+	maxGauge  metrics.Gauge
+
+	mu     sync.Mutex
+	counts map[cid.Cid]uint64
+	max    uint64
+}
+
+func newPutCounter(r *registry, size, top int) *putCounter {
+	return &putCounter{
+		size:     size,
+		top:      top,
+		maxGauge: r.gauge("put.max_refcount", "Highest number of times a single CID was written"),
+		counts:   make(map[cid.Cid]uint64),
+	}
+}
+
+// countPut counts a successful write of c.
+func (m *measure) countPut(c cid.Cid) {
+	p := m.putCounts
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n, ok := p.counts[c]
+	if !ok && len(p.counts) >= p.size {
+		p.evict()
+	}
+	n++
+	p.counts[c] = n
+	if n > p.max {
+		p.max = n
+		p.maxGauge.Set(float64(n))
+	}
+}
+
+// evict forgets the quarter of the CIDs written the least, so that the
+// sort is paid for once every few insertions.
+func (p *putCounter) evict() {
+	entries := p.sorted()
+	for _, e := range entries[len(entries)-len(entries)/4-1:] {
+		delete(p.counts, e.Cid)
+	}
+}
+
+// sorted returns the counts, highest first.
+func (p *putCounter) sorted() []PutCount {
+	entries := make([]PutCount, 0, len(p.counts))
+	for c, n := range p.counts {
+		entries = append(entries, PutCount{Cid: c, Count: n})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Count > entries[j].Count })
+	return entries
+}
+
+// MostPut returns the CIDs tracked by WithPutCounts that were written
+// the most, with their counts, most written first. It returns nil if
+// writes aren't counted.
+func (m *measure) MostPut() []PutCount {
+	p := m.putCounts
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	entries := p.sorted()
+	p.mu.Unlock()
+	if len(entries) > p.top {
+		entries = entries[:p.top]
+	}
+	return entries
+}
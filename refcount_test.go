@@ -0,0 +1,30 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestPutCounts(t *testing.T) {
+	ctx := context.Background()
+	m := New("rc", testutil.New(), WithPutCounts(8, 2))
+	hot := blocks.NewBlock([]byte("hot"))
+	for i := 0; i < 4; i++ {
+		m.Put(ctx, hot)
+	}
+	m.PutMany(ctx, []blocks.Block{hot})
+	for _, b := range mkBlocks(30) {
+		m.Put(ctx, b)
+	}
+	top := m.MostPut()
+	if len(top) != 2 || !top[0].Cid.Equals(hot.Cid()) || top[0].Count != 5 {
+		t.Fatal(top)
+	}
+	if m.Stats().Gauges["put.max_refcount"] != 5 || len(m.putCounts.counts) > 8 {
+		t.Fatal(m.Stats().Gauges)
+	}
+}
@@ -0,0 +1,192 @@
+// Package replay re-executes an operation journal recorded with
+// measure.WithJournal against another blockstore, so that backends can be
+// compared on a real workload.
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+
+	measure "github.com/whyrusleeping/go-bs-measure"
+)
+
+// Options configure a replay.
+type Options struct {
+	// Prefix is used for the metrics of the measure wrapper the replay
+	// runs through. Defaults to "replay".
+	Prefix string
+
+	// RealTime keeps the recorded gaps between operations instead of
+	// replaying as fast as possible.
+	RealTime bool
+}
+
+// Result summarizes a replay.
+type Result struct {
+	// Ops is the number of operations executed.
+	Ops int
+	// Missing counts reads of blocks the target didn't have, typically
+	// because they were written before the journal started.
+	Missing int
+	// Errors counts operations that failed for other reasons.
+	Errors int
+	// Skipped counts records that can't be replayed, such as DeleteMany
+	// whose CIDs are not journaled.
+	Skipped int
+
+	Elapsed time.Duration
+	// Stats holds the metrics recorded while replaying.
+	Stats measure.Stats
+}
+
+// Replay reads journal records from r and executes them against bs.
+// Written blocks are synthesized with the recorded sizes; since their
+// CIDs differ from the recorded ones, later operations on a recorded CID
+// are redirected to the block synthesized for it.
+func Replay(ctx context.Context, r io.Reader, bs blockstore.Blockstore, opts Options) (Result, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = "replay"
+	}
+	m := measure.New(opts.Prefix, bs)
+	rp := &replayer{
+		bs:      m,
+		written: make(map[string]cid.Cid),
+	}
+
+	var res Result
+	var first time.Time
+	start := time.Now()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		var rec measure.JournalRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return res, fmt.Errorf("journal line %d: %w", line, err)
+		}
+
+		if opts.RealTime {
+			if first.IsZero() {
+				first = rec.Time
+			}
+			if wait := rec.Time.Sub(first) - time.Since(start); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return res, ctx.Err()
+				}
+			}
+		}
+
+		ok, err := rp.exec(ctx, rec)
+		switch {
+		case !ok:
+			res.Skipped++
+			continue
+		case format.IsNotFound(err):
+			res.Missing++
+		case err != nil:
+			res.Errors++
+		}
+		res.Ops++
+	}
+	if err := sc.Err(); err != nil {
+		return res, err
+	}
+
+	res.Elapsed = time.Since(start)
+	res.Stats = m.Stats()
+	return res, nil
+}
+
+// store is the part of the measure wrapper the replayer uses.
+type store interface {
+	blockstore.Blockstore
+	View(context.Context, cid.Cid, func([]byte) error) error
+}
+
+type replayer struct {
+	bs store
+
+	// written maps recorded CIDs to the CIDs of the blocks synthesized
+	// in their place.
+	written map[string]cid.Cid
+}
+
+// exec runs a single record, reporting false if it can't be replayed.
+func (rp *replayer) exec(ctx context.Context, rec measure.JournalRecord) (bool, error) {
+	switch rec.Op {
+	case "put":
+		blk := synthesize(rec.Cid, rec.Bytes)
+		rp.written[rec.Cid] = blk.Cid()
+		return true, rp.bs.Put(ctx, blk)
+	case "putmany":
+		if rec.Items == 0 {
+			return false, nil
+		}
+		blks := make([]blocks.Block, rec.Items)
+		for i := range blks {
+			blks[i] = synthesize(fmt.Sprintf("%s/%d/%d", rec.Time, rec.Bytes, i), rec.Bytes/rec.Items)
+		}
+		return true, rp.bs.PutMany(ctx, blks)
+	case "deletemany":
+		return false, nil
+	}
+
+	c, ok := rp.target(rec.Cid)
+	if !ok {
+		return false, nil
+	}
+	switch rec.Op {
+	case "get":
+		_, err := rp.bs.Get(ctx, c)
+		return true, err
+	case "view":
+		return true, rp.bs.View(ctx, c, func([]byte) error { return nil })
+	case "has":
+		has, err := rp.bs.Has(ctx, c)
+		if err == nil && !has {
+			err = format.ErrNotFound{Cid: c}
+		}
+		return true, err
+	case "getsize":
+		_, err := rp.bs.GetSize(ctx, c)
+		return true, err
+	case "delete":
+		return true, rp.bs.DeleteBlock(ctx, c)
+	default:
+		return false, nil
+	}
+}
+
+// target returns the CID to use in place of the recorded one.
+func (rp *replayer) target(recorded string) (cid.Cid, bool) {
+	if c, ok := rp.written[recorded]; ok {
+		return c, true
+	}
+	c, err := cid.Decode(recorded)
+	return c, err == nil
+}
+
+// synthesize returns a block of the given size whose content is derived
+// from seed, so that replays are reproducible.
+func synthesize(seed string, size int) blocks.Block {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(seed))
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(h.Sum64()))).Read(data)
+	return blocks.NewBlock(data)
+}
@@ -0,0 +1,82 @@
+package measure
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WithLatencyReservoir keeps a uniform random sample of up to size call
+// latencies per operation, from which Percentile computes exact
+// percentiles. The histograms only locate a percentile within a bucket,
+// which is too coarse for the rare slow calls making the p99 and p999.
+// The sample is maintained with Vitter's algorithm R, so it is drawn
+// from every call since the wrapper was created and costs one random
+// number per call once full.
+func WithLatencyReservoir(size int) Option {
+	return func(cfg *config) {
+		cfg.reservoirSize = size
+	}
+}
+
+type reservoir struct {
+	mu      sync.Mutex
+	seen    int64
+	samples []time.Duration
+}
+
+func newReservoirs(size int) map[Op]*reservoir {
+	rs := make(map[Op]*reservoir)
+	for _, op := range []Op{OpPut, OpPutMany, OpGet, OpHas, OpGetSize, OpDelete, OpDeleteMany, OpView} {
+		rs[op] = &reservoir{samples: make([]time.Duration, 0, size)}
+	}
+	return rs
+}
+
+// add offers d to the sample.
+func (r *reservoir) add(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen++
+	if len(r.samples) < cap(r.samples) {
+		r.samples = append(r.samples, d)
+		return
+	}
+	if i := rand.Int63n(r.seen); i < int64(len(r.samples)) {
+		r.samples[i] = d
+	}
+}
+
+// observeReservoir offers the latency of a call of op started at start to
+// the sample of op.
+func (m *measure) observeReservoir(op Op, start time.Time) {
+	if r, ok := m.reservoirs[op]; ok {
+		r.add(m.clock.Now().Sub(start))
+	}
+}
+
+// Percentile returns the q-th percentile (0 <= q <= 1) of the latencies
+// of op sampled by WithLatencyReservoir, using the nearest-rank method.
+// It returns 0 when latencies aren't sampled or op wasn't called yet.
+func (m *measure) Percentile(op Op, q float64) time.Duration {
+	r, ok := m.reservoirs[op]
+	if !ok {
+		return 0
+	}
+	r.mu.Lock()
+	samples := append([]time.Duration(nil), r.samples...)
+	r.mu.Unlock()
+	if len(samples) == 0 {
+		return 0
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	i := int(math.Ceil(q*float64(len(samples)))) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(samples) {
+		i = len(samples) - 1
+	}
+	return samples[i]
+}
@@ -0,0 +1,28 @@
+package measure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestReservoirPercentile(t *testing.T) {
+	m := New("rs", testutil.New(), WithLatencyReservoir(1000))
+	r := m.reservoirs[OpGet]
+	for i := 1; i <= 1000; i++ {
+		r.add(time.Duration(i) * time.Millisecond)
+	}
+	if p := m.Percentile(OpGet, 0.99); p != 990*time.Millisecond {
+		t.Fatal(p)
+	}
+	for i := 1; i <= 100000; i++ {
+		r.add(time.Duration(i%1000+1) * time.Millisecond)
+	}
+	if p := m.Percentile(OpGet, 0.99); p < 970*time.Millisecond || p > 1000*time.Millisecond {
+		t.Fatal(p)
+	}
+	if New("rs2", testutil.New()).Percentile(OpGet, 0.99) != 0 {
+		t.Fatal("disabled")
+	}
+}
@@ -0,0 +1,182 @@
+package measure
+
+import (
+	"sort"
+	"sync"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// SetLabel is the label naming the member of a Set a metric belongs to.
+const SetLabel = "store"
+
+// LabeledRecorder is implemented by Recorders that support labels.
+// WithLabel returns a Recorder adding the label name=value to every
+// update it receives.
+type LabeledRecorder interface {
+	Recorder
+	WithLabel(name, value string) Recorder
+}
+
+// Set measures several blockstores sharing one set of metric names, for
+// example the shards of a store. Each member is wrapped with New and
+// records under the SetLabel label set to its name, which Stats reports
+// in Labels. When metrics are pushed to a Recorder that doesn't
+// implement LabeledRecorder, which includes the default
+// go-metrics-interface one, labels can't be expressed and each member
+// uses the prefix <prefix>.<name> instead.
+//
+// Members can be added and removed while the set is in use.
+//
+// The set itself reports in <prefix>.shard.latency_skew the mean Get
+// latency of its slowest member over that of its fastest, see
+// LatencySkew.
+type Set struct {
+	prefix  string
+	opts    []Option
+	labeled bool
+	skew    metrics.Gauge
+
+	mu      sync.Mutex
+	members map[string]*measure
+}
+
+// NewSet returns a set measuring stores, keyed by name, with the given
+// prefix and options.
+func NewSet(prefix string, stores map[string]blockstore.Blockstore, opts ...Option) *Set {
+	cfg := defaultConfig()
+	for _, o := range opts {
+		o(&cfg)
+	}
+	_, labeled := cfg.recorder.(LabeledRecorder)
+	s := &Set{
+		prefix:  prefix,
+		opts:    opts,
+		labeled: labeled || !cfg.push,
+		skew: newRegistry(prefix, cfg.newRecorder()).gauge("shard.latency_skew",
+			"Mean Get latency of the slowest member of the set over that of the fastest"),
+		members: make(map[string]*measure, len(stores)),
+	}
+	for name, bs := range stores {
+		s.Add(name, bs)
+	}
+	return s
+}
+
+// Add wraps bs as the member called name and returns the wrapper. A
+// member with the same name is replaced; it is not closed.
+func (s *Set) Add(name string, bs blockstore.Blockstore) *measure {
+	var m *measure
+	if s.labeled {
+		m = New(s.prefix, bs, append(s.opts[:len(s.opts):len(s.opts)], withLabel(SetLabel, name))...)
+	} else {
+		m = New(s.prefix+"."+name, bs, s.opts...)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.members[name] = m
+	return m
+}
+
+// Remove takes the member called name out of the set and returns it, or
+// nil if there is none. It is not closed.
+func (s *Set) Remove(name string) *measure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.members[name]
+	delete(s.members, name)
+	return m
+}
+
+// Get returns the member called name, or nil if there is none.
+func (s *Set) Get(name string) *measure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.members[name]
+}
+
+// Names returns the names of the members, sorted.
+func (s *Set) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.members))
+	for name := range s.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stats returns a snapshot of the metrics of every member, in the order
+// of Names. It also refreshes shard.latency_skew.
+func (s *Set) Stats() []Stats {
+	names := s.Names()
+	stats := make([]Stats, 0, len(names))
+	for _, name := range names {
+		if m := s.Get(name); m != nil {
+			stats = append(stats, m.Stats())
+		}
+	}
+	if skew := latencySkew(stats); skew > 0 {
+		s.skew.Set(skew)
+	}
+	return stats
+}
+
+// Snapshot is Stats with the Snapshot of every member, leaving
+// shard.latency_skew alone.
+func (s *Set) Snapshot() []Stats {
+	names := s.Names()
+	stats := make([]Stats, 0, len(names))
+	for _, name := range names {
+		if m := s.Get(name); m != nil {
+			stats = append(stats, m.Snapshot())
+		}
+	}
+	return stats
+}
+
+// LatencySkew returns the mean Get latency of the slowest member over
+// that of the fastest, among the members that served Gets, and sets it in
+// shard.latency_skew. Far above 1, one member is hot or degraded. It
+// returns 0 until at least two members served Gets.
+func (s *Set) LatencySkew() float64 {
+	return latencySkew(s.Stats())
+}
+
+func latencySkew(stats []Stats) float64 {
+	var slowest, fastest float64
+	n := 0
+	for _, st := range stats {
+		h, ok := st.Histograms["get.latency_seconds"]
+		if !ok {
+			h = st.Histograms["get.latency_milliseconds"]
+		}
+		if h.Count == 0 {
+			continue
+		}
+		mean := h.Sum / float64(h.Count)
+		if n == 0 || mean > slowest {
+			slowest = mean
+		}
+		if n == 0 || mean < fastest {
+			fastest = mean
+		}
+		n++
+	}
+	if n < 2 || fastest <= 0 {
+		return 0
+	}
+	return slowest / fastest
+}
+
+// withLabel makes the wrapper record under the label name=value.
+func withLabel(name, value string) Option {
+	return func(cfg *config) {
+		cfg.labels = map[string]string{name: value}
+		if lr, ok := cfg.recorder.(LabeledRecorder); ok {
+			cfg.recorder = lr.WithLabel(name, value)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package measure
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type labRec struct {
+	mu     sync.Mutex
+	label  string
+	counts map[string]float64
+}
+
+func (r *labRec) IncCounter(name string, d float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[name+"{"+r.label+"}"] += d
+}
+func (r *labRec) ObserveHistogram(string, float64) {}
+func (r *labRec) SetGauge(string, float64)         {}
+func (r *labRec) WithLabel(n, v string) Recorder {
+	return &labRec{label: n + "=" + v, counts: r.counts}
+}
+
+func TestSet(t *testing.T) {
+	ctx := context.Background()
+	rec := &labRec{counts: map[string]float64{}}
+	s := NewSet("shards", map[string]blockstore.Blockstore{"a": testutil.New(), "b": testutil.New()}, WithRecorder(rec))
+	s.Get("a").Put(ctx, blocks.NewBlock([]byte("x")))
+	s.Add("c", testutil.New()).Put(ctx, blocks.NewBlock([]byte("y")))
+	if rec.counts["shards.put_total{store=a}"] != 1 || rec.counts["shards.put_total{store=c}"] != 1 {
+		t.Fatal(rec.counts)
+	}
+	st := s.Stats()
+	if len(st) != 3 || st[0].Labels["store"] != "a" || st[0].Prefix != "shards" {
+		t.Fatal(st[0].Labels)
+	}
+	if s.Remove("b") == nil || len(s.Names()) != 2 {
+		t.Fatal(s.Names())
+	}
+	f := NewSet("fb", map[string]blockstore.Blockstore{"a": testutil.New()})
+	if st := f.Stats(); st[0].Prefix != "fb.a" || st[0].Labels != nil {
+		t.Fatal(st[0].Prefix)
+	}
+}
+
+func TestSetLatencySkew(t *testing.T) {
+	ctx := context.Background()
+	fast, slow := testutil.New(), testutil.New()
+	s := NewSet("sk", map[string]blockstore.Blockstore{"fast": fast, "slow": slow}, WithoutPushMetrics())
+	b := mkBlocks(1)[0]
+	fast.Put(ctx, b)
+	slow.Put(ctx, b)
+	for _, name := range []string{"fast", "slow"} {
+		s.Get(name).Get(ctx, b.Cid()) // cold start
+	}
+	slow.SetLatency(testutil.Get, testutil.Fixed(20*time.Millisecond))
+	for i := 0; i < 3; i++ {
+		s.Get("fast").Get(ctx, b.Cid())
+		s.Get("slow").Get(ctx, b.Cid())
+	}
+	if skew := s.LatencySkew(); skew < 10 {
+		t.Fatal(skew)
+	}
+}
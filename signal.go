@@ -0,0 +1,89 @@
+package measure
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// String renders the snapshot as text, one metric per line sorted by
+// name, histograms being summarised by their count, mean and 50th and
+// 99th percentiles.
+func (s Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "measure %s", s.Prefix)
+	if s.Backend != "" {
+		fmt.Fprintf(&b, " (%s)", s.Backend)
+	}
+	b.WriteByte('\n')
+	for _, name := range sortedKeys(s.Counters) {
+		fmt.Fprintf(&b, "%s %g\n", name, s.Counters[name])
+	}
+	for _, name := range sortedKeys(s.Gauges) {
+		fmt.Fprintf(&b, "%s %g\n", name, s.Gauges[name])
+	}
+	names := make([]string, 0, len(s.Histograms))
+	for name := range s.Histograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h := s.Histograms[name]
+		fmt.Fprintf(&b, "%s count=%d mean=%g p50=%g p99=%g\n",
+			name, h.Count, h.Mean(), h.Quantile(0.5), h.Quantile(0.99))
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SignalDump is a handler installed with InstallSignalDump.
+type SignalDump struct {
+	ch   chan os.Signal
+	done chan struct{}
+	once sync.Once
+}
+
+// InstallSignalDump passes the text of Stats to logger every time the
+// process receives sig, such as syscall.SIGUSR1, for inspection without
+// a scrape endpoint. The handler is registered with signal.Notify on a
+// channel of its own, so handlers of the application for the same
+// signal, and those of other wrappers, keep receiving it. Note that, as
+// with any use of signal.Notify, the signal stops having its default
+// effect until every handler for it is removed.
+func (m *measure) InstallSignalDump(sig os.Signal, logger func(string)) *SignalDump {
+	d := &SignalDump{
+		ch:   make(chan os.Signal, 1),
+		done: make(chan struct{}),
+	}
+	signal.Notify(d.ch, sig)
+	go func() {
+		for {
+			select {
+			case <-d.ch:
+				logger(m.Stats().String())
+			case <-d.done:
+				return
+			}
+		}
+	}()
+	return d
+}
+
+// Uninstall removes the handler. Dumps already started complete.
+func (d *SignalDump) Uninstall() {
+	d.once.Do(func() {
+		signal.Stop(d.ch)
+		close(d.done)
+	})
+}
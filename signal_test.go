@@ -0,0 +1,31 @@
+package measure
+
+import (
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestSignalDump(t *testing.T) {
+	m := New("sig", testutil.New())
+	m.Put(context.Background(), blocks.NewBlock([]byte("s")))
+	got := make(chan string, 1)
+	d := m.InstallSignalDump(syscall.SIGUSR1, func(s string) { got <- s })
+	defer d.Uninstall()
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	select {
+	case s := <-got:
+		if !strings.Contains(s, "put_total 1\n") || !strings.Contains(s, "cold_start.latency_seconds count=1") {
+			t.Fatal(s)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no dump")
+	}
+	d.Uninstall()
+}
@@ -0,0 +1,182 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithReadSingleflight makes concurrent Get and View calls for the same
+// CID share a single backend read. Calls that joined a read already in
+// progress are counted in get.coalesced_total, and get.shared_keys
+// tracks how many CIDs currently have such calls waiting.
+//
+// Errors, including not-found, are returned to every waiting call. Each
+// waiting Get receives its own copy of the block data, and each View
+// callback is invoked with the data. If the read fails because the
+// context of the call that started it was canceled, waiters whose own
+// context is still live retry the read themselves.
+func WithReadSingleflight() Option {
+	return func(cfg *config) {
+		cfg.singleflight = true
+	}
+}
+
+// WithGetCoalescing is WithReadSingleflight, named after the Get calls
+// it coalesces.
+func WithGetCoalescing() Option {
+	return WithReadSingleflight()
+}
+
+type flight struct {
+	done    chan struct{}
+	waiters int
+	// data and err are set before done is closed.
+	data []byte
+	err  error
+}
+
+type flightGroup struct {
+	coalesced metrics.Counter
+	shared    metrics.Gauge
+
+	mu      sync.Mutex
+	flights map[cid.Cid]*flight
+}
+
+func newFlightGroup(r *registry) *flightGroup {
+	return &flightGroup{
+		coalesced: r.counter("get.coalesced_total", "Number of Get and View calls that shared a read already in progress"),
+		shared:    r.gauge("get.shared_keys", "Number of CIDs with a read currently shared by several calls"),
+		flights:   make(map[cid.Cid]*flight),
+	}
+}
+
+// do runs read for c unless a read for c is already in progress, in
+// which case it waits for that one. read returns data owned by the
+// flight; do returns it as is to the caller that ran read, and a copy to
+// the others (owned reports which).
+func (g *flightGroup) do(ctx context.Context, c cid.Cid, read func() ([]byte, error)) (data []byte, owned bool, err error) {
+	g.mu.Lock()
+	if f, ok := g.flights[c]; ok {
+		f.waiters++
+		if f.waiters == 1 {
+			g.shared.Inc()
+		}
+		g.mu.Unlock()
+		g.coalesced.Inc()
+
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+		if isContextErr(f.err) && ctx.Err() == nil {
+			// The caller that started the read gave up, we didn't.
+			data, err = read()
+			return data, true, err
+		}
+		if f.err != nil {
+			return nil, false, f.err
+		}
+		return append([]byte(nil), f.data...), false, nil
+	}
+	// errReadAborted is only seen by waiters if read panics.
+	f := &flight{done: make(chan struct{}), err: errReadAborted}
+	g.flights[c] = f
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.flights, c)
+		if f.waiters > 0 {
+			g.shared.Dec()
+		}
+		g.mu.Unlock()
+		close(f.done)
+	}()
+	f.data, f.err = read()
+	return f.data, true, f.err
+}
+
+var errReadAborted = errors.New("measure: shared read aborted")
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// readBlock gets c from the backend, going through the read cache and
+// sharing the read with concurrent callers when those are enabled. start
+// is when the calling operation started.
+func (m *measure) readBlock(ctx context.Context, c cid.Cid, start time.Time) (blocks.Block, error) {
+	if m.cache != nil {
+		return m.cachedRead(c, start, func() (blocks.Block, error) {
+			return m.sharedRead(ctx, c)
+		})
+	}
+	return m.sharedRead(ctx, c)
+}
+
+func (m *measure) sharedRead(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if m.flights == nil {
+		return m.backendGet(ctx, c)
+	}
+	var blk blocks.Block
+	data, owned, err := m.flights.do(ctx, c, func() ([]byte, error) {
+		var err error
+		blk, err = m.backendGet(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		return blk.RawData(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if owned && blk != nil {
+		return blk, nil
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
+
+// viewBlock is View on the backend, going through the read cache and
+// sharing the read with concurrent callers when those are enabled. The
+// backend's buffer is only valid during its callback, so it is copied
+// when it has to outlive it.
+func (m *measure) viewBlock(ctx context.Context, v bsViewer, c cid.Cid, f func([]byte) error, start time.Time) error {
+	if m.cache != nil {
+		if blk, ok := m.cache.get(c); ok {
+			defer recordLatency(m.clock, m.cache.hitLatency, start)
+			return f(blk.RawData())
+		}
+		defer recordLatency(m.clock, m.cache.missLatency, start)
+		gen := m.cache.generation()
+		inner := f
+		f = func(data []byte) error {
+			if blk, err := blocks.NewBlockWithCid(append([]byte(nil), data...), c); err == nil {
+				m.cache.add(blk, gen)
+			}
+			return inner(data)
+		}
+	}
+	if m.flights == nil {
+		return v.View(ctx, c, f)
+	}
+	data, _, err := m.flights.do(ctx, c, func() ([]byte, error) {
+		var data []byte
+		err := v.View(ctx, c, func(b []byte) error {
+			data = append([]byte(nil), b...)
+			return nil
+		})
+		return data, err
+	})
+	if err != nil {
+		return err
+	}
+	return f(data)
+}
@@ -0,0 +1,126 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+// concurrentGets runs n simultaneous Gets of c.
+func concurrentGets(m *measure, c cid.Cid, n int) ([]blocks.Block, []error) {
+	blks, errs := make([]blocks.Block, n), make([]error, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			blks[i], errs[i] = m.Get(context.Background(), c)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return blks, errs
+}
+
+func TestGetCoalescing(t *testing.T) {
+	const n = 50
+	ctx := context.Background()
+	fb := testutil.New()
+	fb.SetLatency(testutil.Get, testutil.Fixed(200*time.Millisecond))
+	m := New("test", fb.Plain(), WithGetCoalescing())
+	blk := mkBlocks(1)[0]
+	fb.Put(ctx, blk)
+	// The caller that runs the read gets the backend's own block.
+	want := append([]byte(nil), blk.RawData()...)
+
+	blks, errs := concurrentGets(m, blk.Cid(), n)
+	if fb.Count(testutil.Get) != 1 {
+		t.Fatalf("backend saw %d Gets, want 1", fb.Count(testutil.Get))
+	}
+	for i := range blks {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if !bytes.Equal(blks[i].RawData(), want) {
+			t.Fatalf("caller %d got %q", i, blks[i].RawData())
+		}
+	}
+	// Callers don't share the block data.
+	blks[0].RawData()[0] ^= 0xff
+	for _, b := range blks[1:] {
+		if !bytes.Equal(b.RawData(), want) {
+			t.Fatal("a change to one caller's block is seen by another")
+		}
+	}
+	if got := statCounter(m, "get.coalesced_total"); got != n-1 {
+		t.Fatalf("get.coalesced_total = %v, want %d", got, n-1)
+	}
+	if got := statGauge(m, "get.shared_keys"); got != 0 {
+		t.Fatalf("get.shared_keys = %v after the reads, want 0", got)
+	}
+
+	// Errors reach every caller, and a later Get reads again.
+	missing := mkBlocks(2)[1]
+	_, errs = concurrentGets(m, missing.Cid(), n)
+	for _, err := range errs {
+		if !format.IsNotFound(err) {
+			t.Fatalf("got %v, want not found", err)
+		}
+	}
+	if fb.Count(testutil.Get) != 2 {
+		t.Fatalf("backend saw %d Gets, want 2", fb.Count(testutil.Get))
+	}
+	if _, err := m.Get(ctx, blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if fb.Count(testutil.Get) != 3 {
+		t.Fatal("a finished read was shared")
+	}
+}
+
+func TestSingleflight(t *testing.T) {
+	mem := testutil.New()
+	mem.SetLatency(testutil.Get, testutil.Fixed(50*time.Millisecond))
+	m := New("sf", mem, WithReadSingleflight())
+	blk := blocks.NewBlock([]byte("hello"))
+	mem.Put(context.Background(), blk)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := m.Get(context.Background(), blk.Cid())
+			if err != nil || string(got.RawData()) != "hello" {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if mem.Count(testutil.Get) >= 10 || m.Stats().Counters["get.coalesced_total"] == 0 {
+		t.Fatal(mem.Calls(), m.Stats().Counters)
+	}
+	missing := blocks.NewBlock([]byte("nope")).Cid()
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Get(context.Background(), missing); !format.IsNotFound(err) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if m.Stats().Gauges["get.shared_keys"] != 0 {
+		t.Fatal("gauge")
+	}
+}
@@ -0,0 +1,105 @@
+package measure
+
+import (
+	"context"
+	"math/rand"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithGetSizeCheck verifies a sampled fraction (0 to 1) of successful
+// GetSize calls by also fetching the block and comparing the reported
+// size with the length of its data. Disagreements are counted in
+// getsize.mismatch_total and their magnitude observed in
+// getsize.mismatch_delta_bytes.
+//
+// The block is read with View when the backend supports it, and Get
+// otherwise. That extra read is recorded in getsize.check.latency_seconds,
+// not in the get or view latencies.
+//
+// This is a diagnostic for backends whose GetSize is an estimate, or
+// goes stale. Every sampled call reads the whole block on top of the
+// GetSize, so keep the rate low on busy stores.
+func WithGetSizeCheck(sampleRate float64, opts ...GetSizeCheckOption) Option {
+	return func(cfg *config) {
+		cfg.sizeCheckRate = sampleRate
+		for _, o := range opts {
+			o(cfg)
+		}
+	}
+}
+
+// GetSizeCheckOption configures WithGetSizeCheck.
+type GetSizeCheckOption func(*config)
+
+// LogSizeMismatches reports every disagreement found by WithGetSizeCheck
+// to logf, with the CID and both sizes.
+func LogSizeMismatches(logf func(format string, args ...interface{})) GetSizeCheckOption {
+	return func(cfg *config) {
+		cfg.sizeCheckLogf = logf
+	}
+}
+
+type sizeChecker struct {
+	rate     float64
+	logf     func(format string, args ...interface{})
+	mismatch metrics.Counter
+	delta    metrics.Histogram
+	latency  metrics.Histogram
+}
+
+func newSizeChecker(r *registry, rate float64, logf func(string, ...interface{})) *sizeChecker {
+	return &sizeChecker{
+		rate:     rate,
+		logf:     logf,
+		mismatch: r.counter("getsize.mismatch_total", "Number of sampled GetSize calls that disagreed with the block length"),
+		delta: r.histogram("getsize.mismatch_delta_bytes",
+			"Distribution of the absolute difference between GetSize and the block length", datastoreSizeBuckets),
+		latency: r.latency("getsize.check.latency",
+			"Latency distribution of the reads checking GetSize results"),
+	}
+}
+
+// checkSize compares size, as reported by GetSize for c, with the actual
+// block length on a sample of calls.
+func (m *measure) checkSize(ctx context.Context, c cid.Cid, size int) {
+	if m.sizeCheck == nil || rand.Float64() >= m.sizeCheck.rate {
+		return
+	}
+	actual, err := m.blockLength(ctx, c)
+	if err != nil {
+		// Deleted in between, or failing: nothing to compare.
+		return
+	}
+	delta := actual - size
+	if delta == 0 {
+		return
+	}
+	if delta < 0 {
+		delta = -delta
+	}
+	m.sizeCheck.mismatch.Inc()
+	m.sizeCheck.delta.Observe(float64(delta))
+	if m.sizeCheck.logf != nil {
+		m.sizeCheck.logf("measure: GetSize(%s) returned %d, block is %d bytes", m.cidFormat(c), size, actual)
+	}
+}
+
+// blockLength reads the length of the data of c from the backend.
+func (m *measure) blockLength(ctx context.Context, c cid.Cid) (int, error) {
+	defer recordLatency(m.clock, m.sizeCheck.latency, m.clock.Now())
+	if m.viewer != nil {
+		var n int
+		err := m.viewer.View(ctx, c, func(data []byte) error {
+			n = len(data)
+			return nil
+		})
+		return n, err
+	}
+	blk, err := m.backend.Get(ctx, c)
+	if err != nil {
+		return 0, err
+	}
+	return len(blk.RawData()), nil
+}
@@ -0,0 +1,37 @@
+package measure
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type staleSizeBS struct{ *testutil.Blockstore }
+
+func (s staleSizeBS) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	n, err := s.Blockstore.GetSize(ctx, c)
+	return n + 3, err
+}
+
+func TestGetSizeCheck(t *testing.T) {
+	ctx := context.Background()
+	var logged []string
+	m := New("sc", staleSizeBS{testutil.New()}, WithGetSizeCheck(1, LogSizeMismatches(func(f string, a ...interface{}) {
+		logged = append(logged, fmt.Sprintf(f, a...))
+	})))
+	b := blocks.NewBlock([]byte("hello"))
+	m.Put(ctx, b)
+	m.GetSize(ctx, b.Cid())
+	st := m.Stats()
+	if st.Counters["getsize.mismatch_total"] != 1 || len(logged) != 1 || st.Histograms["getsize.check.latency_seconds"].Count != 1 {
+		t.Fatal(st.Counters, logged)
+	}
+	if st.Counters["get_total"] != 0 {
+		t.Fatal("counted as get")
+	}
+}
@@ -0,0 +1,62 @@
+package measure
+
+import (
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// Size classes of WithSizeClassLatency, with the sizes of the blocks
+// they hold.
+var sizeClasses = []struct {
+	name string
+	max  int // exclusive, 0 for no limit
+}{
+	{"small", 4 << 10},
+	{"medium", 256 << 10},
+	{"large", 0},
+}
+
+// WithSizeClassLatency also records the latency of successful Put, Get,
+// GetSize and View calls by the size of the block they handled, in
+// <op>.small.latency_seconds for blocks under 4KiB,
+// <op>.medium.latency_seconds for blocks under 256KiB and
+// <op>.large.latency_seconds for the others, so that slow large reads
+// can be told from slow small ones. The aggregate histograms are
+// unchanged.
+func WithSizeClassLatency() Option {
+	return func(cfg *config) {
+		cfg.sizeClassLatency = true
+	}
+}
+
+// newSizeClassLatencies returns the histograms of WithSizeClassLatency,
+// indexed like sizeClasses.
+func newSizeClassLatencies(r *registry) map[Op][]metrics.Histogram {
+	hs := make(map[Op][]metrics.Histogram)
+	for _, op := range []Op{OpPut, OpGet, OpGetSize, OpView} {
+		for _, class := range sizeClasses {
+			hs[op] = append(hs[op], r.latency(string(op)+"."+class.name+".latency",
+				"Latency distribution of calls handling blocks of one size class"))
+		}
+	}
+	return hs
+}
+
+// observeSizeClass records the latency of a successful op that handled
+// a block of size bytes in the histogram of its size class.
+func (m *measure) observeSizeClass(op Op, size *int, start time.Time, err error) {
+	if m.sizeClassLatencies == nil || size == nil || err != nil {
+		return
+	}
+	hs, ok := m.sizeClassLatencies[op]
+	if !ok {
+		return
+	}
+	for i, class := range sizeClasses {
+		if class.max == 0 || *size < class.max {
+			recordLatency(m.clock, hs[i], start)
+			return
+		}
+	}
+}
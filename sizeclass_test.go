@@ -0,0 +1,27 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestSizeClassLatency(t *testing.T) {
+	ctx := context.Background()
+	m := New("sc", testutil.New(), WithSizeClassLatency())
+	small := blocks.NewBlock([]byte("s"))
+	large := blocks.NewBlock(make([]byte, 300<<10))
+	m.Put(ctx, small)
+	m.Put(ctx, large)
+	m.Get(ctx, small.Cid())
+	m.Get(ctx, large.Cid())
+	m.Get(ctx, large.Cid())
+	m.Get(ctx, blocks.NewBlock([]byte("missing")).Cid())
+	h := m.Stats().Histograms
+	if h["get.small.latency_seconds"].Count != 1 || h["get.large.latency_seconds"].Count != 2 || h["get.medium.latency_seconds"].Count != 0 || h["put.small.latency_seconds"].Count != 1 {
+		t.Fatal(h["get.small.latency_seconds"], h["get.large.latency_seconds"])
+	}
+}
@@ -0,0 +1,75 @@
+package measure
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// sizeEntropyEvery is how often writes refresh put.size_entropy.
+const sizeEntropyEvery = time.Second
+
+// WithSizeEntropy reports in the put.size_entropy gauge the Shannon
+// entropy, in bits, of the sizes of the blocks written by Put, taking
+// the buckets of put.size_bytes as categories. It is 0 when all the
+// blocks fall in the same bucket, which favours fixed-size optimizations,
+// and grows as sizes vary, up to the base 2 logarithm of the number of
+// buckets. It is refreshed by Stats and at most once a second by Puts.
+func WithSizeEntropy() Option {
+	return func(cfg *config) {
+		cfg.sizeEntropy = true
+	}
+}
+
+type sizeEntropy struct {
+	entropy metrics.Gauge
+	// last is the UnixNano time of the last refresh by a write.
+	last int64 // updated atomically
+}
+
+func newSizeEntropy(r *registry) *sizeEntropy {
+	return &sizeEntropy{
+		entropy: r.gauge("put.size_entropy",
+			"Shannon entropy in bits of the distribution of written block sizes over the put.size_bytes buckets"),
+	}
+}
+
+// refreshSizeEntropy sets put.size_entropy from put.size_bytes.
+func (m *measure) refreshSizeEntropy() {
+	if m.sizeEntropy == nil {
+		return
+	}
+	h, ok := m.putSize.(*histogram)
+	if !ok {
+		return
+	}
+	s := h.snapshot()
+	if s.Count == 0 {
+		return
+	}
+	var entropy float64
+	for _, n := range s.Counts {
+		if n == 0 {
+			continue
+		}
+		p := float64(n) / float64(s.Count)
+		entropy -= p * math.Log2(p)
+	}
+	m.sizeEntropy.entropy.Set(entropy)
+}
+
+// observeSizeEntropy refreshes put.size_entropy after a write if it
+// wasn't in the last sizeEntropyEvery.
+func (m *measure) observeSizeEntropy() {
+	if m.sizeEntropy == nil {
+		return
+	}
+	now := m.clock.Now().UnixNano()
+	last := atomic.LoadInt64(&m.sizeEntropy.last)
+	if now-last < int64(sizeEntropyEvery) || !atomic.CompareAndSwapInt64(&m.sizeEntropy.last, last, now) {
+		return
+	}
+	m.refreshSizeEntropy()
+}
@@ -0,0 +1,28 @@
+package measure
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestSizeEntropy(t *testing.T) {
+	ctx := context.Background()
+	uniform := New("u", testutil.New(), WithSizeEntropy())
+	varied := New("v", testutil.New(), WithSizeEntropy())
+	sizes := []int{10, 100, 5000, 300000}
+	for i := 0; i < 8; i++ {
+		uniform.Put(ctx, blocks.NewBlock([]byte(fmt.Sprintf("%099d", i))))
+		varied.Put(ctx, blocks.NewBlock([]byte(fmt.Sprint(i)+strings.Repeat("x", sizes[i%4]))))
+	}
+	u, v := uniform.Stats().Gauges["put.size_entropy"], varied.Stats().Gauges["put.size_entropy"]
+	if u != 0 || math.Abs(v-2) > 1e-9 {
+		t.Fatal(u, v)
+	}
+}
@@ -0,0 +1,27 @@
+package measure
+
+import (
+	blocks "github.com/ipfs/go-block-format"
+)
+
+// WithSizeEstimator makes the size histograms, put.size_bytes and
+// get.size_bytes, and the sizes reported to the journal
+// use the size estimate returns for a block instead of the length of
+// its data. The length of the data is the logical size of the block;
+// estimate can return its physical size instead, as stored by the
+// backend with framing, padding or compression, which is what matters
+// for capacity planning. Sizes known only as data, such as those of
+// View, stay logical.
+func WithSizeEstimator(estimate func(blocks.Block) int) Option {
+	return func(cfg *config) {
+		cfg.sizeEstimator = estimate
+	}
+}
+
+// blockSize returns the size of blk recorded in size observations.
+func (m *measure) blockSize(blk blocks.Block) int {
+	if m.sizeEstimator != nil {
+		return m.sizeEstimator(blk)
+	}
+	return len(blk.RawData())
+}
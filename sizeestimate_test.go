@@ -0,0 +1,22 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestSizeEstimator(t *testing.T) {
+	ctx := context.Background()
+	m := New("se", testutil.New(), WithSizeEstimator(func(b blocks.Block) int { return len(b.RawData()) + 100 }))
+	b := blocks.NewBlock([]byte("xyz"))
+	m.Put(ctx, b)
+	m.Get(ctx, b.Cid())
+	h := m.Stats().Histograms
+	if h["put.size_bytes"].Sum != 103 || h["get.size_bytes"].Sum != 103 {
+		t.Fatal(h["put.size_bytes"], h["get.size_bytes"])
+	}
+}
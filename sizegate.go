@@ -0,0 +1,19 @@
+package measure
+
+// WithLatencyThresholdSize only records the latency of Put, Get, GetSize
+// and View calls handling blocks of at least n bytes. Counters and size
+// histograms still cover every call, so the latency histograms of these
+// operations then count fewer samples than <op>_total. Failed calls, and
+// operations without a single block size such as Has, DeleteBlock and
+// the batch operations, are always recorded.
+func WithLatencyThresholdSize(n int) Option {
+	return func(cfg *config) {
+		cfg.latencyMinSize = n
+	}
+}
+
+// belowLatencyThreshold reports whether the latency of a successful call
+// that handled a block of *size bytes should be left out.
+func (m *measure) belowLatencyThreshold(size *int, err error) bool {
+	return m.latencyMinSize > 0 && size != nil && err == nil && *size < m.latencyMinSize
+}
@@ -0,0 +1,30 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestLatencyThresholdSize(t *testing.T) {
+	ctx := context.Background()
+	m := New("lt", testutil.New(), WithLatencyThresholdSize(100))
+	small, large := blocks.NewBlock([]byte("s")), blocks.NewBlock(bytes.Repeat([]byte("l"), 200))
+	m.Put(ctx, large) // cold start
+	m.Put(ctx, small)
+	m.Put(ctx, large)
+	m.Get(ctx, small.Cid())
+	m.Get(ctx, large.Cid())
+	m.Get(ctx, large.Cid())
+	st := m.Stats()
+	if st.Counters["put_total"] != 3 || st.Histograms["put.latency_seconds"].Count != 1 {
+		t.Fatal(st.Histograms["put.latency_seconds"])
+	}
+	if st.Histograms["get.latency_seconds"].Count != 1 {
+		t.Fatal(st.Histograms["get.latency_seconds"])
+	}
+}
@@ -0,0 +1,55 @@
+package measure
+
+import (
+	"time"
+
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithSLOTarget counts the successful calls of op that completed within
+// target in <op>.slo_met_total and the others in <op>.slo_missed_total,
+// giving latency SLOs an exact numerator and denominator. Not-found
+// counts as a success; failed calls are left out. It can be given once
+// per operation, the last target for an operation winning.
+func WithSLOTarget(op Op, target time.Duration) Option {
+	return func(cfg *config) {
+		if cfg.sloTargets == nil {
+			cfg.sloTargets = make(map[Op]time.Duration)
+		}
+		cfg.sloTargets[op] = target
+	}
+}
+
+type sloTarget struct {
+	target time.Duration
+	met    metrics.Counter
+	missed metrics.Counter
+}
+
+func newSLOTargets(r *registry, targets map[Op]time.Duration) map[Op]*sloTarget {
+	slos := make(map[Op]*sloTarget, len(targets))
+	for op, target := range targets {
+		slos[op] = &sloTarget{
+			target: target,
+			met: r.counter(string(op)+".slo_met_total",
+				"Number of successful calls that completed within the SLO target of "+target.String()),
+			missed: r.counter(string(op)+".slo_missed_total",
+				"Number of successful calls that took longer than the SLO target of "+target.String()),
+		}
+	}
+	return slos
+}
+
+// observeSLO counts op, started at start, against its SLO target.
+func (m *measure) observeSLO(op Op, start time.Time, err error) {
+	slo, ok := m.sloTargets[op]
+	if !ok || (err != nil && !format.IsNotFound(err)) {
+		return
+	}
+	if m.clock.Now().Sub(start) <= slo.target {
+		slo.met.Inc()
+	} else {
+		slo.missed.Inc()
+	}
+}
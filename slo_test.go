@@ -0,0 +1,45 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestSLOTarget(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	fb := testutil.New()
+	fb.SetClock(clock)
+	m := New("test", fb, WithClock(clock),
+		WithSLOTarget(OpGet, 20*time.Millisecond), WithSLOTarget(OpHas, time.Second))
+	b := mkBlocks(1)[0]
+	fb.Put(ctx, b)
+
+	// A call taking exactly the target meets it.
+	for _, d := range []time.Duration{0, 20 * time.Millisecond, 21 * time.Millisecond} {
+		fb.SetLatency(testutil.Get, testutil.Fixed(d))
+		if _, err := m.Get(ctx, b.Cid()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Has(ctx, b.Cid())
+	// Failed calls don't count.
+	fb.FailCall(testutil.Get, 4, nil)
+	if _, err := m.Get(ctx, b.Cid()); err == nil {
+		t.Fatal("scheduled failure didn't happen")
+	}
+
+	for name, want := range map[string]float64{
+		"get.slo_met_total":    2,
+		"get.slo_missed_total": 1,
+		"has.slo_met_total":    1,
+		"has.slo_missed_total": 0,
+	} {
+		if got := statCounter(m, name); got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+}
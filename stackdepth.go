@@ -0,0 +1,56 @@
+package measure
+
+import (
+	"math/rand"
+	"runtime"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithSlowOpStackDepth records, for a sampled fraction (0 to 1) of
+// operations taking threshold or longer, the depth of the stack the
+// wrapper was called from in slow_op.stack_depth. Correlating it with
+// latency shows whether slowness comes with deep recursion or layers of
+// wrapping above the blockstore. Walking the stack is expensive, so this
+// is a debugging aid meant for low sample rates.
+func WithSlowOpStackDepth(threshold time.Duration, sampleRate float64) Option {
+	return func(cfg *config) {
+		cfg.stackDepthThreshold = threshold
+		cfg.stackDepthRate = sampleRate
+	}
+}
+
+// maxStackDepth bounds the frames walked; deeper stacks are recorded as
+// this deep.
+const maxStackDepth = 4096
+
+var stackDepthBuckets = []float64{8, 16, 32, 64, 128, 256, 512, 1024, 2048, maxStackDepth}
+
+type stackDepthSampler struct {
+	threshold time.Duration
+	rate      float64
+	depth     metrics.Histogram
+}
+
+func newStackDepthSampler(r *registry, threshold time.Duration, rate float64) *stackDepthSampler {
+	return &stackDepthSampler{
+		threshold: threshold,
+		rate:      rate,
+		depth: r.histogram("slow_op.stack_depth",
+			"Distribution of the stack depth of sampled slow operations", stackDepthBuckets),
+	}
+}
+
+// observeStackDepth records the stack depth of the calling operation,
+// which started at start, if it is slow and sampled.
+func (m *measure) observeStackDepth(start time.Time) {
+	s := m.stackDepth
+	if s == nil || m.clock.Now().Sub(start) < s.threshold || rand.Float64() >= s.rate {
+		return
+	}
+	pcs := make([]uintptr, maxStackDepth)
+	// Skip runtime.Callers, this function and recordOpLatency.
+	n := runtime.Callers(3, pcs)
+	s.depth.Observe(float64(n))
+}
@@ -0,0 +1,22 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestSlowOpStackDepth(t *testing.T) {
+	fb := testutil.New()
+	fb.SetLatency(testutil.Has, testutil.Fixed(5*time.Millisecond))
+	m := New("sd", fb, WithSlowOpStackDepth(time.Millisecond, 1))
+	m.Has(context.Background(), blocks.NewBlock([]byte("x")).Cid())
+	h := m.Stats().Histograms["slow_op.stack_depth"]
+	if h.Count != 1 || h.Sum < 2 {
+		t.Fatal(h)
+	}
+}
@@ -0,0 +1,71 @@
+package measure
+
+import (
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// VersionedBlock is implemented by the blocks of replicated backends
+// that return the version, or sequence number, of the copy read.
+type VersionedBlock interface {
+	blocks.Block
+	Version() uint64
+}
+
+// WithStaleReadDetection tracks the highest version returned by Get for
+// each CID, for backends returning VersionedBlocks, and counts reads
+// returning an older version in get.stale_total, which surfaces replicas
+// lagging behind. Versions are kept for at most size CIDs; when more are
+// read, an arbitrary one is forgotten.
+func WithStaleReadDetection(size int) Option {
+	return func(cfg *config) {
+		cfg.staleReadSize = size
+	}
+}
+
+type staleReads struct {
+	size  int
+	stale metrics.Counter
+
+	mu       sync.Mutex
+	versions map[cid.Cid]uint64
+}
+
+func newStaleReads(r *registry, size int) *staleReads {
+	return &staleReads{
+		size:     size,
+		stale:    r.counter("get.stale_total", "Number of reads that returned an older version of a block than previously read"),
+		versions: make(map[cid.Cid]uint64),
+	}
+}
+
+// checkStale compares the version of blk, just read, with the highest
+// seen for its CID.
+func (m *measure) checkStale(blk blocks.Block) {
+	s := m.staleReads
+	if s == nil {
+		return
+	}
+	vb, ok := blk.(VersionedBlock)
+	if !ok {
+		return
+	}
+	v, c := vb.Version(), blk.Cid()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen, ok := s.versions[c]
+	switch {
+	case ok && v < seen:
+		s.stale.Inc()
+		return
+	case !ok && len(s.versions) >= s.size:
+		for old := range s.versions {
+			delete(s.versions, old)
+			break
+		}
+	}
+	s.versions[c] = v
+}
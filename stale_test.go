@@ -0,0 +1,49 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type versionedBlock struct {
+	blocks.Block
+	v uint64
+}
+
+func (b versionedBlock) Version() uint64 { return b.v }
+
+type replicaBS struct {
+	*testutil.Blockstore
+	versions []uint64
+}
+
+func (r *replicaBS) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := r.Blockstore.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	v := r.versions[0]
+	r.versions = r.versions[1:]
+	return versionedBlock{blk, v}, nil
+}
+
+func TestStaleReads(t *testing.T) {
+	ctx := context.Background()
+	bs := &replicaBS{Blockstore: testutil.New(), versions: []uint64{1, 3, 2, 3, 4}}
+	m := New("st", bs, WithStaleReadDetection(16))
+	b := mkBlocks(1)[0]
+	bs.Blockstore.Put(ctx, b)
+	for i := 0; i < 5; i++ {
+		if _, err := m.Get(ctx, b.Cid()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := m.Stats().Counters["get.stale_total"]; n != 1 {
+		t.Fatal(n)
+	}
+}
@@ -0,0 +1,377 @@
+package measure
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// Stats is a point-in-time snapshot of everything a measure wrapper has
+// recorded. Maps are keyed by metric name without the prefix, e.g.
+// "get_total" or "get.latency_seconds".
+type Stats struct {
+	Prefix string
+	// Backend names the concrete type of the wrapped blockstore, looking
+	// through other wrappers, and Created is when the wrapper was made.
+	// Both are unset for a Chain.
+	Backend string
+	Created time.Time
+	// Labels are the labels of the wrapper's metrics, set for the
+	// members of a Set.
+	Labels map[string]string
+	// Help holds the description of every metric.
+	Help       map[string]string
+	Counters   map[string]float64
+	Gauges     map[string]float64
+	Histograms map[string]HistogramStats
+	// LastErrors holds the most recent error of each operation that had
+	// one, see LastError.
+	LastErrors map[Op]ErrInfo
+}
+
+// HistogramStats is a snapshot of a single histogram.
+type HistogramStats struct {
+	Count uint64
+	Sum   float64
+	// Bounds are the bucket upper bounds. Counts has one more element
+	// than Bounds, the last one counting observations above the last
+	// bound. Counts are per bucket, not cumulative.
+	Bounds []float64
+	Counts []uint64
+	// Exemplars holds the latest exemplar of each bucket, indexed like
+	// Counts, with a zero Exemplar for buckets without one. It is nil
+	// when no exemplars were recorded, see WithExemplars.
+	Exemplars []Exemplar
+}
+
+// Mean returns the average observed value, or 0 if nothing was observed.
+func (h HistogramStats) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Count)
+}
+
+// Quantile estimates the q-th quantile (0 <= q <= 1) by linear
+// interpolation within the bucket containing it. Values above the last
+// bound are reported as the last bound.
+func (h HistogramStats) Quantile(q float64) float64 {
+	if h.Count == 0 || len(h.Bounds) == 0 {
+		return 0
+	}
+	rank := q * float64(h.Count)
+	var seen float64
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		if seen+float64(n) < rank {
+			seen += float64(n)
+			continue
+		}
+		if i == len(h.Bounds) {
+			return h.Bounds[len(h.Bounds)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = h.Bounds[i-1]
+		}
+		return lower + (h.Bounds[i]-lower)*(rank-seen)/float64(n)
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// Stats returns a snapshot of all metrics recorded by m, after
+// refreshing the metrics derived from others or from the backend:
+// uptime_seconds, view_to_get_ratio, put.size_entropy, the tombstone
+// metrics, which queries the backend, and the p99 drift, which takes a
+// p99 sample if one is due.
+func (m *measure) Stats() Stats {
+	m.uptime.Set(m.clock.Now().Sub(m.created).Seconds())
+	m.refreshViewRatio()
+	m.refreshSizeEntropy()
+	m.refreshTombstones()
+	m.refreshP99Drift()
+	return m.snapshot()
+}
+
+// Snapshot is Stats without side effects, for collectors that read the
+// metrics on their own schedule, which then doesn't change them: the
+// derived metrics are reported as last refreshed by Stats or by the
+// operations that maintain them, except uptime_seconds, which is
+// computed for the snapshot.
+func (m *measure) Snapshot() Stats {
+	s := m.snapshot()
+	s.Gauges["uptime_seconds"] = m.clock.Now().Sub(m.created).Seconds()
+	return s
+}
+
+func (m *measure) snapshot() Stats {
+	s := m.reg.snapshot()
+	s.Backend = m.backendName
+	s.Created = m.created
+	s.Labels = m.labels
+	s.LastErrors = m.lastErrorsSnapshot()
+	return s
+}
+
+// registry creates the metrics of a measure wrapper and keeps a shadow
+// copy of every value so that it can be read back without going through
+// the metrics backend.
+type registry struct {
+	prefix string
+	// rec is reported every update, unless nil.
+	rec Recorder
+	// latencyUnit is the unit of histograms created by latency.
+	latencyUnit LatencyUnit
+	// restored holds counter values to resume from, applied when the
+	// counter is created.
+	restored map[string]float64
+	// adaptiveBuckets makes latency create adaptive histograms.
+	adaptiveBuckets bool
+	// latencySums makes latency create counters, see
+	// WithoutLatencyHistograms.
+	latencySums bool
+	// latencyCeiling is the longest latency accepted by histograms
+	// created by latency, see WithLatencyCeiling.
+	latencyCeiling time.Duration
+	// clock is the wrapper's clock, for the helpers timing operations
+	// that are only given the registry.
+	clock Clock
+	// anomalies is latency.anomaly_total, registered along with the
+	// first histogram created by latency.
+	anomaliesOnce sync.Once
+	anomalies     metrics.Counter
+
+	mu         sync.Mutex
+	help       map[string]string
+	counters   map[string]*counter
+	gauges     map[string]*gauge
+	histograms map[string]*histogram
+	adaptives  map[string]*adaptiveHistogram
+}
+
+func newRegistry(prefix string, rec Recorder) *registry {
+	return &registry{
+		prefix:     prefix,
+		rec:        rec,
+		clock:      systemClock{},
+		help:       make(map[string]string),
+		counters:   make(map[string]*counter),
+		gauges:     make(map[string]*gauge),
+		histograms: make(map[string]*histogram),
+		adaptives:  make(map[string]*adaptiveHistogram),
+	}
+}
+
+func (r *registry) counter(name, help string) metrics.Counter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.counters[name]; ok {
+		return c
+	}
+	c := &counter{name: r.prefix + "." + name, rec: r.rec}
+	if d, ok := r.rec.(metricDefiner); ok {
+		d.defineCounter(c.name, help)
+	}
+	if v := r.restored[name]; v > 0 {
+		c.Add(v)
+	}
+	r.counters[name] = c
+	r.help[name] = help
+	return c
+}
+
+func (r *registry) gauge(name, help string) metrics.Gauge {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if g, ok := r.gauges[name]; ok {
+		return g
+	}
+	g := &gauge{name: r.prefix + "." + name, rec: r.rec}
+	if d, ok := r.rec.(metricDefiner); ok {
+		d.defineGauge(g.name, help)
+	}
+	r.gauges[name] = g
+	r.help[name] = help
+	return g
+}
+
+func (r *registry) histogram(name, help string, buckets []float64) metrics.Histogram {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok := r.histograms[name]; ok {
+		return h
+	}
+	h := &histogram{
+		name:   r.prefix + "." + name,
+		rec:    r.rec,
+		bounds: buckets,
+		counts: make([]uint64, len(buckets)+1),
+	}
+	if d, ok := r.rec.(metricDefiner); ok {
+		d.defineHistogram(h.name, help, buckets)
+	}
+	r.histograms[name] = h
+	r.help[name] = help
+	return h
+}
+
+func (r *registry) snapshot() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := Stats{
+		Prefix:     r.prefix,
+		Help:       make(map[string]string, len(r.help)),
+		Counters:   make(map[string]float64, len(r.counters)),
+		Gauges:     make(map[string]float64, len(r.gauges)),
+		Histograms: make(map[string]HistogramStats, len(r.histograms)),
+	}
+	for name, help := range r.help {
+		s.Help[name] = help
+	}
+	for name, c := range r.counters {
+		s.Counters[name] = c.value()
+	}
+	for name, g := range r.gauges {
+		s.Gauges[name] = g.value()
+	}
+	for name, h := range r.histograms {
+		s.Histograms[name] = h.snapshot()
+	}
+	return s
+}
+
+// atomicFloat is a float64 that can be updated concurrently.
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+func (f *atomicFloat) store(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		next := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&f.bits, old, next) {
+			return
+		}
+	}
+}
+
+type counter struct {
+	name string
+	rec  Recorder
+	v    atomicFloat
+}
+
+func (c *counter) Inc() {
+	c.Add(1)
+}
+
+func (c *counter) Add(v float64) {
+	c.v.add(v)
+	if c.rec != nil {
+		c.rec.IncCounter(c.name, v)
+	}
+}
+
+func (c *counter) value() float64 { return c.v.load() }
+
+// counterValue returns the value of a counter created by a registry.
+func counterValue(c metrics.Counter) float64 {
+	if c, ok := c.(*counter); ok {
+		return c.value()
+	}
+	return 0
+}
+
+type gauge struct {
+	name string
+	rec  Recorder
+	v    atomicFloat
+
+	// mu orders updates reported to rec, so that the last value it
+	// gets is the current one.
+	mu sync.Mutex
+}
+
+func (g *gauge) Set(v float64) {
+	if g.rec == nil {
+		g.v.store(v)
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.v.store(v)
+	g.rec.SetGauge(g.name, v)
+}
+
+func (g *gauge) Inc() { g.Add(1) }
+
+func (g *gauge) Dec() { g.Add(-1) }
+
+func (g *gauge) Sub(v float64) { g.Add(-v) }
+
+func (g *gauge) Add(v float64) {
+	if g.rec == nil {
+		g.v.add(v)
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.v.add(v)
+	g.rec.SetGauge(g.name, g.v.load())
+}
+
+func (g *gauge) value() float64 { return g.v.load() }
+
+type histogram struct {
+	name   string
+	rec    Recorder
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    atomicFloat
+	ex     exemplars
+}
+
+func (h *histogram) Observe(v float64) {
+	h.observe(v)
+	if h.rec != nil {
+		h.rec.ObserveHistogram(h.name, v)
+	}
+}
+
+// observe records v without reporting it to the recorder.
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	h.sum.add(v)
+}
+
+func (h *histogram) snapshot() HistogramStats {
+	s := HistogramStats{
+		Count:  atomic.LoadUint64(&h.count),
+		Sum:    h.sum.load(),
+		Bounds: h.bounds,
+		Counts: make([]uint64, len(h.counts)),
+
+		Exemplars: h.ex.snapshot(),
+	}
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return s
+}
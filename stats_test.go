@@ -0,0 +1,34 @@
+package measure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestUptime(t *testing.T) {
+	clock := newFakeClock()
+	created := clock.Now()
+	m := New("test", testutil.New(), WithClock(clock))
+
+	s := m.Stats()
+	if got, want := s.Gauges["start_time_seconds"], float64(created.Unix()); got != want {
+		t.Fatalf("start_time_seconds = %v, want %v", got, want)
+	}
+	if !s.Created.Equal(created) {
+		t.Fatalf("Created = %v, want %v", s.Created, created)
+	}
+	if got := s.Gauges["uptime_seconds"]; got != 0 {
+		t.Fatalf("uptime_seconds = %v, want 0", got)
+	}
+
+	clock.Advance(90 * time.Second)
+	s = m.Stats()
+	if got := s.Gauges["uptime_seconds"]; got != 90 {
+		t.Fatalf("uptime_seconds = %v after 90s, want 90", got)
+	}
+	if got, want := s.Gauges["start_time_seconds"], float64(created.Unix()); got != want {
+		t.Fatalf("start_time_seconds changed to %v", got)
+	}
+}
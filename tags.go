@@ -0,0 +1,99 @@
+package measure
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// defaultMaxTags is the number of distinct tags counted separately
+// unless changed with WithMaxTags.
+const defaultMaxTags = 64
+
+const (
+	// unknownTag is used for operations without a tag.
+	unknownTag = "unknown"
+	// otherTag is used for tags seen after the limit was reached.
+	otherTag = "other"
+)
+
+type tagKey struct{}
+
+// ContextWithTag returns a context carrying tag, for TagFromContext.
+func ContextWithTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, tagKey{}, tag)
+}
+
+// TagFromContext returns the tag set with ContextWithTag, or "". It can
+// be passed to WithTagExtractor.
+func TagFromContext(ctx context.Context) string {
+	tag, _ := ctx.Value(tagKey{}).(string)
+	return tag
+}
+
+// WithTagExtractor counts operations per caller-provided tag, such as a
+// tenant, in tag.<tag>.<op>_total. extract is called with the context of
+// every operation; operations it returns "" for are counted under
+// "unknown". Once the number of distinct tags reaches the limit set with
+// WithMaxTags, 64 by default, new tags are counted under "other".
+// Characters other than letters, digits and underscores are replaced
+// with underscores.
+func WithTagExtractor(extract func(context.Context) string) Option {
+	return func(cfg *config) {
+		cfg.tagExtract = extract
+	}
+}
+
+// WithMaxTags sets the number of distinct tags counted separately, see
+// WithTagExtractor.
+func WithMaxTags(n int) Option {
+	return func(cfg *config) {
+		cfg.maxTags = n
+	}
+}
+
+type tagger struct {
+	extract func(context.Context) string
+	max     int
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+// resolve maps a raw tag to the one it is counted under.
+func (t *tagger) resolve(tag string) string {
+	if tag == "" {
+		return unknownTag
+	}
+	tag = sanitizeTag(tag)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.seen[tag]; ok {
+		return tag
+	}
+	if len(t.seen) >= t.max {
+		return otherTag
+	}
+	t.seen[tag] = struct{}{}
+	return tag
+}
+
+func sanitizeTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, tag)
+}
+
+// countTag counts op under the tag of ctx.
+func (m *measure) countTag(ctx context.Context, op Op) {
+	if m.tags == nil {
+		return
+	}
+	tag := m.tags.resolve(m.tags.extract(ctx))
+	m.reg.counter("tag."+tag+"."+string(op)+"_total",
+		"Number of operations with the tag").Inc()
+}
@@ -0,0 +1,25 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestTags(t *testing.T) {
+	m := New("tg", testutil.New(), WithTagExtractor(TagFromContext), WithMaxTags(2))
+	c := blocks.NewBlock([]byte("x")).Cid()
+	bg := context.Background()
+	m.Has(ContextWithTag(bg, "alice"), c)
+	m.Has(ContextWithTag(bg, "bob.x"), c)
+	m.Has(ContextWithTag(bg, "bob.x"), c)
+	m.Has(ContextWithTag(bg, "carol"), c)
+	m.Has(bg, c)
+	cs := m.Stats().Counters
+	if cs["tag.alice.has_total"] != 1 || cs["tag.bob_x.has_total"] != 2 || cs["tag.other.has_total"] != 1 || cs["tag.unknown.has_total"] != 1 {
+		t.Fatal(cs)
+	}
+}
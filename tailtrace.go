@@ -0,0 +1,77 @@
+package measure
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// Span describes an operation kept by WithTailTracing.
+type Span struct {
+	Op       string
+	Cid      cid.Cid // undefined for batch operations
+	Items    int     // number of blocks for batch operations
+	Bytes    int
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// SpanExporter turns the spans kept by WithTailTracing into spans of a
+// tracer. As spans are only exported once the operation is over, they
+// must be created with explicit start and end times, for example with
+// the trace.WithTimestamp options of OpenTelemetry. ctx is the context
+// the operation was called with, carrying the parent span if any.
+type SpanExporter interface {
+	ExportSpan(ctx context.Context, s Span)
+}
+
+// WithTailTracing exports a span to exp for every operation that took at
+// least threshold or failed with an error other than not-found, and
+// nothing for the others. Nothing is buffered beyond the operation
+// itself. Exported and dropped spans are counted in
+// tracing.spans_exported_total and tracing.spans_suppressed_total.
+func WithTailTracing(exp SpanExporter, threshold time.Duration) Option {
+	return func(cfg *config) {
+		cfg.spanExporter = exp
+		cfg.spanThreshold = threshold
+	}
+}
+
+type tailTracer struct {
+	exp        SpanExporter
+	threshold  time.Duration
+	exported   metrics.Counter
+	suppressed metrics.Counter
+}
+
+func newTailTracer(r *registry, exp SpanExporter, threshold time.Duration) *tailTracer {
+	return &tailTracer{
+		exp:        exp,
+		threshold:  threshold,
+		exported:   r.counter("tracing.spans_exported_total", "Number of slow or failed operations exported as spans"),
+		suppressed: r.counter("tracing.spans_suppressed_total", "Number of operations not exported as spans"),
+	}
+}
+
+// record is an event sink exporting the slow and failed operations.
+func (t *tailTracer) record(ev *opEvent) {
+	failed := ev.Err != nil && !format.IsNotFound(ev.Err)
+	if !failed && ev.Duration < t.threshold {
+		t.suppressed.Inc()
+		return
+	}
+	t.exported.Inc()
+	t.exp.ExportSpan(ev.Ctx, Span{
+		Op:       ev.Op,
+		Cid:      ev.Cid,
+		Items:    ev.Items,
+		Bytes:    ev.Bytes,
+		Start:    ev.Start,
+		Duration: ev.Duration,
+		Err:      ev.Err,
+	})
+}
@@ -0,0 +1,36 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type spanRec struct{ spans []Span }
+
+func (r *spanRec) ExportSpan(ctx context.Context, s Span) { r.spans = append(r.spans, s) }
+
+func TestTailTracing(t *testing.T) {
+	ctx := context.Background()
+	rec := &spanRec{}
+	f := &flakyBS{Blockstore: testutil.New()}
+	m := New("tt", f, WithTailTracing(rec, time.Hour))
+	b := blocks.NewBlock([]byte("x"))
+	m.Put(ctx, b)
+	m.Get(ctx, blocks.NewBlock([]byte("missing")).Cid())
+	m.Has(ctx, b.Cid())
+	f.fail = true
+	m.Has(ctx, b.Cid())
+	if len(rec.spans) != 1 || rec.spans[0].Op != "has" || rec.spans[0].Err == nil || errors.Is(rec.spans[0].Err, context.Canceled) {
+		t.Fatal(rec.spans)
+	}
+	st := m.Stats().Counters
+	if st["tracing.spans_exported_total"] != 1 || st["tracing.spans_suppressed_total"] != 3 {
+		t.Fatal(st)
+	}
+}
@@ -0,0 +1,363 @@
+// Package testutil provides an in-memory blockstore whose behaviour is
+// programmable, for testing the measure wrapper, dashboards and alerts.
+// Its calls can be slowed down and failed on a schedule, its optional
+// capabilities hidden, and every call is recorded for assertions.
+package testutil
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// Op names a blockstore operation.
+type Op string
+
+const (
+	Put         Op = "put"
+	PutMany     Op = "putmany"
+	Get         Op = "get"
+	Has         Op = "has"
+	GetSize     Op = "getsize"
+	View        Op = "view"
+	DeleteBlock Op = "delete"
+	DeleteMany  Op = "deletemany"
+	AllKeysChan Op = "allkeys"
+)
+
+// ErrScheduled is returned by scheduled failures that don't set an error.
+var ErrScheduled = errors.New("testutil: scheduled failure")
+
+// Latency returns how long a call should take.
+type Latency func() time.Duration
+
+// Fixed returns a Latency of always d.
+func Fixed(d time.Duration) Latency {
+	return func() time.Duration { return d }
+}
+
+// Uniform returns a Latency uniformly distributed between min and max,
+// drawn from a generator seeded with seed.
+func Uniform(min, max time.Duration, seed int64) Latency {
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+	return func() time.Duration {
+		if max <= min {
+			return min
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return min + time.Duration(rng.Int63n(int64(max-min)))
+	}
+}
+
+// Advancer is a clock that can be moved forward, such as a fake clock
+// given to the measure wrapper with WithClock.
+type Advancer interface {
+	Advance(d time.Duration)
+}
+
+// Call records one call made to a Blockstore.
+type Call struct {
+	Op    Op
+	Cid   cid.Cid // undefined for batch operations
+	Items int     // number of blocks for batch operations
+	Err   error
+}
+
+// Blockstore is an in-memory blockstore. It implements View and
+// DeleteMany; see WithoutView and WithoutDeleteMany to hide them.
+type Blockstore struct {
+	mu        sync.Mutex
+	blocks    map[cid.Cid]blocks.Block
+	latencies map[Op]Latency
+	// clock, if set, is advanced by latencies instead of sleeping.
+	clock Advancer
+	// failures maps an op to its scheduled failures, keyed by the
+	// 1-based number of the call to fail.
+	failures map[Op]map[int]error
+	counts   map[Op]int
+	calls    []Call
+}
+
+var (
+	_ blockstore.Blockstore = (*Blockstore)(nil)
+	_ blockstore.Viewer     = (*Blockstore)(nil)
+)
+
+// New returns an empty Blockstore.
+func New() *Blockstore {
+	return &Blockstore{
+		blocks:    make(map[cid.Cid]blocks.Block),
+		latencies: make(map[Op]Latency),
+		failures:  make(map[Op]map[int]error),
+		counts:    make(map[Op]int),
+	}
+}
+
+// SetLatency makes every call of op take l, or no time if l is nil.
+func (b *Blockstore) SetLatency(op Op, l Latency) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if l == nil {
+		delete(b.latencies, op)
+		return
+	}
+	b.latencies[op] = l
+}
+
+// SetClock makes calls advance c by their latency instead of sleeping,
+// so that latencies timed with c are exact. Nil restores sleeping.
+func (b *Blockstore) SetClock(c Advancer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clock = c
+}
+
+// FailCall makes the n-th call of op, counting from 1 and including
+// calls already made, fail with err, or ErrScheduled if err is nil.
+// Failed writes and deletes don't change the contents.
+func (b *Blockstore) FailCall(op Op, n int, err error) {
+	if err == nil {
+		err = ErrScheduled
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures[op] == nil {
+		b.failures[op] = make(map[int]error)
+	}
+	b.failures[op][n] = err
+}
+
+// Calls returns the calls made so far, in order.
+func (b *Blockstore) Calls() []Call {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Call(nil), b.calls...)
+}
+
+// Count returns the number of calls of op made so far.
+func (b *Blockstore) Count(op Op) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.counts[op]
+}
+
+// Len returns the number of blocks stored.
+func (b *Blockstore) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.blocks)
+}
+
+// WithoutView returns b without its View method, so that callers take
+// their fallback path.
+func (b *Blockstore) WithoutView() blockstore.Blockstore {
+	return withoutView{plain{b}, b}
+}
+
+// WithoutDeleteMany returns b without its DeleteMany method.
+func (b *Blockstore) WithoutDeleteMany() blockstore.Blockstore {
+	return withoutDeleteMany{plain{b}, b}
+}
+
+// Plain returns b with neither View nor DeleteMany.
+func (b *Blockstore) Plain() blockstore.Blockstore {
+	return plain{b}
+}
+
+type plain struct {
+	blockstore.Blockstore
+}
+
+type withoutView struct {
+	plain
+	b *Blockstore
+}
+
+func (w withoutView) DeleteMany(ctx context.Context, cids []cid.Cid) error {
+	return w.b.DeleteMany(ctx, cids)
+}
+
+type withoutDeleteMany struct {
+	plain
+	b *Blockstore
+}
+
+func (w withoutDeleteMany) View(ctx context.Context, c cid.Cid, f func([]byte) error) error {
+	return w.b.View(ctx, c, f)
+}
+
+// begin counts a call of op, waits for its latency and returns its
+// scheduled error, if any. A call canceled while waiting fails with the
+// context's error.
+func (b *Blockstore) begin(ctx context.Context, op Op) error {
+	b.mu.Lock()
+	b.counts[op]++
+	err := b.failures[op][b.counts[op]]
+	l := b.latencies[op]
+	clock := b.clock
+	b.mu.Unlock()
+	if l == nil {
+		return err
+	}
+	if clock != nil {
+		clock.Advance(l())
+		return err
+	}
+	t := time.NewTimer(l())
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// record appends a call. b.mu must be held.
+func (b *Blockstore) record(op Op, c cid.Cid, items int, err error) {
+	b.calls = append(b.calls, Call{Op: op, Cid: c, Items: items, Err: err})
+}
+
+func (b *Blockstore) Put(ctx context.Context, blk blocks.Block) error {
+	err := b.begin(ctx, Put)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.blocks[blk.Cid()] = blk
+	}
+	b.record(Put, blk.Cid(), 0, err)
+	return err
+}
+
+func (b *Blockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	err := b.begin(ctx, PutMany)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		for _, blk := range blks {
+			b.blocks[blk.Cid()] = blk
+		}
+	}
+	b.record(PutMany, cid.Undef, len(blks), err)
+	return err
+}
+
+func (b *Blockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	err := b.begin(ctx, Get)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var blk blocks.Block
+	if err == nil {
+		var ok bool
+		if blk, ok = b.blocks[c]; !ok {
+			err = format.ErrNotFound{Cid: c}
+		}
+	}
+	b.record(Get, c, 0, err)
+	return blk, err
+}
+
+func (b *Blockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	err := b.begin(ctx, Has)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.blocks[c]
+	b.record(Has, c, 0, err)
+	return ok && err == nil, err
+}
+
+func (b *Blockstore) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	err := b.begin(ctx, GetSize)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	size := -1
+	if err == nil {
+		if blk, ok := b.blocks[c]; ok {
+			size = len(blk.RawData())
+		} else {
+			err = format.ErrNotFound{Cid: c}
+		}
+	}
+	b.record(GetSize, c, 0, err)
+	return size, err
+}
+
+func (b *Blockstore) View(ctx context.Context, c cid.Cid, f func([]byte) error) error {
+	err := b.begin(ctx, View)
+	b.mu.Lock()
+	var blk blocks.Block
+	if err == nil {
+		var ok bool
+		if blk, ok = b.blocks[c]; !ok {
+			err = format.ErrNotFound{Cid: c}
+		}
+	}
+	b.record(View, c, 0, err)
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return f(blk.RawData())
+}
+
+func (b *Blockstore) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	err := b.begin(ctx, DeleteBlock)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.blocks, c)
+	}
+	b.record(DeleteBlock, c, 0, err)
+	return err
+}
+
+func (b *Blockstore) DeleteMany(ctx context.Context, cids []cid.Cid) error {
+	err := b.begin(ctx, DeleteMany)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		for _, c := range cids {
+			delete(b.blocks, c)
+		}
+	}
+	b.record(DeleteMany, cid.Undef, len(cids), err)
+	return err
+}
+
+// AllKeysChan lists the keys stored when it is called.
+func (b *Blockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	err := b.begin(ctx, AllKeysChan)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.record(AllKeysChan, cid.Undef, 0, err)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]cid.Cid, 0, len(b.blocks))
+	for c := range b.blocks {
+		keys = append(keys, c)
+	}
+	ch := make(chan cid.Cid)
+	go func() {
+		defer close(ch)
+		for _, c := range keys {
+			select {
+			case ch <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (b *Blockstore) HashOnRead(bool) {}
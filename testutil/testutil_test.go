@@ -0,0 +1,156 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+func TestFailCall(t *testing.T) {
+	ctx := context.Background()
+	b := New()
+	blk := blocks.NewBlock([]byte("a"))
+	b.FailCall(Get, 2, nil)
+	b.FailCall(Put, 1, context.Canceled)
+
+	if err := b.Put(ctx, blk); err != context.Canceled {
+		t.Fatalf("got %v, want the scheduled error", err)
+	}
+	if b.Len() != 0 {
+		t.Fatal("failed Put stored the block")
+	}
+	if err := b.Put(ctx, blk); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get(ctx, blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get(ctx, blk.Cid()); err != ErrScheduled {
+		t.Fatalf("got %v, want ErrScheduled", err)
+	}
+	if _, err := b.Get(ctx, blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := b.Calls()
+	if len(calls) != 5 || calls[0].Op != Put || calls[0].Err != context.Canceled || calls[3].Err != ErrScheduled {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+	if b.Count(Get) != 3 || b.Count(Put) != 2 {
+		t.Fatalf("counted %d Gets and %d Puts", b.Count(Get), b.Count(Put))
+	}
+}
+
+func TestLatency(t *testing.T) {
+	ctx := context.Background()
+	b := New()
+	b.SetLatency(Has, Fixed(20*time.Millisecond))
+	start := time.Now()
+	b.Has(ctx, blocks.NewBlock([]byte("a")).Cid())
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Fatalf("Has took %s", d)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := b.Has(ctx, blocks.NewBlock([]byte("a")).Cid()); err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+
+	b.SetLatency(Has, nil)
+	start = time.Now()
+	b.Has(context.Background(), blocks.NewBlock([]byte("a")).Cid())
+	if d := time.Since(start); d >= 20*time.Millisecond {
+		t.Fatalf("Has took %s after clearing its latency", d)
+	}
+}
+
+// stepClock is an Advancer recording how far it was moved.
+type stepClock struct{ d time.Duration }
+
+func (c *stepClock) Advance(d time.Duration) { c.d += d }
+
+func TestSetClock(t *testing.T) {
+	b := New()
+	clock := &stepClock{}
+	b.SetClock(clock)
+	b.SetLatency(Get, Fixed(time.Hour))
+	start := time.Now()
+	b.Get(context.Background(), blocks.NewBlock([]byte("a")).Cid())
+	if d := time.Since(start); d >= time.Second {
+		t.Fatalf("Get slept for %s", d)
+	}
+	if clock.d != time.Hour {
+		t.Fatalf("clock advanced by %s, want 1h", clock.d)
+	}
+}
+
+func TestUniform(t *testing.T) {
+	l := Uniform(time.Millisecond, 2*time.Millisecond, 1)
+	for i := 0; i < 100; i++ {
+		if d := l(); d < time.Millisecond || d >= 2*time.Millisecond {
+			t.Fatalf("latency %s out of range", d)
+		}
+	}
+	if d := Uniform(time.Second, time.Second, 1)(); d != time.Second {
+		t.Fatalf("latency %s, want 1s", d)
+	}
+}
+
+func TestToggles(t *testing.T) {
+	b := New()
+	var bs blockstore.Blockstore = b
+	if _, ok := bs.(blockstore.Viewer); !ok {
+		t.Fatal("Blockstore should implement View")
+	}
+	type deleter interface {
+		DeleteMany(context.Context, []cid.Cid) error
+	}
+	for _, tc := range []struct {
+		name             string
+		bs               blockstore.Blockstore
+		view, deleteMany bool
+	}{
+		{"WithoutView", b.WithoutView(), false, true},
+		{"WithoutDeleteMany", b.WithoutDeleteMany(), true, false},
+		{"Plain", b.Plain(), false, false},
+	} {
+		_, view := tc.bs.(blockstore.Viewer)
+		_, deleteMany := tc.bs.(deleter)
+		if view != tc.view || deleteMany != tc.deleteMany {
+			t.Errorf("%s: View %t, DeleteMany %t", tc.name, view, deleteMany)
+		}
+	}
+}
+
+func TestAllKeysChan(t *testing.T) {
+	ctx := context.Background()
+	b := New()
+	want := map[cid.Cid]bool{}
+	for _, s := range []string{"a", "b", "c"} {
+		blk := blocks.NewBlock([]byte(s))
+		b.Put(ctx, blk)
+		want[blk.Cid()] = true
+	}
+	ch, err := b.AllKeysChan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for c := range ch {
+		if !want[c] {
+			t.Fatalf("unexpected key %s", c)
+		}
+		delete(want, c)
+	}
+	if len(want) != 0 {
+		t.Fatalf("missing keys %v", want)
+	}
+	if _, err := b.GetSize(ctx, blocks.NewBlock([]byte("d")).Cid()); !format.IsNotFound(err) {
+		t.Fatalf("got %v, want not found", err)
+	}
+}
@@ -0,0 +1,33 @@
+package measure
+
+import (
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// WithLatencyPerMB also records the latency of successful Get calls
+// divided by the size of the block read in megabytes (2^20 bytes), in
+// get.latency_per_mb_seconds. Unlike the raw latency, which treats a
+// slow small read like a slow large one, it is comparable across block
+// sizes and shows the throughput of the backend. Empty blocks are left
+// out.
+func WithLatencyPerMB() Option {
+	return func(cfg *config) {
+		cfg.latencyPerMB = true
+	}
+}
+
+func newLatencyPerMBHistogram(r *registry) metrics.Histogram {
+	return r.latency("get.latency_per_mb",
+		"Distribution of the latency of Get calls per megabyte of block read")
+}
+
+// observeLatencyPerMB records the latency of a successful op that read
+// a block of size bytes, per megabyte.
+func (m *measure) observeLatencyPerMB(op Op, size *int, start time.Time, err error) {
+	if m.latencyPerMB == nil || op != OpGet || size == nil || *size == 0 || err != nil {
+		return
+	}
+	m.latencyPerMB.Observe(m.clock.Now().Sub(start).Seconds() / (float64(*size) / (1 << 20)))
+}
@@ -0,0 +1,38 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestLatencyPerMB(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	fb := testutil.New()
+	fb.SetClock(clock)
+	m := New("test", fb, WithClock(clock), WithLatencyPerMB())
+	small := blocks.NewBlock(bytes.Repeat([]byte{1}, 1<<19))
+	large := blocks.NewBlock(bytes.Repeat([]byte{2}, 4<<20))
+	empty := blocks.NewBlock(nil)
+	for _, b := range []blocks.Block{small, large, empty} {
+		fb.Put(ctx, b)
+	}
+
+	// 10ms for half a megabyte and 80ms for four are both 20ms per
+	// megabyte. Empty blocks aren't observed.
+	fb.SetLatency(testutil.Get, testutil.Fixed(10*time.Millisecond))
+	m.Get(ctx, small.Cid())
+	fb.SetLatency(testutil.Get, testutil.Fixed(80*time.Millisecond))
+	m.Get(ctx, large.Cid())
+	m.Get(ctx, empty.Cid())
+	h := m.Stats().Histograms["get.latency_per_mb_seconds"]
+	if h.Count != 2 || h.Sum != 0.04 {
+		t.Fatalf("get.latency_per_mb_seconds count %d sum %v, want 2 observations summing to 0.04", h.Count, h.Sum)
+	}
+}
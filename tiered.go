@@ -0,0 +1,41 @@
+package measure
+
+import (
+	"fmt"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// Tiered returns a chain of storage tiers, ordered from hottest to
+// coldest, with the read and write semantics of Chain. Each tier is
+// wrapped with New under the sub-prefix <prefix>.tier<i>, so every tier
+// gets the full set of per-operation metrics, latencies included, under
+// names existing dashboards can be pointed at. Reads are attributed to
+// the tier that served them in tier<i>.hits_total.
+//
+// With PromoteOnHit, blocks read by Get or View from a colder tier are
+// copied into the first one, as counted in tier.promoted_total and, for
+// failed copies, tier.promote_errors_total.
+func Tiered(prefix string, tiers ...blockstore.Blockstore) *Chain {
+	wrapped := make([]blockstore.Blockstore, len(tiers))
+	for i, t := range tiers {
+		wrapped[i] = New(fmt.Sprintf("%s.tier%d", prefix, i), t)
+	}
+	c := NewChain(prefix, wrapped...)
+	c.hits = make([]metrics.Counter, len(tiers))
+	for i := range tiers {
+		c.hits[i] = c.reg.counter(fmt.Sprintf("tier%d.hits_total", i),
+			fmt.Sprintf("Number of reads served by tier %d", i))
+	}
+	c.promoted = c.reg.counter("tier.promoted_total", "Number of blocks copied into the first tier after a read from a colder one")
+	c.promoteErr = c.reg.counter("tier.promote_errors_total", "Number of blocks that could not be copied into the first tier")
+	return c
+}
+
+// PromoteOnHit sets whether blocks read from a colder tier are copied
+// into the first one. It is only effective on chains made by Tiered and
+// must be called before the chain is used.
+func (c *Chain) PromoteOnHit(enabled bool) {
+	c.promote = enabled && c.promoted != nil
+}
@@ -0,0 +1,27 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestTiered(t *testing.T) {
+	ctx := context.Background()
+	hot, cold := testutil.New(), testutil.New()
+	tr := Tiered("tr", hot, cold)
+	tr.PromoteOnHit(true)
+	b := blocks.NewBlock([]byte("x"))
+	cold.Put(ctx, b)
+	if _, err := tr.Get(ctx, b.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	tr.Get(ctx, b.Cid())
+	cs := tr.Stats().Counters
+	if cs["tier1.hits_total"] != 1 || cs["tier0.hits_total"] != 1 || cs["tier.promoted_total"] != 1 || cs["chain.level1.fallback_total"] != 1 {
+		t.Fatal(cs)
+	}
+}
@@ -0,0 +1,126 @@
+package measure
+
+import (
+	"sync"
+	"time"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// tombstoneEvery is how often deletes refresh the tombstone count.
+const tombstoneEvery = time.Second
+
+// TombstoneCounter is implemented by backends, typically LSM trees, that
+// keep tombstones for deleted blocks until they compact. Tombstones
+// returns the number of tombstones and of live blocks.
+type TombstoneCounter interface {
+	Tombstones() (tombstones, live int64, err error)
+}
+
+// WithTombstoneMonitor reports the tombstones of a TombstoneCounter
+// backend, found by looking through wrappers, in the
+// backend.tombstone_count gauge, and their share of the tombstones and
+// live blocks in backend.tombstone_ratio. Every time that share rises
+// above ratio, backend.compaction_needed_total is incremented; it must
+// fall back below, usually after a compaction, before being counted
+// again. They are refreshed by Stats and at most once a second by
+// deletes. Failures to read them are counted in
+// backend.tombstone_errors_total. Backends that aren't
+// TombstoneCounters report nothing.
+func WithTombstoneMonitor(ratio float64) Option {
+	return func(cfg *config) {
+		cfg.tombstones = true
+		cfg.tombstoneRatio = ratio
+	}
+}
+
+type tombstoneMonitor struct {
+	backend   TombstoneCounter
+	threshold float64
+	clock     Clock
+	count     metrics.Gauge
+	ratio     metrics.Gauge
+	needed    metrics.Counter
+	errors    metrics.Counter
+
+	mu sync.Mutex
+	// last is when the tombstones were last read by a delete, and over
+	// whether their ratio was above the threshold then.
+	last time.Time
+	over bool
+}
+
+// newTombstoneMonitor returns a monitor of the tombstones of bs, looking
+// through wrappers, or nil if bs doesn't report them.
+func newTombstoneMonitor(r *registry, bs blockstore.Blockstore, threshold float64, clock Clock) *tombstoneMonitor {
+	var tc TombstoneCounter
+	for {
+		if t, ok := bs.(TombstoneCounter); ok {
+			tc = t
+			break
+		}
+		u, ok := bs.(unwrapper)
+		if !ok {
+			return nil
+		}
+		bs = u.Unwrap()
+	}
+	t := &tombstoneMonitor{
+		backend:   tc,
+		threshold: threshold,
+		clock:     clock,
+		count:     r.gauge("backend.tombstone_count", "Number of tombstones kept by the backend for deleted blocks"),
+		ratio:     r.gauge("backend.tombstone_ratio", "Tombstones over tombstones and live blocks in the backend"),
+		needed: r.counter("backend.compaction_needed_total",
+			"Number of times the tombstone ratio of the backend rose above the threshold"),
+		errors: r.counter("backend.tombstone_errors_total", "Number of failures to read the tombstones of the backend"),
+	}
+	t.refresh()
+	return t
+}
+
+// refresh reads the tombstones and updates the metrics.
+func (t *tombstoneMonitor) refresh() {
+	tombstones, live, err := t.backend.Tombstones()
+	if err != nil {
+		t.errors.Inc()
+		return
+	}
+	t.count.Set(float64(tombstones))
+	var ratio float64
+	if tombstones+live > 0 {
+		ratio = float64(tombstones) / float64(tombstones+live)
+	}
+	t.ratio.Set(ratio)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = t.clock.Now()
+	over := ratio > t.threshold
+	if over && !t.over {
+		t.needed.Inc()
+	}
+	t.over = over
+}
+
+// observeTombstones refreshes the tombstones after a delete if they
+// weren't for a second.
+func (m *measure) observeTombstones() {
+	t := m.tombstones
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	due := t.clock.Now().Sub(t.last) >= tombstoneEvery
+	t.mu.Unlock()
+	if due {
+		t.refresh()
+	}
+}
+
+// refreshTombstones refreshes the tombstones for Stats.
+func (m *measure) refreshTombstones() {
+	if m.tombstones != nil {
+		m.tombstones.refresh()
+	}
+}
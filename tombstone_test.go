@@ -0,0 +1,35 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type tombBS struct {
+	*testutil.Blockstore
+	tomb *int64
+}
+
+func (b tombBS) Tombstones() (int64, int64, error) { return *b.tomb, 100, nil }
+
+func TestTombstoneMonitor(t *testing.T) {
+	var tomb int64
+	m := New("tb", tombBS{testutil.New(), &tomb}, WithTombstoneMonitor(0.2))
+	for _, n := range []int64{5, 10, 20, 30, 40, 10, 50} {
+		tomb = n
+		m.Stats()
+	}
+	s := m.Stats()
+	if s.Counters["backend.compaction_needed_total"] != 2 || s.Gauges["backend.tombstone_count"] != 50 {
+		t.Fatal(s.Counters["backend.compaction_needed_total"], s.Gauges)
+	}
+	blk := mkBlocks(1)[0]
+	n := New("tb2", testutil.New(), WithTombstoneMonitor(0.2))
+	n.Put(context.Background(), blk)
+	n.DeleteBlock(context.Background(), blk.Cid())
+	if _, ok := n.Stats().Gauges["backend.tombstone_count"]; ok {
+		t.Fatal("unsupported backend reported")
+	}
+}
@@ -0,0 +1,57 @@
+package measure
+
+import (
+	"sync/atomic"
+)
+
+// WithTraceLog passes one in sampleRate operations to logger as a
+// structured entry, for trace-like visibility without a tracing
+// backend. Entries have the fields:
+//
+//	op        operation name, such as "get" or "putmany"
+//	cid       CID, formatted as set with WithCidFormatter, except for batches
+//	items     number of blocks, for batches only
+//	size      bytes read or written
+//	duration  time.Duration of the operation
+//	error     error message, for failed operations only
+//
+// logger is called on the goroutine of the operation, after it
+// completed. A sampleRate of 1 logs every operation.
+func WithTraceLog(sampleRate int, logger func(fields map[string]interface{})) Option {
+	return func(cfg *config) {
+		cfg.traceLogRate = sampleRate
+		cfg.traceLogger = logger
+	}
+}
+
+type traceLog struct {
+	m      *measure
+	rate   uint64
+	logger func(map[string]interface{})
+	seen   uint64 // updated atomically
+}
+
+func newTraceLog(m *measure, rate int, logger func(map[string]interface{})) *traceLog {
+	return &traceLog{m: m, rate: uint64(rate), logger: logger}
+}
+
+// record is an event sink logging a sample of the operations.
+func (t *traceLog) record(ev *opEvent) {
+	if atomic.AddUint64(&t.seen, 1)%t.rate != 0 {
+		return
+	}
+	fields := map[string]interface{}{
+		"op":       ev.Op,
+		"size":     ev.Bytes,
+		"duration": ev.Duration,
+	}
+	if ev.Cid.Defined() {
+		fields["cid"] = t.m.formatCid(ev.Cid)
+	} else {
+		fields["items"] = ev.Items
+	}
+	if ev.Err != nil {
+		fields["error"] = ev.Err.Error()
+	}
+	t.logger(fields)
+}
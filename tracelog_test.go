@@ -0,0 +1,36 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestTraceLog(t *testing.T) {
+	ctx := context.Background()
+	var entries []map[string]interface{}
+	m := New("tl", testutil.New(), WithTraceLog(1, func(f map[string]interface{}) { entries = append(entries, f) }))
+	b := blocks.NewBlock([]byte("abc"))
+	m.Put(ctx, b)
+	m.Get(ctx, b.Cid())
+	m.PutMany(ctx, mkBlocks(2))
+	m.Get(ctx, blocks.NewBlock([]byte("nope")).Cid())
+	if len(entries) != 4 || entries[0]["op"] != "put" || entries[1]["size"] != 3 || entries[1]["cid"] != b.Cid().String() {
+		t.Fatal(entries)
+	}
+	if _, ok := entries[1]["duration"].(time.Duration); !ok || entries[2]["items"] != 2 || entries[3]["error"] == nil {
+		t.Fatal(entries)
+	}
+	var n int
+	s := New("tl2", testutil.New(), WithTraceLog(3, func(map[string]interface{}) { n++ }))
+	for i := 0; i < 9; i++ {
+		s.Has(ctx, b.Cid())
+	}
+	if n != 3 {
+		t.Fatal(n)
+	}
+}
@@ -0,0 +1,154 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+var (
+	// ErrTTLUnsupported is returned by PutWithTTL when neither the backend
+	// nor the wrapper (see WithExpiry) can track expiry.
+	ErrTTLUnsupported = errors.New("measure: TTL writes are not supported")
+
+	// ErrExpiryLimit is returned by PutWithTTL when the expiry map is full.
+	ErrExpiryLimit = errors.New("measure: too many blocks with a pending expiry")
+)
+
+// WithExpiry enables PutWithTTL for backends that can't store expiry
+// themselves. Expiry times are kept in a map in the wrapper holding at
+// most maxEntries blocks, each costing roughly 150 bytes (the CID, the
+// expiry time and map overhead). Expired blocks are treated as missing by
+// Get, Has, GetSize and View, and are also deleted from the backend when
+// deleteExpired is set. When the map is full, PutWithTTL first deletes
+// the expired blocks from the backend, whatever deleteExpired, and
+// forgets their expiry to make room, counting them in
+// expiry.swept_total. Expiry is only tracked in memory and is lost on
+// restart.
+func WithExpiry(maxEntries int, deleteExpired bool) Option {
+	return func(cfg *config) {
+		cfg.expiryMax = maxEntries
+		cfg.expiryDelete = deleteExpired
+	}
+}
+
+type ttlPutter interface {
+	PutWithTTL(context.Context, blocks.Block, time.Duration) error
+}
+
+type expiryTracker struct {
+	max           int
+	deleteExpired bool
+
+	mu      sync.Mutex
+	expires map[cid.Cid]time.Time
+}
+
+// PutWithTTL stores blk and makes it disappear once ttl has elapsed. The
+// expiry is passed on to the backend if it supports TTL writes, otherwise
+// it is tracked by the wrapper when WithExpiry is set. Either way it is
+// measured as a Put; TTL writes to the backend skip write-behind and
+// write coalescing.
+func (m *measure) PutWithTTL(ctx context.Context, blk blocks.Block, ttl time.Duration) error {
+	if m.readOnly {
+		return m.rejectReadOnly(OpPut)
+	}
+	if tp := m.ttlPutter; tp != nil {
+		return m.put(ctx, blk, func(ctx context.Context, blk blocks.Block) error {
+			return tp.PutWithTTL(ctx, blk, ttl)
+		})
+	}
+	if m.expiry == nil {
+		m.wrapperError(OpPut)
+		return ErrTTLUnsupported
+	}
+
+	expires := m.clock.Now().Add(ttl)
+	m.expiry.mu.Lock()
+	_, tracked := m.expiry.expires[blk.Cid()]
+	full := !tracked && len(m.expiry.expires) >= m.expiry.max
+	m.expiry.mu.Unlock()
+	if full && m.sweepExpired(ctx) == 0 {
+		m.wrapperError(OpPut)
+		return ErrExpiryLimit
+	}
+
+	if err := m.Put(ctx, blk); err != nil {
+		return err
+	}
+	m.expiry.mu.Lock()
+	m.expiry.expires[blk.Cid()] = expires
+	m.expiry.mu.Unlock()
+	return nil
+}
+
+// expired reports whether c has a tracked expiry in the past, deleting
+// it from the backend if configured to.
+func (m *measure) expired(ctx context.Context, c cid.Cid) bool {
+	if m.expiry == nil {
+		return false
+	}
+	m.expiry.mu.Lock()
+	expires, ok := m.expiry.expires[c]
+	if !ok || m.clock.Now().Before(expires) {
+		m.expiry.mu.Unlock()
+		return false
+	}
+	if m.expiry.deleteExpired {
+		delete(m.expiry.expires, c)
+	}
+	m.expiry.mu.Unlock()
+
+	m.expiredNum.Inc()
+	if m.expiry.deleteExpired {
+		// Best effort, the block reads as missing either way.
+		_ = m.backend.DeleteBlock(ctx, c)
+	}
+	return true
+}
+
+// sweepExpired deletes the blocks whose expiry has passed from the
+// backend and forgets their expiry, returning how many were dropped.
+// Blocks the backend fails to delete are kept, as forgetting their
+// expiry would make them visible again.
+func (m *measure) sweepExpired(ctx context.Context) int {
+	now := m.clock.Now()
+	var expired []cid.Cid
+	m.expiry.mu.Lock()
+	for c, expires := range m.expiry.expires {
+		if !now.Before(expires) {
+			expired = append(expired, c)
+		}
+	}
+	m.expiry.mu.Unlock()
+
+	var n int
+	for _, c := range expired {
+		if err := m.backend.DeleteBlock(ctx, c); err != nil {
+			continue
+		}
+		m.expiry.mu.Lock()
+		if expires, ok := m.expiry.expires[c]; ok && !now.Before(expires) {
+			delete(m.expiry.expires, c)
+			n++
+		}
+		m.expiry.mu.Unlock()
+	}
+	m.reg.counter("expiry.swept_total", "Number of expired blocks deleted to make room for new expiries").Add(float64(n))
+	return n
+}
+
+// clearExpiry forgets the expiry of c, for when it is overwritten by a
+// permanent Put or deleted.
+func (m *measure) clearExpiry(c cid.Cid) {
+	if m.expiry == nil {
+		return
+	}
+	m.expiry.mu.Lock()
+	delete(m.expiry.expires, c)
+	m.expiry.mu.Unlock()
+}
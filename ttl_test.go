@@ -0,0 +1,118 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	format "github.com/ipfs/go-ipld-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+// ttlBackend stores TTL writes natively, recording their TTLs.
+type ttlBackend struct {
+	*testutil.Blockstore
+	ttls []time.Duration
+}
+
+func (b *ttlBackend) PutWithTTL(ctx context.Context, blk blocks.Block, ttl time.Duration) error {
+	b.ttls = append(b.ttls, ttl)
+	return b.Put(ctx, blk)
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	m := New("test", testutil.New(), WithClock(clock), WithExpiry(10, true))
+	blk := mkBlocks(1)[0]
+
+	if err := m.PutWithTTL(ctx, blk, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get(ctx, blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(2 * time.Second)
+	if _, err := m.Get(ctx, blk.Cid()); !format.IsNotFound(err) {
+		t.Fatalf("got %v reading an expired block, want not found", err)
+	}
+	if got := statCounter(m, "expired_total"); got != 1 {
+		t.Fatalf("expired_total = %v, want 1", got)
+	}
+}
+
+func TestTTLUnsupported(t *testing.T) {
+	m := New("test", testutil.New())
+	if err := m.PutWithTTL(context.Background(), mkBlocks(1)[0], time.Second); err != ErrTTLUnsupported {
+		t.Fatalf("got %v, want ErrTTLUnsupported", err)
+	}
+}
+
+func TestTTLSweep(t *testing.T) {
+	ctx := context.Background()
+	for _, deleteExpired := range []bool{false, true} {
+		clock := newFakeClock()
+		fb := testutil.New()
+		m := New("test", fb, WithClock(clock), WithExpiry(2, deleteExpired))
+		blks := mkBlocks(4)
+
+		for _, b := range blks[:2] {
+			if err := m.PutWithTTL(ctx, b, time.Second); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := m.PutWithTTL(ctx, blks[2], time.Second); err != ErrExpiryLimit {
+			t.Fatalf("got %v with a full map, want ErrExpiryLimit", err)
+		}
+		// Once expired, the entries make room for new ones.
+		clock.Advance(2 * time.Second)
+		for _, b := range blks[2:] {
+			if err := m.PutWithTTL(ctx, b, time.Second); err != nil {
+				t.Fatalf("deleteExpired %t: %v", deleteExpired, err)
+			}
+		}
+		for _, b := range blks[:2] {
+			if ok, _ := m.Has(ctx, b.Cid()); ok {
+				t.Fatalf("deleteExpired %t: swept block visible again", deleteExpired)
+			}
+			if ok, _ := fb.Has(ctx, b.Cid()); ok {
+				t.Fatalf("deleteExpired %t: swept block left in the backend", deleteExpired)
+			}
+		}
+		if got := statCounter(m, "expiry.swept_total"); got != 2 {
+			t.Fatalf("deleteExpired %t: expiry.swept_total = %v, want 2", deleteExpired, got)
+		}
+	}
+}
+
+func TestTTLNative(t *testing.T) {
+	ctx := context.Background()
+	fb := &ttlBackend{Blockstore: testutil.New()}
+	m := New("test", fb, WithTagExtractor(TagFromContext))
+	blk := mkBlocks(1)[0]
+
+	if err := m.PutWithTTL(ContextWithTag(ctx, "cache"), blk, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if len(fb.ttls) != 1 || fb.ttls[0] != time.Minute {
+		t.Fatalf("backend got TTLs %v", fb.ttls)
+	}
+	if got := statCounter(m, "put_total"); got != 1 {
+		t.Fatalf("put_total = %v, want 1", got)
+	}
+	if got := statCounter(m, "tag.cache.put_total"); got != 1 {
+		t.Fatalf("tag.cache.put_total = %v, want 1", got)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.PutWithTTL(ctx, blk, time.Minute); err != ErrClosed {
+		t.Fatalf("got %v after Close, want ErrClosed", err)
+	}
+	if len(fb.ttls) != 1 {
+		t.Fatal("TTL write reached the backend after Close")
+	}
+}
@@ -0,0 +1,56 @@
+package measure
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// hashOnRead tracks whether the backend verifies blocks on read, so that
+// verified reads can be told apart from the others.
+type hashOnRead struct {
+	enabled int32
+	gauge   metrics.Gauge
+
+	once sync.Once
+	get  metrics.Histogram
+	view metrics.Histogram
+}
+
+// HashOnRead passes enabled on to the backend. While it is on, Get and
+// View latencies are recorded in get.verified.latency_seconds and
+// view.verified.latency_seconds instead of the usual histograms, so that
+// the cost of verification shows, and the hash_on_read gauge is 1.
+func (m *measure) HashOnRead(enabled bool) {
+	m.backend.HashOnRead(enabled)
+	if !enabled {
+		atomic.StoreInt32(&m.hashOnRead.enabled, 0)
+		m.hashOnRead.gauge.Set(0)
+		return
+	}
+	m.hashOnRead.once.Do(func() {
+		m.hashOnRead.get = m.reg.latency("get.verified.latency",
+			"Latency distribution of Blockstore.Get calls with HashOnRead enabled")
+		m.hashOnRead.view = m.reg.latency("view.verified.latency",
+			"Latency distribution of Blockstore.View calls with HashOnRead enabled")
+	})
+	atomic.StoreInt32(&m.hashOnRead.enabled, 1)
+	m.hashOnRead.gauge.Set(1)
+}
+
+// readLatency returns the latency histogram of a Get, or of a View if
+// view is set, depending on whether reads are verified.
+func (m *measure) readLatency(view bool) metrics.Histogram {
+	verified := atomic.LoadInt32(&m.hashOnRead.enabled) != 0
+	switch {
+	case view && verified:
+		return m.hashOnRead.view
+	case view:
+		return m.viewLatency
+	case verified:
+		return m.hashOnRead.get
+	default:
+		return m.getLatency
+	}
+}
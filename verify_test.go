@@ -0,0 +1,31 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestHashOnReadLatency(t *testing.T) {
+	ctx := context.Background()
+	m := New("hor", testutil.New())
+	b := blocks.NewBlock([]byte("x"))
+	m.Put(ctx, b)
+	m.Get(ctx, b.Cid()) // cold
+	m.Get(ctx, b.Cid())
+	m.HashOnRead(true)
+	m.Get(ctx, b.Cid())
+	m.Get(ctx, b.Cid())
+	m.HashOnRead(false)
+	m.Get(ctx, b.Cid())
+	st := m.Stats()
+	if st.Histograms["get.latency_seconds"].Count != 2 || st.Histograms["get.verified.latency_seconds"].Count != 2 {
+		t.Fatal(st.Histograms["get.latency_seconds"].Count, st.Histograms["get.verified.latency_seconds"].Count)
+	}
+	if st.Gauges["hash_on_read"] != 0 {
+		t.Fatal("gauge")
+	}
+}
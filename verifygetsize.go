@@ -0,0 +1,78 @@
+package measure
+
+import (
+	"context"
+	"math/rand"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// VerifyGetSize checks, on up to sampleCount keys picked at random among
+// those enumerated by AllKeysChan, that the backend's GetSize matches
+// the length of the block returned by its Get, and returns the number of
+// mismatches, also counted in verifygetsize.mismatch_total. It catches
+// backends whose GetSize drifts from the data, as a periodic self-check
+// rather than per request like WithGetSizeCheck: every key is enumerated
+// to draw the sample, and every sampled block read whole.
+//
+// Keys deleted while checking are skipped. It stops when ctx is done or
+// the backend fails, returning the mismatches found so far with the
+// error.
+func (m *measure) VerifyGetSize(ctx context.Context, sampleCount int) (mismatches int, err error) {
+	if sampleCount <= 0 {
+		return 0, nil
+	}
+	mismatch := m.reg.counter("verifygetsize.mismatch_total",
+		"Number of sampled blocks whose GetSize disagreed with the length of their data")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	keys, err := m.AllKeysChan(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// Vitter's algorithm R draws the sample in a single pass.
+	sample := make([]cid.Cid, 0, sampleCount)
+	var seen int64
+	for c := range keys {
+		seen++
+		if len(sample) < sampleCount {
+			sample = append(sample, c)
+		} else if i := rand.Int63n(seen); i < int64(sampleCount) {
+			sample[i] = c
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, c := range sample {
+		if err := ctx.Err(); err != nil {
+			return mismatches, err
+		}
+		ok, err := m.getSizeMatches(ctx, c)
+		if err != nil && !format.IsNotFound(err) {
+			return mismatches, err
+		}
+		if err == nil && !ok {
+			mismatches++
+			mismatch.Inc()
+		}
+	}
+	return mismatches, nil
+}
+
+// getSizeMatches reports whether the backend's GetSize of c matches the
+// length of the block its Get returns.
+func (m *measure) getSizeMatches(ctx context.Context, c cid.Cid) (bool, error) {
+	size, err := m.backend.GetSize(ctx, c)
+	if err != nil {
+		return false, err
+	}
+	blk, err := m.backend.Get(ctx, c)
+	if err != nil {
+		return false, err
+	}
+	return len(blk.RawData()) == size, nil
+}
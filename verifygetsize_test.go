@@ -0,0 +1,42 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type wrongSizeBS struct {
+	*testutil.Blockstore
+	wrong cid.Cid
+}
+
+func (b wrongSizeBS) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	n, err := b.Blockstore.GetSize(ctx, c)
+	if c == b.wrong {
+		n++
+	}
+	return n, err
+}
+
+func TestVerifyGetSize(t *testing.T) {
+	ctx := context.Background()
+	blks := mkBlocks(5)
+	bs := wrongSizeBS{testutil.New(), blks[2].Cid()}
+	for _, b := range blks {
+		bs.Blockstore.Put(ctx, b)
+	}
+	m := New("vgs", bs)
+	n, err := m.VerifyGetSize(ctx, 10)
+	if err != nil || n != 1 || m.Stats().Counters["verifygetsize.mismatch_total"] != 1 {
+		t.Fatal(n, err)
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := m.VerifyGetSize(cctx, 10); err == nil {
+		t.Fatal("not cancelled")
+	}
+}
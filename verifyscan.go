@@ -0,0 +1,255 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+const (
+	// DefaultVerifyParallelism is the number of blocks Verify checks at
+	// once when VerifyOptions.Parallelism is zero.
+	DefaultVerifyParallelism = 4
+	// DefaultVerifyMaxCorrupt is the number of corrupt CIDs Verify lists
+	// when VerifyOptions.MaxCorrupt is zero.
+	DefaultVerifyMaxCorrupt = 1000
+)
+
+// ErrCheckpointNotFound is returned by Verify when the key to resume
+// after isn't enumerated by the backend.
+var ErrCheckpointNotFound = errors.New("measure: verify checkpoint not found")
+
+// VerifyOptions configures Verify.
+type VerifyOptions struct {
+	// Parallelism is the number of blocks read and hashed at once.
+	Parallelism int
+	// BlocksPerSecond, if positive, limits the rate blocks are read at.
+	BlocksPerSecond int
+	// MaxCorrupt is the number of corrupt CIDs listed in the report,
+	// the others being only counted.
+	MaxCorrupt int
+	// Resume, if defined, is the Checkpoint of an earlier report. The
+	// keys enumerated up to and including it are skipped, which relies
+	// on the backend enumerating its keys in a stable order, as flatfs
+	// and badger do.
+	Resume cid.Cid
+}
+
+// VerifyReport describes the outcome of Verify.
+type VerifyReport struct {
+	// Checked counts the blocks read and hashed, Missing the keys that
+	// were enumerated but whose block couldn't be found.
+	Checked int
+	Missing int
+	// Corrupt lists the blocks whose data doesn't hash to their CID, up
+	// to VerifyOptions.MaxCorrupt, and CorruptOverflow counts the others.
+	Corrupt         []cid.Cid
+	CorruptOverflow int
+	// Checkpoint is the last key such that it and all the keys
+	// enumerated before it were checked. Passed as VerifyOptions.Resume,
+	// it resumes a scan that stopped early.
+	Checkpoint cid.Cid
+	Duration   time.Duration
+}
+
+// Verify reads every block of the store, from the backend rather than
+// from the wrapper's caches, and checks that its data hashes to its CID.
+// Blocks are read with View when the backend supports it.
+//
+// Progress is published in the verify.blocks_checked gauge, reset when
+// a scan starts, and the problems found are counted in
+// verify.corrupt_total and verify.missing_total. The scan stops when ctx
+// is done or a block can't be read for another reason than being
+// missing, returning the report so far with the error.
+func (m *measure) Verify(ctx context.Context, opts VerifyOptions) (VerifyReport, error) {
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = DefaultVerifyParallelism
+	}
+	maxCorrupt := opts.MaxCorrupt
+	if maxCorrupt <= 0 {
+		maxCorrupt = DefaultVerifyMaxCorrupt
+	}
+	checked := m.reg.gauge("verify.blocks_checked", "Number of blocks checked by the current verification")
+	corrupt := m.reg.counter("verify.corrupt_total", "Number of blocks found corrupt by verifications")
+	missing := m.reg.counter("verify.missing_total", "Number of enumerated blocks verifications couldn't find")
+	checked.Set(0)
+
+	start := time.Now()
+	rep := VerifyReport{Checkpoint: opts.Resume}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	keys, err := m.AllKeysChan(ctx)
+	if err != nil {
+		return rep, err
+	}
+
+	var limit *verifyLimiter
+	if opts.BlocksPerSecond > 0 {
+		limit = newVerifyLimiter(opts.BlocksPerSecond)
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		// finished holds the blocks checked out of order, by index, and
+		// next is the index of the first block not checked yet.
+		finished = make(map[int]cid.Cid)
+		next     int
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	type job struct {
+		i int
+		c cid.Cid
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for n := 0; n < parallelism; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if limit != nil {
+					if err := limit.wait(ctx); err != nil {
+						fail(err)
+						continue
+					}
+				}
+				bad, err := m.verifyBlock(ctx, j.c)
+				notFound := format.IsNotFound(err)
+				if err != nil && !notFound {
+					fail(err)
+					continue
+				}
+
+				mu.Lock()
+				switch {
+				case notFound:
+					rep.Missing++
+					missing.Inc()
+				case bad:
+					if len(rep.Corrupt) < maxCorrupt {
+						rep.Corrupt = append(rep.Corrupt, j.c)
+					} else {
+						rep.CorruptOverflow++
+					}
+					corrupt.Inc()
+				}
+				rep.Checked++
+				checked.Set(float64(rep.Checked))
+				finished[j.i] = j.c
+				for {
+					c, ok := finished[next]
+					if !ok {
+						break
+					}
+					delete(finished, next)
+					rep.Checkpoint = c
+					next++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	skipping := opts.Resume.Defined()
+	i := 0
+feed:
+	for c := range keys {
+		if skipping {
+			skipping = !c.Equals(opts.Resume)
+			continue
+		}
+		select {
+		case jobs <- job{i, c}:
+			i++
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	rep.Duration = time.Since(start)
+	if firstErr != nil {
+		return rep, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return rep, err
+	}
+	if skipping {
+		return rep, ErrCheckpointNotFound
+	}
+	return rep, nil
+}
+
+// verifyBlock reads c from the backend and reports whether its data
+// doesn't hash to it.
+func (m *measure) verifyBlock(ctx context.Context, c cid.Cid) (corrupt bool, err error) {
+	check := func(data []byte) error {
+		sum, err := c.Prefix().Sum(data)
+		if err != nil {
+			return err
+		}
+		corrupt = !sum.Equals(c)
+		return nil
+	}
+	if v := m.viewer; v != nil {
+		err = v.View(ctx, c, check)
+	} else {
+		var blk blocks.Block
+		blk, err = m.backend.Get(ctx, c)
+		if err == nil {
+			err = check(blk.RawData())
+		}
+	}
+	// Backends hashing on read report corrupt blocks as errors.
+	if errors.Is(err, blockstore.ErrHashMismatch) {
+		return true, nil
+	}
+	return corrupt, err
+}
+
+// verifyLimiter paces the blocks read by Verify.
+type verifyLimiter struct {
+	mu     sync.Mutex
+	bucket tokenBucket
+}
+
+func newVerifyLimiter(blocksPerSecond int) *verifyLimiter {
+	n := float64(blocksPerSecond)
+	return &verifyLimiter{bucket: tokenBucket{tokens: 1, capacity: 1, rate: n, last: time.Now()}}
+}
+
+// wait returns once a block may be read, or early with the context's
+// error if ctx is done first.
+func (l *verifyLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	delay := l.bucket.reserve(time.Now())
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,79 @@
+package measure
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type orderedBS struct {
+	*testutil.Blockstore
+	extra []cid.Cid
+}
+
+func (o *orderedBS) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	var keys []cid.Cid
+	in, err := o.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for c := range in {
+		keys = append(keys, c)
+	}
+	keys = append(keys, o.extra...)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyString() < keys[j].KeyString() })
+	ch := make(chan cid.Cid, len(keys))
+	for _, c := range keys {
+		ch <- c
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestVerifyScan(t *testing.T) {
+	ctx := context.Background()
+	bs := &orderedBS{Blockstore: testutil.New()}
+	for _, b := range mkBlocks(20) {
+		bs.Put(ctx, b)
+	}
+	for i := 0; i < 3; i++ {
+		good := blocks.NewBlock([]byte{byte(i), 'c'})
+		bad, _ := blocks.NewBlockWithCid([]byte("garbage"), good.Cid())
+		bs.Put(ctx, bad)
+	}
+	bs.extra = []cid.Cid{blocks.NewBlock([]byte("gone")).Cid()}
+	m := New("vs", bs)
+	rep, err := m.Verify(ctx, VerifyOptions{Parallelism: 3, MaxCorrupt: 2})
+	if err != nil || rep.Checked != 24 || rep.Missing != 1 || len(rep.Corrupt) != 2 || rep.CorruptOverflow != 1 {
+		t.Fatal(err, rep)
+	}
+	st := m.Stats()
+	if st.Gauges["verify.blocks_checked"] != 24 || st.Counters["verify.corrupt_total"] != 3 || st.Counters["verify.missing_total"] != 1 {
+		t.Fatal(st.Gauges, st.Counters)
+	}
+	keys, _ := bs.AllKeysChan(ctx)
+	var all []cid.Cid
+	for c := range keys {
+		all = append(all, c)
+	}
+	if !rep.Checkpoint.Equals(all[len(all)-1]) {
+		t.Fatal("checkpoint")
+	}
+	rep, err = m.Verify(ctx, VerifyOptions{Resume: all[9], BlocksPerSecond: 1000})
+	if err != nil || rep.Checked != 14 {
+		t.Fatal(err, rep)
+	}
+	if _, err = m.Verify(ctx, VerifyOptions{Resume: blocks.NewBlock([]byte("nope")).Cid()}); err != ErrCheckpointNotFound {
+		t.Fatal(err)
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = m.Verify(cctx, VerifyOptions{}); err == nil {
+		t.Fatal("cancel")
+	}
+}
@@ -0,0 +1,60 @@
+package measure
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// PrefixViewer is implemented by backends able to read the beginning of
+// a block without reading all of it. ViewPrefix calls f with at most
+// the first n bytes of the block.
+type PrefixViewer interface {
+	ViewPrefix(ctx context.Context, c cid.Cid, n int, f func([]byte) error) error
+}
+
+// ViewPrefix calls f with the first n bytes of the block c, or all of
+// it if it is shorter, for example to read a header. When the backend
+// is a PrefixViewer only those bytes are read; otherwise the block is
+// read whole with View, recorded as such, and the fallback counted in
+// viewprefix.full_read_fallback_total. Calls are counted in
+// viewprefix_total and timed in viewprefix.latency_seconds, and the
+// bytes passed to f are counted in viewprefix.bytes_total. PrefixViewers
+// returning more than n bytes, which are cut before reaching f, have
+// the excess observed in viewprefix.overread_bytes, to show backends
+// ignoring the range.
+func (m *measure) ViewPrefix(ctx context.Context, c cid.Cid, n int, f func([]byte) error) (err error) {
+	if n < 0 {
+		n = 0
+	}
+	m.reg.counter("viewprefix_total", "Number of ViewPrefix calls").Inc()
+	defer recordLatency(m.clock, m.reg.latency("viewprefix.latency", "Latency distribution of ViewPrefix calls"), m.clock.Now())
+	defer func() {
+		if err != nil && !format.IsNotFound(err) {
+			m.reg.counter("viewprefix.errors_total", "Number of failed ViewPrefix calls").Inc()
+		}
+	}()
+	bytesRead := m.reg.counter("viewprefix.bytes_total", "Number of bytes passed to ViewPrefix callbacks")
+	prefix := func(data []byte) error {
+		if len(data) > n {
+			data = data[:n]
+		}
+		bytesRead.Add(float64(len(data)))
+		return f(data)
+	}
+
+	if m.prefixViewer != nil {
+		return m.prefixViewer.ViewPrefix(ctx, c, n, func(data []byte) error {
+			if len(data) > n {
+				m.reg.histogram("viewprefix.overread_bytes",
+					"Distribution of the bytes returned by backends beyond the prefix asked for",
+					datastoreSizeBuckets).Observe(float64(len(data) - n))
+			}
+			return prefix(data)
+		})
+	}
+	m.reg.counter("viewprefix.full_read_fallback_total",
+		"Number of ViewPrefix calls that read the whole block because the backend can't read a prefix").Inc()
+	return m.View(ctx, c, prefix)
+}
@@ -0,0 +1,83 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+type prefixBS struct {
+	*testutil.Blockstore
+	asked int
+}
+
+func (p *prefixBS) ViewPrefix(ctx context.Context, c cid.Cid, n int, f func([]byte) error) error {
+	p.asked = n
+	blk, err := p.Blockstore.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+	d := blk.RawData()
+	if len(d) > n {
+		d = d[:n]
+	}
+	return f(d)
+}
+
+func TestViewPrefix(t *testing.T) {
+	ctx := context.Background()
+	b := blocks.NewBlock([]byte("0123456789"))
+	for _, ranged := range []bool{true, false} {
+		mem := testutil.New()
+		var bs interface{}
+		p := &prefixBS{Blockstore: mem}
+		m := New("vp", mem)
+		if ranged {
+			m = New("vp", p)
+		}
+		_ = bs
+		m.Put(ctx, b)
+		var got []byte
+		if err := m.ViewPrefix(ctx, b.Cid(), 4, func(d []byte) error { got = append(got, d...); return nil }); err != nil {
+			t.Fatal(err)
+		}
+		st := m.Stats()
+		if string(got) != "0123" || st.Counters["viewprefix.bytes_total"] != 4 {
+			t.Fatal(ranged, string(got), st.Counters)
+		}
+		if ranged != (st.Counters["viewprefix.full_read_fallback_total"] == 0) || ranged != (p.asked == 4) {
+			t.Fatal(ranged, st.Counters)
+		}
+		m.ViewPrefix(ctx, b.Cid(), 100, func(d []byte) error { got = d; return nil })
+		if !ranged && len(got) != 10 {
+			t.Fatal(len(got))
+		}
+	}
+}
+
+type ignoreRangeBS struct{ *testutil.Blockstore }
+
+func (p ignoreRangeBS) ViewPrefix(ctx context.Context, c cid.Cid, n int, f func([]byte) error) error {
+	blk, err := p.Blockstore.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+	return f(blk.RawData())
+}
+
+func TestViewPrefixOverread(t *testing.T) {
+	ctx := context.Background()
+	m := New("vo", ignoreRangeBS{testutil.New()})
+	b := blocks.NewBlock([]byte("0123456789"))
+	m.Put(ctx, b)
+	var got int
+	m.ViewPrefix(ctx, b.Cid(), 3, func(d []byte) error { got = len(d); return nil })
+	h := m.Stats().Histograms["viewprefix.overread_bytes"]
+	if got != 3 || h.Count != 1 || h.Sum != 7 {
+		t.Fatal(got, h)
+	}
+}
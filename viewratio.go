@@ -0,0 +1,89 @@
+package measure
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// viewRatioEvery is how often reads refresh view_to_get_ratio.
+const viewRatioEvery = time.Second
+
+// viewRatio maintains the informational view_to_get_ratio gauge: the
+// number of View calls served by the backend's View over the number of
+// Get calls, computed from view_total and get_total. Views avoid a copy,
+// so a low ratio in a read-and-discard workload hints that callers
+// should switch to View. It is refreshed by Stats and at most once a
+// second by reads, and stays unset until the first Get.
+type viewRatio struct {
+	ratio metrics.Gauge
+	// last is the UnixNano time of the last refresh by a read.
+	last int64 // updated atomically
+}
+
+func newViewRatio(r *registry) *viewRatio {
+	return &viewRatio{
+		ratio: r.gauge("view_to_get_ratio",
+			"Number of Blockstore.View calls over the number of Blockstore.Get calls"),
+	}
+}
+
+// refreshViewRatio sets view_to_get_ratio from the current counts.
+func (m *measure) refreshViewRatio() {
+	gets := counterValue(m.getNum)
+	if gets == 0 {
+		return
+	}
+	m.viewRatio.ratio.Set(counterValue(m.viewNum) / gets)
+}
+
+// observeViewRatio refreshes view_to_get_ratio after a read if it wasn't
+// in the last viewRatioEvery.
+func (m *measure) observeViewRatio() {
+	now := m.clock.Now().UnixNano()
+	last := atomic.LoadInt64(&m.viewRatio.last)
+	if now-last < int64(viewRatioEvery) || !atomic.CompareAndSwapInt64(&m.viewRatio.last, last, now) {
+		return
+	}
+	m.refreshViewRatio()
+}
+
+// readPaths counts, for backends that implement View, the reads made
+// with Get in read.via_get_total and with View in read.via_view_total.
+// Get copies the block where View lends the backend's buffer, so Gets
+// whose data is only looked at are an optimization opportunity.
+type readPaths struct {
+	viaGet  metrics.Counter
+	viaView metrics.Counter
+}
+
+func newReadPaths(r *registry) *readPaths {
+	return &readPaths{
+		viaGet:  r.counter("read.via_get_total", "Number of Get calls on a backend that also implements View"),
+		viaView: r.counter("read.via_view_total", "Number of View calls served by the backend's View"),
+	}
+}
+
+// countReadPath counts a read, made with View if view is set.
+func (m *measure) countReadPath(view bool) {
+	if m.readPaths == nil {
+		return
+	}
+	if view {
+		m.readPaths.viaView.Inc()
+	} else {
+		m.readPaths.viaGet.Inc()
+	}
+}
+
+// countViewFallback counts a View of a block of size bytes served with
+// Get because the backend has no View, in view.fallback_total, and the
+// bytes the backend materialized and copied for it in
+// view.fallback_bytes_total. Together they show what the missing native
+// View costs.
+func (m *measure) countViewFallback(size int) {
+	m.reg.counter("view.fallback_total", "Number of View calls served with Get because the backend has no View").Inc()
+	m.reg.counter("view.fallback_bytes_total",
+		"Number of bytes copied by View calls served with Get because the backend has no View").Add(float64(size))
+}
@@ -0,0 +1,64 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestViewToGetRatio(t *testing.T) {
+	mem := testutil.New()
+	m := New("vr", mem)
+	ctx := context.Background()
+	blks := mkBlocks(1)
+	m.Put(ctx, blks[0])
+	for i := 0; i < 3; i++ {
+		m.View(ctx, blks[0].Cid(), func([]byte) error { return nil })
+	}
+	for i := 0; i < 2; i++ {
+		m.Get(ctx, blks[0].Cid())
+	}
+	s := m.Stats()
+	if s.Counters["view_total"] != 3 || s.Gauges["view_to_get_ratio"] != 1.5 {
+		t.Fatal(s.Counters["view_total"], s.Gauges["view_to_get_ratio"])
+	}
+}
+
+func TestReadPaths(t *testing.T) {
+	ctx := context.Background()
+	mem := testutil.New()
+	m := New("rp", mem)
+	b := mkBlocks(1)[0]
+	mem.Put(ctx, b)
+	m.Get(ctx, b.Cid())
+	m.View(ctx, b.Cid(), func([]byte) error { return nil })
+	m.View(ctx, b.Cid(), func([]byte) error { return nil })
+	s := m.Stats()
+	if s.Counters["read.via_get_total"] != 1 || s.Counters["read.via_view_total"] != 2 {
+		t.Fatal(s.Counters)
+	}
+	m2 := New("rp2", mem.Plain())
+	m2.Get(ctx, b.Cid())
+	if _, ok := m2.Stats().Counters["read.via_get_total"]; ok {
+		t.Fatal("counted without View")
+	}
+}
+
+func TestViewFallbackBytes(t *testing.T) {
+	ctx := context.Background()
+	bs := testutil.New().Plain()
+	blk := blocks.NewBlock(bytes.Repeat([]byte{7}, 1024))
+	bs.Put(ctx, blk)
+	m := New("vf", bs)
+	if err := m.View(ctx, blk.Cid(), func([]byte) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	s := m.Stats()
+	if s.Counters["view.fallback_bytes_total"] != 1024 || s.Counters["view.fallback_total"] != 1 {
+		t.Fatal(s.Counters)
+	}
+}
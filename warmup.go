@@ -0,0 +1,68 @@
+package measure
+
+import (
+	"sync/atomic"
+
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// DefaultWarmupOps is the number of operations WithWarmupLatency treats
+// as warm-up when given zero.
+const DefaultWarmupOps = 10
+
+// WithWarmupLatency diverts the latency of n operations of each type
+// (DefaultWarmupOps if n is zero) to <op>.warmup_latency, so that
+// backends which are slow until their caches fill, such as a badger store
+// replaying its manifest, don't skew the main histograms after every
+// restart. These are the operations following the very first one, which
+// goes to cold_start.latency as usual. warmup_complete_timestamp_seconds
+// is set to the Unix time at which an operation type last finished
+// warming up.
+func WithWarmupLatency(n int) Option {
+	return func(cfg *config) {
+		if n == 0 {
+			n = DefaultWarmupOps
+		}
+		cfg.warmupOps = n
+	}
+}
+
+type warmupHistogram struct {
+	metrics.Histogram
+	seen    int64 // updated atomically
+	n       int64
+	warmup  metrics.Histogram
+	onReady func()
+}
+
+func (m *measure) newWarmupHistogram(op Op, h metrics.Histogram, n int, complete metrics.Gauge) *warmupHistogram {
+	return &warmupHistogram{
+		Histogram: h,
+		n:         int64(n),
+		warmup: m.reg.latency(string(op)+".warmup_latency",
+			"Latency distribution of the first calls after startup"),
+		onReady: func() {
+			complete.Set(float64(m.clock.Now().UnixNano()) / 1e9)
+		},
+	}
+}
+
+func (h *warmupHistogram) Observe(v float64) {
+	h.target().Observe(v)
+}
+
+// target returns the histogram the next observation goes to.
+func (h *warmupHistogram) target() metrics.Histogram {
+	if atomic.LoadInt64(&h.seen) >= h.n {
+		return h.Histogram
+	}
+	switch i := atomic.AddInt64(&h.seen, 1); {
+	case i < h.n:
+		return h.warmup
+	case i == h.n:
+		h.onReady()
+		return h.warmup
+	default:
+		return h.Histogram
+	}
+}
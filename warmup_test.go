@@ -0,0 +1,26 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestWarmupLatency(t *testing.T) {
+	ctx := context.Background()
+	m := New("wu", testutil.New(), WithWarmupLatency(3))
+	c := blocks.NewBlock([]byte("x")).Cid()
+	for i := 0; i < 6; i++ {
+		m.Has(ctx, c)
+	}
+	st := m.Stats()
+	if st.Histograms["has.warmup_latency_seconds"].Count != 3 || st.Histograms["has.latency_seconds"].Count != 2 {
+		t.Fatal(st.Histograms["has.warmup_latency_seconds"], st.Histograms["has.latency_seconds"])
+	}
+	if st.Gauges["warmup_complete_timestamp_seconds"] == 0 {
+		t.Fatal("gauge")
+	}
+}
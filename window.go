@@ -0,0 +1,87 @@
+package measure
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// batchWindowSpan is how far back putmany.batch_size_avg looks.
+	batchWindowSpan = time.Minute
+	// batchWindowCap bounds how many batches the window remembers. Under
+	// heavier PutMany traffic the average covers fewer than a minute.
+	batchWindowCap = 256
+)
+
+// batchWindow remembers the sizes of recent batches to compute a moving
+// average.
+type batchWindow struct {
+	mu    sync.Mutex
+	sizes [batchWindowCap]int
+	times [batchWindowCap]time.Time
+	next  int
+	n     int
+}
+
+// add records a batch of size items at now and returns the average size
+// of the batches recorded within batchWindowSpan of now.
+func (w *batchWindow) add(now time.Time, size int) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sizes[w.next] = size
+	w.times[w.next] = now
+	w.next = (w.next + 1) % batchWindowCap
+	if w.n < batchWindowCap {
+		w.n++
+	}
+
+	cutoff := now.Add(-batchWindowSpan)
+	var total, count int
+	for i := 0; i < w.n; i++ {
+		if w.times[i].Before(cutoff) {
+			continue
+		}
+		total += w.sizes[i]
+		count++
+	}
+	return float64(total) / float64(count)
+}
+
+// errorWindowSeconds is how far back the error_rate gauge looks.
+const errorWindowSeconds = 60
+
+// errorWindow tallies the outcomes of operations in one-second buckets
+// to compute the fraction that failed over the last minute.
+type errorWindow struct {
+	mu      sync.Mutex
+	buckets [errorWindowSeconds]struct {
+		second      int64
+		calls, errs int
+	}
+}
+
+// add records an operation at now, failed or not, and returns the
+// fraction of the operations within errorWindowSeconds of now that
+// failed.
+func (w *errorWindow) add(now time.Time, failed bool) float64 {
+	sec := now.Unix()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	b := &w.buckets[sec%errorWindowSeconds]
+	if b.second != sec {
+		b.second, b.calls, b.errs = sec, 0, 0
+	}
+	b.calls++
+	if failed {
+		b.errs++
+	}
+
+	var calls, errs int
+	for _, b := range w.buckets {
+		if b.second > sec-errorWindowSeconds && b.second <= sec {
+			calls += b.calls
+			errs += b.errs
+		}
+	}
+	return float64(errs) / float64(calls)
+}
@@ -0,0 +1,37 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestBatchSizeAvg(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	m := New("test", testutil.New(), WithClock(clock))
+
+	for _, n := range []int{10, 20} {
+		if err := m.PutMany(ctx, mkBlocks(n)); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(20 * time.Second)
+	}
+	if got := statGauge(m, "putmany.batch_size_avg"); got != 15 {
+		t.Fatalf("putmany.batch_size_avg = %v, want 15", got)
+	}
+
+	// The batch of 10 falls out of the window.
+	clock.Advance(25 * time.Second)
+	m.PutMany(ctx, mkBlocks(50))
+	if got := statGauge(m, "putmany.batch_size_avg"); got != 35 {
+		t.Fatalf("putmany.batch_size_avg = %v, want 35", got)
+	}
+	clock.Advance(2 * time.Minute)
+	m.PutMany(ctx, mkBlocks(4))
+	if got := statGauge(m, "putmany.batch_size_avg"); got != 4 {
+		t.Fatalf("putmany.batch_size_avg = %v after a quiet spell, want 4", got)
+	}
+}
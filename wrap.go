@@ -0,0 +1,41 @@
+package measure
+
+import (
+	"fmt"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// measured is implemented by measure wrappers.
+type measured interface {
+	measurePrefix() string
+}
+
+func (m *measure) measurePrefix() string { return m.reg.prefix }
+
+// IsMeasured reports whether bs is a measure wrapper.
+func IsMeasured(bs blockstore.Blockstore) bool {
+	_, ok := bs.(measured)
+	return ok
+}
+
+// Wrap is New, except that it returns bs unchanged, ignoring opts, when
+// bs already is a measure wrapper with the same prefix, so that wrapping
+// twice doesn't count every operation twice. A wrapper with a different
+// prefix is wrapped again on purpose; use WrapStrict to reject it.
+func Wrap(prefix string, bs blockstore.Blockstore, opts ...Option) blockstore.Blockstore {
+	if m, ok := bs.(measured); ok && m.measurePrefix() == prefix {
+		return bs
+	}
+	return New(prefix, bs, opts...)
+}
+
+// WrapStrict is Wrap, but fails when bs is a measure wrapper with a
+// different prefix.
+func WrapStrict(prefix string, bs blockstore.Blockstore, opts ...Option) (blockstore.Blockstore, error) {
+	if m, ok := bs.(measured); ok && m.measurePrefix() != prefix {
+		return nil, fmt.Errorf("measure: blockstore is already measured with prefix %q, not wrapping it again as %q",
+			m.measurePrefix(), prefix)
+	}
+	return Wrap(prefix, bs, opts...), nil
+}
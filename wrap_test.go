@@ -0,0 +1,81 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestWrap(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		prefix string
+		strict bool
+		// same is whether the inner wrapper is returned unchanged.
+		same    bool
+		wantErr bool
+	}{
+		{"same prefix", "inner", false, true, false},
+		{"different prefix", "outer", false, false, false},
+		{"strict same prefix", "inner", true, true, false},
+		{"strict different prefix", "outer", true, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			inner := New("inner", testutil.New())
+			var bs blockstore.Blockstore
+			var err error
+			if tc.strict {
+				bs, err = WrapStrict(tc.prefix, inner)
+			} else {
+				bs = Wrap(tc.prefix, inner)
+			}
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if same := bs == blockstore.Blockstore(inner); same != tc.same {
+				t.Fatalf("returned the inner wrapper = %v, want %v", same, tc.same)
+			}
+			if !IsMeasured(bs) {
+				t.Fatal("IsMeasured = false for a wrapper")
+			}
+
+			// A nested wrapper counts the operation at both levels.
+			if err := bs.Put(ctx, mkBlocks(1)[0]); err != nil {
+				t.Fatal(err)
+			}
+			if got := statCounter(inner, "put_total"); got != 1 {
+				t.Fatalf("inner put_total = %v, want 1", got)
+			}
+			if !tc.same {
+				if got := statCounter(bs.(*measure), "put_total"); got != 1 {
+					t.Fatalf("outer put_total = %v, want 1", got)
+				}
+			}
+		})
+	}
+}
+
+func TestIsMeasured(t *testing.T) {
+	fb := testutil.New()
+	for _, tc := range []struct {
+		name string
+		bs   blockstore.Blockstore
+		want bool
+	}{
+		{"backend", fb, false},
+		{"plain backend", fb.Plain(), false},
+		{"wrapper", New("test", fb), true},
+		{"nested wrapper", Wrap("outer", New("inner", fb)), true},
+	} {
+		if got := IsMeasured(tc.bs); got != tc.want {
+			t.Errorf("%s: IsMeasured = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package measure
+
+import (
+	"errors"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// isWrapperError reports whether err originates in the wrapper rather
+// than in the backend.
+func isWrapperError(err error) bool {
+	return errors.Is(err, ErrClosed) ||
+		errors.Is(err, ErrQueueFull) ||
+		errors.Is(err, ErrAuditFailed) ||
+		errors.Is(err, ErrTTLUnsupported) ||
+		errors.Is(err, ErrExpiryLimit) ||
+		errors.Is(err, ErrBatchTooLarge) ||
+		errors.Is(err, ErrFenced) ||
+		errors.Is(err, ErrReadOnly) ||
+		errors.Is(err, ErrBlockTooLarge) ||
+		errors.Is(err, ErrFaultInjected)
+}
+
+// wrapperError counts an error the wrapper returned from op on its own
+// in <op>.wrapper_errors_total.
+func (m *measure) wrapperError(op Op) {
+	m.reg.counter(string(op)+".wrapper_errors_total",
+		"Number of errors the wrapper returned without the backend failing").Inc()
+}
+
+// countError counts err, returned by op for c, in errs if it comes from
+// the backend, or as a wrapper error, and remembers it for LastError.
+func (m *measure) countError(op Op, errs metrics.Counter, c cid.Cid, err error) {
+	if isWrapperError(err) {
+		m.wrapperError(op)
+	} else {
+		errs.Inc()
+	}
+	m.noteError(op, c, err)
+}
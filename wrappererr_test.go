@@ -0,0 +1,23 @@
+package measure
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+func TestWrapperErrors(t *testing.T) {
+	bs := &flakyBS{Blockstore: testutil.New(), fail: true}
+	m := New("we", bs)
+	c := blocks.NewBlock([]byte("x")).Cid()
+	m.Has(context.Background(), c)
+	m.Close()
+	m.Has(context.Background(), c)
+	cs := m.Stats().Counters
+	if cs["has.errors_total"] != 1 || cs["has.wrapper_errors_total"] != 1 {
+		t.Fatal(cs)
+	}
+}
@@ -0,0 +1,368 @@
+package measure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+var (
+	// ErrQueueFull is returned by writes in write-behind mode when the
+	// queue has no room and WriteBehindConfig.BlockWhenFull is not set.
+	ErrQueueFull = errors.New("measure: write-behind queue is full")
+	// ErrFlushTimeout is returned by Close when the write-behind queue
+	// wasn't written within WriteBehindConfig.FlushTimeout.
+	ErrFlushTimeout = errors.New("measure: write-behind queue not flushed in time")
+)
+
+// WriteBehindConfig configures WithWriteBehind.
+type WriteBehindConfig struct {
+	// QueueSize is the maximum number of blocks waiting to be written.
+	// It must be positive.
+	QueueSize int
+	// Workers is the number of goroutines writing to the backend.
+	// Defaults to 1.
+	Workers int
+	// MaxBatch is the maximum number of blocks a worker writes with a
+	// single PutMany. Defaults to 1, writing with Put.
+	MaxBatch int
+	// BlockWhenFull makes writes wait for room in the queue instead of
+	// failing with ErrQueueFull.
+	BlockWhenFull bool
+	// FlushTimeout bounds how long Close waits for queued blocks to be
+	// written. Blocks still queued after it are dropped, writes still
+	// running are left to finish on their own, and Close returns
+	// ErrFlushTimeout. Zero waits indefinitely.
+	FlushTimeout time.Duration
+}
+
+// WithWriteBehind makes Put and PutMany return as soon as the blocks are
+// queued in memory; background workers write them to the backend later.
+// Reads consult the queue first, so written blocks are visible
+// immediately, and deletes drop the blocks still queued, counted in
+// writebehind.cancelled_total; a delete waits for the writes already
+// running. The price is durability: a crash loses queued blocks, and
+// backend errors can't be reported to the writer anymore, they are only
+// counted in writebehind.errors_total. Takes precedence over
+// WithWriteCoalescing. It panics if wb.QueueSize is not positive.
+func WithWriteBehind(wb WriteBehindConfig) Option {
+	if wb.QueueSize <= 0 {
+		panic(fmt.Sprintf("measure: invalid write-behind queue size %d", wb.QueueSize))
+	}
+	return func(cfg *config) {
+		cfg.writeBehind = &wb
+	}
+}
+
+type queuedBlock struct {
+	blk      blocks.Block
+	enqueued time.Time
+	// seq numbers the block among those queued, see pendingBlock.since.
+	seq uint64
+}
+
+type writeBehind struct {
+	backend blockstore.Blockstore
+	cfg     WriteBehindConfig
+	clock   Clock
+
+	depth     metrics.Gauge
+	durable   metrics.Histogram
+	rejected  metrics.Counter
+	errors    metrics.Counter
+	abandoned metrics.Counter
+	cancelled metrics.Counter
+
+	// mu guards closed; it is read-locked while queueing so that the
+	// queue isn't closed under a writer.
+	mu     sync.RWMutex
+	closed bool
+
+	// writeMu is read-locked by workers while they write, and locked by
+	// deletes so that they don't race with the write of a block they
+	// delete.
+	writeMu sync.RWMutex
+
+	pendingMu sync.Mutex
+	pending   map[cid.Cid]*pendingBlock
+	seq       uint64
+
+	queue chan queuedBlock
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// pendingBlock is a queued block as seen by readers. The same block can
+// be queued more than once. Deleting the block drops it, and the blocks
+// queued before, numbered below since, are then not written.
+type pendingBlock struct {
+	blk   blocks.Block
+	count int
+	since uint64
+}
+
+func newWriteBehind(m *measure, cfg WriteBehindConfig) *writeBehind {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxBatch < 1 {
+		cfg.MaxBatch = 1
+	}
+	r := m.reg
+	wb := &writeBehind{
+		backend: m.backend,
+		cfg:     cfg,
+		clock:   m.clock,
+
+		depth: r.gauge("writebehind.queue_depth", "Number of blocks waiting to be written"),
+		durable: r.latency("writebehind.durable.latency",
+			"Latency distribution from queueing a block to it being written"),
+		rejected:  r.counter("writebehind.rejected_total", "Number of blocks rejected because the queue was full"),
+		errors:    r.counter("writebehind.errors_total", "Number of queued blocks the backend failed to write"),
+		abandoned: r.counter("writebehind.abandoned_total", "Number of queued blocks dropped on close"),
+		cancelled: r.counter("writebehind.cancelled_total", "Number of queued blocks dropped because they were deleted"),
+
+		pending: make(map[cid.Cid]*pendingBlock),
+		queue:   make(chan queuedBlock, cfg.QueueSize),
+		stop:    make(chan struct{}),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		wb.wg.Add(1)
+		go wb.work()
+	}
+	return wb
+}
+
+// enqueue queues blks. When the queue is full and writes don't block,
+// the blocks queued so far are kept and ErrQueueFull is returned.
+func (wb *writeBehind) enqueue(ctx context.Context, blks ...blocks.Block) error {
+	wb.mu.RLock()
+	defer wb.mu.RUnlock()
+	if wb.closed {
+		return ErrClosed
+	}
+	for i, blk := range blks {
+		qb := queuedBlock{blk: blk, enqueued: wb.clock.Now(), seq: wb.addPending(blk)}
+		wb.depth.Inc()
+		var err error
+		if wb.cfg.BlockWhenFull {
+			select {
+			case wb.queue <- qb:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		} else {
+			select {
+			case wb.queue <- qb:
+			default:
+				err = ErrQueueFull
+			}
+		}
+		if err != nil {
+			wb.removePending(qb)
+			wb.depth.Dec()
+			wb.rejected.Add(float64(len(blks) - i))
+			return err
+		}
+	}
+	return nil
+}
+
+// addPending makes blk visible to readers and returns its sequence
+// number.
+func (wb *writeBehind) addPending(blk blocks.Block) uint64 {
+	wb.pendingMu.Lock()
+	defer wb.pendingMu.Unlock()
+	wb.seq++
+	if p, ok := wb.pending[blk.Cid()]; ok {
+		p.count++
+		return wb.seq
+	}
+	wb.pending[blk.Cid()] = &pendingBlock{blk: blk, count: 1, since: wb.seq}
+	return wb.seq
+}
+
+func (wb *writeBehind) removePending(qb queuedBlock) {
+	wb.pendingMu.Lock()
+	defer wb.pendingMu.Unlock()
+	if p, ok := wb.pending[qb.blk.Cid()]; ok && qb.seq >= p.since {
+		p.count--
+		if p.count == 0 {
+			delete(wb.pending, qb.blk.Cid())
+		}
+	}
+}
+
+// live reports whether qb is still to be written, that is its block
+// wasn't deleted since it was queued.
+func (wb *writeBehind) live(qb queuedBlock) bool {
+	wb.pendingMu.Lock()
+	defer wb.pendingMu.Unlock()
+	p, ok := wb.pending[qb.blk.Cid()]
+	return ok && qb.seq >= p.since
+}
+
+// forget drops the queued blocks of cids, which are being deleted, after
+// waiting for the writes running.
+func (wb *writeBehind) forget(cids ...cid.Cid) {
+	wb.writeMu.Lock()
+	defer wb.writeMu.Unlock()
+	wb.pendingMu.Lock()
+	defer wb.pendingMu.Unlock()
+	for _, c := range cids {
+		delete(wb.pending, c)
+	}
+}
+
+// get returns the queued block for c, if any.
+func (wb *writeBehind) get(c cid.Cid) (blocks.Block, bool) {
+	wb.pendingMu.Lock()
+	defer wb.pendingMu.Unlock()
+	p, ok := wb.pending[c]
+	if !ok {
+		return nil, false
+	}
+	return p.blk, true
+}
+
+func (wb *writeBehind) work() {
+	defer wb.wg.Done()
+	batch := make([]queuedBlock, 0, wb.cfg.MaxBatch)
+	for {
+		// Check for stop first so that a worker coming back from a slow
+		// write doesn't pick up more work after the flush timed out.
+		select {
+		case <-wb.stop:
+			wb.abandon()
+			return
+		default:
+		}
+		select {
+		case <-wb.stop:
+			wb.abandon()
+			return
+		case qb, ok := <-wb.queue:
+			if !ok {
+				return
+			}
+			batch = append(batch[:0], qb)
+		}
+	gather:
+		for len(batch) < wb.cfg.MaxBatch {
+			select {
+			case qb, ok := <-wb.queue:
+				if !ok {
+					break gather
+				}
+				batch = append(batch, qb)
+			default:
+				break gather
+			}
+		}
+		wb.write(batch)
+	}
+}
+
+func (wb *writeBehind) write(batch []queuedBlock) {
+	ctx := context.Background()
+	wb.writeMu.RLock()
+	live := make([]queuedBlock, 0, len(batch))
+	for _, qb := range batch {
+		if wb.live(qb) {
+			live = append(live, qb)
+		} else {
+			wb.cancelled.Inc()
+		}
+	}
+	var err error
+	switch len(live) {
+	case 0:
+	case 1:
+		err = wb.backend.Put(ctx, live[0].blk)
+	default:
+		blks := make([]blocks.Block, len(live))
+		for i, qb := range live {
+			blks[i] = qb.blk
+		}
+		err = wb.backend.PutMany(ctx, blks)
+	}
+	wb.writeMu.RUnlock()
+	for _, qb := range live {
+		if err != nil {
+			wb.errors.Inc()
+		} else {
+			recordLatency(wb.clock, wb.durable, qb.enqueued)
+		}
+	}
+	for _, qb := range batch {
+		wb.removePending(qb)
+		wb.depth.Dec()
+	}
+}
+
+// abandon drops whatever is left in the queue.
+func (wb *writeBehind) abandon() {
+	for qb := range wb.queue {
+		wb.abandoned.Inc()
+		wb.removePending(qb)
+		wb.depth.Dec()
+	}
+}
+
+// close stops accepting blocks and waits for the queue to be written,
+// for at most FlushTimeout.
+func (wb *writeBehind) close() error {
+	wb.mu.Lock()
+	if wb.closed {
+		wb.mu.Unlock()
+		return nil
+	}
+	wb.closed = true
+	close(wb.queue)
+	wb.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		wb.wg.Wait()
+		close(done)
+	}()
+	if wb.cfg.FlushTimeout <= 0 {
+		<-done
+		return nil
+	}
+	t := time.NewTimer(wb.cfg.FlushTimeout)
+	defer t.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-t.C:
+		// Workers stuck in a write can't drop the queue, so drop it
+		// here too.
+		close(wb.stop)
+		wb.abandon()
+		return ErrFlushTimeout
+	}
+}
+
+// forgetPendingWrites drops the blocks of cids from the write-behind
+// queue, as they are being deleted.
+func (m *measure) forgetPendingWrites(cids ...cid.Cid) {
+	if m.writeBehind != nil {
+		m.writeBehind.forget(cids...)
+	}
+}
+
+// pendingWrite returns c from the write-behind queue, if it is there.
+func (m *measure) pendingWrite(c cid.Cid) (blocks.Block, bool) {
+	if m.writeBehind == nil {
+		return nil, false
+	}
+	return m.writeBehind.get(c)
+}
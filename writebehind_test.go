@@ -0,0 +1,145 @@
+package measure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+
+	"github.com/whyrusleeping/go-bs-measure/testutil"
+)
+
+// waitCalls waits for the backend to have been called n times for op.
+func waitCalls(t *testing.T, fb *testutil.Blockstore, op testutil.Op, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for fb.Count(op) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("backend saw %d calls of %s, want %d", fb.Count(op), op, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	fb.SetLatency(testutil.Put, testutil.Fixed(50*time.Millisecond))
+	m := New("test", fb, WithWriteBehind(WriteBehindConfig{QueueSize: 2}))
+	blks := mkBlocks(4)
+
+	if err := m.Put(ctx, blks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := m.Has(ctx, blks[0].Cid()); err != nil || !ok {
+		t.Fatalf("queued block not visible: %t, %v", ok, err)
+	}
+	waitCalls(t, fb, testutil.Put, 1)
+	// The worker is busy with the first block, the next two fill the
+	// queue.
+	for _, b := range blks[1:3] {
+		if err := m.Put(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Put(ctx, blks[3]); err != ErrQueueFull {
+		t.Fatalf("got %v, want ErrQueueFull", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fb.Len() != 3 {
+		t.Fatalf("backend holds %d blocks, want 3", fb.Len())
+	}
+	if got := statCounter(m, "writebehind.rejected_total"); got != 1 {
+		t.Fatalf("writebehind.rejected_total = %v, want 1", got)
+	}
+	if got := statCount(m, "writebehind.durable.latency_seconds"); got != 3 {
+		t.Fatalf("%d durable latencies, want 3", got)
+	}
+}
+
+func TestWriteBehindDelete(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		delete func(m *measure, c cid.Cid) error
+	}{
+		{"DeleteBlock", func(m *measure, c cid.Cid) error { return m.DeleteBlock(ctx, c) }},
+		{"DeleteMany", func(m *measure, c cid.Cid) error { return m.DeleteMany(ctx, []cid.Cid{c}) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fb := testutil.New()
+			fb.SetLatency(testutil.Put, testutil.Fixed(50*time.Millisecond))
+			m := New("test", fb, WithWriteBehind(WriteBehindConfig{QueueSize: 4}))
+			blks := mkBlocks(3)
+
+			m.Put(ctx, blks[0])
+			waitCalls(t, fb, testutil.Put, 1)
+			m.Put(ctx, blks[1])
+			m.Put(ctx, blks[2])
+			if err := tc.delete(m, blks[1].Cid()); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.Get(ctx, blks[1].Cid()); !format.IsNotFound(err) {
+				t.Fatalf("got %v reading a deleted block, want not found", err)
+			}
+			// Written again after the delete, the block must be kept.
+			if err := tc.delete(m, blks[2].Cid()); err != nil {
+				t.Fatal(err)
+			}
+			m.Put(ctx, blks[2])
+
+			if err := m.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if ok, _ := fb.Has(ctx, blks[1].Cid()); ok {
+				t.Fatal("deleted block was written by the queue")
+			}
+			if ok, _ := fb.Has(ctx, blks[2].Cid()); !ok {
+				t.Fatal("block written again after its delete is missing")
+			}
+			if got := statCounter(m, "writebehind.cancelled_total"); got != 2 {
+				t.Fatalf("writebehind.cancelled_total = %v, want 2", got)
+			}
+			if got := statGauge(m, "writebehind.queue_depth"); got != 0 {
+				t.Fatalf("writebehind.queue_depth = %v, want 0", got)
+			}
+		})
+	}
+}
+
+func TestWriteBehindFlushTimeout(t *testing.T) {
+	ctx := context.Background()
+	fb := testutil.New()
+	fb.SetLatency(testutil.Put, testutil.Fixed(time.Hour))
+	m := New("test", fb, WithWriteBehind(WriteBehindConfig{QueueSize: 4, FlushTimeout: 20 * time.Millisecond}))
+	for _, b := range mkBlocks(3) {
+		if err := m.Put(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitCalls(t, fb, testutil.Put, 1)
+
+	start := time.Now()
+	if err := m.Close(); err != ErrFlushTimeout {
+		t.Fatalf("got %v, want ErrFlushTimeout", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Close took %s with a hung backend", d)
+	}
+	if got := statCounter(m, "writebehind.abandoned_total"); got != 2 {
+		t.Fatalf("writebehind.abandoned_total = %v, want 2", got)
+	}
+}
+
+func TestWriteBehindQueueSize(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic on a zero queue size")
+		}
+	}()
+	WithWriteBehind(WriteBehindConfig{})
+}